@@ -0,0 +1,36 @@
+package api
+
+import "net/http"
+
+// GET /healthzのレスポンス（プロセスが応答できればok）
+type HealthResponse struct {
+	Status string `json:"status"`
+}
+
+var HealthOK = &HealthResponse{Status: "ok"}
+
+// GET /readyzのレスポンス（readyでない場合も同じ形式で503を返す）
+type ReadyResponse struct {
+	Ready  bool     `json:"ready"`
+	Checks []*Check `json:"checks"`
+}
+
+// readyの判定に使う確認項目
+type Check struct {
+	Name    string `json:"name"`
+	OK      bool   `json:"ok"`
+	Message string `json:"message,omitempty"`
+}
+
+// 全ての確認項目がokなら200、1つでも失敗していれば503を返す
+func WriteReady(w http.ResponseWriter, checks []*Check) {
+	resp := &ReadyResponse{Ready: true, Checks: checks}
+	for _, c := range checks {
+		resp.Ready = resp.Ready && c.OK
+	}
+	status := http.StatusOK
+	if !resp.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	WriteJSON(w, status, resp)
+}
@@ -0,0 +1,391 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	JSONRPC_VERSION = "2.0"
+
+	// 公開しているメソッドの一覧を返す組み込みのメソッド
+	RPC_METHOD_DISCOVER = "rpc.discover"
+
+	MAX_RPC_REQUEST_SIZE = 1 << 20 // /rpcのリクエストボディの最大バイト数
+	MAX_RPC_BATCH        = 100     // 1回のバッチで呼び出せるメソッドの最大数
+)
+
+// JSON-RPC 2.0のエラーコード
+// -32000〜-32099はサーバー定義のエラーで、RESTのエラーコードに対応させる
+const (
+	RPCParseError     = -32700
+	RPCInvalidRequest = -32600
+	RPCMethodNotFound = -32601
+	RPCInvalidParams  = -32602
+	RPCInternalError  = -32603
+
+	RPCServerError         = -32000
+	RPCUnauthorized        = -32001
+	RPCNotFound            = -32002
+	RPCTransactionRejected = -32003
+	RPCInvalidPassphrase   = -32004
+	RPCGatewayUnavailable  = -32005
+)
+
+// RESTのエラーコードからJSON-RPCのエラーコードへの対応
+var rpcErrorCodes = map[string]int{
+	CodeInvalidJSON:         RPCInvalidParams,
+	CodeInvalidRequest:      RPCInvalidParams,
+	CodeNotFound:            RPCNotFound,
+	CodeTransactionRejected: RPCTransactionRejected,
+	CodeInvalidPassphrase:   RPCInvalidPassphrase,
+	CodeUnauthorized:        RPCUnauthorized,
+	CodeGatewayUnavailable:  RPCGatewayUnavailable,
+	CodeInternal:            RPCInternalError,
+}
+
+// JSON-RPCのリクエスト
+// idがないものは通知で、レスポンスを返さない
+type RPCRequest struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	ID      json.RawMessage `json:"id,omitempty"`
+}
+
+// JSON-RPCのレスポンス（resultかerrorのどちらか一方を持つ）
+type RPCResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *RPCError       `json:"error,omitempty"`
+	ID      json.RawMessage `json:"id"`
+}
+
+// JSON-RPCのエラー
+// dataにはRESTのエラーコードとステータスコードを入れる
+type RPCError struct {
+	Code    int         `json:"code"`
+	Message string      `json:"message"`
+	Data    *RPCErrData `json:"data,omitempty"`
+}
+
+type RPCErrData struct {
+	Code   string `json:"code"`
+	Status int    `json:"status"`
+}
+
+// rpc.discoverで返すメソッドの説明
+type RPCMethod struct {
+	Name    string   `json:"name"`
+	Summary string   `json:"summary"`
+	Params  []string `json:"params"`
+	REST    string   `json:"rest"`
+}
+
+var nullID = json.RawMessage("null")
+
+// RPCが設定されたルートをJSON-RPC 2.0のメソッドとして公開するハンドル
+// メソッドはRESTと同じハンドルで処理し、paramsはパスパラメータ、クエリパラメータ、リクエストボディに割り当てる
+// 配列を送るとバッチとして処理し、レスポンスも配列で返す
+func (rt *Router) RPCHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, MAX_RPC_REQUEST_SIZE))
+		if err != nil {
+			writeRPC(w, rpcFailure(nullID, RPCParseError, err.Error()))
+			return
+		}
+		body = bytes.TrimSpace(body)
+
+		// バッチ
+		if len(body) > 0 && body[0] == '[' {
+			var batch []json.RawMessage
+			if err := json.Unmarshal(body, &batch); err != nil {
+				writeRPC(w, rpcFailure(nullID, RPCParseError, err.Error()))
+				return
+			}
+			if len(batch) == 0 || len(batch) > MAX_RPC_BATCH {
+				writeRPC(w, rpcFailure(nullID, RPCInvalidRequest,
+					fmt.Sprintf("batch must contain 1 to %d requests", MAX_RPC_BATCH)))
+				return
+			}
+			responses := make([]*RPCResponse, 0, len(batch))
+			for _, m := range batch {
+				if resp := rt.callRPC(req, m); resp != nil {
+					responses = append(responses, resp)
+				}
+			}
+			if len(responses) == 0 {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			writeRPC(w, responses)
+			return
+		}
+
+		if !json.Valid(body) {
+			writeRPC(w, rpcFailure(nullID, RPCParseError, "invalid JSON"))
+			return
+		}
+		resp := rt.callRPC(req, body)
+		if resp == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		writeRPC(w, resp)
+	}
+}
+
+func writeRPC(w http.ResponseWriter, v interface{}) {
+	WriteJSON(w, http.StatusOK, v)
+}
+
+func rpcFailure(id json.RawMessage, code int, message string) *RPCResponse {
+	return &RPCResponse{JSONRPC: JSONRPC_VERSION, Error: &RPCError{Code: code, Message: message}, ID: id}
+}
+
+// 1つのリクエストを処理する（通知の場合はnilを返す）
+func (rt *Router) callRPC(outer *http.Request, m json.RawMessage) *RPCResponse {
+	var r RPCRequest
+	if err := json.Unmarshal(m, &r); err != nil || r.JSONRPC != JSONRPC_VERSION || r.Method == "" || !validID(r.ID) {
+		return rpcFailure(nullID, RPCInvalidRequest, "invalid request")
+	}
+	id := r.ID
+	if id == nil {
+		id = nullID
+	}
+	resp := rt.dispatchRPC(outer, &r, id)
+	if r.ID == nil {
+		return nil
+	}
+	return resp
+}
+
+// idは文字列、数値、nullのいずれか
+func validID(id json.RawMessage) bool {
+	if id == nil {
+		return true
+	}
+	var v interface{}
+	if err := json.Unmarshal(id, &v); err != nil {
+		return false
+	}
+	switch v.(type) {
+	case string, float64, nil:
+		return true
+	}
+	return false
+}
+
+func (rt *Router) dispatchRPC(outer *http.Request, r *RPCRequest, id json.RawMessage) *RPCResponse {
+	if r.Method == RPC_METHOD_DISCOVER {
+		result, _ := json.Marshal(rt.RPCMethods())
+		return &RPCResponse{JSONRPC: JSONRPC_VERSION, Result: result, ID: id}
+	}
+	route := rt.rpcRoute(r.Method)
+	if route == nil {
+		return rpcFailure(id, RPCMethodNotFound, fmt.Sprintf("method %q not found", r.Method))
+	}
+	params := r.Params
+	if string(params) == "null" {
+		params = nil
+	}
+	req, err := route.rpcHTTPRequest(outer, params)
+	if err != nil {
+		return rpcFailure(id, RPCInvalidParams, err.Error())
+	}
+
+	rec := newRecorder()
+	route.Handler(rec, req)
+	if rec.status >= http.StatusBadRequest {
+		e, ok := DecodeError(rec.body.Bytes())
+		if !ok {
+			e = &Error{Code: CodeInternal, Message: http.StatusText(rec.status)}
+		}
+		code, ok := rpcErrorCodes[e.Code]
+		if !ok {
+			code = RPCServerError
+		}
+		resp := rpcFailure(id, code, e.Message)
+		resp.Error.Data = &RPCErrData{Code: e.Code, Status: rec.status}
+		return resp
+	}
+	result := json.RawMessage(bytes.TrimSpace(rec.body.Bytes()))
+	if len(result) == 0 {
+		result = nullID
+	}
+	return &RPCResponse{JSONRPC: JSONRPC_VERSION, Result: result, ID: id}
+}
+
+func (rt *Router) rpcRoute(method string) *Route {
+	for _, r := range rt.routes {
+		if r.RPC != "" && r.RPC == method {
+			return r
+		}
+	}
+	return nil
+}
+
+// JSON-RPCで公開しているメソッドの一覧
+func (rt *Router) RPCMethods() []*RPCMethod {
+	methods := make([]*RPCMethod, 0)
+	for _, r := range rt.routes {
+		if r.RPC == "" {
+			continue
+		}
+		params := make([]string, 0, len(r.Params))
+		for _, p := range r.Params {
+			params = append(params, p.Name)
+		}
+		if r.Request != nil {
+			params = append(params, "(request body)")
+		}
+		methods = append(methods, &RPCMethod{Name: r.RPC, Summary: r.Summary, Params: params, REST: r.Method + " " + r.Path})
+	}
+	return methods
+}
+
+// JSON-RPCのparamsからRESTのハンドルに渡すリクエストを作る
+// リクエストボディのあるルートはparams（オブジェクト）をそのままボディにする
+// それ以外はparamsの名前（オブジェクト）かParamsの順番（配列）でパスパラメータとクエリパラメータに割り当てる
+func (r *Route) rpcHTTPRequest(outer *http.Request, params json.RawMessage) (*http.Request, error) {
+	var body io.Reader = http.NoBody
+	values := make(map[string]string)
+	if r.Request != nil {
+		if len(params) == 0 || params[0] != '{' {
+			return nil, fmt.Errorf("params must be an object")
+		}
+		body = bytes.NewReader(params)
+	} else if len(params) > 0 {
+		var err error
+		if values, err = r.rpcParamValues(params); err != nil {
+			return nil, err
+		}
+	}
+
+	pathParams := make(map[string]string)
+	query := url.Values{}
+	segments := r.segments()
+	for i, s := range segments {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			name := s[1 : len(s)-1]
+			v, ok := values[name]
+			if !ok || v == "" {
+				return nil, fmt.Errorf("missing param %q", name)
+			}
+			pathParams[name] = v
+			segments[i] = url.PathEscape(v)
+		}
+	}
+	for _, p := range r.Params {
+		if p.In != "query" {
+			continue
+		}
+		if v, ok := values[p.Name]; ok {
+			query.Set(p.Name, v)
+		} else if p.Required {
+			return nil, fmt.Errorf("missing param %q", p.Name)
+		}
+	}
+
+	target := "/" + strings.Join(segments, "/")
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	ctx := context.WithValue(outer.Context(), pathParamsKey{}, pathParams)
+	req, err := http.NewRequestWithContext(ctx, r.Method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	// 認証などのヘッダーは/rpcのリクエストのものを使う
+	req.Header = outer.Header.Clone()
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = outer.RemoteAddr
+	return req, nil
+}
+
+func (r *Route) rpcParamValues(params json.RawMessage) (map[string]string, error) {
+	values := make(map[string]string)
+	raw := make(map[string]json.RawMessage)
+	switch params[0] {
+	case '{':
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return nil, err
+		}
+		for name := range raw {
+			if r.param(name, "path") == nil && r.param(name, "query") == nil {
+				return nil, fmt.Errorf("unknown param %q", name)
+			}
+		}
+	case '[':
+		var list []json.RawMessage
+		if err := json.Unmarshal(params, &list); err != nil {
+			return nil, err
+		}
+		if len(list) > len(r.Params) {
+			return nil, fmt.Errorf("too many params (at most %d)", len(r.Params))
+		}
+		for i, v := range list {
+			raw[r.Params[i].Name] = v
+		}
+	default:
+		return nil, fmt.Errorf("params must be an object or an array")
+	}
+	for name, v := range raw {
+		s, err := paramString(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid param %q: %v", name, err)
+		}
+		values[name] = s
+	}
+	return values, nil
+}
+
+// 文字列、数値、真偽値をパラメータの文字列にする（nullは省略と同じ）
+func paramString(v json.RawMessage) (string, error) {
+	var x interface{}
+	decoder := json.NewDecoder(bytes.NewReader(v))
+	decoder.UseNumber()
+	if err := decoder.Decode(&x); err != nil {
+		return "", err
+	}
+	switch x := x.(type) {
+	case string:
+		return x, nil
+	case json.Number:
+		return x.String(), nil
+	case bool:
+		return fmt.Sprint(x), nil
+	case nil:
+		return "", nil
+	}
+	return "", fmt.Errorf("must be a string, number or boolean")
+}
+
+// RESTのハンドルのレスポンスを記録するResponseWriter
+type recorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newRecorder() *recorder {
+	return &recorder{header: make(http.Header), status: http.StatusOK}
+}
+
+func (rec *recorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *recorder) Write(b []byte) (int, error) {
+	return rec.body.Write(b)
+}
+
+func (rec *recorder) WriteHeader(status int) {
+	rec.status = status
+}
@@ -0,0 +1,166 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 登録されたルートからOpenAPI 3.0の仕様を生成する
+// スキーマはRoute.Request/Route.Responseに渡した例の値をJSONにして推論する
+func (rt *Router) OpenAPI(title string, version string) map[string]interface{} {
+	paths := make(map[string]interface{})
+	for _, r := range rt.routes {
+		item, ok := paths[r.Path].(map[string]interface{})
+		if !ok {
+			item = make(map[string]interface{})
+			paths[r.Path] = item
+		}
+		item[strings.ToLower(r.Method)] = r.operation()
+	}
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   title,
+			"version": version,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"schemas": map[string]interface{}{
+				"Error": schemaOf(&ErrorResponse{Error{Code: CodeInvalidRequest, Message: "message"}}),
+			},
+		},
+	}
+}
+
+// OpenAPIの仕様を返すハンドル
+func (rt *Router) OpenAPIHandler(title string, version string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		WriteJSON(w, http.StatusOK, rt.OpenAPI(title, version))
+	}
+}
+
+func (r *Route) operation() map[string]interface{} {
+	op := map[string]interface{}{
+		"summary":     r.Summary,
+		"operationId": operationID(r.Method, r.Path),
+	}
+	if r.RPC != "" {
+		op["x-jsonrpc-method"] = r.RPC
+	}
+	if len(r.Params) > 0 {
+		params := make([]interface{}, 0, len(r.Params))
+		for _, p := range r.Params {
+			typ := p.Type
+			if typ == "" {
+				typ = "string"
+			}
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"required":    p.Required || p.In == "path",
+				"description": p.Description,
+				"schema":      map[string]interface{}{"type": typ},
+			})
+		}
+		op["parameters"] = params
+	}
+	if r.Request != nil {
+		op["requestBody"] = map[string]interface{}{
+			"required": true,
+			"content":  jsonContent(r.Request),
+		}
+	}
+
+	success := map[string]interface{}{"description": http.StatusText(r.status())}
+	if r.Response != nil {
+		success["content"] = jsonContent(r.Response)
+	}
+	responses := map[string]interface{}{
+		strconv.Itoa(r.status()): success,
+	}
+	for _, status := range r.Errors {
+		responses[strconv.Itoa(status)] = map[string]interface{}{
+			"description": http.StatusText(status),
+			"content": map[string]interface{}{
+				"application/json": map[string]interface{}{
+					"schema": map[string]interface{}{"$ref": "#/components/schemas/Error"},
+				},
+			},
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+// GET /v1/blocks/{hash} -> getBlocksHash
+func operationID(method string, path string) string {
+	var b strings.Builder
+	b.WriteString(strings.ToLower(method))
+	for _, s := range strings.Split(strings.Trim(path, "/"), "/") {
+		s = strings.Trim(s, "{}")
+		if s == "v1" {
+			continue
+		}
+		for _, w := range strings.FieldsFunc(s, func(c rune) bool { return c == '_' || c == '-' || c == '.' }) {
+			b.WriteString(strings.ToUpper(w[:1]) + w[1:])
+		}
+	}
+	return b.String()
+}
+
+func jsonContent(example interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		"application/json": map[string]interface{}{
+			"schema":  schemaOf(example),
+			"example": example,
+		},
+	}
+}
+
+// 例の値をJSONにしてスキーマを推論する
+func schemaOf(example interface{}) map[string]interface{} {
+	m, err := json.Marshal(example)
+	if err != nil {
+		return map[string]interface{}{}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(m))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err != nil {
+		return map[string]interface{}{}
+	}
+	return inferSchema(v)
+}
+
+func inferSchema(v interface{}) map[string]interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		properties := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			properties[k] = inferSchema(e)
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case []interface{}:
+		schema := map[string]interface{}{"type": "array"}
+		if len(v) > 0 {
+			schema["items"] = inferSchema(v[0])
+		} else {
+			schema["items"] = map[string]interface{}{}
+		}
+		return schema
+	case json.Number:
+		if strings.ContainsAny(v.String(), ".eE") {
+			return map[string]interface{}{"type": "number"}
+		}
+		return map[string]interface{}{"type": "integer"}
+	case string:
+		return map[string]interface{}{"type": "string"}
+	case bool:
+		return map[string]interface{}{"type": "boolean"}
+	default:
+		return map[string]interface{}{"nullable": true}
+	}
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"go-blockchain/logging"
+	"go-blockchain/utils"
+	"net/http"
+)
+
+// エラーコード
+const (
+	CodeInvalidJSON         = "invalid_json"
+	CodeInvalidRequest      = "invalid_request"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeTransactionRejected = "transaction_rejected"
+	CodeInvalidPassphrase   = "invalid_passphrase"
+	CodeUnauthorized        = "unauthorized"
+	CodeGatewayUnavailable  = "gateway_unavailable"
+	CodeTooManyClients      = "too_many_clients"
+	CodeInternal            = "internal_error"
+)
+
+// エラーレスポンスの中身
+type Error struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// エラーレスポンス
+// {"error": {"code": "invalid_request", "message": "..."}}
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// JSONのレスポンスを返す
+func WriteJSON(w http.ResponseWriter, status int, v interface{}) {
+	m, err := json.Marshal(v)
+	if err != nil {
+		logging.New("component", logging.COMPONENT_RPC).Error("failed to encode response", "err", err)
+		WriteError(w, http.StatusInternalServerError, CodeInternal, "failed to encode response")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(m)
+}
+
+// 返す値のない処理の成功レスポンス {"message": "success"}
+var SuccessExample = json.RawMessage(utils.JsonStatus("success"))
+
+func WriteSuccess(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(utils.JsonStatus("success"))
+}
+
+// エラーレスポンスを返す
+func WriteError(w http.ResponseWriter, status int, code string, message string) {
+	m, _ := json.Marshal(&ErrorResponse{Error{Code: code, Message: message}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(m)
+}
+
+// リクエストボディのJSONを読み込む
+// 読み込めなかった場合は400を返してfalseを返す
+func DecodeJSON(w http.ResponseWriter, req *http.Request, maxBytes int64, v interface{}) bool {
+	decoder := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBytes))
+	if err := decoder.Decode(v); err != nil {
+		logging.FromContext(req.Context()).Warn("invalid request body", "err", err)
+		WriteError(w, http.StatusBadRequest, CodeInvalidJSON, err.Error())
+		return false
+	}
+	return true
+}
+
+// 他のサーバーから返ってきたエラーレスポンスを読み込む
+func DecodeError(body []byte) (*Error, bool) {
+	var er ErrorResponse
+	if err := json.Unmarshal(body, &er); err != nil || er.Error.Code == "" {
+		return nil, false
+	}
+	return &er.Error, true
+}
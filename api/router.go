@@ -0,0 +1,157 @@
+// バージョン付きREST APIのルーティングとレスポンスの共通処理
+package api
+
+import (
+	"context"
+	"fmt"
+	"go-blockchain/metrics"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// APIのルート定義
+// Request/ResponseにはJSONの例となる値を渡し、OpenAPIのスキーマはその値から生成する
+type Route struct {
+	Method   string
+	Path     string // "/v1/blocks/{hash}"のように{name}でパスパラメータを指定する
+	Summary  string
+	Params   []Param
+	Request  interface{}
+	Response interface{}
+	Status   int   // 成功時のステータスコード（省略時は200）
+	Errors   []int // 返す可能性のあるエラーのステータスコード
+	Handler  http.HandlerFunc
+	RPC      string // JSON-RPCのメソッド名（空の場合はJSON-RPCでは公開しない）
+}
+
+// クエリパラメータとパスパラメータの定義
+type Param struct {
+	Name        string
+	In          string // "query" or "path"
+	Type        string // "string", "integer", "boolean"
+	Required    bool
+	Description string
+}
+
+func (r *Route) status() int {
+	if r.Status == 0 {
+		return http.StatusOK
+	}
+	return r.Status
+}
+
+func (r *Route) segments() []string {
+	return strings.Split(strings.Trim(r.Path, "/"), "/")
+}
+
+// パスが一致すればパスパラメータを返す
+func (r *Route) match(path string) (map[string]string, bool) {
+	want := r.segments()
+	got := strings.Split(strings.Trim(path, "/"), "/")
+	if len(want) != len(got) {
+		return nil, false
+	}
+	params := make(map[string]string)
+	for i, s := range want {
+		if strings.HasPrefix(s, "{") && strings.HasSuffix(s, "}") {
+			if got[i] == "" {
+				return nil, false
+			}
+			params[s[1:len(s)-1]] = got[i]
+			continue
+		}
+		if s != got[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// ------------------------------------------------------------------------------------------
+type Router struct {
+	routes  []*Route
+	metrics *metrics.HTTPMetrics // nilの場合はレイテンシを記録しない
+}
+
+func NewRouter() *Router {
+	return &Router{}
+}
+
+// ルートを登録する
+// パスパラメータの定義漏れや重複登録は起動時に検出する
+func (rt *Router) Handle(route *Route) {
+	for _, r := range rt.routes {
+		if r.Method == route.Method && r.Path == route.Path {
+			panic(fmt.Sprintf("api: duplicate route %s %s", route.Method, route.Path))
+		}
+	}
+	for _, s := range route.segments() {
+		if !strings.HasPrefix(s, "{") || !strings.HasSuffix(s, "}") {
+			continue
+		}
+		name := s[1 : len(s)-1]
+		if route.param(name, "path") == nil {
+			route.Params = append(route.Params, Param{Name: name, In: "path", Type: "string", Required: true})
+		}
+	}
+	if route.RPC != "" && rt.rpcRoute(route.RPC) != nil {
+		panic(fmt.Sprintf("api: duplicate JSON-RPC method %s", route.RPC))
+	}
+	rt.routes = append(rt.routes, route)
+}
+
+func (r *Route) param(name string, in string) *Param {
+	for i, p := range r.Params {
+		if p.Name == name && p.In == in {
+			return &r.Params[i]
+		}
+	}
+	return nil
+}
+
+// ハンドラのレイテンシをルートのパスごとに記録する
+func (rt *Router) Instrument(m *metrics.HTTPMetrics) {
+	rt.metrics = m
+}
+
+func (rt *Router) Routes() []*Route {
+	return rt.routes
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	allowed := make([]string, 0)
+	for _, r := range rt.routes {
+		params, ok := r.match(req.URL.Path)
+		if !ok {
+			continue
+		}
+		if r.Method != req.Method {
+			allowed = append(allowed, r.Method)
+			continue
+		}
+		ctx := context.WithValue(req.Context(), pathParamsKey{}, params)
+		var h http.Handler = r.Handler
+		if rt.metrics != nil {
+			h = rt.metrics.Handler(r.Path, h)
+		}
+		h.ServeHTTP(w, req.WithContext(ctx))
+		return
+	}
+	if len(allowed) > 0 {
+		sort.Strings(allowed)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		WriteError(w, http.StatusMethodNotAllowed, CodeMethodNotAllowed,
+			fmt.Sprintf("method %s is not allowed", req.Method))
+		return
+	}
+	WriteError(w, http.StatusNotFound, CodeNotFound, fmt.Sprintf("%s not found", req.URL.Path))
+}
+
+type pathParamsKey struct{}
+
+// パスパラメータを取得する
+func PathParam(req *http.Request, name string) string {
+	params, _ := req.Context().Value(pathParamsKey{}).(map[string]string)
+	return params[name]
+}
@@ -0,0 +1,129 @@
+package block
+
+// ブロックに取り込まれたTransactionのアドレスごとの集計
+type AddressInfo struct {
+	TxCount     int     // アドレスが送信者か受信者になっているTransactionの数
+	Received    float32 // 受け取った合計
+	Sent        float32 // 送った合計
+	FirstHeight int     // 最初に現れたブロックの高さ
+	LastHeight  int     // 最後に現れたブロックの高さ
+}
+
+// アドレスが一度でも使われたか
+func (ai *AddressInfo) Used() bool {
+	return ai.TxCount > 0
+}
+
+// アドレスの集計を取得する
+func (bc *Blockchain) AddressInfo(blockchainAddress string) AddressInfo {
+	bc.muxIndex.Lock()
+	defer bc.muxIndex.Unlock()
+	bc.updateIndex()
+
+	if ai, ok := bc.addressIndex[blockchainAddress]; ok {
+		return *ai
+	}
+	return AddressInfo{}
+}
+
+// hashのTransactionが今のチェーンのブロックに取り込まれているか
+func (bc *Blockchain) IsConfirmed(h [32]byte) bool {
+	bc.muxIndex.Lock()
+	defer bc.muxIndex.Unlock()
+	bc.updateIndex()
+	return bc.confirmedIndex[h]
+}
+
+// インデックスを今のチェーンに合わせる（呼び出し側でbc.muxIndexをロックすること）
+// 追加されたブロックの分だけ更新し、チェーンが置き換えられていた場合は作り直す
+func (bc *Blockchain) updateIndex() {
+	chain := bc.Chain()
+	if !bc.indexValid(chain) {
+		bc.addressIndex = make(map[string]*AddressInfo)
+		bc.confirmedIndex = make(map[[32]byte]bool)
+		bc.indexedChain = nil
+	}
+	for height := len(bc.indexedChain); height < len(chain); height++ {
+		for _, t := range chain[height].transactions {
+			if !t.IsCoinbase() {
+				bc.confirmedIndex[t.Hash()] = true
+			}
+			sender := bc.indexAddress(t.senderBlockchainAddress, height)
+			sender.Sent += t.Debit()
+			sender.TxCount++
+			// 同じTransactionで複数回受け取る場合や自分宛ての送金は1つのTransactionとして数える
+			counted := map[*AddressInfo]bool{sender: true}
+			for _, o := range t.outputs {
+				recipient := bc.indexAddress(o.RecipientBlockchainAddress, height)
+				recipient.Received += o.Value
+				if !counted[recipient] {
+					recipient.TxCount++
+					counted[recipient] = true
+				}
+			}
+		}
+	}
+	bc.indexedChain = chain
+}
+
+// インデックス済みのブロックが今のチェーンの先頭部分と一致するか
+func (bc *Blockchain) indexValid(chain []*Block) bool {
+	n := len(bc.indexedChain)
+	if bc.addressIndex == nil || n > len(chain) {
+		return false
+	}
+	return n == 0 || bc.indexedChain[n-1] == chain[n-1]
+}
+
+func (bc *Blockchain) indexAddress(blockchainAddress string, height int) *AddressInfo {
+	ai, ok := bc.addressIndex[blockchainAddress]
+	if !ok {
+		ai = &AddressInfo{FirstHeight: height}
+		bc.addressIndex[blockchainAddress] = ai
+	}
+	ai.LastHeight = height
+	return ai
+}
+
+// Poolに溜まっているTransactionのうちアドレスが関係するものの数
+func (bc *Blockchain) PendingTransactionCount(blockchainAddress string) int {
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	count := 0
+	for _, t := range bc.transactionPool {
+		if t.Involves(blockchainAddress) {
+			count++
+		}
+	}
+	return count
+}
+
+// ブロックに取り込まれたTransactionとその高さ、ブロック内の位置
+type ConfirmedTransaction struct {
+	Height      int
+	Index       int
+	Transaction *Transaction
+}
+
+// アドレスが送信者か受取人になっているTransaction
+// ブロックに取り込まれたもの（古い順）と、Poolに溜まっているものを返す
+func (bc *Blockchain) AddressTransactions(blockchainAddress string) ([]*ConfirmedTransaction, []*Transaction) {
+	confirmed := make([]*ConfirmedTransaction, 0)
+	for height, b := range bc.Chain() {
+		for i, t := range b.transactions {
+			if t.Involves(blockchainAddress) {
+				confirmed = append(confirmed, &ConfirmedTransaction{Height: height, Index: i, Transaction: t})
+			}
+		}
+	}
+
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	pending := make([]*Transaction, 0)
+	for _, t := range bc.transactionPool {
+		if t.Involves(blockchainAddress) {
+			pending = append(pending, t)
+		}
+	}
+	return confirmed, pending
+}
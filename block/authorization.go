@@ -0,0 +1,114 @@
+package block
+
+import (
+	"encoding/hex"
+	"go-blockchain/keys"
+	"go-blockchain/multisig"
+	"go-blockchain/script"
+)
+
+// Transactionの送信者による承認
+// 送信者のアドレスから作るlocking scriptを解除するunlocking scriptになる
+type Authorization interface {
+	// 署名と公開鍵の方式
+	Scheme() keys.Scheme
+	// 送信者のアドレスのlocking scriptを解除するunlocking script
+	UnlockingScript() []byte
+	// 他のnodeに伝播するTransactionRequestに署名を設定する
+	fillRequest(tr *TransactionRequest)
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// 1つの鍵による署名（P2PKH）
+type SignatureAuthorization struct {
+	PublicKey keys.PublicKey
+	Signature *keys.Signature
+}
+
+func NewSignatureAuthorization(publicKey keys.PublicKey, s *keys.Signature) *SignatureAuthorization {
+	return &SignatureAuthorization{PublicKey: publicKey, Signature: s}
+}
+
+func (a *SignatureAuthorization) Scheme() keys.Scheme {
+	return a.PublicKey.Scheme()
+}
+
+// <sig> <pubkey>
+// 公開鍵はアドレスのhashの元にした形式でpushする
+func (a *SignatureAuthorization) UnlockingScript() []byte {
+	s, _ := script.NewBuilder().AddData(a.Signature.Bytes()).AddData(keys.AddressBytes(a.PublicKey)).Script()
+	return s
+}
+
+func (a *SignatureAuthorization) fillRequest(tr *TransactionRequest) {
+	publicKeyStr := keys.PublicKeyString(a.PublicKey)
+	scheme := string(a.PublicKey.Scheme().ID())
+	signatureStr := a.Signature.String()
+	tr.SenderPublicKey = &publicKeyStr
+	tr.Scheme = &scheme
+	tr.Signature = &signatureStr
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// m-of-nのマルチシグ（P2SH）
+// 署名はredeem scriptの公開鍵と同じ順番で閾値と同じ数だけ並べる
+type MultisigAuthorization struct {
+	Script     *multisig.Script
+	Signatures []*keys.Signature
+}
+
+func NewMultisigAuthorization(redeemScript *multisig.Script, signatures []*keys.Signature) *MultisigAuthorization {
+	return &MultisigAuthorization{Script: redeemScript, Signatures: signatures}
+}
+
+func (a *MultisigAuthorization) Scheme() keys.Scheme {
+	return a.Script.Scheme()
+}
+
+// <sig1> ... <sigM> <redeem script>
+func (a *MultisigAuthorization) UnlockingScript() []byte {
+	b := script.NewBuilder()
+	for _, s := range a.Signatures {
+		b.AddData(s.Bytes())
+	}
+	s, _ := b.AddData(a.Script.Bytes()).Script()
+	return s
+}
+
+func (a *MultisigAuthorization) fillRequest(tr *TransactionRequest) {
+	redeemScript := a.Script.String()
+	scheme := string(a.Script.Scheme().ID())
+	signatures := make([]string, 0, len(a.Signatures))
+	for _, s := range a.Signatures {
+		signatures = append(signatures, s.String())
+	}
+	tr.RedeemScript = &redeemScript
+	tr.Scheme = &scheme
+	tr.Signatures = signatures
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// 任意のunlocking script（ハッシュロックやタイムロックのredeem scriptを使うP2SHなど）
+type ScriptAuthorization struct {
+	scheme    keys.Scheme
+	unlocking []byte
+}
+
+func NewScriptAuthorization(scheme keys.Scheme, unlocking []byte) *ScriptAuthorization {
+	return &ScriptAuthorization{scheme: scheme, unlocking: unlocking}
+}
+
+func (a *ScriptAuthorization) Scheme() keys.Scheme {
+	return a.scheme
+}
+
+func (a *ScriptAuthorization) UnlockingScript() []byte {
+	return a.unlocking
+}
+
+func (a *ScriptAuthorization) fillRequest(tr *TransactionRequest) {
+	unlockingScript := hex.EncodeToString(a.unlocking)
+	scheme := string(a.scheme.ID())
+	tr.UnlockingScript = &unlockingScript
+	tr.Scheme = &scheme
+}
@@ -0,0 +1,80 @@
+package block
+
+// アドレスの残高の内訳
+type Balance struct {
+	Confirmed   float32 // minConf以上の承認があり使用可能な残高
+	Unconfirmed float32 // Poolに溜まっている送受信分と、承認数がminConfに満たない受け取り分
+	Immature    float32 // 承認数がCoinbaseMaturityに満たないマイニング報酬
+}
+
+// 承認数を考慮してアドレスの残高を計算する
+// 送金分はブロックに入った時点で承認数に関わらずConfirmedから差し引く
+func (bc *Blockchain) CalculateBalance(blockchainAddress string, minConf int) *Balance {
+	balance := bc.chainBalance(blockchainAddress, minConf)
+
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	for _, t := range bc.transactionPool {
+		balance.Unconfirmed += t.ValueTo(blockchainAddress)
+		if blockchainAddress == t.senderBlockchainAddress {
+			balance.Unconfirmed -= t.Debit()
+		}
+	}
+	return balance
+}
+
+// ブロックに取り込まれたTransactionのみから残高を計算する
+func (bc *Blockchain) chainBalance(blockchainAddress string, minConf int) *Balance {
+	return bc.ChainBalance(bc.Chain(), blockchainAddress, minConf)
+}
+
+// chain（ある時点のこのnodeのチェーン）のTransactionのみから残高を計算する
+func (bc *Blockchain) ChainBalance(chain []*Block, blockchainAddress string, minConf int) *Balance {
+	balance := new(Balance)
+	height := len(chain)
+	for i, b := range chain {
+		// ブロックの承認数（最後のブロックは1承認）
+		confirmations := height - i
+		for _, t := range b.transactions {
+			if blockchainAddress == t.senderBlockchainAddress {
+				balance.Confirmed -= t.Debit()
+			}
+			received := t.ValueTo(blockchainAddress)
+			if received == 0 {
+				continue
+			}
+			// 受け取りの場合
+			switch {
+			case t.IsCoinbase() && confirmations < bc.params.CoinbaseMaturity:
+				balance.Immature += received
+			case confirmations < minConf:
+				balance.Unconfirmed += received
+			default:
+				balance.Confirmed += received
+			}
+		}
+	}
+	return balance
+}
+
+// Poolに溜まっているTransactionによるaddressesの残高の増減（CalculateBalanceのUnconfirmedのうちPoolの分）
+// Poolは1回だけ走査する
+func (bc *Blockchain) PendingBalances(addresses []string) map[string]float32 {
+	pending := make(map[string]float32, len(addresses))
+	for _, a := range addresses {
+		pending[a] = 0
+	}
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	for _, t := range bc.transactionPool {
+		for _, o := range t.outputs {
+			if _, ok := pending[o.RecipientBlockchainAddress]; ok {
+				pending[o.RecipientBlockchainAddress] += o.Value
+			}
+		}
+		if _, ok := pending[t.senderBlockchainAddress]; ok {
+			pending[t.senderBlockchainAddress] -= t.Debit()
+		}
+	}
+	return pending
+}
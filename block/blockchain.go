@@ -2,13 +2,19 @@ package block
 
 import (
 	"bytes"
-	"crypto/ecdsa"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"go-blockchain/keys"
+	"go-blockchain/logging"
+	"go-blockchain/metrics"
+	"go-blockchain/multisig"
+	"go-blockchain/script"
 	"go-blockchain/utils"
-	"log"
+	"io"
 	"net/http"
 	"strings"
 	"sync"
@@ -20,12 +26,24 @@ const (
 	MINING_SENDER     = "THE BLOCKCHAIN"
 	MINING_REWARD     = 1.0
 	MINING_TIMER_SEC  = 20
+	COINBASE_MATURITY = 10 // マイニング報酬が使用可能になるまでに必要な承認数
 
 	BLOCKCHAIN_PORT_RANGE_START       = 5001
 	BLOCKCHAIN_PORT_RANGE_END         = 5004
 	NEIGHBOR_IP_RANGE_START           = 0
 	NEIGHBOR_IP_RANGE_END             = 1
 	BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC = 20
+	PEER_REQUEST_TIMEOUT_SEC          = 30
+
+	MAX_BLOCK_SIZE               = 1 << 20 // JSONにした際のブロックの最大バイト数
+	MAX_BLOCK_TRANSACTIONS       = 1000
+	MAX_TRANSACTION_REQUEST_SIZE = 1 << 16 // Transactionのリクエストボディの最大バイト数
+	MAX_CHAIN_BLOCKS             = 1 << 20 // peerから受け取るチェーンのブロック数の上限
+	MAX_CHAIN_SIZE               = 1 << 28 // peerから受け取るチェーンのJSONの合計バイト数の上限
+
+	// ジェネシスブロックのタイムスタンプ（UnixNano）
+	// 全てのnodeが同じジェネシスブロックから始まるように固定する
+	GENESIS_TIMESTAMP = 1700000000 * int64(time.Second)
 )
 
 // ブロック構造体
@@ -54,6 +72,11 @@ func (b *Block) Nonce() int {
 	return b.nonce
 }
 
+// ブロックを作成した時刻（UnixNano）
+func (b *Block) Timestamp() int64 {
+	return b.timestamp
+}
+
 func (b *Block) Transactions() []*Transaction {
 	return b.transactions
 }
@@ -68,6 +91,12 @@ func (b *Block) Print() {
 	}
 }
 
+// JSONにした際のブロックのバイト数
+func (b *Block) Size() int {
+	m, _ := json.Marshal(b)
+	return len(m)
+}
+
 // Hashの生成
 func (b *Block) Hash() [32]byte {
 	m, _ := json.Marshal(b)
@@ -92,7 +121,7 @@ func (b *Block) UnmarshalJSON(data []byte) error {
 	var previousHash string
 	v := &struct {
 		Timestamp    *int64          `json:"timestamp"`
-		Nonce        *int            `josn:"nonce"`
+		Nonce        *int            `json:"nonce"`
 		PreviousHash *string         `json:"previous_hash"`
 		Transactions *[]*Transaction `json:"transactions"`
 	}{
@@ -104,10 +133,25 @@ func (b *Block) UnmarshalJSON(data []byte) error {
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
+	// peerから受け取ったnullのブロック、previous_hash、Transactionは受け付けない
+	if v == nil {
+		return errors.New("block must not be null")
+	}
+	if v.PreviousHash == nil {
+		return errors.New("previous_hash must not be null")
+	}
+	for _, t := range b.transactions {
+		if t == nil {
+			return errors.New("transaction must not be null")
+		}
+	}
 	// stringからbyteに変換する
-	ph, _ := hex.DecodeString(*v.PreviousHash)
+	ph, err := hex.DecodeString(*v.PreviousHash)
+	if err != nil || len(ph) != len(b.previousHash) {
+		return fmt.Errorf("invalid previous_hash %q", *v.PreviousHash)
+	}
 	// Unmarshalの際にbyteに変換して格納する
-	copy(b.previousHash[:], ph[:32])
+	copy(b.previousHash[:], ph)
 	return nil
 }
 
@@ -115,39 +159,88 @@ func (b *Block) UnmarshalJSON(data []byte) error {
 type Blockchain struct {
 	transactionPool   []*Transaction
 	chain             []*Block
-	blockchainAddress string //ブロックチェーンネットワークを構成する各nodeのアドレス
+	muxChain          sync.RWMutex // chainの読み書き（追加と置き換えはbc.muxも持って行う）
+	blockchainAddress string       //ブロックチェーンネットワークを構成する各nodeのアドレス
 	port              uint16
 	mux               sync.Mutex
 	neighbors         []string
+	banned            map[string]bool // Banで除外したneighbor
+	verifiedHeights   map[string]int  // ResolveConflictsで検証できたneighborのチェーンの高さ
 	muxNeighbors      sync.Mutex
+	params            *Params
+	muxPool           sync.Mutex
+	addressIndex      map[string]*AddressInfo
+	confirmedIndex    map[[32]byte]bool // ブロックに取り込まれたTransactionのhash
+	indexedChain      []*Block          // addressIndexとconfirmedIndexに集計済みのブロック
+	muxIndex          sync.Mutex
+	miningTimer       *time.Timer // 自動マイニング中のみnil以外
+	muxMining         sync.Mutex
+	listeners         listeners
+	metrics           *chainMetrics
+	logger            *logging.Logger
 }
 
-// ブロックチェーンの作成
-func NewBlockchain(blockchainAddress string, port uint16) *Blockchain {
+// 全てのnodeに共通のジェネシスブロック
+func GenesisBlock() *Block {
 	b := &Block{}
+	return &Block{previousHash: b.Hash(), timestamp: GENESIS_TIMESTAMP}
+}
+
+// ブロックチェーンの作成
+func NewBlockchain(blockchainAddress string, port uint16, params *Params) *Blockchain {
 	bc := new(Blockchain)
 	bc.blockchainAddress = blockchainAddress
-	bc.CreateBlock(0, b.Hash())
+	bc.params = params
+	bc.logger = logging.New("port", port)
+	// RegisterMetricsで公開するまではどこにも登録しないRegistryで集計する
+	bc.metrics = newChainMetrics(metrics.NewRegistry())
+	bc.chain = []*Block{GenesisBlock()}
 	bc.port = port
 	return bc
 }
 
+// 今のチェーン（追加や置き換えの途中の状態は返さない）
 func (bc *Blockchain) Chain() []*Block {
+	bc.muxChain.RLock()
+	defer bc.muxChain.RUnlock()
 	return bc.chain
 }
 
+func (bc *Blockchain) Params() *Params {
+	return bc.params
+}
+
+// portフィールドを付けたLogger
+func (bc *Blockchain) Logger() *logging.Logger {
+	return bc.logger
+}
+
+func (bc *Blockchain) BlockchainAddress() string {
+	return bc.blockchainAddress
+}
+
 func (bc *Blockchain) Run() {
-	bc.StartSyncNeighbors()
+	if bc.params.DiscoverNeighbors {
+		bc.StartSyncNeighbors()
+	}
 	bc.ResolveConflicts()
-	bc.StartMining()
+	if bc.params.AutoMining {
+		bc.StartMining()
+	}
 }
 
 func (bc *Blockchain) SetNeighbors() {
-	bc.neighbors = utils.FindNeighbors(
+	neighbors := utils.FindNeighbors(
 		utils.GetHost(), bc.port,
 		NEIGHBOR_IP_RANGE_START, NEIGHBOR_IP_RANGE_END,
 		BLOCKCHAIN_PORT_RANGE_START, BLOCKCHAIN_PORT_RANGE_END)
-	log.Printf("%v", bc.neighbors)
+	bc.neighbors = make([]string, 0, len(neighbors))
+	for _, n := range neighbors {
+		if !bc.banned[n] {
+			bc.neighbors = append(bc.neighbors, n)
+		}
+	}
+	bc.logger.Component(logging.COMPONENT_P2P).Debug("neighbors found", "neighbors", strings.Join(bc.neighbors, ","))
 }
 
 func (bc *Blockchain) SyncNeighbors() {
@@ -161,14 +254,55 @@ func (bc *Blockchain) StartSyncNeighbors() {
 	_ = time.AfterFunc(time.Second*BLOCKCHAIN_NEIGHBOR_SYNC_TIME_SEC, bc.StartSyncNeighbors)
 }
 
+// neighborを手動で追加する（regtestなどポートスキャンを行わない場合に使用）
+// Banしたneighborは追加できない
+func (bc *Blockchain) AddNeighbor(address string) error {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	if bc.banned[address] {
+		return ErrBannedPeer
+	}
+	for _, n := range bc.neighbors {
+		if n == address {
+			return nil
+		}
+	}
+	bc.neighbors = append(bc.neighbors, address)
+	return nil
+}
+
+func (bc *Blockchain) Neighbors() []string {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	neighbors := make([]string, len(bc.neighbors))
+	copy(neighbors, bc.neighbors)
+	return neighbors
+}
+
 // BlockchainのTransactionPoolを取得する処理
 func (bc *Blockchain) TransactionPool() []*Transaction {
-	return bc.transactionPool
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	transactions := make([]*Transaction, len(bc.transactionPool))
+	copy(transactions, bc.transactionPool)
+	return transactions
 }
 
-// BlockchainのTransactionPoolを空にする
+// BlockchainのTransactionPoolを空にする（管理API用）
+// lock_timeに達していないTransactionはブロックに取り込まれていないので残す
+// 他のnodeが作ったブロックに取り込まれたTransactionはコンセンサスを取る際にremoveConfirmedで取り除く
 func (bc *Blockchain) ClearTransactionPool() {
-	bc.transactionPool = bc.transactionPool[:0]
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	chain := bc.Chain()
+	height, medianTime := len(chain), medianTimePast(chain)
+	pool := make([]*Transaction, 0)
+	for _, t := range bc.transactionPool {
+		if !t.IsFinal(height, medianTime) {
+			pool = append(pool, t)
+		}
+	}
+	bc.transactionPool = pool
 }
 
 // marshalをカスタマイズ
@@ -176,119 +310,175 @@ func (bc *Blockchain) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
 		Blocks []*Block `json:"chain"`
 	}{
-		Blocks: bc.chain,
+		Blocks: bc.Chain(),
 	})
 }
 
 // unmarshalをカスタマイズ
 func (bc *Blockchain) UnmarshalJSON(data []byte) error {
+	var chain []*Block
 	v := &struct {
 		Blocks *[]*Block `json:"chain"`
 	}{
-		Blocks: &bc.chain,
+		Blocks: &chain,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
+	for _, b := range chain {
+		if b == nil {
+			return errors.New("block must not be null")
+		}
+	}
+	bc.muxChain.Lock()
+	defer bc.muxChain.Unlock()
+	bc.chain = chain
 	return nil
 }
 
-// ブロックチェーンの中にブロックを格納
-func (bc *Blockchain) CreateBlock(nonce int, previousHash [32]byte) *Block {
-	b := NewBlock(nonce, previousHash, bc.transactionPool)
-	bc.chain = append(bc.chain, b)
-	// ブロックをブロックチェーンに追加した際にPoolを空にする
-	bc.transactionPool = []*Transaction{}
-
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/transactions", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("DELETE", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
+// ブロックチェーンの中にブロックを格納（呼び出し側でbc.muxをロックすること）
+func (bc *Blockchain) CreateBlock(nonce int, previousHash [32]byte, transactions []*Transaction) *Block {
+	b := NewBlock(nonce, previousHash, transactions)
+	bc.muxChain.Lock()
+	// 時計が戻った場合もmedian-time-pastより後のタイムスタンプにする（PoWの対象には含まれない）
+	if medianTime := medianTimePast(bc.chain); b.timestamp <= medianTime {
+		b.timestamp = medianTime + 1
 	}
+	bc.chain = append(bc.chain, b)
+	height := len(bc.chain) - 1
+	bc.muxChain.Unlock()
+	// ブロックに取り込んだTransactionをPoolから取り除く
+	bc.removeFromPool(transactions)
+	bc.notify(&Event{Type: EVENT_BLOCK_CONNECTED, Height: height, Block: b})
 	return b
 }
 
 // ブロックチェーンの中の最後のブロックを取得
 func (bc *Blockchain) LastBlock() *Block {
-	return bc.chain[len(bc.chain)-1]
+	chain := bc.Chain()
+	return chain[len(chain)-1]
 }
 
 // ブロッックチェーンの出力
 func (bc *Blockchain) Print() {
-	for i, block := range bc.chain {
+	for i, block := range bc.Chain() {
 		fmt.Printf("%s Chain %d %s\n", strings.Repeat("=", 25), i, strings.Repeat("=", 25))
 		block.Print()
 	}
 	fmt.Printf("%s\n", strings.Repeat("*", 25))
 }
 
-func (bc *Blockchain) CreateTransaction(sender string, recipient string, value float32,
-	senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	isTransacted := bc.AddTransaction(sender, recipient, value, senderPublicKey, s)
-
-	if isTransacted {
-		for _, n := range bc.neighbors {
-			publicKeyStr := fmt.Sprintf("%064x%064x", senderPublicKey.X.Bytes(),
-				senderPublicKey.Y.Bytes())
-			signatureStr := s.String()
-			bt := &TransactionRequest{
-				&sender, &recipient, &publicKeyStr, &value, &signatureStr}
-			m, _ := json.Marshal(bt)
-			buf := bytes.NewBuffer(m)
-			endpoint := fmt.Sprintf("http://%s/transactions", n)
-			client := &http.Client{}
-			req, _ := http.NewRequest("PUT", endpoint, buf)
-			resp, _ := client.Do(req)
-			log.Printf("%v", resp)
+// TransactionをPoolに追加し、neighborに伝播する（ctxのリクエストIDを引き継ぐ）
+func (bc *Blockchain) CreateTransaction(ctx context.Context, t *Transaction, auth Authorization) error {
+	if err := bc.AddTransaction(t, auth); err != nil {
+		return err
+	}
+
+	m, _ := json.Marshal(NewTransactionRequest(t, auth))
+	bc.broadcast(ctx, http.MethodPut, "/v1/transactions", m)
+	return nil
+}
+
+// 全てのneighborにリクエストを送る（レスポンスのボディは読み捨てる）
+// 送信元のリクエストが終わっても中断しないように、ctxからはリクエストIDだけを引き継ぐ
+func (bc *Blockchain) broadcast(ctx context.Context, method string, path string, body []byte) {
+	l := bc.logger.Component(logging.COMPONENT_P2P)
+	if id := logging.RequestID(ctx); id != "" {
+		l = l.With("request_id", id)
+	}
+	client := &http.Client{Timeout: time.Second * PEER_REQUEST_TIMEOUT_SEC}
+	for _, n := range bc.Neighbors() {
+		req, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", n, path), bytes.NewReader(body))
+		if err != nil {
+			l.Error("failed to create peer request", "peer", n, "err", err)
+			continue
+		}
+		logging.SetRequestID(ctx, req)
+		resp, err := client.Do(req)
+		if err != nil {
+			l.Warn("peer request failed", "peer", n, "method", method, "path", path, "err", err)
+			continue
 		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		l.Debug("peer request", "peer", n, "method", method, "path", path, "status", resp.StatusCode)
 	}
-	return isTransacted
 }
 
 // TransactionPoolにTransactionを追加
-func (bc *Blockchain) AddTransaction(sender string, recipient string, value float32,
-	senderPublicKey *ecdsa.PublicKey, s *utils.Signature) bool {
-	t := NewTransaction(sender, recipient, value)
-	// 送り手がサーバー側であれば検証なしでTransactionを追加
-	if sender == MINING_SENDER {
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
+// lock_timeに達していないTransactionもPoolに入れ、取り込めるようになるまでブロックには入れない
+func (bc *Blockchain) AddTransaction(t *Transaction, auth Authorization) error {
+	if err := bc.addTransaction(t, auth); err != nil {
+		bc.metrics.transactionsRejected.WithLabelValues(transactionRejectReason(err)).Inc()
+		return err
+	}
+	bc.metrics.transactionsAccepted.Inc()
+	bc.logger.Component(logging.COMPONENT_MEMPOOL).Debug("transaction added",
+		"sender", t.senderBlockchainAddress, "value", t.Value(), "fee", t.fee)
+	bc.notify(&Event{Type: EVENT_TRANSACTION_ADDED, Transaction: t})
+	return nil
+}
+
+func (bc *Blockchain) addTransaction(t *Transaction, auth Authorization) error {
+	// マイニング報酬はマイニング時にのみ作成されるので、Transactionとしては受け付けない
+	if t.IsCoinbase() {
+		return ErrCoinbaseTransaction
+	}
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	// 署名の対象には送信者ごとの連番などが含まれないので、同じTransactionの再送は内容のhashで弾く
+	h := t.Hash()
+	if bc.IsConfirmed(h) {
+		return ErrDuplicateTransaction
 	}
 	// 普通のTransactionoの通信は検証を行う
-	if bc.VerifyTransactionSignature(senderPublicKey, s, t) {
-		// ユーザーは持っている仮想通貨が送る分を超過していないか
-		if bc.CalculateTotalAmount(sender) < value {
-			log.Println("ERROR: Not enough balance in a wallet")
-			return false
-		}
-		bc.transactionPool = append(bc.transactionPool, t)
-		return true
-	} else {
-		log.Println("ERROR: Verify Transaction Error")
+	if err := bc.VerifyTransactionSignature(auth, t); err != nil {
+		return err
 	}
-	return false
+
+	bc.muxPool.Lock()
+	if bc.inPool(h) {
+		bc.muxPool.Unlock()
+		return ErrDuplicateTransaction
+	}
+	// ユーザーは持っている仮想通貨から、Poolに溜まっている送金分を差し引いた額が送る分（出力の合計と手数料）を超過していないか
+	if bc.spendableAmount(t.senderBlockchainAddress) < t.Debit() {
+		bc.muxPool.Unlock()
+		return ErrInsufficientBalance
+	}
+	t.setAuthorization(auth)
+	bc.transactionPool = append(bc.transactionPool, t)
+	bc.muxPool.Unlock()
+	return nil
 }
 
 // 正しいTransactionか判定する
-func (bc *Blockchain) VerifyTransactionSignature(
-	senderPublicKey *ecdsa.PublicKey, s *utils.Signature, t *Transaction) bool {
-	m, _ := json.Marshal(t)
-	h := sha256.Sum256([]byte(m))
-	return ecdsa.Verify(senderPublicKey, h[:], s.R, s.S)
+// 送信者のアドレスから作るlocking scriptを、Transactionのunlocking scriptで解除できるか検証する
+func (bc *Blockchain) VerifyTransactionSignature(auth Authorization, t *Transaction) error {
+	// 次に作られるブロックの高さと、支払いに使う資金を受け取ってからのブロック数
+	height := len(bc.Chain())
+	return verifyScript(auth, t, height, bc.spendAge(t, height))
 }
 
-// Poolに溜まっているTransactionをコピーする
-func (bc *Blockchain) CopyTransactionPool() []*Transaction {
-	transactions := make([]*Transaction, 0)
-	for _, t := range bc.transactionPool {
-		transactions = append(transactions,
-			NewTransaction(t.senderBlockchainAddress,
-				t.recipientBlockchainAddress,
-				t.value))
+// 高さheightのブロックに取り込むtのunlocking scriptを検証する
+// ageは支払いに使う資金を受け取ってからのブロック数
+func verifyScript(auth Authorization, t *Transaction, height int, age int) error {
+	locking, err := script.LockingScript(t.senderBlockchainAddress)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScriptFailed, err)
 	}
-	return transactions
+	h := t.Hash()
+	ctx := &script.Context{
+		Scheme:   auth.Scheme(),
+		Hash:     h[:],
+		LockTime: t.effectiveLockTime(height),
+		Age:      int64(age),
+	}
+	if err := script.Verify(auth.UnlockingScript(), locking, ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrScriptFailed, err)
+	}
+	return nil
 }
 
 // NonceとpreviousHashとtransactionを使ってDifficultyを求める
@@ -302,13 +492,13 @@ func (bc *Blockchain) ValidProof(nonce int, previousHash [32]byte, transactions
 }
 
 // 解となるnonceを求める
-func (bc *Blockchain) ProofOfWork() int {
-	transactions := bc.CopyTransactionPool()
+func (bc *Blockchain) ProofOfWork(transactions []*Transaction) int {
 	previousHash := bc.LastBlock().Hash()
 	nonce := 0
-	for !bc.ValidProof(nonce, previousHash, transactions, MINING_DIFFICULTY) {
+	for !bc.ValidProof(nonce, previousHash, transactions, bc.params.MiningDifficulty) {
 		nonce += 1
 	}
+	bc.metrics.hashes.Add(float64(nonce + 1))
 
 	return nonce
 }
@@ -317,183 +507,663 @@ func (bc *Blockchain) ProofOfWork() int {
 func (bc *Blockchain) Mining() bool {
 	// マイニング中に他のマイニング処理が実行されないようにロック
 	bc.mux.Lock()
-	defer bc.mux.Unlock()
 
 	// if len(bc.transactionPool) == 0 {
 	// 	return false
 	// }
 
-	// MINING_SENDERがbc.blockchainAddressにMINING_REWARD送るトランザクション
-	bc.AddTransaction(MINING_SENDER, bc.blockchainAddress, MINING_REWARD, nil, nil)
-	nonce := bc.ProofOfWork()
-	previousHash := bc.LastBlock().Hash()
-	bc.CreateBlock(nonce, previousHash)
-	log.Println("action=mining, status=success")
+	bc.mineBlock(bc.blockchainAddress)
+	bc.mux.Unlock()
+	// neighborのコンセンサスはこのnodeのResolveConflictsを待つことがあるので、ロックを外してから通知する
+	bc.broadcastConsensus()
+	return true
+}
 
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/consensus", n)
-		client := &http.Client{}
-		req, _ := http.NewRequest("PUT", endpoint, nil)
-		resp, _ := client.Do(req)
-		log.Printf("%v", resp)
+// n個のブロックを即座にマイニングする（regtest用）
+// 報酬はrewardAddressに送られる
+func (bc *Blockchain) Generate(n int, rewardAddress string) []*Block {
+	bc.mux.Lock()
+	blocks := make([]*Block, 0, n)
+	for i := 0; i < n; i++ {
+		blocks = append(blocks, bc.mineBlock(rewardAddress))
 	}
-	return true
+	bc.mux.Unlock()
+	// neighborのコンセンサスはこのnodeのResolveConflictsを待つことがあるので、ロックを外してから通知する
+	if len(blocks) > 0 {
+		bc.broadcastConsensus()
+	}
+	return blocks
+}
+
+// 1ブロック分のマイニングを行う（呼び出し側でbc.muxをロックすること）
+func (bc *Blockchain) mineBlock(rewardAddress string) *Block {
+	// Poolを現在の状態で検証し直し、有効なTransactionのみをブロックに取り込む
+	// 最後にMINING_SENDERがrewardAddressにMiningRewardと手数料を送るトランザクションが入る
+	transactions := bc.SelectTransactions(rewardAddress)
+	nonce := bc.ProofOfWork(transactions)
+	previousHash := bc.LastBlock().Hash()
+	b := bc.CreateBlock(nonce, previousHash, transactions)
+	bc.metrics.blocksAccepted.WithLabelValues(SOURCE_MINED).Inc()
+	bc.logger.Component(logging.COMPONENT_MINER).Info("block mined", "height", len(bc.Chain())-1,
+		"hash", fmt.Sprintf("%x", b.Hash()), "transactions", len(transactions), "nonce", nonce)
+	return b
+}
+
+// 他のnodeにコンセンサスを取るよう通知する
+func (bc *Blockchain) broadcastConsensus() {
+	bc.broadcast(context.Background(), http.MethodPut, "/v1/consensus", nil)
 }
 
-// Mining()を自動で呼び出す処理
+// Mining()をMINING_TIMER_SECごとに自動で呼び出す処理を開始する
+// 既に開始している場合は何もしない
 func (bc *Blockchain) StartMining() {
+	bc.muxMining.Lock()
+	defer bc.muxMining.Unlock()
+	if bc.miningTimer == nil {
+		bc.miningTimer = time.AfterFunc(0, bc.autoMining)
+	}
+}
+
+// 自動マイニングを停止する（マイニング中のブロックは最後まで掘る）
+func (bc *Blockchain) StopMining() {
+	bc.muxMining.Lock()
+	defer bc.muxMining.Unlock()
+	if bc.miningTimer != nil {
+		bc.miningTimer.Stop()
+		bc.miningTimer = nil
+	}
+}
+
+// 自動マイニング中か判定する
+func (bc *Blockchain) IsMining() bool {
+	bc.muxMining.Lock()
+	defer bc.muxMining.Unlock()
+	return bc.miningTimer != nil
+}
+
+func (bc *Blockchain) autoMining() {
 	bc.Mining()
-	_ = time.AfterFunc(time.Second*MINING_TIMER_SEC, bc.StartMining)
+	bc.muxMining.Lock()
+	defer bc.muxMining.Unlock()
+	// 停止された場合は次のマイニングを予約しない
+	if bc.miningTimer != nil {
+		bc.miningTimer.Reset(time.Second * MINING_TIMER_SEC)
+	}
 }
 
-// ユーザーのvalueの合計値を取得
+// ユーザーが使用可能なvalueの合計値を取得
+// 1承認以上のトランザクションのみを対象とし、未成熟のマイニング報酬は含まない
 func (bc *Blockchain) CalculateTotalAmount(blockchainAddress string) float32 {
-	var totalAmount float32 = 0.0
-	for _, b := range bc.chain {
-		for _, t := range b.transactions {
-			value := t.value
-			// 受け取りの場合
-			if blockchainAddress == t.recipientBlockchainAddress {
-				totalAmount += value
-			}
-			if blockchainAddress == t.senderBlockchainAddress {
-				totalAmount -= value
-			}
-		}
-	}
-	return totalAmount
+	return bc.CalculateBalance(blockchainAddress, 1).Confirmed
 }
 
 // Blockchainの検証
 func (bc *Blockchain) ValidChain(chain []*Block) bool {
-	preBlock := chain[0]
-	currentIndex := 1
-	for currentIndex < len(chain) {
-		b := chain[currentIndex]
-		if b.previousHash != preBlock.Hash() {
-			return false
+	return bc.VerifyChain(chain) == nil
+}
+
+// Blockchainを検証し、不正なブロックがあればその高さをエラーで返す
+func (bc *Blockchain) VerifyChain(chain []*Block) error {
+	if len(chain) == 0 {
+		return errors.New("empty chain")
+	}
+	if err := bc.checkGenesis(chain[0]); err != nil {
+		return err
+	}
+	s := newChainState(bc.params, chain[0])
+	for _, b := range chain[1:] {
+		if err := bc.checkBlock(s, b); err != nil {
+			return err
 		}
-		if !bc.ValidProof(b.Nonce(), b.PreviousHash(), b.Transactions(), MINING_DIFFICULTY) {
-			return false
+	}
+	return nil
+}
+
+// ジェネシスブロックがこのnodeのものと同じか
+// 別のジェネシスブロックから始まるチェーンは長さに関わらず受け付けない
+func (bc *Blockchain) checkGenesis(b *Block) error {
+	if b.Hash() != bc.Chain()[0].Hash() {
+		bc.logger.Component(logging.COMPONENT_CHAIN).Warn("genesis block does not match",
+			"hash", fmt.Sprintf("%x", b.Hash()))
+		return &BlockError{Height: 0, Reason: REJECT_GENESIS}
+	}
+	return nil
+}
+
+// 前のブロックとのつながり、PoW、サイズの上限を検証する
+func (bc *Blockchain) ValidBlock(preBlock *Block, b *Block) bool {
+	return bc.blockReason(preBlock, b) == ""
+}
+
+// 検証済みのチェーンsの次のブロックを前のブロックとのつながり、PoW、サイズの上限、タイムスタンプ、lock_time、
+// Transactionのunlocking scriptと送信者の残高で検証し、正しければsに加える
+// エラーの場合のsは途中まで差し引いた状態になるので、それ以上使わないこと
+func (bc *Blockchain) checkBlock(s *chainState, b *Block) error {
+	height, medianTime := s.height(), medianTimePast(s.chain)
+	reason := bc.blockReason(s.tip(), b)
+	if reason == "" && !bc.ValidBlockTimestamp(medianTime, b) {
+		reason = REJECT_TIMESTAMP
+	}
+	if reason == "" && !bc.ValidBlockLockTimes(height, medianTime, b) {
+		reason = REJECT_LOCK_TIME
+	}
+	if reason == "" {
+		// マイニング報酬の上限には検証を通ったTransactionの手数料だけを加える
+		var fees float32
+		if fees, reason = bc.spendsReason(s, b); reason == "" {
+			reason = bc.coinbaseReason(b, fees)
+		}
+	}
+	if reason != "" {
+		return &BlockError{Height: height, Reason: reason}
+	}
+	s.connect(b)
+	return nil
+}
+
+// ブロックのマイニング報酬以外のTransactionを順に検証し、送信者の残高から差し引く
+// 同じブロックの前のTransactionの送金分も差し引いた残高で判定し、検証を通ったTransactionの手数料の合計を返す
+func (bc *Blockchain) spendsReason(s *chainState, b *Block) (float32, string) {
+	height := s.height()
+	// SelectTransactionsと同じ順に足し合わせる
+	var fees float32 = 0.0
+	for _, t := range b.transactions {
+		if t.IsCoinbase() {
+			continue
+		}
+		if err := s.verifySpend(t, height); err != nil {
+			bc.logger.Component(logging.COMPONENT_CHAIN).Warn("invalid spend in a block",
+				"height", height, "sender", t.senderBlockchainAddress, "err", err)
+			return 0, spendRejectReason(err)
 		}
+		fees += t.fee
+	}
+	return fees, ""
+}
 
-		preBlock = b
-		currentIndex += 1
+// 前のブロックとのつながり、PoW、サイズの上限で不正なブロックの理由（正しいブロックの場合は空）
+func (bc *Blockchain) blockReason(preBlock *Block, b *Block) string {
+	if b.previousHash != preBlock.Hash() {
+		return REJECT_PREVIOUS_HASH
 	}
-	return true
+	if !bc.ValidProof(b.Nonce(), b.PreviousHash(), b.Transactions(), bc.params.MiningDifficulty) {
+		return REJECT_PROOF_OF_WORK
+	}
+	return bc.blockLimitsReason(b)
+}
+
+// ブロックのサイズとTransaction数が上限を超えていないか、
+// Transactionのメモの大きさと手数料がルールを満たしているか判定する
+func (bc *Blockchain) ValidBlockLimits(b *Block) bool {
+	return bc.blockLimitsReason(b) == ""
+}
+
+func (bc *Blockchain) blockLimitsReason(b *Block) string {
+	l := bc.logger.Component(logging.COMPONENT_CHAIN)
+	if len(b.transactions) > bc.params.MaxBlockTransactions {
+		l.Warn("too many transactions in a block", "transactions", len(b.transactions),
+			"max", bc.params.MaxBlockTransactions)
+		return REJECT_TOO_MANY_TRANSACTIONS
+	}
+	if size := b.Size(); size > bc.params.MaxBlockSize {
+		l.Warn("block size exceeds the limit", "size", size, "max", bc.params.MaxBlockSize)
+		return REJECT_BLOCK_SIZE
+	}
+	for _, t := range b.transactions {
+		if t == nil {
+			return REJECT_INVALID_TRANSACTION
+		}
+		if t.IsCoinbase() {
+			continue
+		}
+		if err := t.Validate(); err != nil {
+			l.Warn("invalid transaction in a block", "err", err)
+			return REJECT_INVALID_TRANSACTION
+		}
+	}
+	return ""
+}
+
+// ジェネシスブロック以外のブロックのマイニング報酬のTransactionが1つだけで、
+// 出力が正しく、合計がMiningRewardとfees（検証を通ったTransactionの手数料の合計）を超えていないか
+func (bc *Blockchain) coinbaseReason(b *Block, fees float32) string {
+	l := bc.logger.Component(logging.COMPONENT_CHAIN)
+	var coinbase *Transaction
+	for _, t := range b.transactions {
+		if !t.IsCoinbase() {
+			continue
+		}
+		if coinbase != nil {
+			l.Warn("multiple mining rewards in a block")
+			return REJECT_COINBASE
+		}
+		coinbase = t
+	}
+	if coinbase == nil {
+		l.Warn("no mining reward in a block")
+		return REJECT_COINBASE
+	}
+	if err := validOutputs(coinbase.outputs); err != nil {
+		l.Warn("invalid mining reward in a block", "err", err)
+		return REJECT_COINBASE
+	}
+	if max := bc.params.MiningReward + fees; coinbase.Value() > max {
+		l.Warn("mining reward exceeds the limit", "value", coinbase.Value(), "max", max)
+		return REJECT_COINBASE
+	}
+	return ""
 }
 
 // ブロックチェーンが最も長いものか判定する
+// neighborからの取得と検証はロックを持たずに行い、置き換える時だけマイニングと重ならないようにbc.muxをロックする
 func (bc *Blockchain) ResolveConflicts() bool {
 	var longestChain []*Block = nil
-	maxLength := len(bc.chain)
+	maxLength := len(bc.Chain())
 
-	for _, n := range bc.neighbors {
-		endpoint := fmt.Sprintf("http://%s/chain", n)
-		resp, _ := http.Get(endpoint)
+	l := bc.logger.Component(logging.COMPONENT_CHAIN)
+	client := &http.Client{Timeout: time.Second * PEER_REQUEST_TIMEOUT_SEC}
+	for _, n := range bc.Neighbors() {
+		endpoint := fmt.Sprintf("http://%s/v1/chain", n)
+		resp, err := client.Get(endpoint)
+		if err != nil {
+			bc.logger.Component(logging.COMPONENT_P2P).Warn("peer request failed", "peer", n,
+				"method", http.MethodGet, "path", "/v1/chain", "err", err)
+			continue
+		}
 		if resp.StatusCode == 200 {
-			var bcResp Blockchain
-			decoder := json.NewDecoder(resp.Body)
-			_ = decoder.Decode(&bcResp)
-
-			chain := bcResp.Chain()
-
-			if len(chain) > maxLength && bc.ValidChain(chain) {
+			// ブロックを1つずつ読み込みながら検証し、不正なブロックがあればその時点で打ち切る
+			chain, err := bc.DecodeChain(resp.Body)
+			var be *BlockError
+			if errors.As(err, &be) {
+				// 不正なブロックの前までは検証できている
+				bc.setVerifiedHeight(n, be.Height-1)
+			} else if err == nil {
+				bc.setVerifiedHeight(n, len(chain)-1)
+			}
+			if err != nil {
+				l.Warn("invalid chain from peer", "peer", n, "err", err)
+				bc.metrics.blocksRejected.WithLabelValues(blockRejectReason(err)).Inc()
+			} else if len(chain) > maxLength {
 				maxLength = len(chain)
 				longestChain = chain
 			}
 		}
+		resp.Body.Close()
 	}
 
-	if longestChain != nil {
+	bc.mux.Lock()
+	defer bc.mux.Unlock()
+	// 取得している間にこのnodeでマイニングしたブロックで追いついていれば置き換えない
+	if longestChain != nil && len(longestChain) > len(bc.Chain()) {
 		// ブロックチェーンを最も長いものに書き換える
+		bc.muxChain.Lock()
+		events := reorgEvents(bc.chain, longestChain)
 		bc.chain = longestChain
-		log.Printf("Resolve confilicts replaced")
+		bc.muxChain.Unlock()
+		connected := make([]*Block, 0, len(events))
+		for _, e := range events {
+			if e.Type == EVENT_BLOCK_CONNECTED {
+				connected = append(connected, e.Block)
+			}
+		}
+		bc.removeConfirmed(connected)
+		disconnected := bc.metrics.chainReplaced(events)
+		events = append(events, bc.returnToPool(events)...)
+		bc.notify(events...)
+		l.Info("chain replaced", "height", len(longestChain)-1, "disconnected", disconnected)
 		return true
 	}
-	log.Printf("Resolve conficts not replaced")
+	l.Debug("chain not replaced", "height", len(bc.Chain())-1)
 	return false
 }
 
 // ------------------------------------------------------------------------------------------------
 type Transaction struct {
-	senderBlockchainAddress    string
-	recipientBlockchainAddress string
-	value                      float32
+	senderBlockchainAddress string
+	outputs                 []*Output
+	fee                     float32
+	memo                    string // 請求書番号などの任意のデータ（署名とブロックのhashの対象になる）
+	lockTime                int64  // 0でなければ、このブロックの高さまたはUNIX時間（秒）まではブロックに取り込めない
+	// 送信者の承認（署名方式とunlocking script）
+	// ブロックのhashの対象にはなるが、署名の対象にはならない
+	scheme          string
+	unlockingScript []byte
 }
 
 // Transactionの生成
 func NewTransaction(sender string, recipient string, value float32) *Transaction {
-	return &Transaction{sender, recipient, value}
+	return NewTransactionWithLockTime(sender, recipient, value, 0)
+}
+
+// lock_timeを指定してTransactionを生成する
+func NewTransactionWithLockTime(sender string, recipient string, value float32, lockTime int64) *Transaction {
+	return NewBatchTransaction(sender, []*Output{NewOutput(recipient, value)}, lockTime)
+}
+
+// 複数の受取人に送るTransactionを生成する
+func NewBatchTransaction(sender string, outputs []*Output, lockTime int64) *Transaction {
+	return &Transaction{senderBlockchainAddress: sender, outputs: outputs, lockTime: lockTime}
+}
+
+// 送信者のアドレス
+func (t *Transaction) SenderBlockchainAddress() string {
+	return t.senderBlockchainAddress
+}
+
+// 署名の対象になるhash（Transactionの承認を除いた正規化したJSONのsha256）
+// 同じ送信者、出力、手数料、メモ、lock_timeのTransactionは同じhashになる
+func (t *Transaction) Hash() [32]byte {
+	m, _ := t.marshal(false)
+	return sha256.Sum256(m)
+}
+
+// Transactionに送信者の承認を付ける
+// ブロックに取り込まれた後も他のnodeがunlocking scriptを検証できるようにする
+func (t *Transaction) setAuthorization(auth Authorization) {
+	t.scheme = string(auth.Scheme().ID())
+	t.unlockingScript = auth.UnlockingScript()
+}
+
+// ブロックに取り込まれたTransactionの承認
+func (t *Transaction) Authorization() (Authorization, error) {
+	if t.scheme == "" || len(t.unlockingScript) == 0 {
+		return nil, ErrMissingAuthorization
+	}
+	scheme, err := keys.SchemeByID(keys.SchemeID(t.scheme))
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", err, t.scheme)
+	}
+	return NewScriptAuthorization(scheme, t.unlockingScript), nil
+}
+
+// マイニング報酬のTransactionか判定する
+func (t *Transaction) IsCoinbase() bool {
+	return t.senderBlockchainAddress == MINING_SENDER
 }
 
 // Transactionの出力
 func (t *Transaction) Print() {
 	fmt.Printf("%s\n", strings.Repeat("-", 40))
 	fmt.Printf(" sender_blockchain_address    %s\n", t.senderBlockchainAddress)
-	fmt.Printf(" recipient_blockchain_address %s\n", t.recipientBlockchainAddress)
-	fmt.Printf(" value                        %.1f\n", t.value)
+	for _, o := range t.outputs {
+		fmt.Printf(" recipient_blockchain_address %s\n", o.RecipientBlockchainAddress)
+		fmt.Printf(" value                        %.1f\n", o.Value)
+	}
+	if t.fee != 0 {
+		fmt.Printf(" fee                          %.3f\n", t.fee)
+	}
+	if t.memo != "" {
+		fmt.Printf(" memo                         %q\n", t.memo)
+	}
+	if t.lockTime != 0 {
+		fmt.Printf(" lock_time                    %d\n", t.lockTime)
+	}
 }
 
+// 署名するJSONが以前と変わらないように、出力が1つの場合はrecipient_blockchain_addressとvalue、
+// 複数の場合はoutputsにする。fee、memo、lock_time、承認が0（空）の場合は省略する
 func (t *Transaction) MarshalJSON() ([]byte, error) {
+	return t.marshal(true)
+}
+
+// witnessがfalseの場合は承認（schemeとunlocking_script）を含めない署名の対象のJSONにする
+func (t *Transaction) marshal(witness bool) ([]byte, error) {
+	var scheme, unlocking string
+	if witness {
+		scheme = t.scheme
+		unlocking = hex.EncodeToString(t.unlockingScript)
+	}
+	if len(t.outputs) == 1 {
+		return json.Marshal(struct {
+			Sender          string  `json:"sender_blockchain_address"`
+			Recipient       string  `json:"recipient_blockchain_address"`
+			Value           float32 `json:"value"`
+			Fee             float32 `json:"fee,omitempty"`
+			Memo            string  `json:"memo,omitempty"`
+			LockTime        int64   `json:"lock_time,omitempty"`
+			Scheme          string  `json:"scheme,omitempty"`
+			UnlockingScript string  `json:"unlocking_script,omitempty"`
+		}{
+			Sender:          t.senderBlockchainAddress,
+			Recipient:       t.outputs[0].RecipientBlockchainAddress,
+			Value:           t.outputs[0].Value,
+			Fee:             t.fee,
+			Memo:            t.memo,
+			LockTime:        t.lockTime,
+			Scheme:          scheme,
+			UnlockingScript: unlocking,
+		})
+	}
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Sender          string    `json:"sender_blockchain_address"`
+		Outputs         []*Output `json:"outputs"`
+		Fee             float32   `json:"fee,omitempty"`
+		Memo            string    `json:"memo,omitempty"`
+		LockTime        int64     `json:"lock_time,omitempty"`
+		Scheme          string    `json:"scheme,omitempty"`
+		UnlockingScript string    `json:"unlocking_script,omitempty"`
 	}{
-		Sender:    t.senderBlockchainAddress,
-		Recipient: t.recipientBlockchainAddress,
-		Value:     t.value,
+		Sender:          t.senderBlockchainAddress,
+		Outputs:         t.outputs,
+		Fee:             t.fee,
+		Memo:            t.memo,
+		LockTime:        t.lockTime,
+		Scheme:          scheme,
+		UnlockingScript: unlocking,
 	})
 }
 
 func (t *Transaction) UnmarshalJSON(data []byte) error {
 	v := &struct {
-		Sender    *string  `json:"sender_blockchain_address"`
-		Recipient *string  `json:"recipient_blockchain_address"`
-		Value     *float32 `json:"value"`
+		Sender    *string   `json:"sender_blockchain_address"`
+		Recipient *string   `json:"recipient_blockchain_address"`
+		Value     *float32  `json:"value"`
+		Outputs   []*Output `json:"outputs"`
+		Fee       *float32  `json:"fee"`
+		Memo      *string   `json:"memo"`
+		LockTime  *int64    `json:"lock_time"`
+		Scheme    *string   `json:"scheme"`
+		Unlocking *string   `json:"unlocking_script"`
 	}{
-		Sender:    &t.senderBlockchainAddress,
-		Recipient: &t.recipientBlockchainAddress,
-		Value:     &t.value,
+		Sender:   &t.senderBlockchainAddress,
+		Fee:      &t.fee,
+		Memo:     &t.memo,
+		LockTime: &t.lockTime,
+		Scheme:   &t.scheme,
 	}
 	if err := json.Unmarshal(data, &v); err != nil {
 		return err
 	}
+	if v == nil {
+		return errors.New("transaction must not be null")
+	}
+	if v.Unlocking != nil {
+		unlocking, err := hex.DecodeString(*v.Unlocking)
+		if err != nil {
+			return fmt.Errorf("invalid unlocking_script: %w", err)
+		}
+		t.unlockingScript = unlocking
+	}
+	for _, o := range v.Outputs {
+		if o == nil {
+			return ErrInvalidOutputs
+		}
+	}
+	switch {
+	case v.Outputs != nil:
+		t.outputs = v.Outputs
+	case v.Recipient != nil && v.Value != nil:
+		t.outputs = []*Output{NewOutput(*v.Recipient, *v.Value)}
+	default:
+		t.outputs = nil
+	}
 	return nil
 }
 
 // --------------------------------------------------------------------------------------------------------------------
 // ブロックチェーンNodeに投げるTransactoin
+// 1つの鍵の場合はsender_public_keyとsignature、マルチシグの場合はredeem_scriptとsignatures、
+// それ以外のP2SHのアドレスの場合はunlocking_scriptを指定する
+// 受取人が1人の場合はrecipient_blockchain_addressとvalue、複数の場合はoutputsを指定する
 type TransactionRequest struct {
-	SenderBlockchainAddress    *string  `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string  `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string  `json:"sender_public_key"`
-	Value                      *float32 `json:"value"`
-	Signature                  *string  `json:"signature"`
+	SenderBlockchainAddress    *string   `json:"sender_blockchain_address"`
+	RecipientBlockchainAddress *string   `json:"recipient_blockchain_address,omitempty"`
+	SenderPublicKey            *string   `json:"sender_public_key,omitempty"`
+	Value                      *float32  `json:"value,omitempty"`
+	Outputs                    []*Output `json:"outputs,omitempty"`
+	Scheme                     *string   `json:"scheme"`
+	Signature                  *string   `json:"signature,omitempty"`
+	RedeemScript               *string   `json:"redeem_script,omitempty"`
+	Signatures                 []string  `json:"signatures,omitempty"`
+	UnlockingScript            *string   `json:"unlocking_script,omitempty"`
+	Fee                        *float32  `json:"fee,omitempty"`
+	Memo                       *string   `json:"memo,omitempty"`
+	LockTime                   *int64    `json:"lock_time,omitempty"`
+}
+
+func NewTransactionRequest(t *Transaction, auth Authorization) *TransactionRequest {
+	tr := &TransactionRequest{SenderBlockchainAddress: &t.senderBlockchainAddress}
+	if len(t.outputs) == 1 {
+		tr.RecipientBlockchainAddress = &t.outputs[0].RecipientBlockchainAddress
+		tr.Value = &t.outputs[0].Value
+	} else {
+		tr.Outputs = t.outputs
+	}
+	if t.fee != 0 {
+		tr.Fee = &t.fee
+	}
+	if t.memo != "" {
+		tr.Memo = &t.memo
+	}
+	if t.lockTime != 0 {
+		tr.LockTime = &t.lockTime
+	}
+	auth.fillRequest(tr)
+	return tr
 }
 
 func (tr *TransactionRequest) Validate() bool {
+	// 受取人はrecipient_blockchain_addressとvalueか、outputsのどちらか一方で指定する
+	if tr.Outputs != nil {
+		if tr.RecipientBlockchainAddress != nil || tr.Value != nil {
+			return false
+		}
+	} else if tr.RecipientBlockchainAddress == nil || tr.Value == nil {
+		return false
+	}
 	if tr.SenderBlockchainAddress == nil ||
-		tr.RecipientBlockchainAddress == nil ||
-		tr.SenderPublicKey == nil ||
-		tr.Value == nil ||
-		tr.Signature == nil {
+		tr.Scheme == nil ||
+		(tr.LockTime != nil && *tr.LockTime < 0) {
 		return false
 	}
-	return true
+	single := tr.SenderPublicKey != nil || tr.Signature != nil
+	switch {
+	case tr.UnlockingScript != nil:
+		return !single && !tr.IsMultisig() && tr.Signatures == nil
+	case tr.IsMultisig():
+		return !single && len(tr.Signatures) > 0 && len(tr.Signatures) <= multisig.MAX_PUBLIC_KEYS
+	}
+	return tr.SenderPublicKey != nil && tr.Signature != nil && tr.Signatures == nil
+}
+
+func (tr *TransactionRequest) IsMultisig() bool {
+	return tr.RedeemScript != nil
+}
+
+// Validateを通ったリクエストからTransactionを作る
+// lock_time、fee、memoは指定されていなければ0（空）になる
+func (tr *TransactionRequest) Transaction() *Transaction {
+	outputs := tr.Outputs
+	if outputs == nil {
+		outputs = []*Output{NewOutput(*tr.RecipientBlockchainAddress, *tr.Value)}
+	}
+	var lockTime int64
+	if tr.LockTime != nil {
+		lockTime = *tr.LockTime
+	}
+	t := NewBatchTransaction(*tr.SenderBlockchainAddress, outputs, lockTime)
+	if tr.Memo != nil {
+		t.memo = *tr.Memo
+	}
+	if tr.Fee != nil {
+		t.fee = *tr.Fee
+	}
+	return t
+}
+
+// 署名方式、公開鍵（redeem script）、署名を読み込む
+// Validateを通ったリクエストに対して呼ぶ
+func (tr *TransactionRequest) Authorization() (Authorization, error) {
+	scheme, err := keys.SchemeByID(keys.SchemeID(*tr.Scheme))
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", err, *tr.Scheme)
+	}
+	if tr.UnlockingScript != nil {
+		unlocking, err := hex.DecodeString(*tr.UnlockingScript)
+		if err != nil || !script.IsPushOnly(unlocking) {
+			return nil, script.ErrNotPushOnly
+		}
+		return NewScriptAuthorization(scheme, unlocking), nil
+	}
+	if tr.IsMultisig() {
+		script, err := multisig.ParseString(scheme, *tr.RedeemScript)
+		if err != nil {
+			return nil, err
+		}
+		signatures := make([]*keys.Signature, 0, len(tr.Signatures))
+		for _, str := range tr.Signatures {
+			s, err := keys.ParseSignatureString(scheme, str)
+			if err != nil {
+				return nil, err
+			}
+			signatures = append(signatures, s)
+		}
+		return NewMultisigAuthorization(script, signatures), nil
+	}
+	publicKey, err := keys.ParsePublicKeyString(scheme, *tr.SenderPublicKey)
+	if err != nil {
+		return nil, err
+	}
+	s, err := keys.ParseSignatureString(scheme, *tr.Signature)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignatureAuthorization(publicKey, s), nil
 }
 
 // --------------------------------------------------------------------------------------------------------------------
 // 仮想通貨の合計値
+// Amountは後方互換のためConfirmedと同じ値を返す
 type AmountResponse struct {
-	Amount float32 `json:"amount"`
+	Amount      float32 `json:"amount"`
+	Confirmed   float32 `json:"confirmed"`
+	Unconfirmed float32 `json:"unconfirmed"`
+	Immature    float32 `json:"immature"`
+	MinConf     int     `json:"minconf"`
+}
+
+func NewAmountResponse(b *Balance, minConf int) *AmountResponse {
+	return &AmountResponse{
+		Amount:      b.Confirmed,
+		Confirmed:   b.Confirmed,
+		Unconfirmed: b.Unconfirmed,
+		Immature:    b.Immature,
+		MinConf:     minConf,
+	}
 }
 
 func (ar *AmountResponse) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		Amount float32 `json:"amount"`
+		Amount      float32 `json:"amount"`
+		Confirmed   float32 `json:"confirmed"`
+		Unconfirmed float32 `json:"unconfirmed"`
+		Immature    float32 `json:"immature"`
+		MinConf     int     `json:"minconf"`
 	}{
-		Amount: ar.Amount,
+		Amount:      ar.Amount,
+		Confirmed:   ar.Confirmed,
+		Unconfirmed: ar.Unconfirmed,
+		Immature:    ar.Immature,
+		MinConf:     ar.MinConf,
 	})
 }
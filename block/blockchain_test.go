@@ -0,0 +1,37 @@
+package block
+
+import "testing"
+
+func TestCoinbaseReason(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	reward := RegtestParams.MiningReward
+	paid := NewTransaction("A", "B", 1).WithMemo("", 0.5)
+	coinbase := func(value float32) *Transaction {
+		return NewTransaction(MINING_SENDER, "miner", value)
+	}
+	nullOutput := &Transaction{senderBlockchainAddress: MINING_SENDER, outputs: []*Output{nil}}
+
+	tests := []struct {
+		name         string
+		transactions []*Transaction
+		fees         float32
+		want         string
+	}{
+		{"reward", []*Transaction{coinbase(reward)}, 0, ""},
+		{"reward and fees", []*Transaction{paid, coinbase(reward + 0.5)}, 0.5, ""},
+		{"no reward", []*Transaction{paid}, 0.5, REJECT_COINBASE},
+		{"multiple rewards", []*Transaction{coinbase(1), coinbase(1)}, 0, REJECT_COINBASE},
+		{"too much reward", []*Transaction{paid, coinbase(reward + 1)}, 0.5, REJECT_COINBASE},
+		// 上限に加えるのは検証を通ったTransactionの手数料だけ
+		{"unverified fees", []*Transaction{paid, coinbase(reward + 0.5)}, 0, REJECT_COINBASE},
+		{"negative reward", []*Transaction{coinbase(-1)}, 0, REJECT_COINBASE},
+		{"null output", []*Transaction{nullOutput}, 0, REJECT_COINBASE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bc.coinbaseReason(NewBlock(0, [32]byte{}, tt.transactions), tt.fees); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package block
+
+import (
+	"fmt"
+	"sort"
+)
+
+// ブロックを先頭から順に検証する間のチェーンの状態
+// 送信者の残高とOP_CHECKSEQUENCEVERIFYの経過ブロック数を、検証済みのブロックだけから求める
+// 額は足し合わせる順番で結果が変わらないようにFEE_BASE_UNITSの単位数で集計する
+type chainState struct {
+	params    *Params
+	chain     []*Block // 検証済みのブロック
+	addresses map[string]*addressState
+	confirmed map[[32]byte]bool // 検証済みのブロックに取り込まれたTransactionのhash
+}
+
+// アドレスが受け取った額と送った額
+// 受け取りは高さの順に並び、合計は累積で持つ（ブロックごとに全ての受け取りを数え直さない）
+type addressState struct {
+	heights          []int   // 受け取ったブロックの高さ
+	received         []int64 // heightsまでに受け取った額の累積
+	coinbaseHeights  []int   // マイニング報酬を受け取ったブロックの高さ
+	coinbaseReceived []int64 // coinbaseHeightsまでに受け取ったマイニング報酬の累積
+	regular          int64   // マイニング報酬以外で受け取った額の合計
+	spent            int64   // 送った額（出力と手数料）の合計
+}
+
+// ジェネシスブロックだけのチェーンの状態
+func newChainState(params *Params, genesis *Block) *chainState {
+	s := &chainState{
+		params:    params,
+		addresses: make(map[string]*addressState),
+		confirmed: make(map[[32]byte]bool),
+	}
+	s.connect(genesis)
+	return s
+}
+
+// 検証済みのチェーン（このnodeのチェーン）の状態
+func chainStateOf(params *Params, chain []*Block) *chainState {
+	s := newChainState(params, chain[0])
+	for _, b := range chain[1:] {
+		for _, t := range b.transactions {
+			if !t.IsCoinbase() {
+				s.spend(t)
+			}
+		}
+		s.connect(b)
+	}
+	return s
+}
+
+// 次に検証するブロックの高さ
+func (s *chainState) height() int {
+	return len(s.chain)
+}
+
+// 検証済みの最後のブロック
+func (s *chainState) tip() *Block {
+	return s.chain[len(s.chain)-1]
+}
+
+func (s *chainState) address(blockchainAddress string) *addressState {
+	as, ok := s.addresses[blockchainAddress]
+	if !ok {
+		as = new(addressState)
+		s.addresses[blockchainAddress] = as
+	}
+	return as
+}
+
+// ブロックの受け取りを記録してチェーンの最後に加える
+// 送金分はspendで先に差し引いておくこと
+func (s *chainState) connect(b *Block) {
+	height := s.height()
+	for _, t := range b.transactions {
+		for _, o := range t.outputs {
+			as := s.address(o.RecipientBlockchainAddress)
+			units := baseUnits(o.Value)
+			var total int64
+			if n := len(as.received); n > 0 {
+				total = as.received[n-1]
+			}
+			as.heights = append(as.heights, height)
+			as.received = append(as.received, total+units)
+			if !t.IsCoinbase() {
+				as.regular += units
+				continue
+			}
+			total = 0
+			if n := len(as.coinbaseReceived); n > 0 {
+				total = as.coinbaseReceived[n-1]
+			}
+			as.coinbaseHeights = append(as.coinbaseHeights, height)
+			as.coinbaseReceived = append(as.coinbaseReceived, total+units)
+		}
+	}
+	s.chain = append(s.chain, b)
+}
+
+// tの送金分を送信者の残高から差し引く
+func (s *chainState) spend(t *Transaction) {
+	s.address(t.senderBlockchainAddress).spent += t.debitUnits()
+	s.confirmed[t.Hash()] = true
+}
+
+// 高さheightのブロックでblockchainAddressが使える額の単位数
+// chainBalanceのminConfが1の場合と同じく、前のブロックまでの受け取りと
+// CoinbaseMaturityに達したマイニング報酬から、送った額を差し引く
+func (s *chainState) available(blockchainAddress string, height int) int64 {
+	as, ok := s.addresses[blockchainAddress]
+	if !ok {
+		return 0
+	}
+	// 承認数がCoinbaseMaturity以上になる高さまでのマイニング報酬
+	mature := sort.SearchInts(as.coinbaseHeights, height-s.params.CoinbaseMaturity+1)
+	units := as.regular - as.spent
+	if mature > 0 {
+		units += as.coinbaseReceived[mature-1]
+	}
+	return units
+}
+
+// spendAgeと同じ数え方で、tの支払いに使う資金を受け取ってからのブロック数
+func (s *chainState) age(t *Transaction, height int) int {
+	as, ok := s.addresses[t.senderBlockchainAddress]
+	if !ok {
+		return 0
+	}
+	debit := t.debitUnits()
+	i := sort.Search(len(as.received), func(i int) bool {
+		return as.received[i]-as.spent >= debit
+	})
+	if i == len(as.received) {
+		return 0
+	}
+	return height - as.heights[i]
+}
+
+// 高さheightのブロックに取り込むマイニング報酬以外のTransactionを検証し、送金分を差し引く
+// 同じTransactionの再送、unlocking script、送信者の残高を確認する
+// エラーの場合は何も差し引かない
+func (s *chainState) verifySpend(t *Transaction, height int) error {
+	if s.confirmed[t.Hash()] {
+		return ErrDuplicateTransaction
+	}
+	auth, err := t.Authorization()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScriptFailed, err)
+	}
+	if err := verifyScript(auth, t, height, s.age(t, height)); err != nil {
+		return err
+	}
+	if s.available(t.senderBlockchainAddress, height) < t.debitUnits() {
+		return ErrInsufficientBalance
+	}
+	s.spend(t)
+	return nil
+}
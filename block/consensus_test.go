@@ -0,0 +1,199 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"go-blockchain/wallet"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// chainの最後にtransactionsとマイニング報酬（MiningRewardと手数料の合計）を取り込んだブロックを加えたチェーン
+func extendChain(bc *Blockchain, chain []*Block, transactions ...*Transaction) []*Block {
+	reward := bc.params.MiningReward
+	for _, t := range transactions {
+		reward += t.fee
+	}
+	return extendChainReward(bc, chain, reward, transactions...)
+}
+
+// マイニング報酬の額を指定してブロックを加えたチェーン（PoWは満たす）
+func extendChainReward(bc *Blockchain, chain []*Block, reward float32, transactions ...*Transaction) []*Block {
+	transactions = append(transactions, NewTransaction(MINING_SENDER, "attacker", reward))
+	previousHash := chain[len(chain)-1].Hash()
+	nonce := 0
+	for !bc.ValidProof(nonce, previousHash, transactions, bc.params.MiningDifficulty) {
+		nonce++
+	}
+	extended := append([]*Block(nil), chain...)
+	return append(extended, NewBlock(nonce, previousHash, transactions))
+}
+
+// peerから受け取るのと同じようにJSONから読み込み直したチェーンを検証する
+func decodeBlocksReason(t *testing.T, bc *Blockchain, chain []*Block) string {
+	t.Helper()
+	m, err := json.Marshal(&struct {
+		Chain []*Block `json:"chain"`
+	}{chain})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bc.DecodeChain(strings.NewReader(string(m)))
+	if err == nil {
+		return ""
+	}
+	var be *BlockError
+	if !errors.As(err, &be) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if be.Height != len(chain)-1 {
+		t.Errorf("rejected at height %d, want %d", be.Height, len(chain)-1)
+	}
+	return be.Reason
+}
+
+// ブロックのTransactionは他のnodeでもunlocking scriptと送信者の残高で検証される
+func TestCheckBlockSpends(t *testing.T) {
+	w, attacker := wallet.NewWallet(), wallet.NewWallet()
+	bc := fundedBlockchain(t, w)
+	chain := bc.Chain()
+
+	valid, auth := signedTransaction(t, w, "B", 1)
+	valid.setAuthorization(auth)
+	// 承認のないTransaction
+	unsigned := NewTransaction(w.BlockchainAddress(), attacker.BlockchainAddress(), 1)
+	// 別の鍵で署名したTransaction
+	forged, _ := signedTransaction(t, w, attacker.BlockchainAddress(), 1)
+	s, err := wallet.NewTransaction(attacker.PrivateKey(), w.BlockchainAddress(), attacker.BlockchainAddress(), 1).GenerateSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged.setAuthorization(NewSignatureAuthorization(attacker.PublicKey(), s))
+	// 残高を超える額
+	overspend, auth := signedTransaction(t, w, "B", 1000)
+	overspend.setAuthorization(auth)
+	// 残高の範囲内でも同じブロックの前のTransactionと合わせると超える
+	half := bc.CalculateTotalAmount(w.BlockchainAddress())/2 + 0.1
+	first, auth := signedTransaction(t, w, "B", half)
+	first.setAuthorization(auth)
+	second, auth := signedTransaction(t, w, "C", half)
+	second.setAuthorization(auth)
+
+	tests := []struct {
+		name  string
+		chain []*Block
+		want  string
+	}{
+		{"valid", extendChain(bc, chain, valid), ""},
+		{"unsigned", extendChain(bc, chain, unsigned), REJECT_SCRIPT},
+		{"forged", extendChain(bc, chain, forged), REJECT_SCRIPT},
+		{"overspend", extendChain(bc, chain, overspend), REJECT_BALANCE},
+		{"overspend in a block", extendChain(bc, chain, first, second), REJECT_BALANCE},
+		{"replay", extendChain(bc, extendChain(bc, chain, valid), valid), REJECT_DUPLICATE_TRANSACTION},
+		// 未成熟のマイニング報酬はCoinbaseMaturityに達するまで使えない
+		{"immature", extendChain(bc, chain[:2], valid), REJECT_BALANCE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeBlocksReason(t, bc, tt.chain); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// 署名や残高の検証を通らないTransactionの手数料でマイニング報酬の上限を上げられない
+func TestCheckBlockFees(t *testing.T) {
+	w, attacker := wallet.NewWallet(), wallet.NewWallet()
+	bc := fundedBlockchain(t, w)
+	chain := bc.Chain()
+	reward := bc.params.MiningReward
+
+	paid := signedPaymentWithFee(t, w, "B", 0.2, 0.5)
+	// 残高のない送信者が自分で署名した手数料の高いTransaction
+	fake := signedPaymentWithFee(t, attacker, "B", 1, 100)
+
+	tests := []struct {
+		name  string
+		chain []*Block
+		want  string
+	}{
+		{"fees", extendChainReward(bc, chain, reward+0.5, paid), ""},
+		{"more than fees", extendChainReward(bc, chain, reward+0.6, paid), REJECT_COINBASE},
+		{"fake fees", extendChainReward(bc, chain, reward+100, fake), REJECT_BALANCE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeBlocksReason(t, bc, tt.chain); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// wの鍵で署名した手数料付きのTransaction（承認を付けたもの）
+func signedPaymentWithFee(t *testing.T, w *wallet.Wallet, recipient string, value float32, fee float32) *Transaction {
+	t.Helper()
+	wt := wallet.NewTransaction(w.PrivateKey(), w.BlockchainAddress(), recipient, value).WithMemo("", fee)
+	s, err := wt.GenerateSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx := NewTransaction(w.BlockchainAddress(), recipient, value).WithMemo("", fee)
+	tx.setAuthorization(NewSignatureAuthorization(w.PublicKey(), s))
+	return tx
+}
+
+// 他人のアドレスから送るTransactionを含むチェーンは長くても置き換えない
+func TestResolveConflictsForgedSpend(t *testing.T) {
+	w, attacker := wallet.NewWallet(), wallet.NewWallet()
+	bc := fundedBlockchain(t, w)
+
+	forged := NewTransaction(w.BlockchainAddress(), attacker.BlockchainAddress(), 1)
+	chain := extendChain(bc, bc.Chain(), forged)
+	chain = extendChain(bc, chain)
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(&struct {
+			Chain []*Block `json:"chain"`
+		}{chain})
+	}))
+	defer peer.Close()
+	if err := bc.AddNeighbor(strings.TrimPrefix(peer.URL, "http://")); err != nil {
+		t.Fatal(err)
+	}
+
+	height := len(bc.Chain())
+	if bc.ResolveConflicts() {
+		t.Fatalf("adopted a chain with a forged spend")
+	}
+	if len(bc.Chain()) != height {
+		t.Errorf("chain height changed from %d to %d", height, len(bc.Chain()))
+	}
+	if balance := bc.CalculateTotalAmount(attacker.BlockchainAddress()); balance != 0 {
+		t.Errorf("attacker balance = %v, want 0", balance)
+	}
+}
+
+// マイニングしたブロックは他のnodeの検証を通る
+func TestMinedBlockSpends(t *testing.T) {
+	w := wallet.NewWallet()
+	bc := fundedBlockchain(t, w)
+	tx, auth := signedTransaction(t, w, "B", 1)
+	if err := bc.AddTransaction(tx, auth); err != nil {
+		t.Fatal(err)
+	}
+	// 承認のないTransactionはPoolに入っていてもブロックに取り込まない
+	bc.muxPool.Lock()
+	bc.transactionPool = append(bc.transactionPool, NewTransaction(w.BlockchainAddress(), "C", 1))
+	bc.muxPool.Unlock()
+
+	b := bc.Generate(1, "miner")[0]
+	if n := len(b.Transactions()); n != 2 {
+		t.Fatalf("block has %d transactions, want the signed one and the reward", n)
+	}
+	if got := decodeBlocksReason(t, NewBlockchain("other", 0, RegtestParams), bc.Chain()); got != "" {
+		t.Errorf("mined chain rejected: %q", got)
+	}
+}
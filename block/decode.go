@@ -0,0 +1,131 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// json.Decoderが先読みする分の余裕
+const decodeBufferSlack = 4096
+
+// 読み込めるバイト数に上限をつけたReader
+// ブロックごとの上限nはブロックを1つ読み込むごとにresetで設定し直し、全体の上限totalは設定し直さない
+type cappedReader struct {
+	r     io.Reader
+	n     int64
+	total int64
+}
+
+var (
+	errSizeLimit  = errors.New("response exceeds size limit")
+	errChainLimit = errors.New("chain exceeds size limit")
+)
+
+func (cr *cappedReader) Read(p []byte) (int, error) {
+	if cr.total <= 0 {
+		return 0, errChainLimit
+	}
+	if cr.n <= 0 {
+		return 0, errSizeLimit
+	}
+	if int64(len(p)) > cr.n {
+		p = p[:cr.n]
+	}
+	if int64(len(p)) > cr.total {
+		p = p[:cr.total]
+	}
+	n, err := cr.r.Read(p)
+	cr.n -= int64(n)
+	cr.total -= int64(n)
+	return n, err
+}
+
+func (cr *cappedReader) reset(n int64) {
+	cr.n = n
+}
+
+// peerから受け取った{"chain": [...]}形式のJSONを1ブロックずつ読み込む
+// 1ブロックあたりMaxBlockSize、全体でMaxChainSizeとMaxChainBlocksを超えて読み込まず、
+// 読み込んだブロックはその場で検証する（ジェネシスブロックはこのnodeのものと同じか確認する）
+func (bc *Blockchain) DecodeChain(r io.Reader) ([]*Block, error) {
+	limit := int64(bc.params.MaxBlockSize + decodeBufferSlack)
+	cr := &cappedReader{r: r, n: limit, total: int64(bc.params.MaxChainSize + decodeBufferSlack)}
+	decoder := json.NewDecoder(cr)
+
+	if err := expectDelim(decoder, '{'); err != nil {
+		return nil, err
+	}
+	var chain []*Block
+	for decoder.More() {
+		cr.reset(limit)
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if key, _ := token.(string); key != "chain" {
+			// chain以外のフィールドは読み飛ばす
+			var skip json.RawMessage
+			if err := decoder.Decode(&skip); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if chain, err = bc.decodeBlocks(decoder, cr, limit); err != nil {
+			return nil, err
+		}
+	}
+	if err := expectDelim(decoder, '}'); err != nil {
+		return nil, err
+	}
+	if len(chain) == 0 {
+		return nil, errors.New("empty chain")
+	}
+	return chain, nil
+}
+
+func (bc *Blockchain) decodeBlocks(decoder *json.Decoder, cr *cappedReader, limit int64) ([]*Block, error) {
+	if err := expectDelim(decoder, '['); err != nil {
+		return nil, err
+	}
+	// ジェネシスブロックを読み込むまではnil
+	var s *chainState
+	for decoder.More() {
+		if s != nil && s.height() >= bc.params.MaxChainBlocks {
+			return nil, fmt.Errorf("chain exceeds %d blocks", bc.params.MaxChainBlocks)
+		}
+		cr.reset(limit)
+		b := new(Block)
+		if err := decoder.Decode(b); err != nil {
+			return nil, err
+		}
+		if s != nil {
+			if err := bc.checkBlock(s, b); err != nil {
+				return nil, err
+			}
+		} else if err := bc.checkGenesis(b); err != nil {
+			return nil, err
+		} else {
+			s = newChainState(bc.params, b)
+		}
+	}
+	if err := expectDelim(decoder, ']'); err != nil {
+		return nil, err
+	}
+	if s == nil {
+		return nil, nil
+	}
+	return s.chain, nil
+}
+
+func expectDelim(decoder *json.Decoder, delim json.Delim) error {
+	token, err := decoder.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := token.(json.Delim); !ok || d != delim {
+		return fmt.Errorf("expected %q but got %v", delim, token)
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package block
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// 3ブロックの正しいチェーンのJSON（ブロックごと）
+func testChainBlocks(t *testing.T, bc *Blockchain) []string {
+	t.Helper()
+	bc.Generate(2, "miner")
+	m, err := json.Marshal(bc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v struct {
+		Chain []json.RawMessage `json:"chain"`
+	}
+	if err := json.Unmarshal(m, &v); err != nil {
+		t.Fatal(err)
+	}
+	blocks := make([]string, len(v.Chain))
+	for i, b := range v.Chain {
+		blocks[i] = string(b)
+	}
+	return blocks
+}
+
+func chainJSON(blocks ...string) string {
+	return `{"chain":[` + strings.Join(blocks, ",") + `]}`
+}
+
+func TestDecodeChain(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	blocks := testChainBlocks(t, bc)
+
+	chain, err := bc.DecodeChain(strings.NewReader(chainJSON(blocks...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chain) != len(blocks) {
+		t.Fatalf("got %d blocks, want %d", len(chain), len(blocks))
+	}
+}
+
+// peerから受け取った不正なチェーンはpanicせずにエラーにする
+func TestDecodeChainInvalid(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	blocks := testChainBlocks(t, bc)
+	// ブロック1のTransactionとマイニング報酬の出力を置き換える
+	var b1 map[string]interface{}
+	if err := json.Unmarshal([]byte(blocks[1]), &b1); err != nil {
+		t.Fatal(err)
+	}
+	withTransactions := func(transactions string) string {
+		v := make(map[string]json.RawMessage)
+		for k, x := range b1 {
+			m, _ := json.Marshal(x)
+			v[k] = m
+		}
+		v["transactions"] = json.RawMessage(transactions)
+		m, _ := json.Marshal(v)
+		return string(m)
+	}
+	huge := `{"sender_blockchain_address":"A","recipient_blockchain_address":"B","value":1,"memo":"` +
+		strings.Repeat("x", RegtestParams.MaxBlockSize) + `"}`
+
+	tests := map[string]string{
+		"null chain":           `{"chain":null}`,
+		"null block":           chainJSON("null"),
+		"null block in middle": chainJSON(blocks[0], "null", blocks[2]),
+		"null previous_hash":   chainJSON(blocks[0], `{"nonce":0,"previous_hash":null,"timestamp":0,"transactions":[]}`),
+		"null transaction":     chainJSON(blocks[0], withTransactions(`[null]`)),
+		"null output": chainJSON(blocks[0], withTransactions(
+			`[{"sender_blockchain_address":"THE BLOCKCHAIN","outputs":[null]}]`)),
+		"oversized block": chainJSON(blocks[0], withTransactions(`[`+huge+`]`)),
+		"truncated":       chainJSON(blocks...)[:len(blocks[0])+20],
+	}
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := bc.DecodeChain(bytes.NewBufferString(body)); err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
+
+// 別のジェネシスブロックから始まるチェーンは長くても受け付けない
+func TestDecodeChainGenesis(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	other := NewBlockchain("miner", 0, RegtestParams)
+	other.chain[0] = NewBlock(0, [32]byte{}, nil)
+	blocks := testChainBlocks(t, other)
+
+	_, err := bc.DecodeChain(strings.NewReader(chainJSON(blocks...)))
+	var be *BlockError
+	if !errors.As(err, &be) || be.Height != 0 || be.Reason != REJECT_GENESIS {
+		t.Fatalf("got %v, want a genesis error", err)
+	}
+	if err := bc.VerifyChain(other.Chain()); err == nil {
+		t.Errorf("VerifyChain accepted a different genesis block")
+	}
+}
+
+// チェーン全体のブロック数とバイト数に上限がある
+func TestDecodeChainLimits(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	body := chainJSON(testChainBlocks(t, bc)...)
+
+	params := RegtestParams.Copy()
+	params.MaxChainBlocks = 2
+	if _, err := NewBlockchain("miner", 0, params).DecodeChain(strings.NewReader(body)); err == nil {
+		t.Errorf("accepted a chain with more than MaxChainBlocks blocks")
+	}
+	params = RegtestParams.Copy()
+	params.MaxChainSize = len(body) - decodeBufferSlack - 100
+	if _, err := NewBlockchain("miner", 0, params).DecodeChain(strings.NewReader(body)); err == nil {
+		t.Errorf("accepted a chain larger than MaxChainSize")
+	}
+	params = RegtestParams.Copy()
+	params.MaxChainBlocks = 3
+	params.MaxChainSize = len(body)
+	if _, err := NewBlockchain("miner", 0, params).DecodeChain(strings.NewReader(body)); err != nil {
+		t.Errorf("rejected a chain within the limits: %v", err)
+	}
+}
@@ -0,0 +1,17 @@
+package block
+
+import "errors"
+
+// Transactionを受け付けなかった理由
+var (
+	ErrCoinbaseTransaction  = errors.New("mining reward can not be sent as a transaction")
+	ErrInvalidValue         = errors.New("value must be positive")
+	ErrInvalidOutputs       = errors.New("transaction must have 1 to 500 outputs with a recipient")
+	ErrInvalidLockTime      = errors.New("lock_time must not be negative")
+	ErrMemoTooLarge         = errors.New("memo must be at most 80 bytes")
+	ErrInsufficientFee      = errors.New("fee must be at least 0.001 per memo byte")
+	ErrScriptFailed         = errors.New("spending conditions are not satisfied")
+	ErrInsufficientBalance  = errors.New("not enough balance in a wallet")
+	ErrDuplicateTransaction = errors.New("transaction is already in the pool or the chain")
+	ErrMissingAuthorization = errors.New("transaction has no unlocking script")
+)
@@ -0,0 +1,61 @@
+package block
+
+import "sync"
+
+// Blockchainで起きたイベントの種類
+const (
+	EVENT_BLOCK_CONNECTED    = "block_connected"    // ブロックがチェーンの末尾に追加された
+	EVENT_BLOCK_DISCONNECTED = "block_disconnected" // より長いチェーンに置き換えられてブロックが外された
+	EVENT_TRANSACTION_ADDED  = "transaction_added"  // TransactionがPoolに追加された
+)
+
+// Blockchainで起きたイベント
+// ブロックのイベントはBlockとHeight、TransactionのイベントはTransactionを持つ
+type Event struct {
+	Type        string
+	Height      int
+	Block       *Block
+	Transaction *Transaction
+}
+
+type listeners struct {
+	fns []func(*Event)
+	mux sync.Mutex
+}
+
+// イベントを受け取る関数を登録する
+// 関数はブロックの作成やPoolへの追加を行ったgoroutineから順番に呼ばれるので、
+// 時間のかかる処理やbc.muxを取る処理は別のgoroutineで行うこと（Chainは呼べる）
+func (bc *Blockchain) Subscribe(fn func(*Event)) {
+	bc.listeners.mux.Lock()
+	defer bc.listeners.mux.Unlock()
+	bc.listeners.fns = append(bc.listeners.fns, fn)
+}
+
+func (bc *Blockchain) notify(events ...*Event) {
+	bc.listeners.mux.Lock()
+	fns := bc.listeners.fns
+	bc.listeners.mux.Unlock()
+	for _, e := range events {
+		for _, fn := range fns {
+			fn(e)
+		}
+	}
+}
+
+// チェーンを置き換えた時に外れたブロックと追加されたブロックのイベント
+// 外れたブロックは新しいものから、追加されたブロックは古いものから並べる
+func reorgEvents(oldChain []*Block, newChain []*Block) []*Event {
+	fork := 0
+	for fork < len(oldChain) && fork < len(newChain) && oldChain[fork].Hash() == newChain[fork].Hash() {
+		fork++
+	}
+	events := make([]*Event, 0, len(oldChain)+len(newChain)-2*fork)
+	for h := len(oldChain) - 1; h >= fork; h-- {
+		events = append(events, &Event{Type: EVENT_BLOCK_DISCONNECTED, Height: h, Block: oldChain[h]})
+	}
+	for h := fork; h < len(newChain); h++ {
+		events = append(events, &Event{Type: EVENT_BLOCK_CONNECTED, Height: h, Block: newChain[h]})
+	}
+	return events
+}
@@ -0,0 +1,110 @@
+package block
+
+import (
+	"go-blockchain/logging"
+	"go-blockchain/script"
+	"sort"
+	"time"
+)
+
+const (
+	// lock_timeがこの値未満ならブロックの高さ、以上ならUNIX時間（秒）
+	LOCK_TIME_THRESHOLD = script.LOCK_TIME_THRESHOLD
+	// median-time-pastに使う直前のブロックの数
+	MEDIAN_TIME_SPAN = 11
+	// ブロックのタイムスタンプがこのnodeの時刻より先になってよい幅
+	MAX_FUTURE_BLOCK_TIME = 2 * time.Hour
+)
+
+func (t *Transaction) LockTime() int64 {
+	return t.lockTime
+}
+
+// 高さheight、median-time-pastがmedianTime（UNIX時間のナノ秒）のブロックに取り込めるか
+// 時間のlock_timeはminerが自由に決められるブロックのタイムスタンプではなく、前のブロックの中央値と比べる
+func (t *Transaction) IsFinal(height int, medianTime int64) bool {
+	if t.lockTime == 0 {
+		return true
+	}
+	if t.lockTime < LOCK_TIME_THRESHOLD {
+		return t.lockTime <= int64(height)
+	}
+	return t.lockTime <= medianTime/int64(time.Second)
+}
+
+// chainの次のブロックのmedian-time-past（最後のMEDIAN_TIME_SPAN個のブロックのタイムスタンプの中央値）
+func medianTimePast(chain []*Block) int64 {
+	if n := len(chain); n > MEDIAN_TIME_SPAN {
+		chain = chain[n-MEDIAN_TIME_SPAN:]
+	}
+	timestamps := make([]int64, 0, len(chain))
+	for _, b := range chain {
+		timestamps = append(timestamps, b.timestamp)
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// ブロックのタイムスタンプがmedian-time-pastより後で、このnodeの時刻からMAX_FUTURE_BLOCK_TIME以内か
+func (bc *Blockchain) ValidBlockTimestamp(medianTime int64, b *Block) bool {
+	l := bc.logger.Component(logging.COMPONENT_CHAIN)
+	if b.timestamp <= medianTime {
+		l.Warn("block timestamp is not after the median time past",
+			"timestamp", b.timestamp, "median_time_past", medianTime)
+		return false
+	}
+	if max := time.Now().Add(MAX_FUTURE_BLOCK_TIME).UnixNano(); b.timestamp > max {
+		l.Warn("block timestamp is too far in the future", "timestamp", b.timestamp, "max", max)
+		return false
+	}
+	return true
+}
+
+// OP_CHECKLOCKTIMEVERIFYと比べるlock_time
+// 高さのlock_timeが次のブロックの高さより小さい場合（0を含む）は次のブロックの高さを使う
+func (t *Transaction) effectiveLockTime(nextHeight int) int64 {
+	if t.lockTime < LOCK_TIME_THRESHOLD && t.lockTime < int64(nextHeight) {
+		return int64(nextHeight)
+	}
+	return t.lockTime
+}
+
+// OP_CHECKSEQUENCEVERIFYと比べる、tの支払いに使う資金を受け取ってからのブロック数
+// 受け取った額を古い順に積み上げ、これまでの送金額（Poolの分を含む）を先に使ったものとして差し引き、
+// tの額に届いたブロックから次のブロックの高さheightまでを数える（届かない場合は0）
+// 後から少額を送られても、それより前に受け取った資金で支払える限り経過したブロック数は変わらない
+func (bc *Blockchain) spendAge(t *Transaction, height int) int {
+	sender := t.senderBlockchainAddress
+	confirmed, pending := bc.AddressTransactions(sender)
+	var spent float32 = 0.0
+	for _, ct := range confirmed {
+		if ct.Transaction.senderBlockchainAddress == sender {
+			spent += ct.Transaction.Debit()
+		}
+	}
+	for _, pt := range pending {
+		if pt.senderBlockchainAddress == sender {
+			spent += pt.Debit()
+		}
+	}
+	var received float32 = 0.0
+	for _, ct := range confirmed {
+		received += ct.Transaction.ValueTo(sender)
+		if received-spent >= t.Debit() {
+			return height - ct.Height
+		}
+	}
+	return 0
+}
+
+// 高さheight、median-time-pastがmedianTimeのブロックにlock_timeに達していないTransactionが含まれていないか
+func (bc *Blockchain) ValidBlockLockTimes(height int, medianTime int64, b *Block) bool {
+	for _, t := range b.transactions {
+		if !t.IsFinal(height, medianTime) {
+			bc.logger.Component(logging.COMPONENT_CHAIN).Warn("transaction is not final",
+				"height", height, "lock_time", t.lockTime)
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,94 @@
+package block
+
+import (
+	"testing"
+	"time"
+)
+
+// 少額を送られても、支払いに使う資金を受け取ってからのブロック数は変わらない
+func TestSpendAge(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	add := func(transactions ...*Transaction) {
+		bc.CreateBlock(0, bc.LastBlock().Hash(), transactions)
+	}
+	add(NewTransaction(MINING_SENDER, "A", 10)) // 高さ1
+	add()
+	add()
+	add()
+	add()
+	add(NewTransaction("B", "A", 1)) // 高さ6
+	height := len(bc.chain)          // 次のブロックは高さ7
+
+	tests := []struct {
+		name  string
+		value float32
+		want  int
+	}{
+		{"old funds", 5, 6},
+		{"needs the new payment", 10.5, 1},
+		{"insufficient", 20, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := bc.spendAge(NewTransaction("A", "C", tt.value), height); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// これまでの送金は古い資金から使ったものとする
+	add(NewTransaction("A", "C", 8)) // 高さ7
+	height = len(bc.chain)
+	if got := bc.spendAge(NewTransaction("A", "C", 2), height); got != 7 {
+		t.Errorf("after spending: got %d, want 7", got)
+	}
+	if got := bc.spendAge(NewTransaction("A", "C", 2.5), height); got != 2 {
+		t.Errorf("after spending, needs the new payment: got %d, want 2", got)
+	}
+}
+
+// ブロックのタイムスタンプを前後にずらして時間のlock_timeのTransactionを早く取り込むことはできない
+func TestCheckBlockTimestamp(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	bc.Generate(MEDIAN_TIME_SPAN, "miner")
+	chain := bc.Chain()
+	medianTime := medianTimePast(chain)
+	now := time.Now().UnixNano()
+
+	at := func(timestamp int64, transactions ...*Transaction) []*Block {
+		extended := extendChain(bc, chain, transactions...)
+		extended[len(extended)-1].timestamp = timestamp
+		return extended
+	}
+	// median-time-pastより後、今の時刻より前のlock_time
+	locked := NewTransactionWithLockTime("A", "B", 1, (medianTime+now)/2/int64(time.Second)+1)
+
+	tests := []struct {
+		name  string
+		chain []*Block
+		want  string
+	}{
+		{"now", at(now), ""},
+		{"median time past", at(medianTime), REJECT_TIMESTAMP},
+		{"before the previous blocks", at(chain[1].timestamp), REJECT_TIMESTAMP},
+		{"too far in the future", at(now + int64(MAX_FUTURE_BLOCK_TIME) + int64(time.Minute)), REJECT_TIMESTAMP},
+		{"within the future drift", at(now + int64(time.Hour)), ""},
+		{"forward-dated lock time", at(now+int64(time.Hour), locked), REJECT_LOCK_TIME},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeBlocksReason(t, bc, tt.chain); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	// 時計が戻ってもマイニングしたブロックはmedian-time-pastより後になる
+	for _, b := range bc.chain[1:] {
+		b.timestamp = now + int64(time.Hour)
+	}
+	b := bc.Generate(1, "miner")[0]
+	if b.timestamp <= now+int64(time.Hour) {
+		t.Errorf("mined a block at %d, not after the median time past %d", b.timestamp, now+int64(time.Hour))
+	}
+}
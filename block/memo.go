@@ -0,0 +1,72 @@
+package block
+
+import "math"
+
+const (
+	MAX_MEMO_SIZE     = 80    // Transactionのメモの最大バイト数
+	MEMO_FEE_PER_BYTE = 0.001 // メモ1バイトあたりに必要な手数料
+	// 手数料や残高を比べる際の1あたりの単位数（float32の誤差で最低限の手数料ちょうどが足りなくならないように整数で比べる）
+	FEE_BASE_UNITS = 1000000
+)
+
+// メモのバイト数に応じて必要な最低限の手数料
+func MinimumFee(memo string) float32 {
+	return float32(len(memo)) * MEMO_FEE_PER_BYTE
+}
+
+// 額を最も近い単位数に丸める
+func baseUnits(value float32) int64 {
+	return int64(math.Round(float64(value) * FEE_BASE_UNITS))
+}
+
+// メモのバイト数に応じて必要な最低限の手数料の単位数
+func minimumFeeUnits(memo string) int64 {
+	return int64(len(memo)) * int64(MEMO_FEE_PER_BYTE*FEE_BASE_UNITS)
+}
+
+func (t *Transaction) Memo() string {
+	return t.memo
+}
+
+func (t *Transaction) Fee() float32 {
+	return t.fee
+}
+
+// メモと手数料を設定する
+// 手数料はブロックを作ったminerが受け取る
+func (t *Transaction) WithMemo(memo string, fee float32) *Transaction {
+	t.memo = memo
+	t.fee = fee
+	return t
+}
+
+// 送信者の残高から差し引く額（出力の合計と手数料）
+func (t *Transaction) Debit() float32 {
+	return t.Value() + t.fee
+}
+
+// 送信者の残高から差し引く額の単位数（出力ごとに丸めて足し合わせる）
+func (t *Transaction) debitUnits() int64 {
+	units := baseUnits(t.fee)
+	for _, o := range t.outputs {
+		units += baseUnits(o.Value)
+	}
+	return units
+}
+
+// マイニング報酬以外のTransactionがコンセンサスのルールを満たしているか
+func (t *Transaction) Validate() error {
+	if err := validOutputs(t.outputs); err != nil {
+		return err
+	}
+	if t.lockTime < 0 {
+		return ErrInvalidLockTime
+	}
+	if len(t.memo) > MAX_MEMO_SIZE {
+		return ErrMemoTooLarge
+	}
+	if t.fee < 0 || baseUnits(t.fee) < minimumFeeUnits(t.memo) {
+		return ErrInsufficientFee
+	}
+	return nil
+}
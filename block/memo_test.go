@@ -0,0 +1,31 @@
+package block
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// 最低限の手数料ちょうどはどのメモの長さでも受け付け、それより少ない手数料は拒否する
+func TestMinimumFee(t *testing.T) {
+	for n := 1; n <= MAX_MEMO_SIZE; n++ {
+		memo := strings.Repeat("x", n)
+		// walletと同じく10進数の文字列から読み込んだ手数料
+		exact, _ := strconv.ParseFloat(strconv.FormatFloat(float64(n)*MEMO_FEE_PER_BYTE, 'f', 3, 64), 32)
+		less, _ := strconv.ParseFloat(strconv.FormatFloat(float64(n)*MEMO_FEE_PER_BYTE-0.0005, 'f', 4, 64), 32)
+		tests := []struct {
+			fee  float32
+			want error
+		}{
+			{float32(exact), nil},
+			{MinimumFee(memo), nil},
+			{float32(less), ErrInsufficientFee},
+		}
+		for _, tt := range tests {
+			tx := NewTransaction("A", "B", 1).WithMemo(memo, tt.fee)
+			if err := tx.Validate(); err != tt.want {
+				t.Errorf("memo %d bytes, fee %v: got %v, want %v", n, tt.fee, err, tt.want)
+			}
+		}
+	}
+}
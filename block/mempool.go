@@ -0,0 +1,170 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"go-blockchain/logging"
+	"math"
+)
+
+// hashのTransactionがPoolに溜まっているか（呼び出し側でbc.muxPoolをロックすること）
+func (bc *Blockchain) inPool(h [32]byte) bool {
+	for _, t := range bc.transactionPool {
+		if t.Hash() == h {
+			return true
+		}
+	}
+	return false
+}
+
+// Poolに溜まっているsenderの送金額の合計（呼び出し側でbc.muxPoolをロックすること）
+func (bc *Blockchain) pendingOutgoingAmount(sender string) float32 {
+	var amount float32 = 0.0
+	for _, t := range bc.transactionPool {
+		if t.senderBlockchainAddress == sender {
+			amount += t.Debit()
+		}
+	}
+	return amount
+}
+
+// Poolに溜まっている送金分を差し引いた、新たに送金可能な額（呼び出し側でbc.muxPoolをロックすること）
+func (bc *Blockchain) spendableAmount(sender string) float32 {
+	return bc.chainBalance(sender, 1).Confirmed - bc.pendingOutgoingAmount(sender)
+}
+
+// ブロックに取り込むTransactionをPoolから選び、最後にrewardAddressへのマイニング報酬と手数料のTransactionを加えて返す
+// 他のnodeがブロックを検証するのと同じルールで、Poolの順にsenderの残高を差し引きながら検証し、
+// 無効になったTransactionはPoolから取り除く
+// ブロックのサイズとTransaction数の上限に収まらない分と、lock_timeに達していない分はPoolに残し、次のブロックに回す
+func (bc *Blockchain) SelectTransactions(rewardAddress string) []*Transaction {
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+
+	s := chainStateOf(bc.params, bc.Chain())
+	// 時間のlock_timeは他のnodeの検証と同じく、ブロックのタイムスタンプではなくmedian-time-pastで判定する
+	height, medianTime := s.height(), medianTimePast(s.chain)
+	// マイニング報酬のみのブロックのサイズ（nonceと報酬の額は最大桁数で見積もる）
+	size := NewBlock(math.MaxInt64, [32]byte{},
+		[]*Transaction{NewTransaction(MINING_SENDER, rewardAddress, -math.MaxFloat32)}).Size()
+	var fees float32 = 0.0
+	selected := make([]*Transaction, 0, len(bc.transactionPool))
+	invalid := make([]*Transaction, 0)
+	for _, t := range bc.transactionPool {
+		if len(selected)+1 >= bc.params.MaxBlockTransactions {
+			break
+		}
+		if t.IsCoinbase() || t.Validate() != nil {
+			invalid = append(invalid, t)
+			continue
+		}
+		if !t.IsFinal(height, medianTime) {
+			continue
+		}
+		// Transactionを追加した際に増えるバイト数（区切りのカンマを含む）
+		m, _ := json.Marshal(t)
+		if size+len(m)+1 > bc.params.MaxBlockSize {
+			continue
+		}
+		// チェーンを置き換えた後に既にブロックに取り込まれたTransactionや、残高が足りなくなったTransactionは取り除く
+		if err := s.verifySpend(t, height); err != nil {
+			bc.logger.Component(logging.COMPONENT_MEMPOOL).Info("transaction dropped",
+				"sender", t.senderBlockchainAddress, "debit", t.Debit(), "err", err)
+			invalid = append(invalid, t)
+			continue
+		}
+		size += len(m) + 1
+		fees += t.fee
+		selected = append(selected, t)
+	}
+	bc.removeTransactions(invalid)
+	coinbase := NewTransaction(MINING_SENDER, rewardAddress, bc.params.MiningReward+fees)
+	return append(selected, coinbase)
+}
+
+// ブロックに取り込まれたTransactionをPoolから取り除く
+func (bc *Blockchain) removeFromPool(transactions []*Transaction) {
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	bc.removeTransactions(transactions)
+}
+
+// 他のnodeが作ったブロックに取り込まれたTransactionをPoolから取り除く
+// ブロックのTransactionはJSONから作り直したものなので、同じhashになるTransactionを取り除く
+// 上限やlock_timeで取り込まれなかったTransactionはPoolに残る
+func (bc *Blockchain) removeConfirmed(blocks []*Block) {
+	confirmed := make(map[[32]byte]int)
+	for _, b := range blocks {
+		for _, t := range b.transactions {
+			if t.IsCoinbase() {
+				continue
+			}
+			confirmed[t.Hash()]++
+		}
+	}
+	if len(confirmed) == 0 {
+		return
+	}
+
+	bc.muxPool.Lock()
+	defer bc.muxPool.Unlock()
+	pool := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if h := t.Hash(); confirmed[h] > 0 {
+			confirmed[h]--
+			continue
+		}
+		pool = append(pool, t)
+	}
+	bc.transactionPool = pool
+}
+
+// チェーンを置き換えて外れたブロックのTransactionのうち、新しいチェーンに取り込まれていないものをPoolに戻す
+// ブロックに入っていた承認で新しいチェーンに対して検証し直し、通ったものだけを古い順に戻す
+// 戻したTransactionのイベントを返す（呼び出し側でbc.muxをロックすること）
+func (bc *Blockchain) returnToPool(events []*Event) []*Event {
+	l := bc.logger.Component(logging.COMPONENT_MEMPOOL)
+	added := make([]*Event, 0)
+	// 外れたブロックは新しいものから並んでいる
+	for i := len(events) - 1; i >= 0; i-- {
+		e := events[i]
+		if e.Type != EVENT_BLOCK_DISCONNECTED {
+			continue
+		}
+		for _, t := range e.Block.transactions {
+			if t.IsCoinbase() {
+				continue
+			}
+			auth, err := t.Authorization()
+			if err == nil {
+				err = bc.addTransaction(t, auth)
+			}
+			if err != nil {
+				if !errors.Is(err, ErrDuplicateTransaction) {
+					l.Info("disconnected transaction dropped", "sender", t.senderBlockchainAddress, "err", err)
+				}
+				continue
+			}
+			added = append(added, &Event{Type: EVENT_TRANSACTION_ADDED, Transaction: t})
+		}
+	}
+	return added
+}
+
+// 呼び出し側でbc.muxPoolをロックすること
+func (bc *Blockchain) removeTransactions(transactions []*Transaction) {
+	if len(transactions) == 0 {
+		return
+	}
+	removed := make(map[*Transaction]bool, len(transactions))
+	for _, t := range transactions {
+		removed[t] = true
+	}
+	pool := make([]*Transaction, 0, len(bc.transactionPool))
+	for _, t := range bc.transactionPool {
+		if !removed[t] {
+			pool = append(pool, t)
+		}
+	}
+	bc.transactionPool = pool
+}
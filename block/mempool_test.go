@@ -0,0 +1,133 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"go-blockchain/wallet"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// 他のnodeのブロックに取り込まれたTransactionだけがPoolから取り除かれる
+func TestRemoveConfirmed(t *testing.T) {
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	included := NewTransaction("A", "B", 1)
+	left := NewTransaction("A", "C", 2)
+	bc.transactionPool = []*Transaction{included, left}
+
+	// 他のnodeから受け取ったブロックのTransactionはJSONから作り直したもの
+	m, err := json.Marshal(included)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded Transaction
+	if err := json.Unmarshal(m, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBlock(0, [32]byte{}, []*Transaction{&decoded, NewTransaction(MINING_SENDER, "miner", 1)})
+	bc.removeConfirmed([]*Block{b})
+
+	pool := bc.TransactionPool()
+	if len(pool) != 1 || pool[0] != left {
+		t.Fatalf("pool = %v, want only the transaction not in the block", pool)
+	}
+}
+
+// wの鍵で署名したTransactionとその承認
+func signedTransaction(t *testing.T, w *wallet.Wallet, recipient string, value float32) (*Transaction, Authorization) {
+	t.Helper()
+	s, err := wallet.NewTransaction(w.PrivateKey(), w.BlockchainAddress(), recipient, value).GenerateSignature()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewTransaction(w.BlockchainAddress(), recipient, value), NewSignatureAuthorization(w.PublicKey(), s)
+}
+
+// 使用可能なマイニング報酬をwに持たせたブロックチェーン
+func fundedBlockchain(t *testing.T, w *wallet.Wallet) *Blockchain {
+	t.Helper()
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	bc.Generate(1, w.BlockchainAddress())
+	bc.Generate(RegtestParams.CoinbaseMaturity, "miner")
+	return bc
+}
+
+// 同じ署名付きのTransactionはPoolにあってもブロックに取り込まれた後でも受け付けない
+func TestDuplicateTransaction(t *testing.T) {
+	w := wallet.NewWallet()
+	bc := fundedBlockchain(t, w)
+
+	tx, auth := signedTransaction(t, w, "B", 0.1)
+	if err := bc.AddTransaction(tx, auth); err != nil {
+		t.Fatal(err)
+	}
+	again, auth := signedTransaction(t, w, "B", 0.1)
+	if err := bc.AddTransaction(again, auth); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Fatalf("in the pool: got %v, want ErrDuplicateTransaction", err)
+	}
+
+	bc.Generate(1, "miner")
+	if n := len(bc.TransactionPool()); n != 0 {
+		t.Fatalf("pool has %d transactions after mining", n)
+	}
+	replay, auth := signedTransaction(t, w, "B", 0.1)
+	if err := bc.AddTransaction(replay, auth); !errors.Is(err, ErrDuplicateTransaction) {
+		t.Errorf("after mining: got %v, want ErrDuplicateTransaction", err)
+	}
+
+	// 内容が違えば同じ受取人と金額でも送れる
+	other, auth := signedTransaction(t, w, "B", 0.2)
+	if err := bc.AddTransaction(other, auth); err != nil {
+		t.Errorf("different transaction: %v", err)
+	}
+}
+
+// チェーンの置き換えで外れたブロックのTransactionはPoolに戻る
+func TestReorgReturnsTransactions(t *testing.T) {
+	w := wallet.NewWallet()
+	bc := fundedBlockchain(t, w)
+	fork := bc.Chain()
+	tx, auth := signedTransaction(t, w, "B", 0.1)
+	if err := bc.AddTransaction(tx, auth); err != nil {
+		t.Fatal(err)
+	}
+	bc.Generate(1, "miner")
+	if n := len(bc.TransactionPool()); n != 0 {
+		t.Fatalf("pool has %d transactions after mining", n)
+	}
+
+	// Transactionを含まない、より長いチェーン
+	chain := extendChain(bc, extendChain(bc, fork))
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(&struct {
+			Chain []*Block `json:"chain"`
+		}{chain})
+	}))
+	defer peer.Close()
+	if err := bc.AddNeighbor(strings.TrimPrefix(peer.URL, "http://")); err != nil {
+		t.Fatal(err)
+	}
+	var added []*Event
+	bc.Subscribe(func(e *Event) {
+		if e.Type == EVENT_TRANSACTION_ADDED {
+			added = append(added, e)
+		}
+	})
+	if !bc.ResolveConflicts() {
+		t.Fatal("chain not replaced")
+	}
+
+	pool := bc.TransactionPool()
+	if len(pool) != 1 || pool[0].Hash() != tx.Hash() {
+		t.Fatalf("pool = %v, want the disconnected transaction", pool)
+	}
+	if len(added) != 1 {
+		t.Errorf("got %d transaction_added events, want 1", len(added))
+	}
+	// 戻したTransactionは次のブロックに取り込まれる
+	if b := bc.Generate(1, "miner")[0]; len(b.Transactions()) != 2 {
+		t.Errorf("block has %d transactions, want the returned one and the reward", len(b.Transactions()))
+	}
+}
@@ -0,0 +1,194 @@
+package block
+
+import (
+	"errors"
+	"fmt"
+	"go-blockchain/metrics"
+	"math"
+	"time"
+)
+
+// ブロックを受け付けなかった理由（メトリクスのラベル）
+const (
+	REJECT_GENESIS               = "genesis" // ジェネシスブロックがこのnodeのものと異なる
+	REJECT_PREVIOUS_HASH         = "previous_hash"
+	REJECT_PROOF_OF_WORK         = "proof_of_work"
+	REJECT_TOO_MANY_TRANSACTIONS = "too_many_transactions"
+	REJECT_BLOCK_SIZE            = "block_size"
+	REJECT_INVALID_TRANSACTION   = "invalid_transaction"
+	REJECT_TIMESTAMP             = "timestamp" // 直前のブロックの中央値以前、またはこのnodeの時刻より先すぎる
+	REJECT_LOCK_TIME             = "lock_time"
+	REJECT_SCRIPT                = "script"                // unlocking scriptがない、または送信者のlocking scriptを解除できない
+	REJECT_BALANCE               = "balance"               // 送信者の残高を超えて送っている
+	REJECT_DUPLICATE_TRANSACTION = "duplicate_transaction" // 既にチェーンに取り込まれたTransactionを含む
+	REJECT_COINBASE              = "coinbase"              // マイニング報酬のTransactionが1つでない、報酬と手数料の合計を超えているなど
+	REJECT_DECODE                = "decode"                // JSONとして読み込めない、サイズの上限を超えたなど
+)
+
+// ブロックを受け付けた経路（メトリクスのラベル）
+const (
+	SOURCE_MINED = "mined" // このnodeでマイニングした
+	SOURCE_PEER  = "peer"  // コンセンサスで他のnodeのチェーンに置き換えた
+)
+
+// ハッシュレートの推定に使う直近のブロックの数
+const HASH_RATE_WINDOW = 10
+
+// Transactionを受け付けなかった理由のラベル
+var transactionRejectReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrCoinbaseTransaction, "coinbase"},
+	{ErrInvalidValue, "invalid_value"},
+	{ErrInvalidOutputs, "invalid_outputs"},
+	{ErrInvalidLockTime, "invalid_lock_time"},
+	{ErrMemoTooLarge, "memo_too_large"},
+	{ErrInsufficientFee, "insufficient_fee"},
+	{ErrScriptFailed, "script_failed"},
+	{ErrInsufficientBalance, "insufficient_balance"},
+	{ErrDuplicateTransaction, "duplicate"},
+}
+
+// ブロックのTransactionを受け付けなかった理由のラベル
+func spendRejectReason(err error) string {
+	switch {
+	case errors.Is(err, ErrDuplicateTransaction):
+		return REJECT_DUPLICATE_TRANSACTION
+	case errors.Is(err, ErrInsufficientBalance):
+		return REJECT_BALANCE
+	}
+	return REJECT_SCRIPT
+}
+
+func transactionRejectReason(err error) string {
+	for _, r := range transactionRejectReasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+	return "other"
+}
+
+// 不正なブロックの高さと理由
+type BlockError struct {
+	Height int
+	Reason string
+}
+
+func (e *BlockError) Error() string {
+	return fmt.Sprintf("invalid block at height %d (%s)", e.Height, e.Reason)
+}
+
+func blockRejectReason(err error) string {
+	var be *BlockError
+	if errors.As(err, &be) {
+		return be.Reason
+	}
+	return REJECT_DECODE
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Blockchainの処理の集計
+// RegisterMetricsを呼ぶまではどこにも公開しない
+type chainMetrics struct {
+	blocksAccepted       *metrics.CounterVec
+	blocksRejected       *metrics.CounterVec
+	transactionsAccepted *metrics.Value
+	transactionsRejected *metrics.CounterVec
+	reorgs               *metrics.Value
+	reorgDepth           *metrics.Histogram
+	hashes               *metrics.Value
+}
+
+func newChainMetrics(r *metrics.Registry) *chainMetrics {
+	return &chainMetrics{
+		blocksAccepted: r.NewCounterVec("blockchain_blocks_accepted_total",
+			"Blocks added to the chain, by source (mined or peer)", "source"),
+		blocksRejected: r.NewCounterVec("blockchain_blocks_rejected_total",
+			"Blocks received from peers that failed validation, by reason", "reason"),
+		transactionsAccepted: r.NewCounter("blockchain_transactions_accepted_total",
+			"Transactions added to the mempool"),
+		transactionsRejected: r.NewCounterVec("blockchain_transactions_rejected_total",
+			"Transactions refused by the mempool, by reason", "reason"),
+		reorgs: r.NewCounter("blockchain_reorgs_total",
+			"Chain replacements that disconnected at least one block"),
+		reorgDepth: r.NewHistogram("blockchain_reorg_depth",
+			"Number of blocks disconnected by a chain replacement", []float64{1, 2, 3, 5, 10, 20, 50, 100}),
+		hashes: r.NewCounter("blockchain_pow_hashes_total",
+			"Proof of work hashes computed by this node"),
+	}
+}
+
+// チェーンを置き換えた時に外れたブロックと追加されたブロックを数える（外れたブロックの数を返す）
+func (m *chainMetrics) chainReplaced(events []*Event) int {
+	disconnected := 0
+	for _, e := range events {
+		switch e.Type {
+		case EVENT_BLOCK_DISCONNECTED:
+			disconnected++
+		case EVENT_BLOCK_CONNECTED:
+			m.blocksAccepted.WithLabelValues(SOURCE_PEER).Inc()
+		}
+	}
+	if disconnected > 0 {
+		m.reorgs.Inc()
+		m.reorgDepth.Observe(float64(disconnected))
+	}
+	return disconnected
+}
+
+// Blockchainのメトリクスをrに登録する
+// 登録する前の集計は捨てる
+func (bc *Blockchain) RegisterMetrics(r *metrics.Registry) {
+	bc.metrics = newChainMetrics(r)
+	r.NewGaugeFunc("blockchain_height", "Height of the tip of the chain", func() float64 {
+		return float64(len(bc.Chain()) - 1)
+	})
+	r.NewGaugeFunc("blockchain_tip_age_seconds", "Seconds since the tip block was created", func() float64 {
+		return time.Since(time.Unix(0, bc.LastBlock().Timestamp())).Seconds()
+	})
+	r.NewGaugeFunc("blockchain_difficulty", "Number of leading zero hex digits required by proof of work", func() float64 {
+		return float64(bc.params.MiningDifficulty)
+	})
+	r.NewGaugeFunc("blockchain_network_hash_rate", "Hashes per second estimated from the difficulty and recent block times",
+		bc.NetworkHashRate)
+	r.NewGaugeFunc("blockchain_mempool_transactions", "Transactions in the mempool", func() float64 {
+		return float64(len(bc.TransactionPool()))
+	})
+	r.NewGaugeFunc("blockchain_mempool_bytes", "Total JSON size of the transactions in the mempool", func() float64 {
+		size := 0
+		for _, t := range bc.TransactionPool() {
+			m, _ := t.MarshalJSON()
+			size += len(m)
+		}
+		return float64(size)
+	})
+	r.NewGaugeFunc("blockchain_peers", "Number of neighbors", func() float64 {
+		return float64(len(bc.Neighbors()))
+	})
+	r.NewGaugeFunc("blockchain_mining", "1 if automatic mining is running", func() float64 {
+		if bc.IsMining() {
+			return 1
+		}
+		return 0
+	})
+}
+
+// 直近のブロックの間隔とdifficultyから推定したハッシュレート（1ブロックあたり16^difficulty回のハッシュを期待値とする）
+func (bc *Blockchain) NetworkHashRate() float64 {
+	chain := bc.Chain()
+	n := len(chain) - 1
+	if n > HASH_RATE_WINDOW {
+		n = HASH_RATE_WINDOW
+	}
+	if n < 1 {
+		return 0
+	}
+	tip := chain[len(chain)-1]
+	span := time.Duration(tip.Timestamp() - chain[len(chain)-1-n].Timestamp()).Seconds()
+	if span <= 0 {
+		return 0
+	}
+	return float64(n) * math.Pow(16, float64(bc.params.MiningDifficulty)) / span
+}
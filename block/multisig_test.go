@@ -0,0 +1,93 @@
+package block
+
+import (
+	"encoding/json"
+	"errors"
+	"go-blockchain/keys"
+	"go-blockchain/multisig"
+	"go-blockchain/wallet"
+	"testing"
+)
+
+// 署名者の間でJSONで受け渡すのと同じように読み込み直す
+func passAround(t *testing.T, pt *wallet.PartiallySignedTransaction) *wallet.PartiallySignedTransaction {
+	t.Helper()
+	m, err := json.Marshal(pt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var received wallet.PartiallySignedTransaction
+	if err := json.Unmarshal(m, &received); err != nil {
+		t.Fatal(err)
+	}
+	return &received
+}
+
+// 2-of-3のマルチシグのアドレスから、作成、署名、閾値に達した署名での送金までの流れ
+func TestMultisigFlow(t *testing.T) {
+	cosigners := []*wallet.Wallet{wallet.NewWallet(), wallet.NewWallet(), wallet.NewWallet()}
+	publicKeys := make([]keys.PublicKey, len(cosigners))
+	for i, w := range cosigners {
+		publicKeys[i] = w.PublicKey()
+	}
+	redeemScript, err := multisig.New(2, publicKeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := NewBlockchain("miner", 0, RegtestParams)
+	bc.Generate(1, redeemScript.Address())
+	bc.Generate(RegtestParams.CoinbaseMaturity, "miner")
+
+	outputs := []*wallet.Output{wallet.NewOutput("B", 0.5)}
+	pt := wallet.NewPartiallySignedTransaction(redeemScript, outputs, "", 0, 0)
+	tx := NewTransaction(redeemScript.Address(), "B", 0.5)
+	if err := pt.Sign(wallet.NewWallet()); err != wallet.ErrNotCosigner {
+		t.Errorf("outsider: got %v, want ErrNotCosigner", err)
+	}
+
+	pt = passAround(t, pt)
+	if err := pt.Sign(cosigners[2]); err != nil {
+		t.Fatal(err)
+	}
+	// 閾値より1つ少ない署名ではまとめられず、nodeに送ってもscriptの検証を通らない
+	if _, _, err := pt.FinalSignatures(); err != wallet.ErrIncompleteTransaction {
+		t.Errorf("1 of 2 signatures: got %v, want ErrIncompleteTransaction", err)
+	}
+	// redeem scriptの公開鍵は辞書順に並ぶので、署名の位置は公開鍵から探す
+	s, err := keys.ParseSignatureString(redeemScript.Scheme(), *pt.Signatures[redeemScript.IndexOf(cosigners[2].PublicKey())])
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = bc.AddTransaction(tx, NewMultisigAuthorization(redeemScript, []*keys.Signature{s}))
+	if !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("1 of 2 signatures: got %v, want ErrScriptFailed", err)
+	}
+	// 同じ署名を2回並べても閾値には達しない
+	err = bc.AddTransaction(tx, NewMultisigAuthorization(redeemScript, []*keys.Signature{s, s}))
+	if !errors.Is(err, ErrScriptFailed) {
+		t.Errorf("repeated signature: got %v, want ErrScriptFailed", err)
+	}
+
+	pt = passAround(t, pt)
+	if err := pt.Sign(cosigners[0]); err != nil {
+		t.Fatal(err)
+	}
+	if pt.SignatureCount() != 2 {
+		t.Fatalf("got %d signatures, want 2", pt.SignatureCount())
+	}
+	finalScript, signatures, err := pt.FinalSignatures()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := bc.AddTransaction(tx, NewMultisigAuthorization(finalScript, signatures)); err != nil {
+		t.Fatalf("2 of 2 signatures: %v", err)
+	}
+	// ブロックに取り込んだ後も他のnodeの検証を通る
+	bc.Generate(1, "miner")
+	if got := bc.CalculateTotalAmount("B"); got != 0.5 {
+		t.Errorf("recipient balance = %v, want 0.5", got)
+	}
+	if got := decodeBlocksReason(t, NewBlockchain("other", 0, RegtestParams), bc.Chain()); got != "" {
+		t.Errorf("chain rejected: %q", got)
+	}
+}
@@ -0,0 +1,60 @@
+package block
+
+// 1つのTransactionに含められる出力の最大数
+// Transactionのリクエストボディの最大バイト数に収まる数にする
+const MAX_TRANSACTION_OUTPUTS = 500
+
+// Transactionの出力（受取人と金額）
+type Output struct {
+	RecipientBlockchainAddress string  `json:"recipient_blockchain_address"`
+	Value                      float32 `json:"value"`
+}
+
+func NewOutput(recipient string, value float32) *Output {
+	return &Output{RecipientBlockchainAddress: recipient, Value: value}
+}
+
+// 出力の数と、各出力の受取人と金額が正しいか
+func validOutputs(outputs []*Output) error {
+	if len(outputs) == 0 || len(outputs) > MAX_TRANSACTION_OUTPUTS {
+		return ErrInvalidOutputs
+	}
+	for _, o := range outputs {
+		if o == nil || o.RecipientBlockchainAddress == "" {
+			return ErrInvalidOutputs
+		}
+		if o.Value <= 0 {
+			return ErrInvalidValue
+		}
+	}
+	return nil
+}
+
+func (t *Transaction) Outputs() []*Output {
+	return t.outputs
+}
+
+// 出力の合計（送信者の残高から差し引く額）
+func (t *Transaction) Value() float32 {
+	var value float32 = 0.0
+	for _, o := range t.outputs {
+		value += o.Value
+	}
+	return value
+}
+
+// blockchainAddressが受け取る額の合計
+func (t *Transaction) ValueTo(blockchainAddress string) float32 {
+	var value float32 = 0.0
+	for _, o := range t.outputs {
+		if o.RecipientBlockchainAddress == blockchainAddress {
+			value += o.Value
+		}
+	}
+	return value
+}
+
+// blockchainAddressが送信者か受取人になっているか
+func (t *Transaction) Involves(blockchainAddress string) bool {
+	return t.senderBlockchainAddress == blockchainAddress || t.ValueTo(blockchainAddress) > 0
+}
@@ -0,0 +1,73 @@
+package block
+
+import "time"
+
+const (
+	REGTEST_MINING_DIFFICULTY = 1
+
+	// readyと判定する最後のブロックの古さと、neighborの最も高いブロックからの遅れの上限
+	MAX_TIP_AGE       = 10 * MINING_TIMER_SEC * time.Second
+	MAX_BLOCKS_BEHIND = 2
+)
+
+// ブロックチェーンネットワークごとの動作パラメータ
+type Params struct {
+	Name                 string
+	MiningDifficulty     int
+	MiningReward         float32
+	CoinbaseMaturity     int  // マイニング報酬が使用可能になるまでに必要な承認数
+	MaxBlockSize         int  // JSONにした際のブロックの最大バイト数
+	MaxBlockTransactions int  // 1ブロックに含められるTransactionの最大数（マイニング報酬を含む）
+	MaxChainBlocks       int  // peerから受け取るチェーンのブロック数の上限
+	MaxChainSize         int  // peerから受け取るチェーンのJSONの合計バイト数の上限
+	AutoMining           bool // MINING_TIMER_SECごとに自動でマイニングするか
+	DiscoverNeighbors    bool // ポートスキャンでneighborを探索するか
+	// 最後のブロックがこれより古い場合はreadyにしない（0の場合は確認しない）
+	MaxTipAge time.Duration
+	// neighborの最も高いブロックからこれより多く遅れている場合はreadyにしない
+	MaxBlocksBehind int
+}
+
+// 通常のネットワーク
+var MainParams = &Params{
+	Name:                 "main",
+	MiningDifficulty:     MINING_DIFFICULTY,
+	MiningReward:         MINING_REWARD,
+	CoinbaseMaturity:     COINBASE_MATURITY,
+	MaxBlockSize:         MAX_BLOCK_SIZE,
+	MaxBlockTransactions: MAX_BLOCK_TRANSACTIONS,
+	MaxChainBlocks:       MAX_CHAIN_BLOCKS,
+	MaxChainSize:         MAX_CHAIN_SIZE,
+	AutoMining:           true,
+	DiscoverNeighbors:    true,
+	MaxTipAge:            MAX_TIP_AGE,
+	MaxBlocksBehind:      MAX_BLOCKS_BEHIND,
+}
+
+// 結合テスト用のネットワーク
+// difficultyを下げ、自動マイニングとneighborの探索を行わない
+// ブロックは必要な時にだけ生成するので最後のブロックの古さは確認せず、neighborと同じ高さになるまでreadyにしない
+var RegtestParams = &Params{
+	Name:                 "regtest",
+	MiningDifficulty:     REGTEST_MINING_DIFFICULTY,
+	MiningReward:         MINING_REWARD,
+	CoinbaseMaturity:     COINBASE_MATURITY,
+	MaxBlockSize:         MAX_BLOCK_SIZE,
+	MaxBlockTransactions: MAX_BLOCK_TRANSACTIONS,
+	MaxChainBlocks:       MAX_CHAIN_BLOCKS,
+	MaxChainSize:         MAX_CHAIN_SIZE,
+	AutoMining:           false,
+	DiscoverNeighbors:    false,
+	MaxTipAge:            0,
+	MaxBlocksBehind:      0,
+}
+
+func (p *Params) IsRegtest() bool {
+	return p.Name == RegtestParams.Name
+}
+
+// パラメータをコピーして返す（フラグなどで一部の値を上書きする場合に使用）
+func (p *Params) Copy() *Params {
+	c := *p
+	return &c
+}
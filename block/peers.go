@@ -0,0 +1,73 @@
+package block
+
+import (
+	"errors"
+	"net"
+	"sort"
+)
+
+var ErrBannedPeer = errors.New("peer is banned")
+
+// neighborをBanする
+// neighborから外し、ポートスキャンで見つかっても手動でも追加しない（Transactionやブロックの伝播もしない）
+func (bc *Blockchain) Ban(address string) {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	if bc.banned == nil {
+		bc.banned = make(map[string]bool)
+	}
+	bc.banned[address] = true
+
+	neighbors := make([]string, 0, len(bc.neighbors))
+	for _, n := range bc.neighbors {
+		if n != address {
+			neighbors = append(neighbors, n)
+		}
+	}
+	bc.neighbors = neighbors
+}
+
+// neighborから取得して検証できたチェーンの高さを記録する
+func (bc *Blockchain) setVerifiedHeight(peer string, height int) {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	if bc.verifiedHeights == nil {
+		bc.verifiedHeights = make(map[string]int)
+	}
+	bc.verifiedHeights[peer] = height
+}
+
+// 最後にResolveConflictsでneighborから取得したチェーンのうち、検証できた最も高いブロックの高さ
+// まだ取得していない場合（取得に失敗し続けている場合を含む）はfalseを返す
+func (bc *Blockchain) VerifiedPeerHeight(peer string) (int, bool) {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	height, ok := bc.verifiedHeights[peer]
+	return height, ok
+}
+
+// Banしたneighborの一覧
+func (bc *Blockchain) Banned() []string {
+	bc.muxNeighbors.Lock()
+	defer bc.muxNeighbors.Unlock()
+	banned := make([]string, 0, len(bc.banned))
+	for n := range bc.banned {
+		banned = append(banned, n)
+	}
+	sort.Strings(banned)
+	return banned
+}
+
+// 管理APIから送られるneighborの追加とBanのリクエスト
+type PeerRequest struct {
+	Address *string `json:"address"`
+}
+
+// addressはhost:portの形式
+func (pr *PeerRequest) Validate() bool {
+	if pr.Address == nil {
+		return false
+	}
+	host, port, err := net.SplitHostPort(*pr.Address)
+	return err == nil && host != "" && port != ""
+}
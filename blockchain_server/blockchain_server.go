@@ -1,239 +0,0 @@
-package main
-
-import (
-	"encoding/json"
-	"go-blockchain/block"
-	"go-blockchain/utils"
-	"go-blockchain/wallet"
-	"io"
-	"log"
-	"net/http"
-	"strconv"
-)
-
-// 一度作ったブロックチェーンをcacheに格納
-var cache map[string]*block.Blockchain = make(map[string]*block.Blockchain)
-
-type BlockchainServer struct {
-	port uint16
-}
-
-// ブロックチェーンサーバーの作成
-func NewBlockchainServer(port uint16) *BlockchainServer {
-	return &BlockchainServer{port}
-}
-
-// ブロックチェーンサーバーのポートを返す
-func (bcs *BlockchainServer) Port() uint16 {
-	return bcs.port
-}
-
-// create済みのブロックチェーンをcacheから取得
-func (bcs *BlockchainServer) GetBlockchain() *block.Blockchain {
-	// cacheからブロックチェーンを取得
-	bc, ok := cache["blockchain"]
-
-	// cahceに存在しない場合
-	if !ok {
-		// 1:Minerをブロックチェーンに登録
-		minersWallet := wallet.NewWallet()
-		bc = block.NewBlockchain(minersWallet.BlockchainAddress(), bcs.Port())
-		cache["blockchain"] = bc
-
-		// デバッグ
-		log.Printf("private_key %v", minersWallet.PrivateKeyStr())
-		log.Printf("public_key %v", minersWallet.PublicKeyStr())
-		log.Printf("blockchain_address %v", minersWallet.BlockchainAddress())
-	}
-	return bc
-}
-
-// Blockchainを取得し表示するハンドル
-func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodGet:
-		w.Header().Add("Content-Type", "application/json")
-		bc := bcs.GetBlockchain()
-		m, _ := bc.MarshalJSON()
-		io.WriteString(w, string(m[:]))
-	default:
-		log.Printf("ERROR: Invalid HTTP Method")
-	}
-}
-
-// Transactionを取得したり、受信したりするハンドル
-func (bcs *BlockchainServer) Transactions(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodGet:
-		w.Header().Add("Content-Type", "application/json")
-		bc := bcs.GetBlockchain()
-		transactions := bc.TransactionPool()
-		m, _ := json.Marshal(struct {
-			Transactions []*block.Transaction `json:"transactions"`
-			Length       int                  `json:"length"`
-		}{
-			Transactions: transactions,
-			Length:       len(transactions),
-		})
-		io.WriteString(w, string(m[:]))
-
-	case http.MethodPost:
-		// 受け取ったJsonを構造体に格納する処理
-		var t block.TransactionRequest
-		decoder := json.NewDecoder(req.Body)
-		err := decoder.Decode(&t)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		// Transactionのエラーハンドリング
-		if !t.Validate() {
-			log.Println("ERROR: missing validation")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
-		bc := bcs.GetBlockchain()
-		isCreated := bc.CreateTransaction(*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress, *t.Value, publicKey, signature)
-
-		w.Header().Add("Content-Type", "application/json")
-		var m []byte
-		if !isCreated {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			w.WriteHeader(http.StatusCreated)
-			m = utils.JsonStatus("success")
-		}
-		io.WriteString(w, string(m))
-	case http.MethodPut:
-		decoder := json.NewDecoder(req.Body)
-		var t block.TransactionRequest
-		err := decoder.Decode(&t)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		signature := utils.SignatureFromString(*t.Signature)
-		bc := bcs.GetBlockchain()
-		isUpdated := bc.AddTransaction(*t.SenderBlockchainAddress,
-			*t.RecipientBlockchainAddress, *t.Value, publicKey, signature)
-		w.Header().Add("Content-Type", "application/json")
-		var m []byte
-		if !isUpdated {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			m = utils.JsonStatus("success")
-		}
-		io.WriteString(w, string(m))
-
-	case http.MethodDelete:
-		bc := bcs.GetBlockchain()
-		bc.ClearTransactionPool()
-		io.WriteString(w, string(utils.JsonStatus("success")))
-	default:
-		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
-	}
-}
-
-// マイニングAPIサーバー
-func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodGet:
-		bc := bcs.GetBlockchain()
-		isMined := bc.Mining()
-
-		var m []byte
-		// マイニングが成功したか失敗したかの判定
-		if !isMined {
-			w.WriteHeader(http.StatusBadRequest)
-			m = utils.JsonStatus("fail")
-		} else {
-			m = utils.JsonStatus("success")
-		}
-		w.Header().Add("Content-Type", "application/json")
-		io.WriteString(w, string(m))
-
-	default:
-		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
-	}
-}
-
-// マイニング処理を自動化するAPI
-func (bcs *BlockchainServer) StartMine(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodGet:
-		bc := bcs.GetBlockchain()
-		bc.StartMining()
-
-		m := utils.JsonStatus("success")
-		w.Header().Add("Content-Type", "application/json")
-		io.WriteString(w, string(m))
-
-	default:
-		log.Println("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
-	}
-}
-
-// 仮想通貨の合計値を返すAPI
-func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodGet:
-		blockchainAddress := req.URL.Query().Get("blockchain_address")
-		amount := bcs.GetBlockchain().CalculateTotalAmount(blockchainAddress)
-
-		ar := &block.AmountResponse{Amount: amount}
-		m, _ := ar.MarshalJSON()
-
-		w.Header().Add("Content-Type", "application/json")
-		io.WriteString(w, string(m[:]))
-
-	default:
-		log.Printf("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
-	}
-}
-
-func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodPut:
-		bc := bcs.GetBlockchain()
-		replaced := bc.ResolveConflicts()
-
-		w.Header().Add("Content-Type", "application/json")
-		if replaced {
-			io.WriteString(w, string(utils.JsonStatus("success")))
-		} else {
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-		}
-	default:
-		log.Printf("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
-	}
-}
-
-// サーバーの立ち上げ
-func (bcs *BlockchainServer) Run() {
-	bcs.GetBlockchain().Run()
-	http.HandleFunc("/", bcs.GetChain)
-	http.HandleFunc("/transactions", bcs.Transactions)
-	http.HandleFunc("/mine", bcs.Mine)
-	http.HandleFunc("/mine/start", bcs.StartMine)
-	http.HandleFunc("/amount", bcs.Amount)
-	http.HandleFunc("/consensus", bcs.Consensus)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(bcs.Port())), nil))
-}
@@ -2,17 +2,73 @@ package main
 
 import (
 	"flag"
-	"log"
+	"fmt"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"go-blockchain/node"
+	"go-blockchain/webhook"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
-func init() {
-	log.SetPrefix("Blockchain: ")
-}
+// 管理APIのトークンを渡す環境変数
+const ADMIN_TOKEN_ENV = "BLOCKCHAIN_ADMIN_TOKEN"
 
 func main() {
 	// コマンドライン引数でportを指定
 	port := flag.Uint("port", 5001, "TCP Port Number for Blockchain Server")
+	regtest := flag.Bool("regtest", false, "Run in regtest mode (trivial difficulty, no auto mining, no neighbor scanning)")
+	coinbaseMaturity := flag.Int("coinbase-maturity", -1, "Confirmations required before mining rewards can be spent (default: network setting)")
+	minerAddress := flag.String("miner-address", "",
+		"Address to receive mining rewards (default: a new key that is not stored, so the rewards cannot be spent)")
+	adminToken := flag.String("admin-token", "",
+		"Token required by the admin API and mining endpoints (default: $"+ADMIN_TOKEN_ENV+", empty restricts them to localhost)")
+	webhookDir := flag.String("webhook-dir", "",
+		"Directory to store webhooks and their delivery queue in <dir>/<port> (default: webhooks disabled)")
+	webhookAllowPrivate := flag.Bool("webhook-allow-private", false,
+		"Allow webhooks to loopback, link-local and private addresses (for receivers on the same host or LAN)")
+	maxTipAge := flag.Int("ready-max-tip-age-sec", -1,
+		"Seconds since the last block after which /readyz fails (default: network setting, 0 disables the check)")
+	maxBlocksBehind := flag.Int("ready-max-blocks-behind", -1,
+		"Blocks behind the best neighbor allowed by /readyz (default: network setting)")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error (can be changed through the admin API)")
+	logFormat := flag.String("log-format", logging.FORMAT_LOGFMT, "Log format: logfmt or json")
 	flag.Parse()
-	app := NewBlockchainServer(uint16(*port))
+	if err := logging.Configure(*logLevel, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if *adminToken == "" {
+		*adminToken = os.Getenv(ADMIN_TOKEN_ENV)
+	}
+
+	params := block.MainParams.Copy()
+	if *regtest {
+		params = block.RegtestParams.Copy()
+	}
+	if *coinbaseMaturity >= 0 {
+		params.CoinbaseMaturity = *coinbaseMaturity
+	}
+	if *maxTipAge >= 0 {
+		params.MaxTipAge = time.Duration(*maxTipAge) * time.Second
+	}
+	if *maxBlocksBehind >= 0 {
+		params.MaxBlocksBehind = *maxBlocksBehind
+	}
+	app := node.NewBlockchainServer(uint16(*port), params)
+	app.SetAdminToken(*adminToken)
+	app.SetMinerAddress(*minerAddress)
+	if *webhookDir != "" {
+		// 同じディレクトリで複数のnodeを立ち上げられるようにportごとに分ける
+		d, err := webhook.Open(filepath.Join(*webhookDir, strconv.Itoa(int(*port))))
+		if err != nil {
+			logging.New("port", *port, "component", logging.COMPONENT_WEBHOOK).Error("failed to open webhooks", "err", err)
+			os.Exit(1)
+		}
+		d.SetAllowPrivateTargets(*webhookAllowPrivate)
+		app.SetWebhooks(d)
+	}
 	app.Run()
 }
@@ -0,0 +1,405 @@
+// ブロックチェーンサーバー（node）の管理用のコマンドラインツール
+// nodeの管理APIを叩き、結果をtextかJSON（-json）で表示する
+//
+//	blockchain-cli [-node <url>] [-token <token>] [-json] <command> [args]
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/node"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const (
+	// 管理APIのトークンを渡す環境変数（blockchain_serverの-admin-tokenと同じ）
+	ADMIN_TOKEN_ENV = "BLOCKCHAIN_ADMIN_TOKEN"
+	// generateはProof of Workを行うので長めに待つ
+	NODE_TIMEOUT = 5 * time.Minute
+)
+
+type command struct {
+	name    string
+	args    string
+	summary string
+	run     func(c *client, args []string) error
+}
+
+var commands = []*command{
+	{"getinfo", "", "Show the state of the node", getInfo},
+	{"getblock", "<height|hash>", "Show a block", getBlock},
+	{"getmempool", "", "List transactions in the pool", getMempool},
+	{"getpeers", "", "List neighbors and banned neighbors", getPeers},
+	{"addpeer", "<host:port>", "Add a neighbor", addPeer},
+	{"ban", "<host:port>", "Remove a neighbor and never connect to it again", ban},
+	{"mine", "start|stop", "Start or stop mining automatically", mine},
+	{"generate", "[n] [address]", "Mine n blocks instantly (regtest only)", generate},
+	{"verifychain", "", "Verify every block of the chain", verifyChain},
+	{"loglevel", "[level]", "Show or change the log level (debug, info, warn or error)", logLevel},
+	{"dumpchain", "[file]", "Write the whole chain as JSON (default: stdout)", dumpChain},
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: blockchain-cli [flags] <command> [args]")
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "commands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-26s %s\n", c.name+" "+c.args, c.summary)
+	}
+	fmt.Fprintln(out)
+	fmt.Fprintln(out, "flags:")
+	flag.PrintDefaults()
+}
+
+func main() {
+	nodeURL := flag.String("node", "http://127.0.0.1:5001", "Blockchain Server")
+	token := flag.String("token", "", "Admin API token (default: $"+ADMIN_TOKEN_ENV+")")
+	jsonOut := flag.Bool("json", false, "Print the result as JSON")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	// トークンがhelpに表示されないように、環境変数はフラグのデフォルト値にしない
+	if *token == "" {
+		*token = os.Getenv(ADMIN_TOKEN_ENV)
+	}
+	c := &client{
+		url:    *nodeURL,
+		token:  *token,
+		json:   *jsonOut,
+		client: &http.Client{Timeout: NODE_TIMEOUT},
+	}
+	for _, cmd := range commands {
+		if cmd.name == flag.Arg(0) {
+			if err := cmd.run(c, flag.Args()[1:]); err != nil {
+				fmt.Fprintf(os.Stderr, "blockchain-cli: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	fmt.Fprintf(os.Stderr, "blockchain-cli: unknown command %q\n", flag.Arg(0))
+	usage()
+	os.Exit(2)
+}
+
+// nodeのAPIのクライアント
+type client struct {
+	url    string
+	token  string
+	json   bool
+	client *http.Client
+}
+
+func (c *client) do(method string, path string, body interface{}, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		m, _ := json.Marshal(body)
+		r = bytes.NewBuffer(m)
+	}
+	req, err := http.NewRequest(method, c.url+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	m, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if e, ok := api.DecodeError(m); ok {
+			return fmt.Errorf("%s (%s)", e.Message, e.Code)
+		}
+		return fmt.Errorf("unexpected response %d from %s", resp.StatusCode, path)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(m, v)
+}
+
+// -jsonの指定があればJSON、なければtextで結果を表示する
+func (c *client) print(v interface{}, text func(w io.Writer)) error {
+	if c.json {
+		return writeJSON(os.Stdout, v)
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	text(tw)
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	m, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(m, '\n'))
+	return err
+}
+
+// 引数の数を確認する
+func nargs(args []string, min int, max int, usage string) error {
+	if len(args) < min || len(args) > max {
+		return fmt.Errorf("usage: %s", usage)
+	}
+	return nil
+}
+
+func getInfo(c *client, args []string) error {
+	if err := nargs(args, 0, 0, "getinfo"); err != nil {
+		return err
+	}
+	var info node.InfoResponse
+	if err := c.do(http.MethodGet, "/v1/admin/info", nil, &info); err != nil {
+		return err
+	}
+	return c.print(&info, func(w io.Writer) {
+		fmt.Fprintf(w, "network:\t%s\n", info.Network)
+		fmt.Fprintf(w, "port:\t%d\n", info.Port)
+		fmt.Fprintf(w, "blocks:\t%d\n", info.Blocks)
+		fmt.Fprintf(w, "best block hash:\t%s\n", info.BestBlockHash)
+		fmt.Fprintf(w, "difficulty:\t%d\n", info.Difficulty)
+		fmt.Fprintf(w, "mining reward:\t%v\n", info.MiningReward)
+		fmt.Fprintf(w, "coinbase maturity:\t%d\n", info.CoinbaseMaturity)
+		fmt.Fprintf(w, "mining:\t%t\n", info.Mining)
+		fmt.Fprintf(w, "miner address:\t%s\n", info.MinerAddress)
+		fmt.Fprintf(w, "mempool size:\t%d\n", info.MempoolSize)
+		fmt.Fprintf(w, "peers:\t%d (banned %d)\n", info.Peers, info.Banned)
+	})
+}
+
+func getBlock(c *client, args []string) error {
+	if err := nargs(args, 1, 1, "getblock <height|hash>"); err != nil {
+		return err
+	}
+	var br node.BlockResponse
+	if err := c.do(http.MethodGet, "/v1/blocks/"+url.PathEscape(args[0]), nil, &br); err != nil {
+		return err
+	}
+	return c.print(&br, func(w io.Writer) {
+		b := br.Block
+		fmt.Fprintf(w, "height:\t%d\n", br.Height)
+		fmt.Fprintf(w, "hash:\t%s\n", br.Hash)
+		fmt.Fprintf(w, "previous hash:\t%x\n", b.PreviousHash())
+		fmt.Fprintf(w, "confirmations:\t%d\n", br.Confirmations)
+		fmt.Fprintf(w, "time:\t%s\n", time.Unix(0, b.Timestamp()).UTC().Format(time.RFC3339))
+		fmt.Fprintf(w, "nonce:\t%d\n", b.Nonce())
+		fmt.Fprintf(w, "size:\t%d bytes\n", b.Size())
+		fmt.Fprintf(w, "transactions:\t%d\n", len(b.Transactions()))
+		fmt.Fprintln(w)
+		printTransactions(w, b.Transactions())
+	})
+}
+
+func getMempool(c *client, args []string) error {
+	if err := nargs(args, 0, 0, "getmempool"); err != nil {
+		return err
+	}
+	var tr node.TransactionsResponse
+	if err := c.do(http.MethodGet, "/v1/transactions", nil, &tr); err != nil {
+		return err
+	}
+	return c.print(&tr, func(w io.Writer) {
+		fmt.Fprintf(w, "%d transaction(s)\n\n", tr.Length)
+		printTransactions(w, tr.Transactions)
+	})
+}
+
+// Transactionを1行ずつ表示する（受取人が複数の場合は受取人ごとに行を分ける）
+func printTransactions(w io.Writer, transactions []*block.Transaction) {
+	fmt.Fprintln(w, "SENDER\tRECIPIENT\tVALUE\tFEE\tLOCK TIME\tMEMO")
+	for _, t := range transactions {
+		for i, o := range t.Outputs() {
+			if i == 0 {
+				fmt.Fprintf(w, "%s\t%s\t%v\t%v\t%d\t%s\n", t.SenderBlockchainAddress(),
+					o.RecipientBlockchainAddress, o.Value, t.Fee(), t.LockTime(), t.Memo())
+			} else {
+				fmt.Fprintf(w, "\t%s\t%v\t\t\t\n", o.RecipientBlockchainAddress, o.Value)
+			}
+		}
+	}
+}
+
+func printPeers(c *client, pr *node.PeersResponse) error {
+	return c.print(pr, func(w io.Writer) {
+		fmt.Fprintln(w, "PEER\tSTATUS")
+		for _, p := range pr.Peers {
+			fmt.Fprintf(w, "%s\tconnected\n", p)
+		}
+		for _, p := range pr.Banned {
+			fmt.Fprintf(w, "%s\tbanned\n", p)
+		}
+	})
+}
+
+func getPeers(c *client, args []string) error {
+	if err := nargs(args, 0, 0, "getpeers"); err != nil {
+		return err
+	}
+	var pr node.PeersResponse
+	if err := c.do(http.MethodGet, "/v1/admin/peers", nil, &pr); err != nil {
+		return err
+	}
+	return printPeers(c, &pr)
+}
+
+func addPeer(c *client, args []string) error {
+	if err := nargs(args, 1, 1, "addpeer <host:port>"); err != nil {
+		return err
+	}
+	var pr node.PeersResponse
+	if err := c.do(http.MethodPost, "/v1/admin/peers", &block.PeerRequest{Address: &args[0]}, &pr); err != nil {
+		return err
+	}
+	return printPeers(c, &pr)
+}
+
+func ban(c *client, args []string) error {
+	if err := nargs(args, 1, 1, "ban <host:port>"); err != nil {
+		return err
+	}
+	var pr node.PeersResponse
+	if err := c.do(http.MethodPost, "/v1/admin/peers/ban", &block.PeerRequest{Address: &args[0]}, &pr); err != nil {
+		return err
+	}
+	return printPeers(c, &pr)
+}
+
+func mine(c *client, args []string) error {
+	if err := nargs(args, 1, 1, "mine start|stop"); err != nil {
+		return err
+	}
+	if args[0] != "start" && args[0] != "stop" {
+		return fmt.Errorf("usage: mine start|stop")
+	}
+	if err := c.do(http.MethodPost, "/v1/mine/"+args[0], nil, nil); err != nil {
+		return err
+	}
+	var info node.InfoResponse
+	if err := c.do(http.MethodGet, "/v1/admin/info", nil, &info); err != nil {
+		return err
+	}
+	return c.print(map[string]bool{"mining": info.Mining}, func(w io.Writer) {
+		fmt.Fprintf(w, "mining: %t\n", info.Mining)
+	})
+}
+
+func generate(c *client, args []string) error {
+	if err := nargs(args, 0, 2, "generate [n] [address]"); err != nil {
+		return err
+	}
+	q := url.Values{}
+	if len(args) > 0 {
+		if _, err := strconv.Atoi(args[0]); err != nil {
+			return fmt.Errorf("invalid n %q", args[0])
+		}
+		q.Set("n", args[0])
+	}
+	if len(args) > 1 {
+		q.Set("address", args[1])
+	}
+	var gr node.GenerateResponse
+	if err := c.do(http.MethodPost, "/v1/regtest/generate?"+q.Encode(), nil, &gr); err != nil {
+		return err
+	}
+	return c.print(&gr, func(w io.Writer) {
+		for _, h := range gr.Hashes {
+			fmt.Fprintln(w, h)
+		}
+	})
+}
+
+func verifyChain(c *client, args []string) error {
+	if err := nargs(args, 0, 0, "verifychain"); err != nil {
+		return err
+	}
+	var vr node.VerifyChainResponse
+	if err := c.do(http.MethodGet, "/v1/admin/verifychain", nil, &vr); err != nil {
+		return err
+	}
+	if err := c.print(&vr, func(w io.Writer) {
+		if vr.Valid {
+			fmt.Fprintf(w, "chain is valid (%d blocks)\n", vr.Blocks)
+		} else {
+			fmt.Fprintf(w, "chain is invalid: %s (%d blocks)\n", vr.Error, vr.Blocks)
+		}
+	}); err != nil {
+		return err
+	}
+	// スクリプトから判定できるように、不正な場合は終了コードを1にする
+	if !vr.Valid {
+		os.Exit(1)
+	}
+	return nil
+}
+
+func logLevel(c *client, args []string) error {
+	if err := nargs(args, 0, 1, "loglevel [level]"); err != nil {
+		return err
+	}
+	var lr node.LogLevelResponse
+	var err error
+	if len(args) == 0 {
+		err = c.do(http.MethodGet, "/v1/admin/loglevel", nil, &lr)
+	} else {
+		err = c.do(http.MethodPut, "/v1/admin/loglevel", &node.LogLevelRequest{Level: &args[0]}, &lr)
+	}
+	if err != nil {
+		return err
+	}
+	return c.print(&lr, func(w io.Writer) {
+		fmt.Fprintf(w, "log level: %s\n", lr.Level)
+	})
+}
+
+// GET /v1/chainのJSONをそのまま書き出す（-jsonの指定に関わらずJSON）
+func dumpChain(c *client, args []string) error {
+	if err := nargs(args, 0, 1, "dumpchain [file]"); err != nil {
+		return err
+	}
+	var cr node.ChainResponse
+	if err := c.do(http.MethodGet, "/v1/chain", nil, &cr); err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return writeJSON(os.Stdout, &cr)
+	}
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	if err := writeJSON(f, &cr); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "wrote %d blocks to %s\n", len(cr.Chain), args[0])
+	return nil
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/node"
+	"go-blockchain/wallet"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// ゲートウェイのリクエストのタイムアウト
+const GATEWAY_TIMEOUT = 10 * time.Second
+
+// ブロックチェーンサーバー（ゲートウェイ）のAPIのクライアント
+type gateway struct {
+	url    string
+	client *http.Client
+}
+
+func (o *options) Gateway() *gateway {
+	return &gateway{url: o.gateway, client: &http.Client{Timeout: GATEWAY_TIMEOUT}}
+}
+
+func (g *gateway) get(path string, query url.Values, v interface{}) error {
+	endpoint := g.url + path
+	if query != nil {
+		endpoint += "?" + query.Encode()
+	}
+	resp, err := g.client.Get(endpoint)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readResponse(resp, http.StatusOK, v)
+}
+
+func (g *gateway) post(path string, body interface{}, status int) error {
+	m, _ := json.Marshal(body)
+	resp, err := g.client.Post(g.url+path, "application/json", bytes.NewBuffer(m))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return readResponse(resp, status, nil)
+}
+
+// ステータスコードが期待したものでなければ、エラーのレスポンスのmessageをエラーにする
+func readResponse(resp *http.Response, status int, v interface{}) error {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != status {
+		if e, ok := api.DecodeError(body); ok {
+			return fmt.Errorf("%s (%s)", e.Message, e.Code)
+		}
+		return fmt.Errorf("unexpected gateway response %d", resp.StatusCode)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.Unmarshal(body, v)
+}
+
+// -addressか、-userと-idで指定したキーストアのウォレットのアドレス
+func addressFlags(fs *flag.FlagSet) func(o *options) (string, error) {
+	address := fs.String("address", "", "Blockchain address")
+	user := fs.String("user", "", "Keystore user")
+	id := fs.String("id", "", "Wallet ID in the keystore")
+	return func(o *options) (string, error) {
+		switch {
+		case *address != "" && *user == "" && *id == "":
+			return *address, nil
+		case *address == "" && *user != "" && *id != "":
+			kf, err := o.Keystore().Get(*user, *id)
+			if err != nil {
+				return "", err
+			}
+			return kf.BlockchainAddress, nil
+		}
+		return "", fmt.Errorf("specify either -address or -user and -id")
+	}
+}
+
+// アドレスの残高を表示する
+func balance(args []string) error {
+	fs, o := newFlagSet("balance")
+	address := addressFlags(fs)
+	minConf := fs.Int("minconf", 1, "Minimum confirmations for confirmed balance")
+	fs.Parse(args)
+	addr, err := address(o)
+	if err != nil {
+		return err
+	}
+
+	var ar block.AmountResponse
+	q := url.Values{"blockchain_address": {addr}, "minconf": {strconv.Itoa(*minConf)}}
+	if err := o.Gateway().get("/v1/amount", q, &ar); err != nil {
+		return err
+	}
+	return o.print(&ar, func(w io.Writer) {
+		fmt.Fprintf(w, "blockchain_address: %s\n", addr)
+		fmt.Fprintf(w, "confirmed:          %v (minconf %d)\n", ar.Confirmed, ar.MinConf)
+		fmt.Fprintf(w, "unconfirmed:        %v\n", ar.Unconfirmed)
+		fmt.Fprintf(w, "immature:           %v\n", ar.Immature)
+	})
+}
+
+// アドレスが送信者か受取人になっているTransactionを新しい順に表示する
+func history(args []string) error {
+	fs, o := newFlagSet("history")
+	address := addressFlags(fs)
+	fs.Parse(args)
+	addr, err := address(o)
+	if err != nil {
+		return err
+	}
+
+	var hr node.AddressTransactionsResponse
+	if err := o.Gateway().get("/v1/addresses/"+url.PathEscape(addr)+"/transactions", nil, &hr); err != nil {
+		return err
+	}
+	return o.print(&hr, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "HEIGHT\tCONFIRMATIONS\tAMOUNT\tFEE\tCOUNTERPARTY\tMEMO")
+		for _, at := range hr.Transactions {
+			height := "pending"
+			if at.Height != nil {
+				height = strconv.Itoa(*at.Height)
+			}
+			t := at.Transaction
+			amount, counterparty := t.ValueTo(addr), t.SenderBlockchainAddress()
+			if counterparty == addr {
+				amount -= t.Debit()
+				counterparty = recipients(t, addr)
+			}
+			fmt.Fprintf(tw, "%s\t%d\t%+v\t%v\t%s\t%s\n",
+				height, at.Confirmations, amount, t.Fee(), counterparty, t.Memo())
+		}
+		tw.Flush()
+	})
+}
+
+// 自分以外の受取人（複数の場合は最初の受取人と人数）
+func recipients(t *block.Transaction, self string) string {
+	var others []string
+	for _, o := range t.Outputs() {
+		if o.RecipientBlockchainAddress != self {
+			others = append(others, o.RecipientBlockchainAddress)
+		}
+	}
+	switch len(others) {
+	case 0:
+		return self
+	case 1:
+		return others[0]
+	}
+	return fmt.Sprintf("%s (+%d)", others[0], len(others)-1)
+}
+
+// キーストアのウォレットで署名してゲートウェイに送金する
+func send(args []string) error {
+	fs, o := newFlagSet("send")
+	user := fs.String("user", "", "Keystore user")
+	id := fs.String("id", "", "Wallet ID in the keystore")
+	to := fs.String("to", "", "Recipient blockchain address")
+	value := fs.String("value", "", "Value to send to -to")
+	csvFile := fs.String("csv", "", "CSV file of 'address,value' lines for a batch payment (- for stdin)")
+	memo := fs.String("memo", "", "Memo (at most 80 bytes)")
+	fee := fs.String("fee", "", "Fee (default: the minimum fee for the memo)")
+	lockTime := fs.Int64("lock-time", 0, "Block height or unix time before which the transaction can not be mined")
+	fs.Parse(args)
+	if err := required(fs, "user", "id"); err != nil {
+		return err
+	}
+
+	var pr wallet.PaymentRequest
+	if *to != "" || *value != "" {
+		pr.RecipientBlockchainAddress, pr.Value = to, value
+	}
+	if *csvFile != "" {
+		csv, err := readFile(*csvFile)
+		if err != nil {
+			return err
+		}
+		pr.CSV = &csv
+	}
+	if *memo != "" {
+		pr.Memo = memo
+	}
+	if *fee != "" {
+		pr.Fee = fee
+	}
+	if !pr.Validate() || *lockTime < 0 {
+		return fmt.Errorf("specify either -to and -value or -csv, and a non-negative -lock-time")
+	}
+	outputs, err := pr.TransactionOutputs()
+	if err != nil {
+		return err
+	}
+	m, f, err := pr.MemoAndFee(block.MinimumFee)
+	if err != nil {
+		return err
+	}
+	if len(m) > block.MAX_MEMO_SIZE {
+		return block.ErrMemoTooLarge
+	}
+
+	passphrase, err := o.Passphrase()
+	if err != nil {
+		return err
+	}
+	senderWallet, kf, err := o.Keystore().Unlock(*user, *id, passphrase)
+	if err != nil {
+		return err
+	}
+	// オフラインでの署名と同じく、digestを確認してから署名する
+	ut := wallet.NewUnsignedTransaction(wallet.NewTransactionData(kf.BlockchainAddress, outputs, m, f, *lockTime))
+	st, err := ut.Sign(senderWallet)
+	if err != nil {
+		return err
+	}
+	bt, err := transactionRequest(st)
+	if err != nil {
+		return err
+	}
+	if err := o.Gateway().post("/v1/transactions", bt, http.StatusCreated); err != nil {
+		return err
+	}
+	return o.print(st, func(w io.Writer) {
+		fmt.Fprintf(w, "sent %v to %d recipient(s) from %s (fee %v)\n",
+			outputsTotal(outputs), len(outputs), st.Sender, st.Fee)
+		fmt.Fprintf(w, "digest: %s\n", ut.Digest)
+	})
+}
+
+func outputsTotal(outputs []*wallet.Output) float32 {
+	var total float32
+	for _, o := range outputs {
+		total += o.Value
+	}
+	return total
+}
+
+// 署名したTransactionからnodeに送るリクエストを作る
+func transactionRequest(st *wallet.SignedTransaction) (*block.TransactionRequest, error) {
+	publicKey, signature, err := st.Verify()
+	if err != nil {
+		return nil, err
+	}
+	outputs := make([]*block.Output, 0, len(st.TransactionOutputs()))
+	for _, o := range st.TransactionOutputs() {
+		outputs = append(outputs, block.NewOutput(o.RecipientBlockchainAddress, o.Value))
+	}
+	t := block.NewBatchTransaction(st.Sender, outputs, st.LockTime).WithMemo(st.Memo, st.Fee)
+	return block.NewTransactionRequest(t, block.NewSignatureAuthorization(publicKey, signature)), nil
+}
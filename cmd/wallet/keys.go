@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"go-blockchain/keystore"
+	"go-blockchain/wallet"
+	"io"
+	"strings"
+	"text/tabwriter"
+)
+
+// キーストアに保存したウォレットの情報（秘密鍵は含めない、wallet_serverのレスポンスと同じ形式）
+type walletInfo struct {
+	WalletID          string `json:"wallet_id"`
+	PublicKey         string `json:"public_key"`
+	BlockchainAddress string `json:"blockchain_address"`
+	HDSeedID          string `json:"hd_seed_id,omitempty"`
+	HDPath            string `json:"hd_path,omitempty"`
+}
+
+func newWalletInfo(kf *keystore.KeyFile) *walletInfo {
+	return &walletInfo{
+		WalletID:          kf.ID,
+		PublicKey:         kf.PublicKey,
+		BlockchainAddress: kf.BlockchainAddress,
+		HDSeedID:          kf.HDSeedID,
+		HDPath:            kf.HDPath,
+	}
+}
+
+func (wi *walletInfo) print(w io.Writer) {
+	fmt.Fprintf(w, "wallet_id:          %s\n", wi.WalletID)
+	fmt.Fprintf(w, "blockchain_address: %s\n", wi.BlockchainAddress)
+	fmt.Fprintf(w, "public_key:         %s\n", wi.PublicKey)
+}
+
+// ウォレットを作成してキーストアに保存する
+func create(args []string) error {
+	fs, o := newFlagSet("create")
+	user := fs.String("user", "", "Keystore user")
+	fs.Parse(args)
+	if err := required(fs, "user"); err != nil {
+		return err
+	}
+	passphrase, err := o.Passphrase()
+	if err != nil {
+		return err
+	}
+	kf, err := o.Keystore().Store(*user, wallet.NewWallet(), passphrase)
+	if err != nil {
+		return err
+	}
+	wi := newWalletInfo(kf)
+	return o.print(wi, wi.print)
+}
+
+// WIFまたは暗号化したバックアップからウォレットをインポートしてキーストアに保存する
+func importWallet(args []string) error {
+	fs, o := newFlagSet("import")
+	user := fs.String("user", "", "Keystore user")
+	wifFile := fs.String("wif-file", "", "File containing the WIF private key (- for stdin)")
+	backupFile := fs.String("backup", "", "Encrypted backup file exported by the wallet server")
+	backupPasswordFile := fs.String("backup-password-file", "",
+		"File containing the backup password (default: $"+BACKUP_PASSWORD_ENV+")")
+	fs.Parse(args)
+	if err := required(fs, "user"); err != nil {
+		return err
+	}
+	if (*wifFile == "") == (*backupFile == "") {
+		return fmt.Errorf("specify either -wif-file or -backup")
+	}
+
+	var imported *wallet.Wallet
+	if *wifFile != "" {
+		wif, err := readFile(*wifFile)
+		if err != nil {
+			return err
+		}
+		if imported, err = wallet.FromWIF(strings.TrimSpace(wif), wallet.WIFVersion(o.regtest)); err != nil {
+			return err
+		}
+	} else {
+		password, err := readSecret(*backupPasswordFile, BACKUP_PASSWORD_ENV)
+		if err != nil {
+			return err
+		}
+		if imported, err = keystore.LoadKeyFile(*backupFile, password); err != nil {
+			return err
+		}
+	}
+
+	passphrase, err := o.Passphrase()
+	if err != nil {
+		return err
+	}
+	kf, err := o.Keystore().Store(*user, imported, passphrase)
+	if err != nil {
+		return err
+	}
+	wi := newWalletInfo(kf)
+	return o.print(wi, wi.print)
+}
+
+// ユーザーのウォレットの一覧を表示する
+func list(args []string) error {
+	fs, o := newFlagSet("list")
+	user := fs.String("user", "", "Keystore user")
+	fs.Parse(args)
+	if err := required(fs, "user"); err != nil {
+		return err
+	}
+	keys, err := o.Keystore().List(*user)
+	if err != nil {
+		return err
+	}
+	wallets := make([]*walletInfo, 0, len(keys))
+	for _, kf := range keys {
+		wallets = append(wallets, newWalletInfo(kf))
+	}
+	return o.print(map[string]interface{}{"wallets": wallets}, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "WALLET ID\tBLOCKCHAIN ADDRESS\tHD PATH")
+		for _, wi := range wallets {
+			fmt.Fprintf(tw, "%s\t%s\t%s\n", wi.WalletID, wi.BlockchainAddress, wi.HDPath)
+		}
+		tw.Flush()
+	})
+}
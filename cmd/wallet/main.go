@@ -0,0 +1,178 @@
+// ウォレットのコマンドラインツール
+// キーストアの鍵の作成、インポート、一覧、残高と履歴の表示、送金、オフラインでの署名を行う
+// 残高、履歴、送金はwallet_serverと同じく-gatewayで指定したブロックチェーンサーバーと通信する
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go-blockchain/keystore"
+	"io"
+	"os"
+	"strings"
+)
+
+// パスフレーズを渡す環境変数（-passphrase-fileの指定がない場合に使う）
+const (
+	PASSPHRASE_ENV      = "WALLET_PASSPHRASE"
+	BACKUP_PASSWORD_ENV = "WALLET_BACKUP_PASSWORD"
+)
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string) error
+}
+
+var commands = []*command{
+	{"create", "-user <user>", "Create a new wallet and store it encrypted in the keystore", create},
+	{"import", "-user <user> (-wif-file <file> | -backup <file>)", "Import a wallet from WIF or an encrypted backup", importWallet},
+	{"list", "-user <user>", "List the wallets of a user", list},
+	{"balance", "(-address <address> | -user <user> -id <wallet id>) [-minconf <n>]", "Show the balance of an address", balance},
+	{"history", "(-address <address> | -user <user> -id <wallet id>)", "Show the transactions of an address", history},
+	{"send", "-user <user> -id <wallet id> (-to <address> -value <value> | -csv <file>) [-memo <memo>] [-fee <fee>] [-lock-time <n>]", "Sign a payment and send it to the gateway", send},
+	{"sign", "-keyfile <key file> [-in <file>] [-out <file>] [-yes]", "Sign a transaction built by /v1/transaction/build offline", sign},
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: wallet <command> [flags]")
+	fmt.Fprintln(os.Stderr)
+	for _, c := range commands {
+		fmt.Fprintf(os.Stderr, "  %-8s %s\n", c.name, c.summary)
+		fmt.Fprintf(os.Stderr, "  %-8s wallet %s %s\n", "", c.name, c.usage)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintf(os.Stderr, "Passphrases are read from -passphrase-file or $%s ($%s for backups).\n",
+		PASSPHRASE_ENV, BACKUP_PASSWORD_ENV)
+	fmt.Fprintln(os.Stderr, "Run 'wallet <command> -h' for the flags of a command.")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	for _, c := range commands {
+		if c.name == os.Args[1] {
+			if err := c.run(os.Args[2:]); err != nil {
+				fmt.Fprintf(os.Stderr, "wallet: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+	usage()
+}
+
+// 全てのコマンドに共通するフラグ
+type options struct {
+	keystore       string
+	gateway        string
+	regtest        bool
+	json           bool
+	passphraseFile string
+}
+
+func newFlagSet(name string) (*flag.FlagSet, *options) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	o := &options{}
+	fs.StringVar(&o.keystore, "keystore", "keystore", "Directory to store encrypted wallets")
+	fs.StringVar(&o.gateway, "gateway", "http://127.0.0.1:5001", "Blockchain Gateway")
+	fs.BoolVar(&o.regtest, "regtest", false, "Use the regtest network version byte for WIF import")
+	fs.BoolVar(&o.json, "json", false, "Print the result as JSON")
+	fs.StringVar(&o.passphraseFile, "passphrase-file", "", "File containing the passphrase (default: $"+PASSPHRASE_ENV+")")
+	return fs, o
+}
+
+func (o *options) Keystore() *keystore.Keystore {
+	return keystore.NewKeystore(o.keystore)
+}
+
+func (o *options) Passphrase() (string, error) {
+	return readSecret(o.passphraseFile, PASSPHRASE_ENV)
+}
+
+// 必須のフラグが指定されているか確認する
+func required(fs *flag.FlagSet, names ...string) error {
+	var missing []string
+	for _, name := range names {
+		if fs.Lookup(name).Value.String() == "" {
+			missing = append(missing, "-"+name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%s is required", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// ファイルか環境変数からパスフレーズを読み込む
+// コマンドラインの引数はプロセスの一覧から見えるので使わない
+func readSecret(path string, env string) (string, error) {
+	if path == "" {
+		secret, ok := os.LookupEnv(env)
+		if !ok {
+			return "", fmt.Errorf("passphrase is required (-passphrase-file or $%s)", env)
+		}
+		return secret, nil
+	}
+	m, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(m), "\r\n"), nil
+}
+
+// ファイル（-は標準入力）を読み込む
+func readFile(path string) (string, error) {
+	var m []byte
+	var err error
+	if path == "-" {
+		m, err = io.ReadAll(os.Stdin)
+	} else {
+		m, err = os.ReadFile(path)
+	}
+	return string(m), err
+}
+
+// ファイル（-は標準入力）のJSONを読み込む
+func readJSON(path string, v interface{}) error {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+	if err := json.NewDecoder(r).Decode(v); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// ファイル（-は標準出力）にJSONを書き出す
+func writeJSON(path string, v interface{}) error {
+	m, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	m = append(m, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(m)
+		return err
+	}
+	return os.WriteFile(path, m, 0600)
+}
+
+// -jsonの指定があればJSON、なければtextで結果を表示する
+func (o *options) print(v interface{}, text func(w io.Writer)) error {
+	if o.json {
+		return writeJSON("-", v)
+	}
+	text(os.Stdout)
+	return nil
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"go-blockchain/block"
+	"go-blockchain/keystore"
+	"go-blockchain/wallet"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var errNotConfirmed = errors.New("signing cancelled")
+
+// 未署名のTransactionをキーファイルの鍵で署名し、署名済みのTransactionを書き出す
+// ネットワークにつながっていない端末で実行し、結果を/v1/transaction/broadcastに送る
+// 署名する前に送金先、金額、手数料、lock_timeを標準エラーに表示して確認する（-yesで省略）
+func sign(args []string) error {
+	fs, o := newFlagSet("sign")
+	keyFile := fs.String("keyfile", "", "Keystore wallet file or encrypted backup file")
+	in := fs.String("in", "-", "Unsigned transaction JSON (- for stdin)")
+	out := fs.String("out", "-", "Signed transaction JSON (- for stdout)")
+	yes := fs.Bool("yes", false, "Sign without asking for confirmation")
+	fs.Parse(args)
+	if err := required(fs, "keyfile"); err != nil {
+		return err
+	}
+	// 標準入力からTransactionを読み込む場合は確認の応答を読めない
+	if *in == "-" && !*yes {
+		return fmt.Errorf("-yes is required when reading the transaction from stdin (or use -in <file>)")
+	}
+
+	passphrase, err := o.Passphrase()
+	if err != nil {
+		return err
+	}
+	w, err := keystore.LoadKeyFile(*keyFile, passphrase)
+	if err != nil {
+		return fmt.Errorf("%s: %v", *keyFile, err)
+	}
+
+	var ut wallet.UnsignedTransaction
+	if err := readJSON(*in, &ut); err != nil {
+		return err
+	}
+	if !*yes {
+		printTransaction(os.Stderr, &ut.TransactionData)
+		if !confirm(os.Stdin, os.Stderr, "Sign this transaction?") {
+			return errNotConfirmed
+		}
+	}
+	st, err := ut.Sign(w)
+	if err != nil {
+		return err
+	}
+	return writeJSON(*out, st)
+}
+
+// 署名するTransactionの内容を表示する
+func printTransaction(w io.Writer, td *wallet.TransactionData) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "From:\t%s\n", td.Sender)
+	for _, o := range td.TransactionOutputs() {
+		fmt.Fprintf(tw, "To:\t%s\t%g\n", o.RecipientBlockchainAddress, o.Value)
+	}
+	fmt.Fprintf(tw, "Fee:\t%g\n", td.Fee)
+	if td.Memo != "" {
+		fmt.Fprintf(tw, "Memo:\t%s\n", td.Memo)
+	}
+	fmt.Fprintf(tw, "Lock time:\t%s\n", lockTimeString(td.LockTime))
+	tw.Flush()
+}
+
+// lock_timeの意味（ブロックの高さかUNIX時間）
+func lockTimeString(lockTime int64) string {
+	switch {
+	case lockTime == 0:
+		return "none"
+	case lockTime < block.LOCK_TIME_THRESHOLD:
+		return fmt.Sprintf("%d (block height)", lockTime)
+	}
+	return fmt.Sprintf("%d (%s)", lockTime, time.Unix(lockTime, 0).UTC().Format(time.RFC3339))
+}
+
+// y/yesと答えた場合だけtrueを返す
+func confirm(r io.Reader, w io.Writer, question string) bool {
+	fmt.Fprintf(w, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(r).ReadString('\n')
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package keys
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+var testSchemes = []Scheme{Secp256k1, P256}
+
+func testSchemeKey(tb testing.TB, scheme Scheme) PrivateKey {
+	tb.Helper()
+	k, err := scheme.GenerateKey()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return k
+}
+
+func FuzzParseSignature(f *testing.F) {
+	hash := sha256.Sum256([]byte("message"))
+	for _, scheme := range testSchemes {
+		sig, err := testSchemeKey(f, scheme).Sign(hash[:])
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(sig.Bytes())
+		f.Add(sig.WithFormat(SIGNATURE_FORMAT_COMPACT).Bytes())
+	}
+	f.Add([]byte{})
+	f.Add([]byte{byte(SIGNATURE_FORMAT_DER), 0x30, 0x06, 0x02, 0x01, 0x01, 0x02, 0x01, 0x01})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, scheme := range testSchemes {
+			sig, err := ParseSignature(scheme, b)
+			if err != nil {
+				continue
+			}
+			// 冗長なエンコードは受け付けないので、読み込めた署名はエンコードし直すと同じバイト列になる
+			if got := sig.Bytes(); !bytes.Equal(got, b) {
+				t.Errorf("%s: round trip: got %x, want %x", scheme.ID(), got, b)
+			}
+			if sig.S.Cmp(halfOrder(scheme.Order())) > 0 {
+				t.Errorf("%s: accepted a high-S signature %x", scheme.ID(), b)
+			}
+		}
+	})
+}
+
+func FuzzParsePublicKey(f *testing.F) {
+	for _, scheme := range testSchemes {
+		f.Add(testSchemeKey(f, scheme).PublicKey().SerializeCompressed())
+	}
+	f.Add(make([]byte, COMPRESSED_PUBLIC_KEY_SIZE))
+	f.Add([]byte{0x04})
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, scheme := range testSchemes {
+			pub, err := scheme.ParsePublicKey(b)
+			if err != nil {
+				continue
+			}
+			if got := pub.SerializeCompressed(); !bytes.Equal(got, b) {
+				t.Errorf("%s: round trip: got %x, want %x", scheme.ID(), got, b)
+			}
+		}
+	})
+}
+
+func FuzzParsePublicKeyString(f *testing.F) {
+	for _, scheme := range testSchemes {
+		f.Add(PublicKeyString(testSchemeKey(f, scheme).PublicKey()))
+	}
+	legacy := testSchemeKey(f, P256).PublicKey().(*p256PublicKey)
+	f.Add(legacy.key.X.Text(16) + legacy.key.Y.Text(16))
+	f.Add("zz")
+	f.Fuzz(func(t *testing.T, s string) {
+		for _, scheme := range testSchemes {
+			pub, err := ParsePublicKeyString(scheme, s)
+			if err != nil {
+				continue
+			}
+			// 読み込めた公開鍵は圧縮形式でも読み込める
+			if _, err := scheme.ParsePublicKey(pub.SerializeCompressed()); err != nil {
+				t.Errorf("%s: %s: %v", scheme.ID(), s, err)
+			}
+		}
+	})
+}
+
+func FuzzParseAddressBytes(f *testing.F) {
+	for _, scheme := range testSchemes {
+		f.Add(AddressBytes(testSchemeKey(f, scheme).PublicKey()))
+	}
+	f.Add([]byte{})
+	f.Add(make([]byte, 2*PRIVATE_KEY_SIZE))
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, scheme := range testSchemes {
+			pub, err := ParseAddressBytes(scheme, b)
+			if err != nil {
+				continue
+			}
+			// AddressBytesに戻したものを読み込むと同じ公開鍵になる
+			again, err := ParseAddressBytes(scheme, AddressBytes(pub))
+			if err != nil {
+				t.Fatalf("%s: %x: %v", scheme.ID(), b, err)
+			}
+			if !bytes.Equal(again.SerializeCompressed(), pub.SerializeCompressed()) {
+				t.Errorf("%s: round trip: got %x, want %x", scheme.ID(), again.SerializeCompressed(), pub.SerializeCompressed())
+			}
+		}
+	})
+}
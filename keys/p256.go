@@ -0,0 +1,134 @@
+package keys
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"math/big"
+)
+
+// P-256の署名方式（以前のウォレットの鍵の検証用）
+var P256 Scheme = p256Scheme{}
+
+type p256Scheme struct{}
+
+func (p256Scheme) ID() SchemeID {
+	return SCHEME_P256
+}
+
+func (p256Scheme) Order() *big.Int {
+	return elliptic.P256().Params().N
+}
+
+// crypto/ecdsaのP-256の秘密鍵からPrivateKeyを作成する
+func NewP256PrivateKey(key *ecdsa.PrivateKey) PrivateKey {
+	return &p256PrivateKey{key}
+}
+
+func (p256Scheme) GenerateKey() (PrivateKey, error) {
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	return &p256PrivateKey{k}, nil
+}
+
+func (s p256Scheme) PrivateKeyFromBytes(b []byte) (PrivateKey, error) {
+	if !validPrivateKey(s, b) {
+		return nil, ErrInvalidPrivateKey
+	}
+	k := new(ecdsa.PrivateKey)
+	k.Curve = elliptic.P256()
+	k.D = new(big.Int).SetBytes(b)
+	k.X, k.Y = k.Curve.ScalarBaseMult(b)
+	return &p256PrivateKey{k}, nil
+}
+
+func (p256Scheme) ParsePublicKey(b []byte) (PublicKey, error) {
+	if len(b) != COMPRESSED_PUBLIC_KEY_SIZE {
+		return nil, ErrInvalidPublicKey
+	}
+	// UnmarshalCompressedは曲線上の点でなければnilを返す
+	x, y := elliptic.UnmarshalCompressed(elliptic.P256(), b)
+	if x == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return &p256PublicKey{&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}}, nil
+}
+
+// ------------------------------------------------------------------------------------------
+type p256PrivateKey struct {
+	key *ecdsa.PrivateKey
+}
+
+func (k *p256PrivateKey) Scheme() Scheme {
+	return P256
+}
+
+func (k *p256PrivateKey) Bytes() []byte {
+	return k.key.D.FillBytes(make([]byte, PRIVATE_KEY_SIZE))
+}
+
+func (k *p256PrivateKey) PublicKey() PublicKey {
+	return &p256PublicKey{&k.key.PublicKey}
+}
+
+func (k *p256PrivateKey) Sign(hash []byte) (*Signature, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, hash)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignature(r, s, P256.Order(), SIGNATURE_FORMAT_DER), nil
+}
+
+// ------------------------------------------------------------------------------------------
+type p256PublicKey struct {
+	key *ecdsa.PublicKey
+}
+
+func (k *p256PublicKey) Scheme() Scheme {
+	return P256
+}
+
+func (k *p256PublicKey) SerializeCompressed() []byte {
+	return elliptic.MarshalCompressed(elliptic.P256(), k.key.X, k.key.Y)
+}
+
+// 以前のアドレスの作成方法で使っていたX||Y（先頭の0を除いた座標をそのまま連結したもの）
+func (k *p256PublicKey) LegacyBytes() []byte {
+	return append(k.key.X.Bytes(), k.key.Y.Bytes()...)
+}
+
+// LegacyBytesの形式の公開鍵を読み込む
+// 座標の先頭の0が除かれているので、曲線上の点になる分け方がちょうど1つの場合だけ受け付ける
+func parseLegacyP256PublicKey(b []byte) (PublicKey, error) {
+	const coordinateSize = PRIVATE_KEY_SIZE
+	if len(b) > coordinateSize*2 {
+		return nil, ErrInvalidPublicKey
+	}
+	var found *ecdsa.PublicKey
+	for i := len(b) - coordinateSize; i <= coordinateSize; i++ {
+		if i < 1 || len(b)-i < 1 || b[0] == 0 || b[i] == 0 {
+			continue
+		}
+		x, y := new(big.Int).SetBytes(b[:i]), new(big.Int).SetBytes(b[i:])
+		if !elliptic.P256().IsOnCurve(x, y) {
+			continue
+		}
+		if found != nil {
+			return nil, ErrInvalidPublicKey
+		}
+		found = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+	}
+	if found == nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return &p256PublicKey{found}, nil
+}
+
+func (k *p256PublicKey) Verify(hash []byte, sig *Signature) bool {
+	if sig.S.Cmp(halfOrder(P256.Order())) > 0 {
+		return false
+	}
+	return ecdsa.Verify(k.key, hash, sig.R, sig.S)
+}
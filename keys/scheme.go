@@ -0,0 +1,126 @@
+// 署名方式（楕円曲線）を抽象化した鍵と署名
+//
+// 公開鍵は33バイトの圧縮形式、署名はlow-Sに正規化したDERまたはcompact形式で扱う
+// デフォルトはsecp256k1で、以前から使っているP-256も検証できるように残している
+package keys
+
+import (
+	"encoding/hex"
+	"errors"
+	"go-blockchain/utils"
+	"math/big"
+)
+
+// 署名方式の識別子（Transactionに載せて送る）
+type SchemeID string
+
+const (
+	SCHEME_SECP256K1 SchemeID = "secp256k1"
+	SCHEME_P256      SchemeID = "p256"
+
+	DEFAULT_SCHEME = SCHEME_SECP256K1
+
+	PRIVATE_KEY_SIZE           = 32
+	COMPRESSED_PUBLIC_KEY_SIZE = 33
+)
+
+var (
+	ErrUnknownScheme     = errors.New("unknown signature scheme")
+	ErrInvalidPrivateKey = errors.New("invalid private key")
+	ErrInvalidPublicKey  = errors.New("invalid public key")
+)
+
+// 署名方式
+type Scheme interface {
+	ID() SchemeID
+	// 曲線の位数（秘密鍵と署名の値の範囲）
+	Order() *big.Int
+	GenerateKey() (PrivateKey, error)
+	// 32バイトの秘密鍵を読み込む（1..N-1の範囲外ならエラー）
+	PrivateKeyFromBytes(b []byte) (PrivateKey, error)
+	// 33バイトの圧縮形式の公開鍵を読み込む（曲線上の点でなければエラー）
+	ParsePublicKey(b []byte) (PublicKey, error)
+}
+
+type PrivateKey interface {
+	Scheme() Scheme
+	// 32バイトの固定長
+	Bytes() []byte
+	PublicKey() PublicKey
+	// hashに署名する（Sはlow-Sに正規化する）
+	Sign(hash []byte) (*Signature, error)
+}
+
+type PublicKey interface {
+	Scheme() Scheme
+	// 33バイトの圧縮形式
+	SerializeCompressed() []byte
+	Verify(hash []byte, sig *Signature) bool
+}
+
+var schemes = map[SchemeID]Scheme{
+	SCHEME_SECP256K1: Secp256k1,
+	SCHEME_P256:      P256,
+}
+
+// 識別子から署名方式を取得する
+func SchemeByID(id SchemeID) (Scheme, error) {
+	s, ok := schemes[id]
+	if !ok {
+		return nil, ErrUnknownScheme
+	}
+	return s, nil
+}
+
+// デフォルトの署名方式
+func Default() Scheme {
+	return schemes[DEFAULT_SCHEME]
+}
+
+// 公開鍵を16進数の文字列にする
+func PublicKeyString(pub PublicKey) string {
+	return hex.EncodeToString(pub.SerializeCompressed())
+}
+
+// 16進数の圧縮形式の公開鍵を読み込む
+// P-256の場合は以前のX||Y形式の公開鍵も受け付ける
+func ParsePublicKeyString(scheme Scheme, s string) (PublicKey, error) {
+	if scheme.ID() == SCHEME_P256 && len(s) == utils.COORDINATE_HEX_SIZE*2 {
+		pub, err := utils.PublicKeyFromString(s)
+		if err != nil {
+			return nil, err
+		}
+		return &p256PublicKey{pub}, nil
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return scheme.ParsePublicKey(b)
+}
+
+// アドレスのhashの元にする公開鍵のバイト列
+// P-256の鍵は以前のアドレスと変わらないように座標をそのまま連結したものを使う
+func AddressBytes(pub PublicKey) []byte {
+	if legacy, ok := pub.(interface{ LegacyBytes() []byte }); ok {
+		return legacy.LegacyBytes()
+	}
+	return pub.SerializeCompressed()
+}
+
+// AddressBytesで作ったバイト列または圧縮形式の公開鍵を読み込む
+func ParseAddressBytes(scheme Scheme, b []byte) (PublicKey, error) {
+	if scheme.ID() == SCHEME_P256 && len(b) != COMPRESSED_PUBLIC_KEY_SIZE {
+		return parseLegacyP256PublicKey(b)
+	}
+	return scheme.ParsePublicKey(b)
+}
+
+// 秘密鍵が1..N-1の範囲にあるか
+func validPrivateKey(scheme Scheme, b []byte) bool {
+	if len(b) != PRIVATE_KEY_SIZE {
+		return false
+	}
+	k := new(big.Int).SetBytes(b)
+	return k.Sign() != 0 && k.Cmp(scheme.Order()) < 0
+}
@@ -0,0 +1,98 @@
+package keys
+
+import (
+	"math/big"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	"github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// secp256k1の署名方式（署名はRFC6979の決定的なnonceで作成する）
+var Secp256k1 Scheme = secp256k1Scheme{}
+
+type secp256k1Scheme struct{}
+
+func (secp256k1Scheme) ID() SchemeID {
+	return SCHEME_SECP256K1
+}
+
+func (secp256k1Scheme) Order() *big.Int {
+	return secp256k1.Params().N
+}
+
+func (secp256k1Scheme) GenerateKey() (PrivateKey, error) {
+	k, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		return nil, err
+	}
+	return &secp256k1PrivateKey{k}, nil
+}
+
+func (s secp256k1Scheme) PrivateKeyFromBytes(b []byte) (PrivateKey, error) {
+	if !validPrivateKey(s, b) {
+		return nil, ErrInvalidPrivateKey
+	}
+	return &secp256k1PrivateKey{secp256k1.PrivKeyFromBytes(b)}, nil
+}
+
+func (secp256k1Scheme) ParsePublicKey(b []byte) (PublicKey, error) {
+	if len(b) != COMPRESSED_PUBLIC_KEY_SIZE {
+		return nil, ErrInvalidPublicKey
+	}
+	k, err := secp256k1.ParsePubKey(b)
+	if err != nil {
+		return nil, ErrInvalidPublicKey
+	}
+	return &secp256k1PublicKey{k}, nil
+}
+
+// ------------------------------------------------------------------------------------------
+type secp256k1PrivateKey struct {
+	key *secp256k1.PrivateKey
+}
+
+func (k *secp256k1PrivateKey) Scheme() Scheme {
+	return Secp256k1
+}
+
+func (k *secp256k1PrivateKey) Bytes() []byte {
+	return k.key.Serialize()
+}
+
+func (k *secp256k1PrivateKey) PublicKey() PublicKey {
+	return &secp256k1PublicKey{k.key.PubKey()}
+}
+
+func (k *secp256k1PrivateKey) Sign(hash []byte) (*Signature, error) {
+	// ecdsa.Signはlow-Sに正規化した署名を返す
+	der := ecdsa.Sign(k.key, hash).Serialize()
+	sig, err := parseDER(der)
+	if err != nil {
+		return nil, err
+	}
+	return NewSignature(sig.R, sig.S, Secp256k1.Order(), SIGNATURE_FORMAT_DER), nil
+}
+
+// ------------------------------------------------------------------------------------------
+type secp256k1PublicKey struct {
+	key *secp256k1.PublicKey
+}
+
+func (k *secp256k1PublicKey) Scheme() Scheme {
+	return Secp256k1
+}
+
+func (k *secp256k1PublicKey) SerializeCompressed() []byte {
+	return k.key.SerializeCompressed()
+}
+
+func (k *secp256k1PublicKey) Verify(hash []byte, sig *Signature) bool {
+	var r, s secp256k1.ModNScalar
+	if r.SetByteSlice(sig.R.Bytes()) || s.SetByteSlice(sig.S.Bytes()) || r.IsZero() || s.IsZero() {
+		return false
+	}
+	if s.IsOverHalfOrder() {
+		return false
+	}
+	return ecdsa.NewSignature(&r, &s).Verify(hash, k.key)
+}
@@ -0,0 +1,170 @@
+package keys
+
+import (
+	"encoding/hex"
+	"errors"
+	"math/big"
+)
+
+// 署名のエンコード形式（エンコードした署名の先頭1バイト）
+type SignatureFormat byte
+
+const (
+	SIGNATURE_FORMAT_DER     SignatureFormat = 0x01
+	SIGNATURE_FORMAT_COMPACT SignatureFormat = 0x02
+
+	COMPACT_SIGNATURE_SIZE = 64
+	MAX_DER_SIGNATURE_SIZE = 72
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid signature encoding")
+	ErrHighS            = errors.New("signature s value is not low-S normalised")
+)
+
+// ECDSAの署名
+// エンコードはformat(1byte) || DERまたはcompact(r||s 64byte)
+type Signature struct {
+	R      *big.Int
+	S      *big.Int
+	Format SignatureFormat
+}
+
+// Sをlow-S（N/2以下）に正規化した署名を作成する
+func NewSignature(r *big.Int, s *big.Int, order *big.Int, format SignatureFormat) *Signature {
+	if s.Cmp(halfOrder(order)) > 0 {
+		s = new(big.Int).Sub(order, s)
+	}
+	return &Signature{R: r, S: s, Format: format}
+}
+
+// 形式を付けてエンコードする
+func (sig *Signature) Bytes() []byte {
+	if sig.Format == SIGNATURE_FORMAT_COMPACT {
+		b := make([]byte, 1+COMPACT_SIGNATURE_SIZE)
+		b[0] = byte(SIGNATURE_FORMAT_COMPACT)
+		sig.R.FillBytes(b[1:33])
+		sig.S.FillBytes(b[33:])
+		return b
+	}
+	return append([]byte{byte(SIGNATURE_FORMAT_DER)}, sig.DER()...)
+}
+
+func (sig *Signature) String() string {
+	return hex.EncodeToString(sig.Bytes())
+}
+
+// DER形式 0x30 len 0x02 len(r) r 0x02 len(s) s
+func (sig *Signature) DER() []byte {
+	r := derInt(sig.R)
+	s := derInt(sig.S)
+	b := []byte{0x30, byte(4 + len(r) + len(s)), 0x02, byte(len(r))}
+	b = append(b, r...)
+	b = append(b, 0x02, byte(len(s)))
+	return append(b, s...)
+}
+
+// 同じ値の別の形式の署名
+func (sig *Signature) WithFormat(format SignatureFormat) *Signature {
+	return &Signature{R: sig.R, S: sig.S, Format: format}
+}
+
+// エンコードされた署名を厳密に読み込む
+// 形式が不明なもの、DERの冗長なエンコード、範囲外の値、low-Sでないものはエラーにする
+func ParseSignature(scheme Scheme, b []byte) (*Signature, error) {
+	if len(b) < 1 {
+		return nil, ErrInvalidSignature
+	}
+	var sig *Signature
+	var err error
+	switch SignatureFormat(b[0]) {
+	case SIGNATURE_FORMAT_DER:
+		sig, err = parseDER(b[1:])
+	case SIGNATURE_FORMAT_COMPACT:
+		sig, err = parseCompact(b[1:])
+	default:
+		return nil, ErrInvalidSignature
+	}
+	if err != nil {
+		return nil, err
+	}
+	order := scheme.Order()
+	if sig.R.Sign() <= 0 || sig.R.Cmp(order) >= 0 || sig.S.Sign() <= 0 {
+		return nil, ErrInvalidSignature
+	}
+	if sig.S.Cmp(halfOrder(order)) > 0 {
+		return nil, ErrHighS
+	}
+	return sig, nil
+}
+
+// 16進数の署名を読み込む
+func ParseSignatureString(scheme Scheme, s string) (*Signature, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	return ParseSignature(scheme, b)
+}
+
+func parseCompact(b []byte) (*Signature, error) {
+	if len(b) != COMPACT_SIGNATURE_SIZE {
+		return nil, ErrInvalidSignature
+	}
+	return &Signature{
+		R:      new(big.Int).SetBytes(b[:32]),
+		S:      new(big.Int).SetBytes(b[32:]),
+		Format: SIGNATURE_FORMAT_COMPACT,
+	}, nil
+}
+
+func parseDER(b []byte) (*Signature, error) {
+	if len(b) < 8 || len(b) > MAX_DER_SIGNATURE_SIZE || b[0] != 0x30 || int(b[1]) != len(b)-2 {
+		return nil, ErrInvalidSignature
+	}
+	r, rest, err := parseDERInt(b[2:])
+	if err != nil {
+		return nil, err
+	}
+	s, rest, err := parseDERInt(rest)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, ErrInvalidSignature
+	}
+	return &Signature{R: r, S: s, Format: SIGNATURE_FORMAT_DER}, nil
+}
+
+// DERの整数を読み込む（正の数で最小のバイト数のもののみ受け付ける）
+func parseDERInt(b []byte) (*big.Int, []byte, error) {
+	if len(b) < 2 || b[0] != 0x02 {
+		return nil, nil, ErrInvalidSignature
+	}
+	n := int(b[1])
+	if n == 0 || n > 33 || len(b) < 2+n {
+		return nil, nil, ErrInvalidSignature
+	}
+	v := b[2 : 2+n]
+	// 負の数
+	if v[0]&0x80 != 0 {
+		return nil, nil, ErrInvalidSignature
+	}
+	// 不要な0x00の付加
+	if n > 1 && v[0] == 0x00 && v[1]&0x80 == 0 {
+		return nil, nil, ErrInvalidSignature
+	}
+	return new(big.Int).SetBytes(v), b[2+n:], nil
+}
+
+func derInt(v *big.Int) []byte {
+	b := v.Bytes()
+	if len(b) == 0 || b[0]&0x80 != 0 {
+		b = append([]byte{0x00}, b...)
+	}
+	return b
+}
+
+func halfOrder(order *big.Int) *big.Int {
+	return new(big.Int).Rsh(order, 1)
+}
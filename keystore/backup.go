@@ -0,0 +1,45 @@
+package keystore
+
+import (
+	"errors"
+	"go-blockchain/wallet"
+)
+
+const BACKUP_TYPE = "go-blockchain-wallet-backup"
+
+var ErrInvalidBackup = errors.New("invalid backup file")
+
+// パスワードで暗号化したウォレットのバックアップ
+// キーストアのパスフレーズとは別のパスワードで暗号化する
+type Backup struct {
+	Type              string     `json:"type"`
+	Version           int        `json:"version"`
+	Scheme            string     `json:"scheme,omitempty"`
+	PublicKey         string     `json:"public_key"`
+	BlockchainAddress string     `json:"blockchain_address"`
+	Crypto            CryptoJSON `json:"crypto"`
+}
+
+// ウォレットをパスワードで暗号化したバックアップを作成する
+func ExportBackup(w *wallet.Wallet, password string) (*Backup, error) {
+	c, err := Encrypt(w.PrivateKeyBytes(), password, []byte(w.BlockchainAddress()))
+	if err != nil {
+		return nil, err
+	}
+	return &Backup{
+		Type:              BACKUP_TYPE,
+		Version:           KEYSTORE_VERSION,
+		Scheme:            string(w.Scheme().ID()),
+		PublicKey:         w.PublicKeyStr(),
+		BlockchainAddress: w.BlockchainAddress(),
+		Crypto:            *c,
+	}, nil
+}
+
+// バックアップをパスワードで復号してウォレットを取り出す
+func ImportBackup(b *Backup, password string) (*wallet.Wallet, error) {
+	if b.Type != BACKUP_TYPE || b.Version != KEYSTORE_VERSION {
+		return nil, ErrInvalidBackup
+	}
+	return decryptWallet(b.Scheme, &b.Crypto, password, b.BlockchainAddress)
+}
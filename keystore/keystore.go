@@ -0,0 +1,348 @@
+// ウォレットの秘密鍵をパスフレーズで暗号化してユーザーごとに保存するキーストア
+//
+// 秘密鍵はscryptでパスフレーズから導出した鍵を使ってAES-256-GCMで暗号化する
+// ファイルは<dir>/<user>/<wallet_id>.jsonに保存する
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-blockchain/keys"
+	"go-blockchain/wallet"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KEYSTORE_VERSION = 1
+
+	SCRYPT_N     = 1 << 15
+	SCRYPT_R     = 8
+	SCRYPT_P     = 1
+	SCRYPT_DKLEN = 32
+	SALT_SIZE    = 32
+
+	CIPHER_AES_256_GCM = "aes-256-gcm"
+	KDF_SCRYPT         = "scrypt"
+)
+
+var (
+	ErrInvalidName       = errors.New("invalid user or wallet id")
+	ErrNotFound          = errors.New("wallet not found")
+	ErrInvalidPassphrase = errors.New("invalid passphrase")
+	ErrEmptyPassphrase   = errors.New("passphrase must not be empty")
+	ErrAddressMismatch   = errors.New("address does not match the private key")
+	ErrUnsupportedCrypto = errors.New("unsupported cipher or kdf parameters")
+)
+
+// ユーザー名とウォレットIDに使える文字（パスに使うのでディレクトリの移動を防ぐ）
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// scryptのパラメータ
+type KDFParams struct {
+	N     int    `json:"n"`
+	R     int    `json:"r"`
+	P     int    `json:"p"`
+	DKLen int    `json:"dklen"`
+	Salt  string `json:"salt"`
+}
+
+// 暗号化した秘密鍵
+type CryptoJSON struct {
+	Cipher     string    `json:"cipher"`
+	CipherText string    `json:"ciphertext"`
+	Nonce      string    `json:"nonce"`
+	KDF        string    `json:"kdf"`
+	KDFParams  KDFParams `json:"kdfparams"`
+}
+
+// キーストアに保存するウォレットファイル
+// 公開鍵とアドレスは平文で持ち、パスフレーズなしで一覧表示できるようにする
+type KeyFile struct {
+	Version           int        `json:"version"`
+	ID                string     `json:"id"`
+	Scheme            string     `json:"scheme,omitempty"`
+	PublicKey         string     `json:"public_key"`
+	BlockchainAddress string     `json:"blockchain_address"`
+	Crypto            CryptoJSON `json:"crypto"`
+	// HDウォレットから導出した鍵の場合のシードのIDと導出パス
+	HDSeedID string `json:"hd_seed_id,omitempty"`
+	HDPath   string `json:"hd_path,omitempty"`
+}
+
+// 秘密鍵をパスフレーズで暗号化する
+// additionalDataは改ざん検知のために暗号文と一緒に認証される
+func Encrypt(plainText []byte, passphrase string, additionalData []byte) (*CryptoJSON, error) {
+	if passphrase == "" {
+		return nil, ErrEmptyPassphrase
+	}
+	salt := make([]byte, SALT_SIZE)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	params := KDFParams{N: SCRYPT_N, R: SCRYPT_R, P: SCRYPT_P, DKLen: SCRYPT_DKLEN, Salt: hex.EncodeToString(salt)}
+	gcm, err := newGCM(passphrase, &params)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	cipherText := gcm.Seal(nil, nonce, plainText, additionalData)
+	return &CryptoJSON{
+		Cipher:     CIPHER_AES_256_GCM,
+		CipherText: hex.EncodeToString(cipherText),
+		Nonce:      hex.EncodeToString(nonce),
+		KDF:        KDF_SCRYPT,
+		KDFParams:  params,
+	}, nil
+}
+
+// 暗号化した秘密鍵をパスフレーズで復号する
+func Decrypt(c *CryptoJSON, passphrase string, additionalData []byte) ([]byte, error) {
+	if c.Cipher != CIPHER_AES_256_GCM || c.KDF != KDF_SCRYPT {
+		return nil, ErrUnsupportedCrypto
+	}
+	gcm, err := newGCM(passphrase, &c.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := hex.DecodeString(c.Nonce)
+	if err != nil || len(nonce) != gcm.NonceSize() {
+		return nil, errors.New("invalid nonce")
+	}
+	cipherText, err := hex.DecodeString(c.CipherText)
+	if err != nil {
+		return nil, errors.New("invalid ciphertext")
+	}
+	plainText, err := gcm.Open(nil, nonce, cipherText, additionalData)
+	if err != nil {
+		// パスフレーズが違う場合も改ざんされた場合も認証に失敗する
+		return nil, ErrInvalidPassphrase
+	}
+	return plainText, nil
+}
+
+// パスフレーズからscryptで鍵を導出し、AES-GCMを作成する
+// バックアップのファイルは信頼できないので、巨大なNやpでメモリやCPUを使い切らないように
+// Encryptで使うパラメータ以外は受け付けない
+func newGCM(passphrase string, params *KDFParams) (cipher.AEAD, error) {
+	if params.N != SCRYPT_N || params.R != SCRYPT_R || params.P != SCRYPT_P || params.DKLen != SCRYPT_DKLEN {
+		return nil, ErrUnsupportedCrypto
+	}
+	salt, err := hex.DecodeString(params.Salt)
+	if err != nil || len(salt) != SALT_SIZE {
+		return nil, errors.New("invalid salt")
+	}
+	key, err := scrypt.Key([]byte(passphrase), salt, params.N, params.R, params.P, params.DKLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// ------------------------------------------------------------------------------------------
+type Keystore struct {
+	dir string
+	mux sync.Mutex
+}
+
+func NewKeystore(dir string) *Keystore {
+	return &Keystore{dir: dir}
+}
+
+func (ks *Keystore) Dir() string {
+	return ks.dir
+}
+
+// ウォレットを暗号化して保存し、保存したファイルの内容を返す
+func (ks *Keystore) Store(user string, w *wallet.Wallet, passphrase string) (*KeyFile, error) {
+	return ks.store(user, w, passphrase, "", "")
+}
+
+// HDウォレットから導出した鍵を、シードのIDと導出パスと一緒に保存する
+func (ks *Keystore) StoreDerived(user string, dw *wallet.DerivedWallet, seedID string, passphrase string) (*KeyFile, error) {
+	return ks.store(user, dw.Wallet, passphrase, seedID, dw.Path())
+}
+
+func (ks *Keystore) store(user string, w *wallet.Wallet, passphrase string, seedID string, hdPath string) (*KeyFile, error) {
+	if !namePattern.MatchString(user) {
+		return nil, ErrInvalidName
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	c, err := Encrypt(w.PrivateKeyBytes(), passphrase, []byte(w.BlockchainAddress()))
+	if err != nil {
+		return nil, err
+	}
+	kf := &KeyFile{
+		Version:           KEYSTORE_VERSION,
+		ID:                id,
+		Scheme:            string(w.Scheme().ID()),
+		PublicKey:         w.PublicKeyStr(),
+		BlockchainAddress: w.BlockchainAddress(),
+		Crypto:            *c,
+		HDSeedID:          seedID,
+		HDPath:            hdPath,
+	}
+
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	if err := writeFile(ks.path(user, id), kf); err != nil {
+		return nil, err
+	}
+	return kf, nil
+}
+
+// 保存されているウォレットファイルを取得する
+func (ks *Keystore) Get(user string, id string) (*KeyFile, error) {
+	if !namePattern.MatchString(user) || !namePattern.MatchString(id) {
+		return nil, ErrInvalidName
+	}
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	return readKeyFile(ks.path(user, id))
+}
+
+// ユーザーのウォレットの一覧を取得する
+func (ks *Keystore) List(user string) ([]*KeyFile, error) {
+	if !namePattern.MatchString(user) {
+		return nil, ErrInvalidName
+	}
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	paths, err := filepath.Glob(filepath.Join(ks.dir, user, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+	keys := make([]*KeyFile, 0, len(paths))
+	for _, p := range paths {
+		kf, err := readKeyFile(p)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, kf)
+	}
+	return keys, nil
+}
+
+// パスフレーズでウォレットの秘密鍵を復号する
+func (ks *Keystore) Unlock(user string, id string, passphrase string) (*wallet.Wallet, *KeyFile, error) {
+	kf, err := ks.Get(user, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	w, err := decryptWallet(kf.Scheme, &kf.Crypto, passphrase, kf.BlockchainAddress)
+	if err != nil {
+		return nil, nil, err
+	}
+	return w, kf, nil
+}
+
+// キーストアのウォレットファイルか暗号化バックアップのファイルを読み込み、パスフレーズで復号する
+// オフラインで署名する場合など、キーストアのディレクトリを使わずにファイルを直接指定する場合に使う
+func LoadKeyFile(path string, passphrase string) (*wallet.Wallet, error) {
+	m, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var backup Backup
+	if err := json.Unmarshal(m, &backup); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	if backup.Type != "" {
+		return ImportBackup(&backup, passphrase)
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(m, &kf); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return decryptWallet(kf.Scheme, &kf.Crypto, passphrase, kf.BlockchainAddress)
+}
+
+// 秘密鍵を復号し、ファイルに記録されたアドレスと一致するか確認する
+func decryptWallet(schemeID string, c *CryptoJSON, passphrase string, address string) (*wallet.Wallet, error) {
+	scheme, err := Scheme(schemeID)
+	if err != nil {
+		return nil, err
+	}
+	d, err := Decrypt(c, passphrase, []byte(address))
+	if err != nil {
+		return nil, err
+	}
+	w, err := wallet.FromPrivateKeyBytes(scheme, d)
+	if err != nil {
+		return nil, err
+	}
+	if w.BlockchainAddress() != address {
+		return nil, ErrAddressMismatch
+	}
+	return w, nil
+}
+
+// ファイルに記録された署名方式を取得する
+// 署名方式の記録がないファイルはsecp256k1に移行する前のP-256の鍵
+func Scheme(id string) (keys.Scheme, error) {
+	if id == "" {
+		return keys.P256, nil
+	}
+	return keys.SchemeByID(keys.SchemeID(id))
+}
+
+func (ks *Keystore) path(user string, id string) string {
+	return filepath.Join(ks.dir, user, id+".json")
+}
+
+// 書き込み途中のファイルが残らないように一時ファイルに書いてからrenameする
+func writeFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	m, _ := json.MarshalIndent(v, "", "  ")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, m, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func readKeyFile(path string) (*KeyFile, error) {
+	m, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var kf KeyFile
+	if err := json.Unmarshal(m, &kf); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return &kf, nil
+}
+
+func newID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
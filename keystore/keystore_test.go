@@ -0,0 +1,52 @@
+package keystore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDecrypt(t *testing.T) {
+	c, err := Encrypt([]byte("secret"), "passphrase", []byte("address"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plainText, err := Decrypt(c, "passphrase", []byte("address"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plainText) != "secret" {
+		t.Errorf("got %q, want %q", plainText, "secret")
+	}
+	if _, err := Decrypt(c, "wrong", []byte("address")); err != ErrInvalidPassphrase {
+		t.Errorf("wrong passphrase: got %v, want %v", err, ErrInvalidPassphrase)
+	}
+}
+
+// ファイルのscryptのパラメータは信頼せず、導出する前に拒否する
+func TestDecryptUnsupportedKDFParams(t *testing.T) {
+	c, err := Encrypt([]byte("secret"), "passphrase", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := map[string]func(p *KDFParams){
+		"huge n":   func(p *KDFParams) { p.N = 1 << 30 },
+		"small n":  func(p *KDFParams) { p.N = 2 },
+		"huge r":   func(p *KDFParams) { p.R = 1 << 20 },
+		"huge p":   func(p *KDFParams) { p.P = 1 << 20 },
+		"dklen":    func(p *KDFParams) { p.DKLen = 1 << 30 },
+		"negative": func(p *KDFParams) { p.N = -1 },
+	}
+	for name, modify := range tests {
+		t.Run(name, func(t *testing.T) {
+			tampered := *c
+			modify(&tampered.KDFParams)
+			start := time.Now()
+			if _, err := Decrypt(&tampered, "passphrase", nil); err != ErrUnsupportedCrypto {
+				t.Errorf("got %v, want %v", err, ErrUnsupportedCrypto)
+			}
+			if d := time.Since(start); d > time.Second {
+				t.Errorf("rejecting took %s", d)
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package keystore
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-blockchain/keys"
+	"os"
+	"path/filepath"
+)
+
+// シードファイルを保存するユーザーのディレクトリ内のサブディレクトリ
+const SEED_DIR = "seeds"
+
+// HDウォレットのシードをパスフレーズで暗号化したファイル
+// 導出した鍵はKeyFileとして別に保存し、新しいアドレスを導出する時だけシードを復号する
+type SeedFile struct {
+	Version int        `json:"version"`
+	ID      string     `json:"id"`
+	Scheme  string     `json:"scheme,omitempty"` // 鍵の導出に使う署名方式
+	Crypto  CryptoJSON `json:"crypto"`
+}
+
+// シードを暗号化して保存する
+func (ks *Keystore) StoreSeed(user string, scheme keys.Scheme, seed []byte, passphrase string) (*SeedFile, error) {
+	if !namePattern.MatchString(user) {
+		return nil, ErrInvalidName
+	}
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+	c, err := Encrypt(seed, passphrase, []byte(id))
+	if err != nil {
+		return nil, err
+	}
+	sf := &SeedFile{Version: KEYSTORE_VERSION, ID: id, Scheme: string(scheme.ID()), Crypto: *c}
+
+	ks.mux.Lock()
+	defer ks.mux.Unlock()
+	if err := writeFile(ks.seedPath(user, id), sf); err != nil {
+		return nil, err
+	}
+	return sf, nil
+}
+
+// パスフレーズでシードを復号し、シードと署名方式を返す
+func (ks *Keystore) UnlockSeed(user string, id string, passphrase string) ([]byte, keys.Scheme, error) {
+	if !namePattern.MatchString(user) || !namePattern.MatchString(id) {
+		return nil, nil, ErrInvalidName
+	}
+	ks.mux.Lock()
+	m, err := os.ReadFile(ks.seedPath(user, id))
+	ks.mux.Unlock()
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	var sf SeedFile
+	if err := json.Unmarshal(m, &sf); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", id, err)
+	}
+	scheme, err := Scheme(sf.Scheme)
+	if err != nil {
+		return nil, nil, err
+	}
+	seed, err := Decrypt(&sf.Crypto, passphrase, []byte(sf.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return seed, scheme, nil
+}
+
+func (ks *Keystore) seedPath(user string, id string) string {
+	return filepath.Join(ks.dir, user, SEED_DIR, id+".json")
+}
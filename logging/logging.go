@@ -0,0 +1,236 @@
+// レベル付きの構造化ログ（1行に1レコードのlogfmtまたはJSON）
+//
+// 出力先、形式、レベルはプロセスで共有し、管理APIから実行中にレベルを変更できる
+// 同じプロセスの複数のnodeはLoggerにportなどのフィールドを付けて区別する
+package logging
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ログのレベル
+type Level int32
+
+const (
+	DEBUG Level = iota
+	INFO
+	WARN
+	ERROR
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < DEBUG || l > ERROR {
+		return "level(" + strconv.Itoa(int(l)) + ")"
+	}
+	return levelNames[l]
+}
+
+// "debug"、"info"、"warn"、"error"（大文字小文字は区別しない）
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("%w %q (debug, info, warn or error)", ErrInvalidLevel, s)
+}
+
+// 出力形式
+const (
+	FORMAT_LOGFMT = "logfmt"
+	FORMAT_JSON   = "json"
+)
+
+// ログを出力した処理の区分（componentフィールドの値）
+const (
+	COMPONENT_CHAIN   = "chain"   // ブロックの検証、チェーンの置き換え
+	COMPONENT_MEMPOOL = "mempool" // TransactionのPool
+	COMPONENT_P2P     = "p2p"     // neighborとの通信
+	COMPONENT_MINER   = "miner"   // マイニング
+	COMPONENT_RPC     = "rpc"     // REST APIとJSON-RPCのリクエスト
+	COMPONENT_EVENTS  = "events"  // Server-Sent EventsとWebSocket
+	COMPONENT_WEBHOOK = "webhook" // Webhookの配信
+)
+
+var (
+	ErrInvalidLevel  = errors.New("invalid log level")
+	ErrInvalidFormat = errors.New("invalid log format")
+)
+
+// プロセスで共有する出力先
+type output struct {
+	w      io.Writer
+	format string
+	mux    sync.Mutex
+	level  int32 // atomicで読み書きする
+}
+
+var std = &output{w: os.Stderr, format: FORMAT_LOGFMT, level: int32(INFO)}
+
+func SetOutput(w io.Writer) {
+	std.mux.Lock()
+	defer std.mux.Unlock()
+	std.w = w
+}
+
+func SetFormat(format string) error {
+	if format != FORMAT_LOGFMT && format != FORMAT_JSON {
+		return fmt.Errorf("%w %q (logfmt or json)", ErrInvalidFormat, format)
+	}
+	std.mux.Lock()
+	defer std.mux.Unlock()
+	std.format = format
+	return nil
+}
+
+// コマンドライン引数のレベルと形式を設定する
+func Configure(level string, format string) error {
+	l, err := ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	if err := SetFormat(format); err != nil {
+		return err
+	}
+	SetLevel(l)
+	return nil
+}
+
+// 出力する最低のレベルを変更する
+func SetLevel(l Level) {
+	atomic.StoreInt32(&std.level, int32(l))
+}
+
+func CurrentLevel() Level {
+	return Level(atomic.LoadInt32(&std.level))
+}
+
+func Enabled(l Level) bool {
+	return l >= CurrentLevel()
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// 全てのレコードに付けるフィールドを持つLogger
+type Logger struct {
+	fields []interface{} // key, value, key, value, ...
+}
+
+// kvはkeyとvalueを交互に並べたもの
+func New(kv ...interface{}) *Logger {
+	return &Logger{fields: kv}
+}
+
+// フィールドを追加したLoggerを返す（元のLoggerは変更しない）
+func (l *Logger) With(kv ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(kv))
+	fields = append(fields, l.fields...)
+	return &Logger{fields: append(fields, kv...)}
+}
+
+func (l *Logger) Component(name string) *Logger {
+	return l.With("component", name)
+}
+
+func (l *Logger) Debug(msg string, kv ...interface{}) {
+	l.log(DEBUG, msg, kv)
+}
+
+func (l *Logger) Info(msg string, kv ...interface{}) {
+	l.log(INFO, msg, kv)
+}
+
+func (l *Logger) Warn(msg string, kv ...interface{}) {
+	l.log(WARN, msg, kv)
+}
+
+func (l *Logger) Error(msg string, kv ...interface{}) {
+	l.log(ERROR, msg, kv)
+}
+
+func (l *Logger) log(level Level, msg string, kv []interface{}) {
+	if !Enabled(level) {
+		return
+	}
+	pairs := make([]interface{}, 0, 6+len(l.fields)+len(kv))
+	pairs = append(pairs, "time", time.Now().UTC().Format("2006-01-02T15:04:05.000Z07:00"), "level", level.String(), "msg", msg)
+	pairs = append(pairs, l.fields...)
+	pairs = append(pairs, kv...)
+
+	std.mux.Lock()
+	defer std.mux.Unlock()
+	var line string
+	if std.format == FORMAT_JSON {
+		line = formatJSON(pairs)
+	} else {
+		line = formatLogfmt(pairs)
+	}
+	io.WriteString(std.w, line+"\n")
+}
+
+// keyとvalueの組に分ける（valueが足りない場合は"(MISSING)"にする）
+func eachPair(pairs []interface{}, fn func(key string, value interface{})) {
+	for i := 0; i < len(pairs); i += 2 {
+		key := fmt.Sprint(pairs[i])
+		var value interface{} = "(MISSING)"
+		if i+1 < len(pairs) {
+			value = pairs[i+1]
+		}
+		switch v := value.(type) {
+		case error:
+			value = v.Error()
+		case fmt.Stringer:
+			value = v.String()
+		}
+		fn(key, value)
+	}
+}
+
+// key=value key="value with spaces"
+func formatLogfmt(pairs []interface{}) string {
+	var sb strings.Builder
+	eachPair(pairs, func(key string, value interface{}) {
+		if sb.Len() > 0 {
+			sb.WriteByte(' ')
+		}
+		sb.WriteString(key)
+		sb.WriteByte('=')
+		s := fmt.Sprint(value)
+		if s == "" || strings.ContainsAny(s, " =\"\\") || strings.IndexFunc(s, func(r rune) bool { return r < 0x20 }) >= 0 {
+			s = strconv.Quote(s)
+		}
+		sb.WriteString(s)
+	})
+	return sb.String()
+}
+
+// {"key":value,...}（keyの順番はフィールドの順番のまま）
+func formatJSON(pairs []interface{}) string {
+	var sb strings.Builder
+	sb.WriteByte('{')
+	eachPair(pairs, func(key string, value interface{}) {
+		if sb.Len() > 1 {
+			sb.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		v, err := json.Marshal(value)
+		if err != nil {
+			v, _ = json.Marshal(fmt.Sprint(value))
+		}
+		sb.Write(k)
+		sb.WriteByte(':')
+		sb.Write(v)
+	})
+	sb.WriteByte('}')
+	return sb.String()
+}
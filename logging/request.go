@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"go-blockchain/utils"
+	"net/http"
+	"time"
+)
+
+// wallet_serverからBlockchainServer、BlockchainServerからneighborへ引き継ぐリクエストIDのヘッダー
+const REQUEST_ID_HEADER = "X-Request-Id"
+
+// 受け取ったリクエストIDの最大の長さ（超える場合や使えない文字を含む場合は新しく作る）
+const MAX_REQUEST_ID_SIZE = 64
+
+type loggerKey struct{}
+type requestIDKey struct{}
+
+// ctxにLoggerを持たせる
+func NewContext(ctx context.Context, l *Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, l)
+}
+
+// ctxのLogger（持っていない場合はフィールドのないLogger）
+func FromContext(ctx context.Context) *Logger {
+	if l, ok := ctx.Value(loggerKey{}).(*Logger); ok {
+		return l
+	}
+	return New()
+}
+
+// ctxのリクエストID（持っていない場合は空）
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// 16文字の16進数のリクエストID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// 英数字と"-_.:"のみのMAX_REQUEST_ID_SIZE以下の文字列
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > MAX_REQUEST_ID_SIZE {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9', c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// 送信するリクエストにctxのリクエストIDを付ける
+func SetRequestID(ctx context.Context, req *http.Request) {
+	if id := RequestID(ctx); id != "" {
+		req.Header.Set(REQUEST_ID_HEADER, id)
+	}
+}
+
+// リクエストIDを引き継ぐ（無ければ作る）ハンドラ
+// リクエストIDはレスポンスのヘッダーにも付け、request_idフィールドを付けたlをハンドラのcontextに持たせる
+// 処理が終わったらDEBUGでアクセスログを出力する
+func Handler(l *Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(REQUEST_ID_HEADER)
+		if !ValidRequestID(id) {
+			id = NewRequestID()
+		}
+		w.Header().Set(REQUEST_ID_HEADER, id)
+		rl := l.With("request_id", id)
+		ctx := NewContext(context.WithValue(req.Context(), requestIDKey{}, id), rl)
+
+		start := time.Now()
+		sw := utils.NewStatusWriter(w)
+		h.ServeHTTP(sw, req.WithContext(ctx))
+		rl.Debug("request", "method", req.Method, "path", req.URL.Path, "status", sw.Status(),
+			"duration", time.Since(start), "remote", req.RemoteAddr)
+	})
+}
@@ -0,0 +1,33 @@
+package metrics
+
+import (
+	"go-blockchain/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPのハンドラのレイテンシ
+type HTTPMetrics struct {
+	duration *HistogramVec
+}
+
+func (r *Registry) NewHTTPMetrics() *HTTPMetrics {
+	return &HTTPMetrics{
+		duration: r.NewHistogramVec("http_request_duration_seconds",
+			"Latency of HTTP handlers by route template, method and status code",
+			DefaultBuckets, "route", "method", "code"),
+	}
+}
+
+// hのレイテンシをrouteのラベルで記録する
+// routeはパスそのものではなく"/v1/blocks/{id}"のようなテンプレートにして系列が増えすぎないようにする
+func (m *HTTPMetrics) Handler(route string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		sw := utils.NewStatusWriter(w)
+		h.ServeHTTP(sw, req)
+		m.duration.WithLabelValues(route, req.Method, strconv.Itoa(sw.Status())).
+			Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,319 @@
+// Prometheusのテキスト形式（version 0.0.4）で公開するメトリクス
+//
+// 1つのプロセスで複数のnodeを動かせるように、メトリクスはグローバルではなくRegistryごとに登録する
+package metrics
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const CONTENT_TYPE = "text/plain; version=0.0.4; charset=utf-8"
+
+// HTTPのレイテンシのデフォルトのバケット（秒）
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// 登録したメトリクスを書き出すもの
+type collector interface {
+	name() string
+	write(sb *strings.Builder)
+}
+
+// メトリクスの登録先
+type Registry struct {
+	collectors []collector
+	mux        sync.Mutex
+}
+
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// 同じ名前のメトリクスの重複登録は起動時に検出する
+func (r *Registry) register(c collector) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, rc := range r.collectors {
+		if rc.name() == c.name() {
+			panic(fmt.Sprintf("metrics: duplicate metric %s", c.name()))
+		}
+	}
+	r.collectors = append(r.collectors, c)
+}
+
+// 全てのメトリクスを名前順にテキスト形式で書き出す
+func (r *Registry) Text() string {
+	r.mux.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mux.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+
+	var sb strings.Builder
+	for _, c := range collectors {
+		c.write(&sb)
+	}
+	return sb.String()
+}
+
+// GET /metricsのハンドル
+func (r *Registry) Handler() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", CONTENT_TYPE)
+		w.Write([]byte(r.Text()))
+	}
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// メトリクスの名前、説明、種類、ラベル名
+type desc struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+func (d *desc) name() string {
+	return d.Name
+}
+
+func (d *desc) header(sb *strings.Builder) {
+	fmt.Fprintf(sb, "# HELP %s %s\n", d.Name, escapeHelp(d.Help))
+	fmt.Fprintf(sb, "# TYPE %s %s\n", d.Name, d.Type)
+}
+
+// {a="1",b="2"}の形式のラベル（extraは"le"などの追加のラベル）
+func (d *desc) labels(values []string, extra ...string) string {
+	if len(values) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(values)+len(extra)/2)
+	for i, v := range values {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, d.Labels[i], escapeLabel(v)))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extra[i], escapeLabel(extra[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.Labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", d.Name, len(d.Labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`).Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// ラベルごとの値（counterとgauge）
+type valueVec struct {
+	desc
+	values map[string]*Value
+	mux    sync.Mutex
+}
+
+// 1つの系列の値
+type Value struct {
+	labels []string
+	v      float64
+	mux    sync.Mutex
+}
+
+func (v *Value) Add(delta float64) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.v += delta
+}
+
+func (v *Value) Inc() {
+	v.Add(1)
+}
+
+func (v *Value) Set(value float64) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	v.v = value
+}
+
+func (v *Value) Get() float64 {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	return v.v
+}
+
+func (vv *valueVec) with(values []string) *Value {
+	k := vv.key(values)
+	vv.mux.Lock()
+	defer vv.mux.Unlock()
+	v, ok := vv.values[k]
+	if !ok {
+		v = &Value{labels: append([]string(nil), values...)}
+		vv.values[k] = v
+	}
+	return v
+}
+
+func (vv *valueVec) write(sb *strings.Builder) {
+	vv.header(sb)
+	vv.mux.Lock()
+	keys := make([]string, 0, len(vv.values))
+	for k := range vv.values {
+		keys = append(keys, k)
+	}
+	vv.mux.Unlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		vv.mux.Lock()
+		v := vv.values[k]
+		vv.mux.Unlock()
+		fmt.Fprintf(sb, "%s%s %s\n", vv.Name, vv.labels(v.labels), formatFloat(v.Get()))
+	}
+}
+
+// 増えるだけの値（ラベル付き）
+type CounterVec struct {
+	valueVec
+}
+
+func (r *Registry) NewCounterVec(name string, help string, labels ...string) *CounterVec {
+	c := &CounterVec{valueVec{desc: desc{name, help, "counter", labels}, values: make(map[string]*Value)}}
+	r.register(c)
+	return c
+}
+
+func (c *CounterVec) WithLabelValues(values ...string) *Value {
+	return c.with(values)
+}
+
+// 増えるだけの値
+func (r *Registry) NewCounter(name string, help string) *Value {
+	c := r.NewCounterVec(name, help)
+	return c.with(nil)
+}
+
+// 増減する値
+func (r *Registry) NewGauge(name string, help string) *Value {
+	g := &valueVec{desc: desc{name, help, "gauge", nil}, values: make(map[string]*Value)}
+	r.register(g)
+	return g.with(nil)
+}
+
+// 書き出す時に計算する値
+type gaugeFunc struct {
+	desc
+	fn func() float64
+}
+
+func (r *Registry) NewGaugeFunc(name string, help string, fn func() float64) {
+	r.register(&gaugeFunc{desc{name, help, "gauge", nil}, fn})
+}
+
+func (g *gaugeFunc) write(sb *strings.Builder) {
+	g.header(sb)
+	fmt.Fprintf(sb, "%s %s\n", g.Name, formatFloat(g.fn()))
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// 値の分布（ラベル付き）
+type HistogramVec struct {
+	desc
+	buckets    []float64
+	histograms map[string]*Histogram
+	mux        sync.Mutex
+}
+
+// 1つの系列の分布
+type Histogram struct {
+	labels  []string
+	buckets []float64
+	counts  []uint64 // バケットごとの数（累積ではない）
+	count   uint64
+	sum     float64
+	mux     sync.Mutex
+}
+
+func (r *Registry) NewHistogramVec(name string, help string, buckets []float64, labels ...string) *HistogramVec {
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	h := &HistogramVec{desc: desc{name, help, "histogram", labels}, buckets: buckets, histograms: make(map[string]*Histogram)}
+	r.register(h)
+	return h
+}
+
+func (r *Registry) NewHistogram(name string, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).WithLabelValues()
+}
+
+func (hv *HistogramVec) WithLabelValues(values ...string) *Histogram {
+	k := hv.key(values)
+	hv.mux.Lock()
+	defer hv.mux.Unlock()
+	h, ok := hv.histograms[k]
+	if !ok {
+		h = &Histogram{labels: append([]string(nil), values...), buckets: hv.buckets, counts: make([]uint64, len(hv.buckets))}
+		hv.histograms[k] = h
+	}
+	return h
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.counts) {
+		h.counts[i]++
+	}
+	h.count++
+	h.sum += v
+}
+
+func (hv *HistogramVec) write(sb *strings.Builder) {
+	hv.header(sb)
+	hv.mux.Lock()
+	keys := make([]string, 0, len(hv.histograms))
+	for k := range hv.histograms {
+		keys = append(keys, k)
+	}
+	hv.mux.Unlock()
+	sort.Strings(keys)
+	for _, k := range keys {
+		hv.mux.Lock()
+		h := hv.histograms[k]
+		hv.mux.Unlock()
+
+		h.mux.Lock()
+		var cumulative uint64
+		for i, b := range h.buckets {
+			cumulative += h.counts[i]
+			fmt.Fprintf(sb, "%s_bucket%s %d\n", hv.Name, hv.labels(h.labels, "le", formatFloat(b)), cumulative)
+		}
+		fmt.Fprintf(sb, "%s_bucket%s %d\n", hv.Name, hv.labels(h.labels, "le", "+Inf"), h.count)
+		fmt.Fprintf(sb, "%s_sum%s %s\n", hv.Name, hv.labels(h.labels), formatFloat(h.sum))
+		fmt.Fprintf(sb, "%s_count%s %d\n", hv.Name, hv.labels(h.labels), h.count)
+		h.mux.Unlock()
+	}
+}
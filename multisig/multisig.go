@@ -0,0 +1,153 @@
+// m-of-nのマルチシグのアドレス
+//
+// 公開鍵を辞書順に並べ、Bitcoinと同じ形式のredeem script
+// OP_m <pubkey1> ... <pubkeyN> OP_n OP_CHECKMULTISIG を作り、
+// そのhashからP2SHのアドレスを作る
+// 署名の検証はscriptパッケージでredeem scriptを実行して行う
+package multisig
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"go-blockchain/keys"
+	"go-blockchain/script"
+	"sort"
+)
+
+const MAX_PUBLIC_KEYS = 15
+
+var (
+	ErrInvalidThreshold = errors.New("threshold must be between 1 and the number of public keys")
+	ErrTooManyKeys      = errors.New("too many public keys")
+	ErrDuplicateKey     = errors.New("duplicate public key")
+	ErrMixedSchemes     = errors.New("public keys must use the same signature scheme")
+	ErrInvalidScript    = errors.New("invalid redeem script")
+)
+
+// マルチシグのredeem script
+type Script struct {
+	threshold  int
+	publicKeys []keys.PublicKey // 圧縮形式の辞書順
+}
+
+// 閾値と公開鍵からredeem scriptを作成する（公開鍵は辞書順に並べ替える）
+func New(threshold int, publicKeys []keys.PublicKey) (*Script, error) {
+	if len(publicKeys) > MAX_PUBLIC_KEYS {
+		return nil, ErrTooManyKeys
+	}
+	if threshold < 1 || threshold > len(publicKeys) {
+		return nil, ErrInvalidThreshold
+	}
+	sorted := make([]keys.PublicKey, len(publicKeys))
+	copy(sorted, publicKeys)
+	sort.Slice(sorted, func(i, j int) bool {
+		return bytes.Compare(sorted[i].SerializeCompressed(), sorted[j].SerializeCompressed()) < 0
+	})
+	for i, pub := range sorted {
+		if pub.Scheme() != sorted[0].Scheme() {
+			return nil, ErrMixedSchemes
+		}
+		if i > 0 && bytes.Equal(pub.SerializeCompressed(), sorted[i-1].SerializeCompressed()) {
+			return nil, ErrDuplicateKey
+		}
+	}
+	return &Script{threshold: threshold, publicKeys: sorted}, nil
+}
+
+// redeem scriptを厳密に読み込む（公開鍵が辞書順でないものは受け付けない）
+func Parse(scheme keys.Scheme, b []byte) (*Script, error) {
+	if len(b) < 3 || b[len(b)-1] != script.OP_CHECKMULTISIG {
+		return nil, ErrInvalidScript
+	}
+	m, ok := smallInt(b[0])
+	if !ok {
+		return nil, ErrInvalidScript
+	}
+	n, ok := smallInt(b[len(b)-2])
+	if !ok || n > MAX_PUBLIC_KEYS {
+		return nil, ErrInvalidScript
+	}
+	body := b[1 : len(b)-2]
+	if len(body) != n*(1+keys.COMPRESSED_PUBLIC_KEY_SIZE) {
+		return nil, ErrInvalidScript
+	}
+	publicKeys := make([]keys.PublicKey, 0, n)
+	for i := 0; i < n; i++ {
+		chunk := body[i*(1+keys.COMPRESSED_PUBLIC_KEY_SIZE) : (i+1)*(1+keys.COMPRESSED_PUBLIC_KEY_SIZE)]
+		if chunk[0] != keys.COMPRESSED_PUBLIC_KEY_SIZE {
+			return nil, ErrInvalidScript
+		}
+		pub, err := scheme.ParsePublicKey(chunk[1:])
+		if err != nil {
+			return nil, err
+		}
+		publicKeys = append(publicKeys, pub)
+	}
+	s, err := New(m, publicKeys)
+	if err != nil {
+		return nil, err
+	}
+	// 並べ替えで順番が変わる場合は同じアドレスに複数のscriptが対応してしまうので拒否する
+	if !bytes.Equal(s.Bytes(), b) {
+		return nil, ErrInvalidScript
+	}
+	return s, nil
+}
+
+// 16進数のredeem scriptを読み込む
+func ParseString(scheme keys.Scheme, s string) (*Script, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidScript
+	}
+	return Parse(scheme, b)
+}
+
+func (s *Script) Threshold() int {
+	return s.threshold
+}
+
+func (s *Script) PublicKeys() []keys.PublicKey {
+	return s.publicKeys
+}
+
+func (s *Script) Scheme() keys.Scheme {
+	return s.publicKeys[0].Scheme()
+}
+
+// OP_m <pubkey1> ... <pubkeyN> OP_n OP_CHECKMULTISIG
+func (s *Script) Bytes() []byte {
+	b := []byte{script.OP_1 - 1 + byte(s.threshold)}
+	for _, pub := range s.publicKeys {
+		b = append(b, keys.COMPRESSED_PUBLIC_KEY_SIZE)
+		b = append(b, pub.SerializeCompressed()...)
+	}
+	return append(b, script.OP_1-1+byte(len(s.publicKeys)), script.OP_CHECKMULTISIG)
+}
+
+func (s *Script) String() string {
+	return hex.EncodeToString(s.Bytes())
+}
+
+// redeem scriptのhashから作るアドレス
+func (s *Script) Address() string {
+	return script.ScriptHashAddress(s.Bytes())
+}
+
+// 公開鍵のインデックス（含まれていなければ-1）
+func (s *Script) IndexOf(pub keys.PublicKey) int {
+	for i, p := range s.publicKeys {
+		if bytes.Equal(p.SerializeCompressed(), pub.SerializeCompressed()) {
+			return i
+		}
+	}
+	return -1
+}
+
+func smallInt(op byte) (int, bool) {
+	if op < script.OP_1 || op > script.OP_16 {
+		return 0, false
+	}
+	return int(op-script.OP_1) + 1, true
+}
@@ -0,0 +1,204 @@
+package node
+
+import (
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// 管理APIのリクエストボディの最大バイト数
+const MAX_ADMIN_REQUEST_SIZE = 1 << 10
+
+// 管理APIのトークンを確認するハンドル
+// トークンを設定している場合は"Authorization: Bearer <token>"が必要
+// 設定していない場合は同じホストから（ループバックアドレス）のリクエストのみ受け付ける
+func (bcs *BlockchainServer) admin(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if bcs.adminToken == "" {
+			if !isLoopback(req.RemoteAddr) {
+				api.WriteError(w, http.StatusUnauthorized, api.CodeUnauthorized,
+					"admin token is not set; the admin API is only available from localhost")
+				return
+			}
+		} else {
+			token := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(bcs.adminToken)) != 1 {
+				api.WriteError(w, http.StatusUnauthorized, api.CodeUnauthorized, "invalid admin token")
+				return
+			}
+		}
+		next(w, req)
+	}
+}
+
+// host:port形式のアドレスがループバックアドレスか
+func isLoopback(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// nodeの状態を返すAPI
+func (bcs *BlockchainServer) Info(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	chain := bc.Chain()
+	params := bc.Params()
+	api.WriteJSON(w, http.StatusOK, &InfoResponse{
+		Network:          params.Name,
+		Port:             bcs.Port(),
+		Blocks:           len(chain),
+		BestBlockHash:    fmt.Sprintf("%x", chain[len(chain)-1].Hash()),
+		Difficulty:       params.MiningDifficulty,
+		MiningReward:     params.MiningReward,
+		CoinbaseMaturity: params.CoinbaseMaturity,
+		Mining:           bc.IsMining(),
+		MinerAddress:     bc.BlockchainAddress(),
+		MempoolSize:      len(bc.TransactionPool()),
+		Peers:            len(bc.Neighbors()),
+		Banned:           len(bc.Banned()),
+	})
+}
+
+// 高さかhashで指定したブロックを返すAPI
+func (bcs *BlockchainServer) GetBlock(w http.ResponseWriter, req *http.Request) {
+	id := api.PathParam(req, "id")
+	chain := bcs.GetBlockchain().Chain()
+	height, ok := findBlock(chain, id)
+	if !ok {
+		api.WriteError(w, http.StatusNotFound, api.CodeNotFound, fmt.Sprintf("block %s not found", id))
+		return
+	}
+	b := chain[height]
+	api.WriteJSON(w, http.StatusOK, &BlockResponse{
+		Height:        height,
+		Hash:          fmt.Sprintf("%x", b.Hash()),
+		Confirmations: len(chain) - height,
+		Block:         b,
+	})
+}
+
+// 数字の場合は高さ、64文字の16進数の場合はhashとしてブロックを探す
+func findBlock(chain []*block.Block, id string) (int, bool) {
+	if height, err := strconv.Atoi(id); err == nil {
+		return height, height >= 0 && height < len(chain)
+	}
+	hash, err := hex.DecodeString(id)
+	if err != nil || len(hash) != 32 {
+		return 0, false
+	}
+	for i, b := range chain {
+		h := b.Hash()
+		if string(h[:]) == string(hash) {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// neighborとBanしたneighborの一覧を返すAPI
+func (bcs *BlockchainServer) Peers(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	api.WriteJSON(w, http.StatusOK, &PeersResponse{Peers: bc.Neighbors(), Banned: bc.Banned()})
+}
+
+// neighborを手動で追加するAPI
+func (bcs *BlockchainServer) AddPeer(w http.ResponseWriter, req *http.Request) {
+	pr, ok := decodePeerRequest(w, req)
+	if !ok {
+		return
+	}
+	bc := bcs.GetBlockchain()
+	if err := bc.AddNeighbor(*pr.Address); err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	logging.FromContext(req.Context()).Info("peer added", "peer", *pr.Address)
+	api.WriteJSON(w, http.StatusOK, &PeersResponse{Peers: bc.Neighbors(), Banned: bc.Banned()})
+}
+
+// neighborをBanするAPI
+func (bcs *BlockchainServer) BanPeer(w http.ResponseWriter, req *http.Request) {
+	pr, ok := decodePeerRequest(w, req)
+	if !ok {
+		return
+	}
+	bc := bcs.GetBlockchain()
+	bc.Ban(*pr.Address)
+	logging.FromContext(req.Context()).Info("peer banned", "peer", *pr.Address)
+	api.WriteJSON(w, http.StatusOK, &PeersResponse{Peers: bc.Neighbors(), Banned: bc.Banned()})
+}
+
+func decodePeerRequest(w http.ResponseWriter, req *http.Request) (*block.PeerRequest, bool) {
+	var pr block.PeerRequest
+	if !api.DecodeJSON(w, req, MAX_ADMIN_REQUEST_SIZE, &pr) {
+		return nil, false
+	}
+	if !pr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "address must be host:port")
+		return nil, false
+	}
+	return &pr, true
+}
+
+// 自動マイニングを停止するAPI
+func (bcs *BlockchainServer) StopMine(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	bc.StopMining()
+	api.WriteSuccess(w, http.StatusOK)
+}
+
+// 保持しているブロックチェーンを検証するAPI
+func (bcs *BlockchainServer) VerifyChain(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	chain := bc.Chain()
+	resp := &VerifyChainResponse{Valid: true, Blocks: len(chain)}
+	if err := bc.VerifyChain(chain); err != nil {
+		resp.Valid, resp.Error = false, err.Error()
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+}
+
+// PUT /v1/admin/loglevelのリクエスト
+type LogLevelRequest struct {
+	Level *string `json:"level"`
+}
+
+// levelはdebug、info、warn、errorのいずれか
+func (lr *LogLevelRequest) Validate() bool {
+	if lr.Level == nil {
+		return false
+	}
+	_, err := logging.ParseLevel(*lr.Level)
+	return err == nil
+}
+
+// 出力しているログのレベルを返すAPI
+func (bcs *BlockchainServer) LogLevel(w http.ResponseWriter, req *http.Request) {
+	api.WriteJSON(w, http.StatusOK, &LogLevelResponse{Level: logging.CurrentLevel().String()})
+}
+
+// ログのレベルを変更するAPI（同じプロセスの全てのサーバーに反映される）
+func (bcs *BlockchainServer) SetLogLevel(w http.ResponseWriter, req *http.Request) {
+	var lr LogLevelRequest
+	if !api.DecodeJSON(w, req, MAX_ADMIN_REQUEST_SIZE, &lr) {
+		return
+	}
+	if !lr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "level must be debug, info, warn or error")
+		return
+	}
+	level, _ := logging.ParseLevel(*lr.Level)
+	logging.FromContext(req.Context()).Info("log level changed", "from", logging.CurrentLevel(), "to", level)
+	logging.SetLevel(level)
+	api.WriteJSON(w, http.StatusOK, &LogLevelResponse{Level: level.String()})
+}
@@ -0,0 +1,89 @@
+package node
+
+import (
+	"go-blockchain/block"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T, token string) http.Handler {
+	t.Helper()
+	bcs := NewBlockchainServer(0, block.RegtestParams)
+	bcs.SetAdminToken(token)
+	t.Cleanup(bcs.Close)
+	return bcs.Handler()
+}
+
+func serve(h http.Handler, method string, path string, body string, remoteAddr string, token string) int {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.RemoteAddr = remoteAddr
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// トークンを設定していない場合、管理APIは同じホストからのリクエストのみ受け付ける
+func TestAdminWithoutToken(t *testing.T) {
+	h := newTestServer(t, "")
+	rpc := `{"jsonrpc":"2.0","id":1,"method":"getinfo"}`
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		remoteAddr string
+		want       int
+	}{
+		{"loopback", http.MethodGet, "/v1/admin/info", "", "127.0.0.1:1234", http.StatusOK},
+		{"loopback ipv6", http.MethodGet, "/v1/admin/info", "", "[::1]:1234", http.StatusOK},
+		{"remote", http.MethodGet, "/v1/admin/info", "", "203.0.113.1:1234", http.StatusUnauthorized},
+		{"remote mining", http.MethodPost, "/v1/mine/start", "", "203.0.113.1:1234", http.StatusUnauthorized},
+		{"remote log level", http.MethodPut, "/v1/admin/loglevel", `{"level":"debug"}`, "203.0.113.1:1234", http.StatusUnauthorized},
+		{"remote generate", http.MethodPost, "/v1/regtest/generate", "", "203.0.113.1:1234", http.StatusUnauthorized},
+		{"remote public", http.MethodGet, "/v1/chain", "", "203.0.113.1:1234", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(h, tt.method, tt.path, tt.body, tt.remoteAddr, ""); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+
+	// JSON-RPCから呼び出す場合も同じ
+	for remoteAddr, want := range map[string]string{"127.0.0.1:1234": `"result"`, "203.0.113.1:1234": `"error"`} {
+		req := httptest.NewRequest(http.MethodPost, "/rpc", strings.NewReader(rpc))
+		req.RemoteAddr = remoteAddr
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if !strings.Contains(rec.Body.String(), want) {
+			t.Errorf("rpc getinfo from %s: expected %s, got %s", remoteAddr, want, rec.Body.String())
+		}
+	}
+}
+
+func TestAdminWithToken(t *testing.T) {
+	h := newTestServer(t, "secret")
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		want       int
+	}{
+		{"remote with token", "203.0.113.1:1234", "secret", http.StatusOK},
+		{"remote with wrong token", "203.0.113.1:1234", "wrong", http.StatusUnauthorized},
+		{"loopback without token", "127.0.0.1:1234", "", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serve(h, http.MethodGet, "/v1/admin/info", "", tt.remoteAddr, tt.token); got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,341 @@
+package node
+
+import (
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"go-blockchain/metrics"
+	"go-blockchain/wallet"
+	"go-blockchain/webhook"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+)
+
+// /v1/regtest/generateで一度に生成できるブロックの最大数（生成中はブロックチェーンをロックする）
+const MAX_REGTEST_GENERATE = 1000
+
+type BlockchainServer struct {
+	port   uint16
+	params *block.Params
+	// 一度作ったブロックチェーンをcacheに格納
+	cache    map[string]*block.Blockchain
+	muxCache sync.Mutex
+	// 管理APIのトークン（空の場合は同じホストからのリクエストのみ受け付ける）
+	adminToken string
+	// マイニング報酬を受け取るアドレス（空の場合は保存しない鍵を起動のたびに作る）
+	minerAddress string
+	// ブロックチェーンのイベントの配信（ブロックチェーンと一緒に作る）
+	events *EventHub
+	// アドレスへの入金のWebhook（nilの場合は無効）
+	webhooks *webhook.Dispatcher
+	// /metricsで公開するメトリクス
+	metrics *metrics.Registry
+	http    *metrics.HTTPMetrics
+	// portフィールドを付けたLogger
+	logger *logging.Logger
+	// neighborの/statusから取得した高さ（応答したneighborのみ）
+	peerHeights map[string]int
+	muxPeers    sync.Mutex
+	// Closeで閉じ、バックグラウンドの処理を止める
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// ブロックチェーンサーバーの作成
+func NewBlockchainServer(port uint16, params *block.Params) *BlockchainServer {
+	registry := metrics.NewRegistry()
+	return &BlockchainServer{
+		port:    port,
+		params:  params,
+		cache:   make(map[string]*block.Blockchain),
+		metrics: registry,
+		http:    registry.NewHTTPMetrics(),
+		logger:  logging.New("port", port),
+		done:    make(chan struct{}),
+	}
+}
+
+// neighborの確認やWebhookの配信などのバックグラウンドの処理を止める（複数回呼んでもよい）
+func (bcs *BlockchainServer) Close() {
+	bcs.closeOnce.Do(func() {
+		close(bcs.done)
+	})
+	if bcs.webhooks != nil {
+		bcs.webhooks.Close()
+	}
+}
+
+// 管理APIのトークンを設定する
+func (bcs *BlockchainServer) SetAdminToken(token string) {
+	bcs.adminToken = token
+}
+
+// マイニング報酬を受け取るアドレスを設定する（ブロックチェーンを作る前に呼ぶこと）
+func (bcs *BlockchainServer) SetMinerAddress(address string) {
+	bcs.minerAddress = address
+}
+
+// ブロックチェーンサーバーのポートを返す
+func (bcs *BlockchainServer) Port() uint16 {
+	return bcs.port
+}
+
+// create済みのブロックチェーンをcacheから取得
+func (bcs *BlockchainServer) GetBlockchain() *block.Blockchain {
+	bcs.muxCache.Lock()
+	defer bcs.muxCache.Unlock()
+
+	// cacheからブロックチェーンを取得
+	bc, ok := bcs.cache["blockchain"]
+
+	// cahceに存在しない場合
+	if !ok {
+		// 1:Minerをブロックチェーンに登録
+		l := bcs.logger.Component(logging.COMPONENT_MINER)
+		minerAddress := bcs.minerAddress
+		if minerAddress == "" {
+			minersWallet := wallet.NewWallet()
+			minerAddress = minersWallet.BlockchainAddress()
+			// 秘密鍵はログに出さない
+			l.Info("miner wallet created", "blockchain_address", minerAddress,
+				"public_key", minersWallet.PublicKeyStr())
+			l.Warn("miner private key is not stored, mining rewards cannot be spent (set a miner address to keep them)")
+		} else {
+			l.Info("miner address configured", "blockchain_address", minerAddress)
+		}
+		bc = block.NewBlockchain(minerAddress, bcs.Port(), bcs.params)
+		bc.RegisterMetrics(bcs.metrics)
+		bcs.cache["blockchain"] = bc
+		bcs.events = NewEventHub(bc)
+		if bcs.webhooks != nil {
+			bcs.watchWebhooks(bc)
+		}
+		go bcs.watchPeers(bc)
+	}
+	return bc
+}
+
+// ブロックチェーンのイベントの配信を取得
+func (bcs *BlockchainServer) Events() *EventHub {
+	bcs.GetBlockchain()
+	bcs.muxCache.Lock()
+	defer bcs.muxCache.Unlock()
+	return bcs.events
+}
+
+// メトリクスをPrometheusのテキスト形式で返すハンドル
+func (bcs *BlockchainServer) Metrics(w http.ResponseWriter, req *http.Request) {
+	bcs.GetBlockchain()
+	bcs.metrics.Handler()(w, req)
+}
+
+// Blockchainを取得し表示するハンドル
+func (bcs *BlockchainServer) GetChain(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	api.WriteJSON(w, http.StatusOK, bc)
+}
+
+// Poolに溜まっているTransactionを取得するハンドル
+func (bcs *BlockchainServer) GetTransactions(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	transactions := bc.TransactionPool()
+	api.WriteJSON(w, http.StatusOK, &TransactionsResponse{
+		Transactions: transactions,
+		Length:       len(transactions),
+	})
+}
+
+// walletから送られたTransactionを受け取り、他のnodeに伝播するハンドル
+func (bcs *BlockchainServer) CreateTransaction(w http.ResponseWriter, req *http.Request) {
+	t, auth, ok := decodeTransactionRequest(w, req)
+	if !ok {
+		return
+	}
+	bc := bcs.GetBlockchain()
+	err := bc.CreateTransaction(req.Context(), t.Transaction(), auth)
+	if err != nil {
+		logging.FromContext(req.Context()).Warn("transaction rejected", "err", err)
+		api.WriteError(w, http.StatusUnprocessableEntity, api.CodeTransactionRejected, err.Error())
+		return
+	}
+	api.WriteSuccess(w, http.StatusCreated)
+}
+
+// 他のnodeから伝播されたTransactionをPoolに追加するハンドル
+func (bcs *BlockchainServer) AddTransaction(w http.ResponseWriter, req *http.Request) {
+	t, auth, ok := decodeTransactionRequest(w, req)
+	if !ok {
+		return
+	}
+	bc := bcs.GetBlockchain()
+	err := bc.AddTransaction(t.Transaction(), auth)
+	if err != nil {
+		logging.FromContext(req.Context()).Warn("transaction from peer rejected", "err", err)
+		api.WriteError(w, http.StatusUnprocessableEntity, api.CodeTransactionRejected, err.Error())
+		return
+	}
+	api.WriteSuccess(w, http.StatusOK)
+}
+
+// 受け取ったJsonを構造体に格納し、Transactionのバリデーションを行う
+// 署名方式、公開鍵（redeem script）、署名のエンコードが不正な場合は400を返す
+func decodeTransactionRequest(w http.ResponseWriter, req *http.Request) (
+	*block.TransactionRequest, block.Authorization, bool) {
+	var t block.TransactionRequest
+	if !api.DecodeJSON(w, req, block.MAX_TRANSACTION_REQUEST_SIZE, &t) {
+		return nil, nil, false
+	}
+	if !t.Validate() {
+		logging.FromContext(req.Context()).Warn("invalid transaction request: missing field(s)")
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "missing field(s)")
+		return nil, nil, false
+	}
+	auth, err := t.Authorization()
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return nil, nil, false
+	}
+	return &t, auth, true
+}
+
+// Poolを空にするハンドル
+func (bcs *BlockchainServer) ClearTransactions(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	bc.ClearTransactionPool()
+	api.WriteSuccess(w, http.StatusOK)
+}
+
+// マイニングAPIサーバー
+func (bcs *BlockchainServer) Mine(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	if !bc.Mining() {
+		api.WriteError(w, http.StatusInternalServerError, api.CodeInternal, "mining failed")
+		return
+	}
+	api.WriteSuccess(w, http.StatusOK)
+}
+
+// マイニング処理を自動化するAPI
+func (bcs *BlockchainServer) StartMine(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	bc.StartMining()
+	api.WriteSuccess(w, http.StatusOK)
+}
+
+// 仮想通貨の合計値を返すAPI
+func (bcs *BlockchainServer) Amount(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	blockchainAddress := q.Get("blockchain_address")
+	if blockchainAddress == "" {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "blockchain_address is required")
+		return
+	}
+	// 残高に含める最小の承認数（デフォルトは1）
+	minConf := 1
+	if s := q.Get("minconf"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 0 {
+			api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+				fmt.Sprintf("invalid minconf %q", s))
+			return
+		}
+		minConf = v
+	}
+	balance := bcs.GetBlockchain().CalculateBalance(blockchainAddress, minConf)
+	api.WriteJSON(w, http.StatusOK, block.NewAmountResponse(balance, minConf))
+}
+
+// アドレスの使用状況を返すAPI
+// Poolに溜まっているTransactionに現れたアドレスも使用済みとする
+func (bcs *BlockchainServer) Address(w http.ResponseWriter, req *http.Request) {
+	blockchainAddress := api.PathParam(req, "address")
+	bc := bcs.GetBlockchain()
+	info := bc.AddressInfo(blockchainAddress)
+	pending := bc.PendingTransactionCount(blockchainAddress)
+
+	resp := &AddressResponse{
+		BlockchainAddress: blockchainAddress,
+		Used:              info.Used() || pending > 0,
+		TxCount:           info.TxCount,
+		PendingTxCount:    pending,
+		Received:          info.Received,
+		Sent:              info.Sent,
+	}
+	if info.Used() {
+		resp.FirstHeight = &info.FirstHeight
+		resp.LastHeight = &info.LastHeight
+	}
+	api.WriteJSON(w, http.StatusOK, resp)
+}
+
+// アドレスが送信者か受取人になっているTransactionの履歴を返すAPI
+func (bcs *BlockchainServer) AddressTransactions(w http.ResponseWriter, req *http.Request) {
+	blockchainAddress := api.PathParam(req, "address")
+	bc := bcs.GetBlockchain()
+	height := len(bc.Chain())
+	confirmed, pending := bc.AddressTransactions(blockchainAddress)
+
+	transactions := make([]*AddressTransaction, 0, len(confirmed)+len(pending))
+	for _, t := range pending {
+		transactions = append(transactions, &AddressTransaction{Transaction: t})
+	}
+	for i := len(confirmed) - 1; i >= 0; i-- {
+		ct := confirmed[i]
+		transactions = append(transactions, &AddressTransaction{
+			Height:        &ct.Height,
+			Confirmations: height - ct.Height,
+			Transaction:   ct.Transaction,
+		})
+	}
+	api.WriteJSON(w, http.StatusOK, &AddressTransactionsResponse{
+		BlockchainAddress: blockchainAddress,
+		Transactions:      transactions,
+	})
+}
+
+// 他のnodeとコンセンサスを取るAPI
+func (bcs *BlockchainServer) Consensus(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	replaced := bc.ResolveConflicts()
+	api.WriteJSON(w, http.StatusOK, &ConsensusResponse{Replaced: replaced})
+}
+
+// regtestでブロックを即座に生成するAPI
+func (bcs *BlockchainServer) RegtestGenerate(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	q := req.URL.Query()
+
+	n := 1
+	if s := q.Get("n"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > MAX_REGTEST_GENERATE {
+			api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+				fmt.Sprintf("invalid n %q (1 to %d)", s, MAX_REGTEST_GENERATE))
+			return
+		}
+		n = v
+	}
+	// addressの指定がなければminerのアドレスに報酬を送る
+	address := q.Get("address")
+	if address == "" {
+		address = bc.BlockchainAddress()
+	}
+
+	blocks := bc.Generate(n, address)
+	hashes := make([]string, len(blocks))
+	for i, b := range blocks {
+		hashes[i] = fmt.Sprintf("%x", b.Hash())
+	}
+	api.WriteJSON(w, http.StatusOK, &GenerateResponse{Hashes: hashes})
+}
+
+// サーバーの立ち上げ
+func (bcs *BlockchainServer) Run() {
+	bcs.GetBlockchain().Run()
+	err := http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(bcs.Port())), bcs.Handler())
+	bcs.logger.Error("server stopped", "err", err)
+	os.Exit(1)
+}
@@ -0,0 +1,93 @@
+package node
+
+import (
+	"bytes"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"go-blockchain/wallet"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type lockedBuffer struct {
+	buf bytes.Buffer
+	mux sync.Mutex
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return b.buf.String()
+}
+
+// 指定したアドレスでマイニング報酬を受け取り、debugレベルでもminerの秘密鍵はログに出さない
+func TestMinerAddress(t *testing.T) {
+	var out lockedBuffer
+	logging.SetOutput(&out)
+	level := logging.CurrentLevel()
+	logging.SetLevel(logging.DEBUG)
+	defer func() {
+		logging.SetLevel(level)
+		logging.SetOutput(os.Stderr)
+	}()
+
+	miner := wallet.NewWallet()
+	bcs := NewBlockchainServer(0, block.RegtestParams)
+	defer bcs.Close()
+	bcs.SetMinerAddress(miner.BlockchainAddress())
+	bc := bcs.GetBlockchain()
+	if got := bc.BlockchainAddress(); got != miner.BlockchainAddress() {
+		t.Fatalf("miner address = %s, want %s", got, miner.BlockchainAddress())
+	}
+	// addressを省略して生成したブロックの報酬は指定したアドレスに送られる
+	if code := serve(bcs.Handler(), http.MethodPost, "/v1/regtest/generate?n=1", "", "127.0.0.1:1234", ""); code != http.StatusOK {
+		t.Fatalf("generate: got %d", code)
+	}
+	chain := bc.Chain()
+	transactions := chain[len(chain)-1].Transactions()
+	coinbase := transactions[len(transactions)-1]
+	if !coinbase.IsCoinbase() || coinbase.ValueTo(miner.BlockchainAddress()) != block.RegtestParams.MiningReward {
+		t.Errorf("mining reward was not sent to the miner address: %+v", coinbase)
+	}
+
+	logs := out.String()
+	if !strings.Contains(logs, "miner address configured") || !strings.Contains(logs, miner.BlockchainAddress()) {
+		t.Errorf("miner address was not logged:\n%s", logs)
+	}
+	if strings.Contains(logs, "private_key") {
+		t.Errorf("private key was logged:\n%s", logs)
+	}
+}
+
+// 指定しない場合は保存しない鍵を作り、報酬を使えないことを警告する
+func TestMinerKeyNotLogged(t *testing.T) {
+	var out lockedBuffer
+	logging.SetOutput(&out)
+	level := logging.CurrentLevel()
+	logging.SetLevel(logging.DEBUG)
+	defer func() {
+		logging.SetLevel(level)
+		logging.SetOutput(os.Stderr)
+	}()
+
+	bcs := NewBlockchainServer(0, block.RegtestParams)
+	defer bcs.Close()
+	bcs.GetBlockchain()
+
+	logs := out.String()
+	if !strings.Contains(logs, "miner wallet created") || !strings.Contains(logs, "mining rewards cannot be spent") {
+		t.Fatalf("miner wallet was not logged:\n%s", logs)
+	}
+	if strings.Contains(logs, "private_key") {
+		t.Errorf("private key was logged:\n%s", logs)
+	}
+}
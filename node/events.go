@@ -0,0 +1,557 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// クライアントに送るイベントの種類
+// ブロックとPoolのイベント（block.EVENT_*）に加えて、Transactionの承認と残高の変化を送る
+const (
+	EVENT_TRANSACTION_CONFIRMED = "transaction_confirmed"
+	EVENT_BALANCE_CHANGED       = "balance_changed"
+	EVENT_SUBSCRIBED            = "subscribed" // 購読の開始と条件の変更の確認
+)
+
+const (
+	EVENT_CLIENT_QUEUE_SIZE = 64 // クライアントごとの送信待ちのイベントの数（超えたら切断する）
+	EVENT_KEEPALIVE_SEC     = 15
+	MAX_EVENT_CLIENTS       = 100 // 同時に接続できるクライアントの数
+	MAX_EVENT_ADDRESSES     = 100 // 1つのクライアントが購読できるアドレスの数
+	MAX_EVENT_MESSAGE_SIZE  = 1 << 14
+)
+
+var ErrTooManyEventClients = errors.New("too many event clients")
+
+var eventTypes = []string{
+	block.EVENT_BLOCK_CONNECTED, block.EVENT_BLOCK_DISCONNECTED, block.EVENT_TRANSACTION_ADDED,
+	EVENT_TRANSACTION_CONFIRMED, EVENT_BALANCE_CHANGED,
+}
+
+// クライアントに送るイベント
+type EventMessage struct {
+	Type         string                `json:"type"`
+	Height       *int                  `json:"height,omitempty"`
+	Hash         string                `json:"hash,omitempty"`
+	PreviousHash string                `json:"previous_hash,omitempty"`
+	Transaction  *block.Transaction    `json:"transaction,omitempty"`
+	Address      string                `json:"address,omitempty"`
+	Balance      *block.AmountResponse `json:"balance,omitempty"`
+	Filter       *EventFilter          `json:"filter,omitempty"`
+	Timestamp    int64                 `json:"timestamp"`
+}
+
+// クライアントごとの購読の条件
+// eventsを省略すると全ての種類、addressesを指定するとそのアドレスが関わるTransactionと残高の変化だけを送る
+// 残高の変化はaddressesに指定したアドレスについてのみ送る
+type EventFilter struct {
+	Events    []string `json:"events"`
+	Addresses []string `json:"addresses"`
+}
+
+// クエリパラメータ（カンマ区切りのevents、addresses）から購読の条件を作る
+func ParseEventFilter(events string, addresses string) *EventFilter {
+	return &EventFilter{Events: splitList(events), Addresses: splitList(addresses)}
+}
+
+func splitList(s string) []string {
+	list := make([]string, 0)
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+func (f *EventFilter) Validate() error {
+	for _, e := range f.Events {
+		if !contains(eventTypes, e) {
+			return fmt.Errorf("unknown event %q", e)
+		}
+	}
+	if len(f.Addresses) > MAX_EVENT_ADDRESSES {
+		return fmt.Errorf("at most %d addresses can be subscribed", MAX_EVENT_ADDRESSES)
+	}
+	return nil
+}
+
+func (f *EventFilter) match(m *EventMessage) bool {
+	if len(f.Events) > 0 && !contains(f.Events, m.Type) {
+		return false
+	}
+	switch m.Type {
+	case EVENT_BALANCE_CHANGED:
+		return contains(f.Addresses, m.Address)
+	case block.EVENT_TRANSACTION_ADDED, EVENT_TRANSACTION_CONFIRMED:
+		if len(f.Addresses) == 0 {
+			return true
+		}
+		for _, a := range f.Addresses {
+			if m.Transaction.Involves(a) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// イベントを購読しているクライアント
+type eventClient struct {
+	filter *EventFilter
+	send   chan *EventMessage
+	closed bool
+}
+
+// 購読されているアドレスの残高
+// チェーンの分はイベントのブロックの差分だけで更新し、チェーン全体を数え直さない
+type addressBalance struct {
+	confirmed float64
+	immature  float64
+	last      *block.Balance // 最後に送った残高（Poolの分を含む）
+}
+
+// Blockchainのイベントを受け取り、購読の条件に合うクライアントに配信する
+type EventHub struct {
+	bc      *block.Blockchain
+	clients map[*eventClient]bool
+	// 処理したイベントまでのチェーン（Blockchainのチェーンより遅れることがある）
+	chain    []*block.Block
+	balances map[string]*addressBalance
+	mux      sync.Mutex
+	// Blockchainから受け取って処理待ちのイベント（捨てないように上限は設けない）
+	queue    []*block.Event
+	muxQueue sync.Mutex
+	wake     chan struct{}
+	logger   *logging.Logger
+}
+
+// Blockchainを作った直後（ブロックのイベントが起きる前）に呼ぶこと
+func NewEventHub(bc *block.Blockchain) *EventHub {
+	h := &EventHub{
+		bc:       bc,
+		clients:  make(map[*eventClient]bool),
+		chain:    bc.Chain(),
+		balances: make(map[string]*addressBalance),
+		wake:     make(chan struct{}, 1),
+		logger:   bc.Logger().Component(logging.COMPONENT_EVENTS),
+	}
+	// Blockchainのロックを持ったまま呼ばれるので、キューに入れるだけにする
+	bc.Subscribe(func(e *block.Event) {
+		h.muxQueue.Lock()
+		h.queue = append(h.queue, e)
+		h.muxQueue.Unlock()
+		select {
+		case h.wake <- struct{}{}:
+		default:
+		}
+	})
+	go h.run()
+	return h
+}
+
+func (h *EventHub) run() {
+	for range h.wake {
+		h.muxQueue.Lock()
+		events := h.queue
+		h.queue = nil
+		h.muxQueue.Unlock()
+		for _, e := range events {
+			for _, m := range h.messages(e) {
+				h.broadcast(m)
+			}
+		}
+	}
+}
+
+// Blockchainのイベントからクライアントに送るイベントを作る
+func (h *EventHub) messages(e *block.Event) []*EventMessage {
+	now := time.Now().UnixNano()
+	messages := make([]*EventMessage, 0)
+	var changed []string
+	switch e.Type {
+	case block.EVENT_BLOCK_CONNECTED, block.EVENT_BLOCK_DISCONNECTED:
+		height := e.Height
+		messages = append(messages, &EventMessage{
+			Type:         e.Type,
+			Height:       &height,
+			Hash:         fmt.Sprintf("%x", e.Block.Hash()),
+			PreviousHash: fmt.Sprintf("%x", e.Block.PreviousHash()),
+			Timestamp:    now,
+		})
+		if e.Type == block.EVENT_BLOCK_CONNECTED {
+			for _, t := range e.Block.Transactions() {
+				messages = append(messages, &EventMessage{
+					Type:        EVENT_TRANSACTION_CONFIRMED,
+					Height:      &height,
+					Hash:        fmt.Sprintf("%x", e.Block.Hash()),
+					Transaction: t,
+					Timestamp:   now,
+				})
+			}
+		}
+		changed = h.applyBlock(e)
+	case block.EVENT_TRANSACTION_ADDED:
+		messages = append(messages, &EventMessage{Type: e.Type, Transaction: e.Transaction, Timestamp: now})
+		changed = h.subscribedAddresses(e.Transaction)
+	}
+	if len(changed) == 0 {
+		return messages
+	}
+
+	pending := h.bc.PendingBalances(changed)
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for _, address := range changed {
+		ab, ok := h.balances[address]
+		if !ok {
+			continue
+		}
+		b := ab.balance(pending[address])
+		if *ab.last == *b {
+			continue
+		}
+		ab.last = b
+		messages = append(messages, &EventMessage{
+			Type:      EVENT_BALANCE_CHANGED,
+			Address:   address,
+			Balance:   block.NewAmountResponse(b, 1),
+			Timestamp: now,
+		})
+	}
+	return messages
+}
+
+// チェーンの分とPoolの分を合わせた残高（承認は1以上）
+func (ab *addressBalance) balance(pending float32) *block.Balance {
+	return &block.Balance{Confirmed: float32(ab.confirmed), Unconfirmed: pending, Immature: float32(ab.immature)}
+}
+
+// ブロックの追加または取り外しをチェーンと購読されているアドレスの残高に反映し、残高が変わりうるアドレスを返す
+// ブロックのTransactionと、承認数がCoinbaseMaturityに達する（取り外しでは達しなくなる）マイニング報酬だけを見る
+func (h *EventHub) applyBlock(e *block.Event) []string {
+	maturity := h.bc.Params().CoinbaseMaturity
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	changed := make(map[string]bool)
+	sign := 1.0
+	if e.Type == block.EVENT_BLOCK_DISCONNECTED {
+		sign = -1.0
+	} else {
+		h.chain = append(h.chain, e.Block)
+	}
+	for _, t := range e.Block.Transactions() {
+		if ab, ok := h.balances[t.SenderBlockchainAddress()]; ok {
+			ab.confirmed -= sign * float64(t.Debit())
+			changed[t.SenderBlockchainAddress()] = true
+		}
+		for _, o := range t.Outputs() {
+			ab, ok := h.balances[o.RecipientBlockchainAddress]
+			if !ok {
+				continue
+			}
+			if t.IsCoinbase() && maturity > 1 {
+				ab.immature += sign * float64(o.Value)
+			} else {
+				ab.confirmed += sign * float64(o.Value)
+			}
+			changed[o.RecipientBlockchainAddress] = true
+		}
+	}
+	// このブロックで承認数がCoinbaseMaturityになるマイニング報酬のブロック
+	if matured := e.Height + 1 - maturity; maturity > 1 && matured > 0 && matured < len(h.chain) {
+		for _, t := range h.chain[matured].Transactions() {
+			if !t.IsCoinbase() {
+				continue
+			}
+			for _, o := range t.Outputs() {
+				if ab, ok := h.balances[o.RecipientBlockchainAddress]; ok {
+					ab.immature -= sign * float64(o.Value)
+					ab.confirmed += sign * float64(o.Value)
+					changed[o.RecipientBlockchainAddress] = true
+				}
+			}
+		}
+	}
+	if e.Type == block.EVENT_BLOCK_DISCONNECTED && e.Height < len(h.chain) {
+		// 次に追加するブロックで取り出し済みのチェーンを書き換えないように容量も切り詰める
+		h.chain = h.chain[:e.Height:e.Height]
+	}
+	addresses := make([]string, 0, len(changed))
+	for a := range changed {
+		addresses = append(addresses, a)
+	}
+	return addresses
+}
+
+// 購読されているアドレスのうちtに関わるもの
+func (h *EventHub) subscribedAddresses(t *block.Transaction) []string {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	addresses := make([]string, 0)
+	for a := range h.balances {
+		if t.Involves(a) {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
+
+func (h *EventHub) broadcast(m *EventMessage) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for c := range h.clients {
+		if !c.filter.match(m) {
+			continue
+		}
+		select {
+		case c.send <- m:
+		default:
+			// 読み出しが追いつかないクライアントは切断する
+			h.logger.Warn("event client is too slow, disconnecting")
+			h.remove(c)
+		}
+	}
+}
+
+// クライアントを登録する（MAX_EVENT_CLIENTSに達している場合はエラー）
+func (h *EventHub) add(f *EventFilter) (*eventClient, error) {
+	c := &eventClient{filter: &EventFilter{}, send: make(chan *EventMessage, EVENT_CLIENT_QUEUE_SIZE)}
+	h.mux.Lock()
+	if len(h.clients) >= MAX_EVENT_CLIENTS {
+		h.mux.Unlock()
+		return nil, ErrTooManyEventClients
+	}
+	h.clients[c] = true
+	h.mux.Unlock()
+	h.setFilter(c, f)
+	return c, nil
+}
+
+// 購読の条件を変更し、確認のイベントを送る
+// 新しく購読したアドレスは処理済みのイベントまでのチェーンから残高を計算して記録し、以後変化した時に送る
+func (h *EventHub) setFilter(c *eventClient, f *EventFilter) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for {
+		added := make([]string, 0)
+		for _, a := range f.Addresses {
+			if _, ok := h.balances[a]; !ok {
+				added = append(added, a)
+			}
+		}
+		if len(added) == 0 {
+			break
+		}
+		// チェーン全体から計算する間はロックを外し、その間にチェーンが変わっていれば計算し直す
+		chain := h.chain
+		h.mux.Unlock()
+		balances := h.initialBalances(chain, added)
+		h.mux.Lock()
+		if len(h.chain) == len(chain) && h.chain[len(chain)-1] == chain[len(chain)-1] {
+			for a, ab := range balances {
+				if _, ok := h.balances[a]; !ok {
+					h.balances[a] = ab
+				}
+			}
+			break
+		}
+	}
+	c.filter = f
+	h.pruneBalances()
+	if !c.closed {
+		select {
+		case c.send <- &EventMessage{Type: EVENT_SUBSCRIBED, Filter: f, Timestamp: time.Now().UnixNano()}:
+		default:
+		}
+	}
+}
+
+// クライアントの登録を解除する
+func (h *EventHub) Remove(c *eventClient) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.remove(c)
+}
+
+// 呼び出し側でh.muxをロックすること
+func (h *EventHub) remove(c *eventClient) {
+	if c.closed {
+		return
+	}
+	c.closed = true
+	delete(h.clients, c)
+	close(c.send)
+	h.pruneBalances()
+}
+
+// 購読を始めるアドレスのchainとPoolからの残高
+func (h *EventHub) initialBalances(chain []*block.Block, addresses []string) map[string]*addressBalance {
+	pending := h.bc.PendingBalances(addresses)
+	balances := make(map[string]*addressBalance, len(addresses))
+	for _, a := range addresses {
+		b := h.bc.ChainBalance(chain, a, 1)
+		ab := &addressBalance{confirmed: float64(b.Confirmed), immature: float64(b.Immature)}
+		ab.last = ab.balance(pending[a])
+		balances[a] = ab
+	}
+	return balances
+}
+
+// どのクライアントも購読していないアドレスの残高を忘れる（呼び出し側でh.muxをロックすること）
+func (h *EventHub) pruneBalances() {
+	for a := range h.balances {
+		subscribed := false
+		for c := range h.clients {
+			if contains(c.filter.Addresses, a) {
+				subscribed = true
+				break
+			}
+		}
+		if !subscribed {
+			delete(h.balances, a)
+		}
+	}
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Server-Sent Eventsでイベントを配信するAPI
+func (bcs *BlockchainServer) EventStream(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.WriteError(w, http.StatusInternalServerError, api.CodeInternal, "streaming is not supported")
+		return
+	}
+	filter, ok := eventFilter(w, req)
+	if !ok {
+		return
+	}
+	hub := bcs.Events()
+	c, err := hub.add(filter)
+	if err != nil {
+		api.WriteError(w, http.StatusServiceUnavailable, api.CodeTooManyClients, err.Error())
+		return
+	}
+	defer hub.Remove(c)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepalive := time.NewTicker(time.Second * EVENT_KEEPALIVE_SEC)
+	defer keepalive.Stop()
+	for {
+		select {
+		case m, ok := <-c.send:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(m)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", m.Type, data)
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		case <-req.Context().Done():
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+var upgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+// WebSocketでイベントを配信するAPI
+// 接続後に購読の条件（EventFilterのJSON）を送ると条件を変更できる
+func (bcs *BlockchainServer) EventSocket(w http.ResponseWriter, req *http.Request) {
+	filter, ok := eventFilter(w, req)
+	if !ok {
+		return
+	}
+	hub := bcs.Events()
+	c, err := hub.add(filter)
+	if err != nil {
+		api.WriteError(w, http.StatusServiceUnavailable, api.CodeTooManyClients, err.Error())
+		return
+	}
+	defer hub.Remove(c)
+	conn, err := upgrader.Upgrade(w, req, nil)
+	if err != nil {
+		// Upgradeがエラーのレスポンスを返している
+		logging.FromContext(req.Context()).Warn("websocket upgrade failed", "err", err)
+		return
+	}
+	defer conn.Close()
+
+	// 購読の条件の変更を読み込む
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn.SetReadLimit(MAX_EVENT_MESSAGE_SIZE)
+		for {
+			var f EventFilter
+			if err := conn.ReadJSON(&f); err != nil {
+				return
+			}
+			if err := f.Validate(); err != nil {
+				hub.Remove(c)
+				conn.WriteControl(websocket.CloseMessage,
+					websocket.FormatCloseMessage(websocket.CloseUnsupportedData, err.Error()),
+					time.Now().Add(time.Second))
+				return
+			}
+			hub.setFilter(c, &f)
+		}
+	}()
+
+	keepalive := time.NewTicker(time.Second * EVENT_KEEPALIVE_SEC)
+	defer keepalive.Stop()
+	for {
+		select {
+		case m, ok := <-c.send:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(m); err != nil {
+				return
+			}
+		case <-keepalive.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(time.Second)); err != nil {
+				return
+			}
+		case <-done:
+			return
+		}
+	}
+}
+
+func eventFilter(w http.ResponseWriter, req *http.Request) (*EventFilter, bool) {
+	q := req.URL.Query()
+	f := ParseEventFilter(q.Get("events"), q.Get("addresses"))
+	if err := f.Validate(); err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return nil, false
+	}
+	return f, true
+}
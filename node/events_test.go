@@ -0,0 +1,83 @@
+package node
+
+import (
+	"encoding/json"
+	"go-blockchain/block"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 次の残高の変化のイベント
+func nextBalance(t *testing.T, c *eventClient) *block.AmountResponse {
+	t.Helper()
+	for {
+		select {
+		case m := <-c.send:
+			if m.Type == EVENT_BALANCE_CHANGED {
+				return m.Balance
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("no balance_changed event")
+		}
+	}
+}
+
+func wantBalance(t *testing.T, bc *block.Blockchain, got *block.AmountResponse, address string) {
+	t.Helper()
+	want := block.NewAmountResponse(bc.CalculateBalance(address, 1), 1)
+	if *got != *want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+// 購読したアドレスの残高はブロックの差分から計算し、マイニング報酬の成熟とチェーンの置き換えも反映する
+func TestEventHubBalances(t *testing.T) {
+	params := block.RegtestParams
+	bc := block.NewBlockchain("miner", 0, params)
+	h := NewEventHub(bc)
+	c, err := h.add(&EventFilter{Addresses: []string{"A"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bc.Generate(1, "A")
+	wantBalance(t, bc, nextBalance(t, c), "A")
+	// 関わらないブロックでも報酬が成熟した時だけ変化を送る
+	bc.Generate(params.CoinbaseMaturity-1, "miner")
+	got := nextBalance(t, c)
+	wantBalance(t, bc, got, "A")
+	if got.Confirmed != params.MiningReward || got.Immature != 0 {
+		t.Errorf("mining reward has not matured: %+v", got)
+	}
+
+	// Aへの報酬を含まないより長いチェーンに置き換えると、外れたブロックの分を差し引く
+	other := block.NewBlockchain("miner", 0, params)
+	other.Generate(params.CoinbaseMaturity+1, "B")
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		json.NewEncoder(w).Encode(other)
+	}))
+	defer peer.Close()
+	bc.AddNeighbor(strings.TrimPrefix(peer.URL, "http://"))
+	if !bc.ResolveConflicts() {
+		t.Fatal("chain not replaced")
+	}
+	for got = nextBalance(t, c); got.Confirmed != 0 || got.Immature != 0; got = nextBalance(t, c) {
+	}
+	wantBalance(t, bc, got, "A")
+}
+
+func TestEventHubClientLimit(t *testing.T) {
+	bc := block.NewBlockchain("miner", 0, block.RegtestParams)
+	h := NewEventHub(bc)
+	for i := 0; i < MAX_EVENT_CLIENTS; i++ {
+		if _, err := h.add(&EventFilter{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := h.add(&EventFilter{}); err != ErrTooManyEventClients {
+		t.Errorf("got %v, want ErrTooManyEventClients", err)
+	}
+}
@@ -0,0 +1,314 @@
+package node
+
+import (
+	"embed"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 1ページに表示するブロックの数
+const EXPLORER_PAGE_SIZE = 20
+
+//go:embed templates/*.html
+var templateFS embed.FS
+
+var explorerFuncs = template.FuncMap{
+	"short": func(s string) string {
+		if len(s) <= 16 {
+			return s
+		}
+		return s[:8] + "…" + s[len(s)-8:]
+	},
+	"time": func(nano int64) string {
+		return time.Unix(0, nano).UTC().Format("2006-01-02 15:04:05 UTC")
+	},
+	"amount": func(v float32) string {
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	},
+	"add":  func(a int, b int) int { return a + b },
+	"path": url.PathEscape,
+}
+
+// ページごとにレイアウトと組み合わせたテンプレート
+var explorerTemplates = func() map[string]*template.Template {
+	pages := []string{"blocks", "block", "transaction", "address", "mempool", "error"}
+	templates := make(map[string]*template.Template, len(pages))
+	for _, p := range pages {
+		templates[p] = template.Must(template.New("").Funcs(explorerFuncs).
+			ParseFS(templateFS, "templates/layout.html", "templates/"+p+".html"))
+	}
+	return templates
+}()
+
+// 全てのページに共通の値
+type explorerPage struct {
+	Title   string
+	Network string
+	Height  int // 最後のブロックの高さ
+	Query   string
+}
+
+// 表示用のブロック
+type blockView struct {
+	Height        int
+	Hash          string
+	PreviousHash  string
+	Nonce         int
+	Timestamp     int64
+	Size          int
+	Confirmations int
+	Transactions  []*transactionView
+}
+
+// 表示用のTransaction（Poolに溜まっているものはHeightが-1）
+type transactionView struct {
+	Height        int
+	Index         int
+	BlockHash     string
+	Confirmations int
+	Sender        string
+	Coinbase      bool
+	Outputs       []*block.Output
+	Value         float32
+	Fee           float32
+	Memo          string
+	LockTime      int64
+}
+
+func (tv *transactionView) Pending() bool {
+	return tv.Height < 0
+}
+
+func newBlockView(chain []*block.Block, height int) *blockView {
+	b := chain[height]
+	bv := &blockView{
+		Height:        height,
+		Hash:          fmt.Sprintf("%x", b.Hash()),
+		PreviousHash:  fmt.Sprintf("%x", b.PreviousHash()),
+		Nonce:         b.Nonce(),
+		Timestamp:     b.Timestamp(),
+		Size:          b.Size(),
+		Confirmations: len(chain) - height,
+	}
+	for i, t := range b.Transactions() {
+		tv := newTransactionView(t)
+		tv.Height, tv.Index, tv.BlockHash, tv.Confirmations = height, i, bv.Hash, bv.Confirmations
+		bv.Transactions = append(bv.Transactions, tv)
+	}
+	return bv
+}
+
+func newTransactionView(t *block.Transaction) *transactionView {
+	return &transactionView{
+		Height:   -1,
+		Sender:   t.SenderBlockchainAddress(),
+		Coinbase: t.IsCoinbase(),
+		Outputs:  t.Outputs(),
+		Value:    t.Value(),
+		Fee:      t.Fee(),
+		Memo:     t.Memo(),
+		LockTime: t.LockTime(),
+	}
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// ブロックエクスプローラーのルーティング
+// GET /                    最近のブロック（?before=<height>で前のページ）
+// GET /block/<height|hash> ブロックの詳細
+// GET /tx/<height>/<index> Transactionの詳細
+// GET /address/<address>   アドレスの残高と履歴（?before=<n>で前のページ）
+// GET /mempool             Poolに溜まっているTransaction
+// GET /search?q=           高さ、hash、アドレスで検索
+func (bcs *BlockchainServer) Explorer(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		api.WriteError(w, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed,
+			fmt.Sprintf("method %s is not allowed", req.Method))
+		return
+	}
+	segments := strings.Split(strings.Trim(req.URL.Path, "/"), "/")
+	switch {
+	case req.URL.Path == "/":
+		bcs.explorerBlocks(w, req)
+	case segments[0] == "block" && len(segments) == 2:
+		bcs.explorerBlock(w, segments[1])
+	case segments[0] == "tx" && len(segments) == 3:
+		bcs.explorerTransaction(w, segments[1], segments[2])
+	case segments[0] == "address" && len(segments) == 2 && segments[1] != "":
+		bcs.explorerAddress(w, req, segments[1])
+	case req.URL.Path == "/mempool":
+		bcs.explorerMempool(w)
+	case req.URL.Path == "/search":
+		bcs.explorerSearch(w, req)
+	default:
+		bcs.explorerError(w, http.StatusNotFound, fmt.Sprintf("%s not found", req.URL.Path), "")
+	}
+}
+
+func (bcs *BlockchainServer) page(title string, chain []*block.Block) explorerPage {
+	return explorerPage{Title: title, Network: bcs.params.Name, Height: len(chain) - 1}
+}
+
+func (bcs *BlockchainServer) render(w http.ResponseWriter, status int, name string, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	if err := explorerTemplates[name].ExecuteTemplate(w, "layout", data); err != nil {
+		bcs.logger.Component(logging.COMPONENT_RPC).Error("failed to render explorer page", "page", name, "err", err)
+	}
+}
+
+func (bcs *BlockchainServer) explorerError(w http.ResponseWriter, status int, message string, query string) {
+	page := bcs.page(http.StatusText(status), bcs.GetBlockchain().Chain())
+	page.Query = query
+	bcs.render(w, status, "error", &struct {
+		explorerPage
+		Message string
+	}{page, message})
+}
+
+// 最近のブロックの一覧
+func (bcs *BlockchainServer) explorerBlocks(w http.ResponseWriter, req *http.Request) {
+	bc := bcs.GetBlockchain()
+	chain := bc.Chain()
+	top := len(chain) - 1
+	if s := req.URL.Query().Get("before"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > len(chain) {
+			bcs.explorerError(w, http.StatusBadRequest, fmt.Sprintf("invalid before %q", s), "")
+			return
+		}
+		top = v - 1
+	}
+	blocks := make([]*blockView, 0, EXPLORER_PAGE_SIZE)
+	for h := top; h >= 0 && h > top-EXPLORER_PAGE_SIZE; h-- {
+		blocks = append(blocks, newBlockView(chain, h))
+	}
+	next := top - EXPLORER_PAGE_SIZE + 1
+	bcs.render(w, http.StatusOK, "blocks", &struct {
+		explorerPage
+		Blocks     []*blockView
+		Mining     bool
+		Difficulty int
+		PoolSize   int
+		Peers      int
+		Next       int // 前のページの?before=（0の場合は最初のブロックまで表示している）
+	}{bcs.page("Blocks", chain), blocks, bc.IsMining(), bc.Params().MiningDifficulty,
+		len(bc.TransactionPool()), len(bc.Neighbors()), next})
+}
+
+// ブロックの詳細
+func (bcs *BlockchainServer) explorerBlock(w http.ResponseWriter, id string) {
+	chain := bcs.GetBlockchain().Chain()
+	height, ok := findBlock(chain, id)
+	if !ok {
+		bcs.explorerError(w, http.StatusNotFound, fmt.Sprintf("block %s not found", id), id)
+		return
+	}
+	bv := newBlockView(chain, height)
+	bcs.render(w, http.StatusOK, "block", &struct {
+		explorerPage
+		Block *blockView
+		Next  bool // 次のブロックがあるか
+	}{bcs.page(fmt.Sprintf("Block %d", height), chain), bv, height < len(chain)-1})
+}
+
+// Transactionの詳細（ブロックの高さとブロック内の位置で指定する）
+func (bcs *BlockchainServer) explorerTransaction(w http.ResponseWriter, h string, i string) {
+	chain := bcs.GetBlockchain().Chain()
+	height, err := strconv.Atoi(h)
+	index, err2 := strconv.Atoi(i)
+	if err != nil || err2 != nil || height < 0 || height >= len(chain) ||
+		index < 0 || index >= len(chain[height].Transactions()) {
+		bcs.explorerError(w, http.StatusNotFound, fmt.Sprintf("transaction %s/%s not found", h, i), "")
+		return
+	}
+	tv := newBlockView(chain, height).Transactions[index]
+	bcs.render(w, http.StatusOK, "transaction", &struct {
+		explorerPage
+		Transaction *transactionView
+	}{bcs.page(fmt.Sprintf("Transaction %d/%d", height, index), chain), tv})
+}
+
+// アドレスの残高と履歴（新しい順、最初のページはPoolの分を含む）
+// ブロックに取り込まれたTransactionは古い方から数えてbefore件目より前をEXPLORER_PAGE_SIZE件ずつ表示する
+func (bcs *BlockchainServer) explorerAddress(w http.ResponseWriter, req *http.Request, address string) {
+	bc := bcs.GetBlockchain()
+	chain := bc.Chain()
+	info := bc.AddressInfo(address)
+	confirmed, pending := bc.AddressTransactions(address)
+	top := len(confirmed)
+	if s := req.URL.Query().Get("before"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 1 || v > len(confirmed) {
+			bcs.explorerError(w, http.StatusBadRequest, fmt.Sprintf("invalid before %q", s), "")
+			return
+		}
+		top = v
+		pending = nil
+	}
+
+	transactions := make([]*transactionView, 0, len(pending)+EXPLORER_PAGE_SIZE)
+	for _, t := range pending {
+		transactions = append(transactions, newTransactionView(t))
+	}
+	for i := top - 1; i >= 0 && i >= top-EXPLORER_PAGE_SIZE; i-- {
+		ct := confirmed[i]
+		tv := newTransactionView(ct.Transaction)
+		tv.Height, tv.Index, tv.Confirmations = ct.Height, ct.Index, len(chain)-ct.Height
+		transactions = append(transactions, tv)
+	}
+	bcs.render(w, http.StatusOK, "address", &struct {
+		explorerPage
+		Address      string
+		Balance      *block.AmountResponse
+		Info         block.AddressInfo
+		Transactions []*transactionView
+		Next         int // 前のページの?before=（0の場合は最初のTransactionまで表示している）
+	}{bcs.page("Address "+address, chain), address,
+		block.NewAmountResponse(bc.CalculateBalance(address, 1), 1), info, transactions, top - EXPLORER_PAGE_SIZE})
+}
+
+// Poolに溜まっているTransaction
+func (bcs *BlockchainServer) explorerMempool(w http.ResponseWriter) {
+	bc := bcs.GetBlockchain()
+	pool := bc.TransactionPool()
+	transactions := make([]*transactionView, 0, len(pool))
+	size := 0
+	for _, t := range pool {
+		transactions = append(transactions, newTransactionView(t))
+		m, _ := t.MarshalJSON()
+		size += len(m)
+	}
+	bcs.render(w, http.StatusOK, "mempool", &struct {
+		explorerPage
+		Transactions []*transactionView
+		Size         int
+	}{bcs.page("Mempool", bc.Chain()), transactions, size})
+}
+
+// 数字はブロックの高さ、64文字の16進数はブロックのhash、それ以外はアドレスとして検索する
+func (bcs *BlockchainServer) explorerSearch(w http.ResponseWriter, req *http.Request) {
+	q := strings.TrimSpace(req.URL.Query().Get("q"))
+	if q == "" {
+		http.Redirect(w, req, "/", http.StatusFound)
+		return
+	}
+	chain := bcs.GetBlockchain().Chain()
+	if _, ok := findBlock(chain, q); ok {
+		http.Redirect(w, req, "/block/"+q, http.StatusFound)
+		return
+	}
+	if _, err := strconv.Atoi(q); err == nil || len(q) == 64 {
+		bcs.explorerError(w, http.StatusNotFound, fmt.Sprintf("block %s not found", q), q)
+		return
+	}
+	http.Redirect(w, req, "/address/"+url.PathEscape(q), http.StatusFound)
+}
@@ -0,0 +1,49 @@
+package node
+
+import (
+	"fmt"
+	"go-blockchain/block"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// アドレスの履歴はブロックの一覧と同じくEXPLORER_PAGE_SIZE件ずつ表示する
+func TestExplorerAddressPaging(t *testing.T) {
+	bcs := NewBlockchainServer(0, block.RegtestParams)
+	t.Cleanup(bcs.Close)
+	bcs.GetBlockchain().Generate(EXPLORER_PAGE_SIZE+5, "X")
+	h := bcs.Handler()
+
+	get := func(path string) (int, string) {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		return rec.Code, rec.Body.String()
+	}
+	code, body := get("/address/X")
+	if code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if n := strings.Count(body, `href="/tx/`); n != EXPLORER_PAGE_SIZE {
+		t.Errorf("first page has %d transactions, want %d", n, EXPLORER_PAGE_SIZE)
+	}
+	if !strings.Contains(body, "?before=5") {
+		t.Errorf("no link to older transactions")
+	}
+	code, body = get("/address/X?before=5")
+	if code != http.StatusOK {
+		t.Fatalf("got %d", code)
+	}
+	if n := strings.Count(body, `href="/tx/`); n != 5 || !strings.Contains(body, `href="/tx/1/0"`) {
+		t.Errorf("second page has %d transactions, want 5 ending at block 1", n)
+	}
+	if strings.Contains(body, "?before=") {
+		t.Errorf("link to older transactions on the last page")
+	}
+	for _, before := range []string{"0", "x", fmt.Sprint(EXPLORER_PAGE_SIZE + 6)} {
+		if code, _ := get("/address/X?before=" + before); code != http.StatusBadRequest {
+			t.Errorf("before=%s: got %d, want %d", before, code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	READY_MIN_PEERS          = 1  // readyに必要な応答するneighborの数
+	PEER_STATUS_INTERVAL_SEC = 10 // neighborの高さを確認する間隔
+	PEER_STATUS_TIMEOUT_SEC  = 3
+	MAX_STATUS_RESPONSE_SIZE = 1 << 12
+)
+
+// 同期の段階
+const (
+	SYNC_PHASE_CONNECTING = "connecting" // 応答するneighborがいない
+	SYNC_PHASE_SYNCING    = "syncing"    // neighborの最も高いブロックからMaxBlocksBehindより多く遅れている
+	SYNC_PHASE_SYNCED     = "synced"
+)
+
+// neighborの高さをCloseされるまで定期的に確認する
+// 確認にはneighborの/statusを使う（/statusはこの結果を返すだけなので、互いに確認し合っても再帰しない）
+func (bcs *BlockchainServer) watchPeers(bc *block.Blockchain) {
+	ticker := time.NewTicker(time.Second * PEER_STATUS_INTERVAL_SEC)
+	defer ticker.Stop()
+	for {
+		bcs.refreshPeers(bc)
+		select {
+		case <-ticker.C:
+		case <-bcs.done:
+			return
+		}
+	}
+}
+
+// 全てのneighborの高さを取得し直す（応答しなかったneighborは数えない）
+// 申告された高さはtrustedPeerHeightで検証できた高さと照らし合わせる
+func (bcs *BlockchainServer) refreshPeers(bc *block.Blockchain) {
+	l := bcs.logger.Component(logging.COMPONENT_P2P)
+	client := &http.Client{Timeout: time.Second * PEER_STATUS_TIMEOUT_SEC}
+	heights := make(map[string]int)
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	for _, n := range bc.Neighbors() {
+		wg.Add(1)
+		go func(n string) {
+			defer wg.Done()
+			height, err := peerHeight(client, n)
+			if err != nil {
+				l.Debug("peer status unavailable", "peer", n, "err", err)
+				return
+			}
+			height = trustedPeerHeight(bc, n, height)
+			mux.Lock()
+			heights[n] = height
+			mux.Unlock()
+		}(n)
+	}
+	wg.Wait()
+
+	bcs.muxPeers.Lock()
+	defer bcs.muxPeers.Unlock()
+	bcs.peerHeights = heights
+}
+
+func peerHeight(client *http.Client, peer string) (int, error) {
+	resp, err := client.Get(fmt.Sprintf("http://%s/status", peer))
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("unexpected response %d", resp.StatusCode)
+	}
+	var sr StatusResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, MAX_STATUS_RESPONSE_SIZE)).Decode(&sr); err != nil {
+		return 0, err
+	}
+	return sr.Height, nil
+}
+
+// neighborが/statusで申告した高さのうち信用できる高さ
+// ResolveConflictsで検証できた高さよりMaxBlocksBehindを超えて高い申告は使わず、検証できた高さにする
+// （1つのneighborが大きな高さを申告し続けても、全てのnodeがsyncingのままにならないようにする）
+// まだチェーンを取得していないneighborの申告はそのまま使う（起動して最初の同期が終わるまではsyncingになる）
+func trustedPeerHeight(bc *block.Blockchain, peer string, reported int) int {
+	verified, ok := bc.VerifiedPeerHeight(peer)
+	if !ok || reported <= verified+bc.Params().MaxBlocksBehind {
+		return reported
+	}
+	bc.Logger().Component(logging.COMPONENT_P2P).Debug("peer height not verified", "peer", peer,
+		"height", reported, "verified_height", verified)
+	return verified
+}
+
+// 応答したneighborの数と最も高いブロックの高さ（neighborがいない場合は-1）
+func (bcs *BlockchainServer) bestPeerHeight() (int, int) {
+	bcs.muxPeers.Lock()
+	defer bcs.muxPeers.Unlock()
+	best := -1
+	for _, h := range bcs.peerHeights {
+		if h > best {
+			best = h
+		}
+	}
+	return len(bcs.peerHeights), best
+}
+
+// 同期の段階と進み具合
+func (bcs *BlockchainServer) syncStatus() *StatusResponse {
+	bc := bcs.GetBlockchain()
+	chain := bc.Chain()
+	height := len(chain) - 1
+	tip := chain[height]
+	peers, best := bcs.bestPeerHeight()
+
+	s := &StatusResponse{
+		Network:       bc.Params().Name,
+		Phase:         SYNC_PHASE_SYNCED,
+		Progress:      1,
+		Height:        height,
+		BestBlockHash: fmt.Sprintf("%x", tip.Hash()),
+		Peers:         peers,
+		TipAgeSec:     time.Since(time.Unix(0, tip.Timestamp())).Seconds(),
+		Mining:        bc.IsMining(),
+	}
+	if peers == 0 {
+		s.Phase, s.Progress = SYNC_PHASE_CONNECTING, 0
+		return s
+	}
+	s.BestPeerHeight = &best
+	if best > height {
+		s.Progress = float64(height) / float64(best)
+	}
+	if best > height+bc.Params().MaxBlocksBehind {
+		s.Phase = SYNC_PHASE_SYNCING
+	}
+	return s
+}
+
+// readyの判定（neighborの数、neighborの最も高いブロックからの遅れ、最後のブロックの古さ）
+func (bcs *BlockchainServer) readyChecks() []*api.Check {
+	s := bcs.syncStatus()
+	params := bcs.GetBlockchain().Params()
+
+	checks := []*api.Check{{
+		Name:    "peers",
+		OK:      s.Peers >= READY_MIN_PEERS,
+		Message: fmt.Sprintf("%d responding neighbors (min %d)", s.Peers, READY_MIN_PEERS),
+	}}
+	height := &api.Check{Name: "height", Message: "no neighbor height"}
+	if s.BestPeerHeight != nil {
+		height.OK = *s.BestPeerHeight <= s.Height+params.MaxBlocksBehind
+		height.Message = fmt.Sprintf("height %d, best neighbor height %d (max %d blocks behind)",
+			s.Height, *s.BestPeerHeight, params.MaxBlocksBehind)
+	}
+	checks = append(checks, height)
+	if params.MaxTipAge > 0 {
+		age := time.Duration(s.TipAgeSec * float64(time.Second))
+		checks = append(checks, &api.Check{
+			Name:    "tip_age",
+			OK:      age <= params.MaxTipAge,
+			Message: fmt.Sprintf("tip is %s old (max %s)", age.Round(time.Second), params.MaxTipAge),
+		})
+	}
+	return checks
+}
+
+// プロセスが応答しているかを返すAPI（liveness）
+func (bcs *BlockchainServer) Healthz(w http.ResponseWriter, req *http.Request) {
+	api.WriteJSON(w, http.StatusOK, api.HealthOK)
+}
+
+// リクエストを受け付けられる程度に同期しているかを返すAPI（readiness）
+func (bcs *BlockchainServer) Readyz(w http.ResponseWriter, req *http.Request) {
+	api.WriteReady(w, bcs.readyChecks())
+}
+
+// 同期の段階と進み具合を返すAPI
+func (bcs *BlockchainServer) Status(w http.ResponseWriter, req *http.Request) {
+	api.WriteJSON(w, http.StatusOK, bcs.syncStatus())
+}
@@ -0,0 +1,56 @@
+package node
+
+import (
+	"encoding/json"
+	"go-blockchain/block"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// neighborが検証できたチェーンより大きな高さを申告してもsyncingのままにならない
+func TestPeerHeightVerified(t *testing.T) {
+	other := block.NewBlockchain("miner", 0, block.RegtestParams)
+	other.Generate(3, "B")
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/status" {
+			json.NewEncoder(w).Encode(&StatusResponse{Height: 1000000})
+			return
+		}
+		json.NewEncoder(w).Encode(other)
+	}))
+	defer peer.Close()
+
+	bcs := NewBlockchainServer(0, block.RegtestParams)
+	defer bcs.Close()
+	bc := bcs.GetBlockchain()
+	// watchPeersの最初の確認が後から結果を上書きしないように終わるのを待つ
+	for {
+		bcs.muxPeers.Lock()
+		refreshed := bcs.peerHeights != nil
+		bcs.muxPeers.Unlock()
+		if refreshed {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := bc.AddNeighbor(strings.TrimPrefix(peer.URL, "http://")); err != nil {
+		t.Fatal(err)
+	}
+	// チェーンを取得するまでは申告をそのまま使う
+	bcs.refreshPeers(bc)
+	if s := bcs.syncStatus(); s.Phase != SYNC_PHASE_SYNCING {
+		t.Errorf("phase before fetching the chain = %s, want %s", s.Phase, SYNC_PHASE_SYNCING)
+	}
+
+	if !bc.ResolveConflicts() {
+		t.Fatal("chain not replaced")
+	}
+	bcs.refreshPeers(bc)
+	s := bcs.syncStatus()
+	if s.Phase != SYNC_PHASE_SYNCED || *s.BestPeerHeight != 3 {
+		t.Errorf("got phase %s and best peer height %d, want %s and 3", s.Phase, *s.BestPeerHeight, SYNC_PHASE_SYNCED)
+	}
+}
@@ -0,0 +1,554 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/keys"
+	"go-blockchain/logging"
+	"go-blockchain/webhook"
+	"net/http"
+)
+
+const API_VERSION = "v1"
+
+// GET /v1/chainのレスポンス（block.BlockchainのJSONと同じ形式）
+type ChainResponse struct {
+	Chain []*block.Block `json:"chain"`
+}
+
+// GET /v1/transactionsのレスポンス
+type TransactionsResponse struct {
+	Transactions []*block.Transaction `json:"transactions"`
+	Length       int                  `json:"length"`
+}
+
+// PUT /v1/consensusのレスポンス
+type ConsensusResponse struct {
+	Replaced bool `json:"replaced"`
+}
+
+// GET /v1/addresses/{address}のレスポンス
+type AddressResponse struct {
+	BlockchainAddress string  `json:"blockchain_address"`
+	Used              bool    `json:"used"`
+	TxCount           int     `json:"tx_count"`
+	PendingTxCount    int     `json:"pending_tx_count"`
+	Received          float32 `json:"received"`
+	Sent              float32 `json:"sent"`
+	FirstHeight       *int    `json:"first_height,omitempty"`
+	LastHeight        *int    `json:"last_height,omitempty"`
+}
+
+// GET /v1/addresses/{address}/transactionsのレスポンス
+// 新しい順に並べ、Poolに溜まっているTransactionはheightをnullにして先頭に置く
+type AddressTransactionsResponse struct {
+	BlockchainAddress string                `json:"blockchain_address"`
+	Transactions      []*AddressTransaction `json:"transactions"`
+}
+
+type AddressTransaction struct {
+	Height        *int               `json:"height"`
+	Confirmations int                `json:"confirmations"`
+	Transaction   *block.Transaction `json:"transaction"`
+}
+
+// POST /v1/regtest/generateのレスポンス
+type GenerateResponse struct {
+	Hashes []string `json:"hashes"`
+}
+
+// GET /v1/admin/infoのレスポンス
+// blocksはジェネシスブロックを含むブロック数（最後のブロックの高さはblocks-1）
+type InfoResponse struct {
+	Network          string  `json:"network"`
+	Port             uint16  `json:"port"`
+	Blocks           int     `json:"blocks"`
+	BestBlockHash    string  `json:"best_block_hash"`
+	Difficulty       int     `json:"difficulty"`
+	MiningReward     float32 `json:"mining_reward"`
+	CoinbaseMaturity int     `json:"coinbase_maturity"`
+	Mining           bool    `json:"mining"`
+	MinerAddress     string  `json:"miner_address"`
+	MempoolSize      int     `json:"mempool_size"`
+	Peers            int     `json:"peers"`
+	Banned           int     `json:"banned"`
+}
+
+// GET /v1/blocks/{id}のレスポンス
+type BlockResponse struct {
+	Height        int          `json:"height"`
+	Hash          string       `json:"hash"`
+	Confirmations int          `json:"confirmations"`
+	Block         *block.Block `json:"block"`
+}
+
+// GET /v1/admin/peersのレスポンス
+type PeersResponse struct {
+	Peers  []string `json:"peers"`
+	Banned []string `json:"banned"`
+}
+
+// GET /v1/admin/verifychainのレスポンス
+type VerifyChainResponse struct {
+	Valid  bool   `json:"valid"`
+	Blocks int    `json:"blocks"`
+	Error  string `json:"error,omitempty"`
+}
+
+// GET /statusのレスポンス
+// heightとbest_peer_heightは最後のブロックの高さ、progressはheight/best_peer_height（追いついていれば1）
+type StatusResponse struct {
+	Network        string  `json:"network"`
+	Phase          string  `json:"phase"`
+	Progress       float64 `json:"progress"`
+	Height         int     `json:"height"`
+	BestPeerHeight *int    `json:"best_peer_height,omitempty"`
+	BestBlockHash  string  `json:"best_block_hash"`
+	Peers          int     `json:"peers"`
+	TipAgeSec      float64 `json:"tip_age_sec"`
+	Mining         bool    `json:"mining"`
+}
+
+// GET /v1/admin/loglevelのレスポンス
+type LogLevelResponse struct {
+	Level string `json:"level"`
+}
+
+// GET /v1/webhooksのレスポンス
+type WebhooksResponse struct {
+	Webhooks []*webhook.Webhook `json:"webhooks"`
+}
+
+// GET /v1/webhooks/{id}/deliveriesのレスポンス（新しい順）
+type DeliveriesResponse struct {
+	Deliveries []*webhook.Delivery `json:"deliveries"`
+}
+
+// OpenAPIの例に使う値
+var (
+	exampleAddress     = "1Kb7aKPSmdXpY53qAkGPmgKvbD1PR5G1tb"
+	exampleRecipient   = "1NRtW14nJH187LcLNx4bAUc5reu7ePiuyz"
+	examplePublicKey   = "022a20ba619029da5b69a12ac2f19a1f6744a96ebf3a2e982fca199ae6b7a102a4"
+	exampleSignature   = "013044022013c8fec8db7977712d963c8b3956e0a3d9d912288986ebcc80eadf2ce48cc86902204b0ffbecdb4fe8e85bcd80eb73ba6b9ba2ba2e2ab0e67d104bab4e85e4fd9234"
+	exampleValue       = float32(1.5)
+	exampleScheme      = string(keys.DEFAULT_SCHEME)
+	exampleHash        = "000f3c2b6a1c7e0e9d6f1b7a5c4d3e2f1a0b9c8d7e6f5a4b3c2d1e0f9a8b7c6d"
+	exampleMemo        = "INV-2024-0042"
+	exampleTransaction = block.NewTransaction(exampleAddress, exampleRecipient, exampleValue).
+				WithMemo(exampleMemo, block.MinimumFee(exampleMemo))
+	exampleBlock      = block.NewBlock(0, [32]byte{}, []*block.Transaction{exampleTransaction})
+	examplePeer       = "127.0.0.1:5002"
+	exampleWebhookURL = "https://example.com/hooks/deposits"
+	exampleSecret     = "9f2c4e6a8b0d1f3e5a7c9b1d3f5e7a9c"
+	exampleConfs      = 3
+	exampleWebhook    = &webhook.Webhook{
+		ID:            "4b1c0e5f2a3d4e6f8a9b0c1d2e3f4a5b",
+		URL:           exampleWebhookURL,
+		Addresses:     []string{exampleRecipient},
+		Confirmations: exampleConfs,
+		Secret:        exampleSecret,
+		CreatedAt:     1700000000,
+	}
+	exampleEvent = &EventMessage{
+		Type:      EVENT_BALANCE_CHANGED,
+		Address:   exampleAddress,
+		Balance:   block.NewAmountResponse(&block.Balance{Confirmed: exampleValue}, 1),
+		Timestamp: 1700000000000000000,
+	}
+)
+
+// v1のAPIのルーティング
+func (bcs *BlockchainServer) Routes() *api.Router {
+	r := api.NewRouter()
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/v1/chain",
+		Summary:  "Get the whole blockchain",
+		Response: &ChainResponse{[]*block.Block{exampleBlock}},
+		RPC:      "getchain",
+		Handler:  bcs.GetChain,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/blocks/{id}",
+		Summary: "Get a block by height or hash",
+		Response: &BlockResponse{
+			Height:        0,
+			Hash:          exampleHash,
+			Confirmations: 1,
+			Block:         exampleBlock,
+		},
+		Errors:  []int{http.StatusNotFound},
+		RPC:     "getblock",
+		Handler: bcs.GetBlock,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/v1/transactions",
+		Summary:  "List transactions in the pool",
+		Response: &TransactionsResponse{[]*block.Transaction{exampleTransaction}, 1},
+		RPC:      "getmempool",
+		Handler:  bcs.GetTransactions,
+	})
+	transactionRequest := &block.TransactionRequest{
+		SenderBlockchainAddress:    &exampleAddress,
+		RecipientBlockchainAddress: &exampleRecipient,
+		SenderPublicKey:            &examplePublicKey,
+		Value:                      &exampleValue,
+		Scheme:                     &exampleScheme,
+		Signature:                  &exampleSignature,
+	}
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/transactions",
+		Summary:  "Submit a signed (single-key or multisig) transaction and relay it to neighbors",
+		Request:  transactionRequest,
+		Response: api.SuccessExample,
+		Status:   http.StatusCreated,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+		RPC:      "sendtransaction",
+		Handler:  bcs.CreateTransaction,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPut,
+		Path:     "/v1/transactions",
+		Summary:  "Add a transaction relayed by a neighbor to the pool",
+		Request:  transactionRequest,
+		Response: api.SuccessExample,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity},
+		Handler:  bcs.AddTransaction,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodDelete,
+		Path:     "/v1/transactions",
+		Summary:  "Clear the transaction pool (transactions waiting for their lock_time are kept)",
+		Response: api.SuccessExample,
+		Errors:   []int{http.StatusUnauthorized},
+		Handler:  bcs.admin(bcs.ClearTransactions),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/mine",
+		Summary:  "Mine one block",
+		Response: api.SuccessExample,
+		Errors:   []int{http.StatusUnauthorized, http.StatusInternalServerError},
+		RPC:      "mine",
+		Handler:  bcs.admin(bcs.Mine),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/mine/start",
+		Summary:  "Start mining automatically",
+		Response: api.SuccessExample,
+		Errors:   []int{http.StatusUnauthorized},
+		RPC:      "startmining",
+		Handler:  bcs.admin(bcs.StartMine),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/mine/stop",
+		Summary:  "Stop mining automatically",
+		Response: api.SuccessExample,
+		Errors:   []int{http.StatusUnauthorized},
+		RPC:      "stopmining",
+		Handler:  bcs.admin(bcs.StopMine),
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/amount",
+		Summary: "Get the balance of an address",
+		Params: []api.Param{
+			{Name: "blockchain_address", In: "query", Required: true},
+			{Name: "minconf", In: "query", Type: "integer", Description: "Minimum confirmations for confirmed balance (default 1)"},
+		},
+		Response: block.NewAmountResponse(&block.Balance{Confirmed: 1.5, Unconfirmed: 0.5, Immature: 2.5}, 1),
+		Errors:   []int{http.StatusBadRequest},
+		RPC:      "getbalance",
+		Handler:  bcs.Amount,
+	})
+	exampleHeight := 3
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/addresses/{address}",
+		Summary: "Look up whether an address has been used (for HD wallet gap-limit discovery)",
+		Response: &AddressResponse{
+			BlockchainAddress: exampleAddress,
+			Used:              true,
+			TxCount:           2,
+			Received:          3,
+			Sent:              exampleValue,
+			FirstHeight:       &exampleHeight,
+			LastHeight:        &exampleHeight,
+		},
+		RPC:     "getaddressinfo",
+		Handler: bcs.Address,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/addresses/{address}/transactions",
+		Summary: "List transactions sent from or to an address, newest first, including pending ones",
+		Response: &AddressTransactionsResponse{
+			BlockchainAddress: exampleAddress,
+			Transactions: []*AddressTransaction{
+				{Height: &exampleHeight, Confirmations: 1, Transaction: exampleTransaction},
+			},
+		},
+		RPC:     "getaddresstransactions",
+		Handler: bcs.AddressTransactions,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPut,
+		Path:     "/v1/consensus",
+		Summary:  "Resolve conflicts with neighbors and adopt the longest valid chain",
+		Response: &ConsensusResponse{Replaced: true},
+		Handler:  bcs.Consensus,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/admin/info",
+		Summary: "Get the state of the node",
+		Response: &InfoResponse{
+			Network:          block.MainParams.Name,
+			Port:             5001,
+			Blocks:           4,
+			BestBlockHash:    exampleHash,
+			Difficulty:       block.MINING_DIFFICULTY,
+			MiningReward:     block.MINING_REWARD,
+			CoinbaseMaturity: block.COINBASE_MATURITY,
+			Mining:           true,
+			MinerAddress:     exampleAddress,
+			MempoolSize:      1,
+			Peers:            1,
+		},
+		Errors:  []int{http.StatusUnauthorized},
+		RPC:     "getinfo",
+		Handler: bcs.admin(bcs.Info),
+	})
+	examplePeers := &PeersResponse{Peers: []string{examplePeer}, Banned: []string{}}
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/v1/admin/peers",
+		Summary:  "List neighbors and banned neighbors",
+		Response: examplePeers,
+		Errors:   []int{http.StatusUnauthorized},
+		RPC:      "getpeerinfo",
+		Handler:  bcs.admin(bcs.Peers),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/admin/peers",
+		Summary:  "Add a neighbor",
+		Request:  &block.PeerRequest{Address: &examplePeer},
+		Response: examplePeers,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+		RPC:      "addpeer",
+		Handler:  bcs.admin(bcs.AddPeer),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/admin/peers/ban",
+		Summary:  "Remove a neighbor and never connect to it again",
+		Request:  &block.PeerRequest{Address: &examplePeer},
+		Response: &PeersResponse{Peers: []string{}, Banned: []string{examplePeer}},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+		RPC:      "banpeer",
+		Handler:  bcs.admin(bcs.BanPeer),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/v1/admin/verifychain",
+		Summary:  "Verify the proof of work, limits and lock times of every block",
+		Response: &VerifyChainResponse{Valid: true, Blocks: 4},
+		Errors:   []int{http.StatusUnauthorized},
+		RPC:      "verifychain",
+		Handler:  bcs.admin(bcs.VerifyChain),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/v1/admin/loglevel",
+		Summary:  "Get the minimum level of the logs written by this process",
+		Response: &LogLevelResponse{Level: "info"},
+		Errors:   []int{http.StatusUnauthorized},
+		RPC:      "getloglevel",
+		Handler:  bcs.admin(bcs.LogLevel),
+	})
+	exampleLevel := "debug"
+	r.Handle(&api.Route{
+		Method:   http.MethodPut,
+		Path:     "/v1/admin/loglevel",
+		Summary:  "Change the minimum log level (debug, info, warn or error) at runtime",
+		Request:  &LogLevelRequest{Level: &exampleLevel},
+		Response: &LogLevelResponse{Level: exampleLevel},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+		RPC:      "setloglevel",
+		Handler:  bcs.admin(bcs.SetLogLevel),
+	})
+	if bcs.params.IsRegtest() {
+		r.Handle(&api.Route{
+			Method:  http.MethodPost,
+			Path:    "/v1/regtest/generate",
+			Summary: "Mine blocks instantly (regtest only)",
+			Params: []api.Param{
+				{Name: "n", In: "query", Type: "integer", Description: fmt.Sprintf("Number of blocks (default 1, max %d)", MAX_REGTEST_GENERATE)},
+				{Name: "address", In: "query", Description: "Reward address (default: miner address)"},
+			},
+			Response: &GenerateResponse{Hashes: []string{exampleHash}},
+			Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+			RPC:      "generate",
+			Handler:  bcs.admin(bcs.RegtestGenerate),
+		})
+	}
+	if bcs.webhooks != nil {
+		r.Handle(&api.Route{
+			Method:  http.MethodPost,
+			Path:    "/v1/webhooks",
+			Summary: "Register a webhook notified when the addresses receive funds (secret is generated if omitted)",
+			Request: &webhook.WebhookRequest{
+				URL:           &exampleWebhookURL,
+				Addresses:     []string{exampleRecipient},
+				Confirmations: &exampleConfs,
+			},
+			Response: exampleWebhook,
+			Status:   http.StatusCreated,
+			Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+			RPC:      "addwebhook",
+			Handler:  bcs.admin(bcs.AddWebhook),
+		})
+		r.Handle(&api.Route{
+			Method:   http.MethodGet,
+			Path:     "/v1/webhooks",
+			Summary:  "List registered webhooks (without secrets)",
+			Response: &WebhooksResponse{Webhooks: []*webhook.Webhook{exampleWebhook.Redacted()}},
+			Errors:   []int{http.StatusUnauthorized},
+			RPC:      "listwebhooks",
+			Handler:  bcs.admin(bcs.Webhooks),
+		})
+		r.Handle(&api.Route{
+			Method:  http.MethodDelete,
+			Path:    "/v1/webhooks/{id}",
+			Summary: "Remove a webhook; its pending deliveries are marked as failed",
+			Errors:  []int{http.StatusNotFound, http.StatusUnauthorized},
+			RPC:     "removewebhook",
+			Handler: bcs.admin(bcs.RemoveWebhook),
+		})
+		r.Handle(&api.Route{
+			Method:  http.MethodGet,
+			Path:    "/v1/webhooks/{id}/deliveries",
+			Summary: "Delivery log of a webhook, newest first",
+			Params: []api.Param{
+				{Name: "status", In: "query", Description: "pending, delivered or failed"},
+			},
+			Response: &DeliveriesResponse{Deliveries: []*webhook.Delivery{{
+				ID:             "c0ffee0123456789abcdef0123456789",
+				WebhookID:      exampleWebhook.ID,
+				Payload:        json.RawMessage(`{"type":"address_received","value":1.5}`),
+				Status:         webhook.STATUS_DELIVERED,
+				Attempts:       1,
+				LastStatusCode: http.StatusOK,
+				CreatedAt:      1700000000,
+				DeliveredAt:    1700000001,
+			}}},
+			Errors:  []int{http.StatusNotFound, http.StatusUnauthorized},
+			RPC:     "getwebhookdeliveries",
+			Handler: bcs.admin(bcs.WebhookDeliveries),
+		})
+	}
+	eventParams := []api.Param{
+		{Name: "events", In: "query", Description: "Comma separated event types (default: all)"},
+		{Name: "addresses", In: "query", Description: "Comma separated addresses to follow transactions and balances of"},
+	}
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/v1/events",
+		Summary:  "Stream block, transaction and balance events as Server-Sent Events",
+		Params:   eventParams,
+		Response: exampleEvent,
+		Errors:   []int{http.StatusBadRequest, http.StatusServiceUnavailable},
+		Handler:  bcs.EventStream,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/v1/events/ws",
+		Summary:  "Stream events over WebSocket; send {\"events\":[...],\"addresses\":[...]} to change the subscription",
+		Params:   eventParams,
+		Response: exampleEvent,
+		Errors:   []int{http.StatusBadRequest, http.StatusServiceUnavailable},
+		Handler:  bcs.EventSocket,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/rpc",
+		Summary:  "JSON-RPC 2.0 endpoint (single or batch requests) for the methods listed by rpc.discover",
+		Request:  &api.RPCRequest{JSONRPC: api.JSONRPC_VERSION, Method: "getblock", Params: json.RawMessage(`[1]`), ID: json.RawMessage(`1`)},
+		Response: &api.RPCResponse{JSONRPC: api.JSONRPC_VERSION, Result: json.RawMessage(`{"height":1}`), ID: json.RawMessage(`1`)},
+		Handler:  r.RPCHandler(),
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/healthz",
+		Summary:  "Liveness probe; always ok while the process is serving requests",
+		Response: api.HealthOK,
+		Handler:  bcs.Healthz,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/readyz",
+		Summary: "Readiness probe; 503 unless the node has a neighbor, is close to the best neighbor height and has a recent tip",
+		Response: &api.ReadyResponse{Ready: true, Checks: []*api.Check{
+			{Name: "peers", OK: true, Message: "1 responding neighbors (min 1)"},
+			{Name: "height", OK: true, Message: "height 4, best neighbor height 4 (max 2 blocks behind)"},
+			{Name: "tip_age", OK: true, Message: "tip is 12s old (max 3m20s)"},
+		}},
+		Handler: bcs.Readyz,
+	})
+	exampleBestHeight := 4
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/status",
+		Summary: "Sync phase (connecting, syncing or synced) and progress against the best neighbor height",
+		Response: &StatusResponse{
+			Network:        block.MainParams.Name,
+			Phase:          SYNC_PHASE_SYNCED,
+			Progress:       1,
+			Height:         4,
+			BestPeerHeight: &exampleBestHeight,
+			BestBlockHash:  exampleHash,
+			Peers:          1,
+			TipAgeSec:      12.5,
+			Mining:         true,
+		},
+		RPC:     "getsyncstatus",
+		Handler: bcs.Status,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/metrics",
+		Summary: "Chain, mempool, peer and HTTP metrics in the Prometheus text format",
+		Handler: bcs.Metrics,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/openapi.json",
+		Summary: "OpenAPI specification of this API",
+		Handler: r.OpenAPIHandler("Blockchain Server API", API_VERSION),
+	})
+	return r
+}
+
+// ルーティングの設定
+// 全てのリクエストにリクエストIDを付け、DEBUGでアクセスログを出力する
+func (bcs *BlockchainServer) Handler() http.Handler {
+	routes := bcs.Routes()
+	routes.Instrument(bcs.http)
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", routes)
+	mux.Handle("/rpc", routes)
+	mux.Handle("/metrics", routes)
+	mux.Handle("/healthz", routes)
+	mux.Handle("/readyz", routes)
+	mux.Handle("/status", routes)
+	mux.Handle("/", bcs.http.Handler("explorer", http.HandlerFunc(bcs.Explorer)))
+	return logging.Handler(bcs.logger.Component(logging.COMPONENT_RPC), mux)
+}
@@ -0,0 +1,104 @@
+package node
+
+import (
+	"errors"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"go-blockchain/webhook"
+	"net/http"
+)
+
+// Webhookのリクエストボディの最大バイト数（アドレスの一覧を含む）
+const MAX_WEBHOOK_REQUEST_SIZE = 1 << 16
+
+// Webhookを設定し、配信を始める（GetBlockchainより前に呼ぶこと）
+func (bcs *BlockchainServer) SetWebhooks(d *webhook.Dispatcher) {
+	d.SetLogger(bcs.logger.Component(logging.COMPONENT_WEBHOOK))
+	bcs.webhooks = d
+	d.Start()
+}
+
+// ブロックの追加とPoolへの追加をWebhookに渡す
+// キューを挟むと溢れた時に通知が失われるので、イベントを受け取ったgoroutineでそのまま配信待ちとして保存する
+// （保存はジャーナルへの追記だけで、配信は別のgoroutineで行う）
+func (bcs *BlockchainServer) watchWebhooks(bc *block.Blockchain) {
+	bc.Subscribe(func(e *block.Event) {
+		switch e.Type {
+		case block.EVENT_BLOCK_CONNECTED:
+			// チェーンを置き換えた時は置き換えた後のチェーンでイベントが届く
+			chain := bc.Chain()
+			if e.Height < len(chain) && chain[e.Height].Hash() == e.Block.Hash() {
+				bcs.webhooks.BlockConnected(chain, e.Height)
+			}
+		case block.EVENT_TRANSACTION_ADDED:
+			bcs.webhooks.TransactionAdded(e.Transaction)
+		}
+	})
+}
+
+// Webhookを登録するAPI
+func (bcs *BlockchainServer) AddWebhook(w http.ResponseWriter, req *http.Request) {
+	var wr webhook.WebhookRequest
+	if !api.DecodeJSON(w, req, MAX_WEBHOOK_REQUEST_SIZE, &wr) {
+		return
+	}
+	if !wr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+			"url (http or https), addresses and confirmations are required")
+		return
+	}
+	wh, err := bcs.webhooks.Add(&wr)
+	if errors.Is(err, webhook.ErrInvalidTarget) || errors.Is(err, webhook.ErrTooManyWebhooks) {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	if err != nil {
+		logging.FromContext(req.Context()).Error("failed to add webhook", "err", err)
+		api.WriteError(w, http.StatusInternalServerError, api.CodeInternal, err.Error())
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, wh)
+}
+
+// 登録しているWebhookの一覧を返すAPI
+func (bcs *BlockchainServer) Webhooks(w http.ResponseWriter, req *http.Request) {
+	api.WriteJSON(w, http.StatusOK, &WebhooksResponse{Webhooks: bcs.webhooks.Webhooks()})
+}
+
+// Webhookを削除するAPI
+func (bcs *BlockchainServer) RemoveWebhook(w http.ResponseWriter, req *http.Request) {
+	if err := bcs.webhooks.Remove(api.PathParam(req, "id")); err != nil {
+		writeWebhookError(w, req, err)
+		return
+	}
+	api.WriteSuccess(w, http.StatusOK)
+}
+
+// Webhookの配信記録を返すAPI
+func (bcs *BlockchainServer) WebhookDeliveries(w http.ResponseWriter, req *http.Request) {
+	deliveries, err := bcs.webhooks.Deliveries(api.PathParam(req, "id"))
+	if err != nil {
+		writeWebhookError(w, req, err)
+		return
+	}
+	if status := req.URL.Query().Get("status"); status != "" {
+		filtered := make([]*webhook.Delivery, 0, len(deliveries))
+		for _, dl := range deliveries {
+			if dl.Status == status {
+				filtered = append(filtered, dl)
+			}
+		}
+		deliveries = filtered
+	}
+	api.WriteJSON(w, http.StatusOK, &DeliveriesResponse{Deliveries: deliveries})
+}
+
+func writeWebhookError(w http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, webhook.ErrNotFound) {
+		api.WriteError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
+		return
+	}
+	logging.FromContext(req.Context()).Error("webhook store error", "err", err)
+	api.WriteError(w, http.StatusInternalServerError, api.CodeInternal, err.Error())
+}
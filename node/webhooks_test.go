@@ -0,0 +1,73 @@
+package node
+
+import (
+	"encoding/json"
+	"go-blockchain/block"
+	"go-blockchain/webhook"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newWebhookServer(t *testing.T, allowPrivate bool) http.Handler {
+	t.Helper()
+	d, err := webhook.Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetAllowPrivateTargets(allowPrivate)
+	bcs := NewBlockchainServer(0, block.RegtestParams)
+	bcs.SetWebhooks(d)
+	t.Cleanup(bcs.Close)
+	return bcs.Handler()
+}
+
+// nodeの内部のホストを通知先にするWebhookは登録できない
+func TestAddWebhookPrivateTarget(t *testing.T) {
+	h := newWebhookServer(t, false)
+	for _, url := range []string{"http://127.0.0.1:5001/v1/admin/log-level", "http://169.254.169.254/", "http://10.0.0.1/"} {
+		body := `{"url":"` + url + `","addresses":["B"],"confirmations":0}`
+		if code := serve(h, http.MethodPost, "/v1/webhooks", body, "127.0.0.1:1234", ""); code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want %d", url, code, http.StatusBadRequest)
+		}
+	}
+	// トークンを設定していない場合は他のホストから登録できない
+	body := `{"url":"https://example.com/hook","addresses":["B"],"confirmations":0}`
+	if code := serve(h, http.MethodPost, "/v1/webhooks", body, "203.0.113.1:1234", ""); code != http.StatusUnauthorized {
+		t.Errorf("remote: got %d, want %d", code, http.StatusUnauthorized)
+	}
+}
+
+// 生成したブロックの入金がhttptestの受信側に届く
+func TestWebhookBlockConnected(t *testing.T) {
+	received := make(chan []byte, 10)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		received <- body
+	}))
+	defer receiver.Close()
+	h := newWebhookServer(t, true)
+
+	body := `{"url":"` + receiver.URL + `","addresses":["X"],"confirmations":1}`
+	if code := serve(h, http.MethodPost, "/v1/webhooks", body, "127.0.0.1:1234", ""); code != http.StatusCreated {
+		t.Fatalf("register: got %d", code)
+	}
+	if code := serve(h, http.MethodPost, "/v1/regtest/generate?n=1&address=X", "", "127.0.0.1:1234", ""); code != http.StatusOK {
+		t.Fatalf("generate: got %d", code)
+	}
+
+	select {
+	case body := <-received:
+		var p webhook.Payload
+		if err := json.Unmarshal(body, &p); err != nil {
+			t.Fatal(err)
+		}
+		if p.Address != "X" || p.Confirmations != 1 || p.Height == nil || *p.Height != 1 {
+			t.Errorf("unexpected payload %s", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("webhook was not delivered")
+	}
+}
@@ -0,0 +1,133 @@
+// 結合テスト用に、regtestモードのブロックチェーンnodeを
+// httptestサーバー上でプロセス内に複数立ち上げるためのハーネス
+package regtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-blockchain/block"
+	"go-blockchain/node"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+// httptestサーバー上で動くregtestのnode
+type Node struct {
+	server *node.BlockchainServer
+	http   *httptest.Server
+}
+
+// regtestのnodeを1つ立ち上げる
+func NewNode() *Node {
+	return NewNodeWithParams(block.RegtestParams)
+}
+
+// パラメータを指定してnodeを1つ立ち上げる（CoinbaseMaturityを変更する場合など）
+func NewNodeWithParams(params *block.Params) *Node {
+	bcs := node.NewBlockchainServer(0, params)
+	n := &Node{
+		server: bcs,
+		http:   httptest.NewServer(bcs.Handler()),
+	}
+	bcs.GetBlockchain().Run()
+	return n
+}
+
+func (n *Node) Server() *node.BlockchainServer {
+	return n.server
+}
+
+func (n *Node) Blockchain() *block.Blockchain {
+	return n.server.GetBlockchain()
+}
+
+// nodeのURL（http://127.0.0.1:port）
+func (n *Node) URL() string {
+	return n.http.URL
+}
+
+// neighborとして登録する際のアドレス（127.0.0.1:port）
+func (n *Node) Host() string {
+	u, _ := url.Parse(n.http.URL)
+	return u.Host
+}
+
+// /v1/regtest/generateを叩いてブロックをcount個生成し、ブロックのhashを返す
+// addressが空の場合はnodeのminerに報酬が送られる
+func (n *Node) Generate(count int, address string) ([]string, error) {
+	q := url.Values{}
+	q.Set("n", strconv.Itoa(count))
+	if address != "" {
+		q.Set("address", address)
+	}
+	resp, err := http.Post(n.URL()+"/v1/regtest/generate?"+q.Encode(), "application/json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("generate: unexpected status %d", resp.StatusCode)
+	}
+
+	var v struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+		return nil, err
+	}
+	return v.Hashes, nil
+}
+
+func (n *Node) Close() {
+	n.http.Close()
+	n.server.Close()
+}
+
+// ------------------------------------------------------------------------------------------
+// 複数のregtest nodeをまとめて管理する
+type Harness struct {
+	Nodes []*Node
+}
+
+// count個のnodeを立ち上げ、全てのnodeを相互に接続する
+// テスト終了時に自動でCloseされる
+func NewHarness(tb testing.TB, count int) *Harness {
+	tb.Helper()
+	h := &Harness{}
+	for i := 0; i < count; i++ {
+		h.Nodes = append(h.Nodes, NewNode())
+	}
+	h.ConnectAll()
+	tb.Cleanup(h.Close)
+	return h
+}
+
+// 2つのnodeを相互にneighborとして登録する
+func (h *Harness) Connect(a *Node, b *Node) {
+	a.Blockchain().AddNeighbor(b.Host())
+	b.Blockchain().AddNeighbor(a.Host())
+}
+
+func (h *Harness) ConnectAll() {
+	for i, a := range h.Nodes {
+		for _, b := range h.Nodes[i+1:] {
+			h.Connect(a, b)
+		}
+	}
+}
+
+// 全てのnodeでコンセンサスを取り直す
+func (h *Harness) Sync() {
+	for _, n := range h.Nodes {
+		n.Blockchain().ResolveConflicts()
+	}
+}
+
+func (h *Harness) Close() {
+	for _, n := range h.Nodes {
+		n.Close()
+	}
+}
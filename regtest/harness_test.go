@@ -0,0 +1,47 @@
+package regtest
+
+import (
+	"fmt"
+	"go-blockchain/node"
+	"testing"
+)
+
+func TestGenerateAndSync(t *testing.T) {
+	h := NewHarness(t, 2)
+	hashes, err := h.Nodes[0].Generate(3, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hashes) != 3 {
+		t.Fatalf("got %d hashes, want 3", len(hashes))
+	}
+	h.Sync()
+
+	for i, n := range h.Nodes {
+		chain := n.Blockchain().Chain()
+		if len(chain) != 4 {
+			t.Fatalf("node %d: got %d blocks, want 4", i, len(chain))
+		}
+		if got := fmt.Sprintf("%x", chain[3].Hash()); got != hashes[2] {
+			t.Errorf("node %d: tip %s, want %s", i, got, hashes[2])
+		}
+	}
+}
+
+func TestGenerateLimit(t *testing.T) {
+	h := NewHarness(t, 1)
+	for _, n := range []int{0, -1, node.MAX_REGTEST_GENERATE + 1} {
+		if _, err := h.Nodes[0].Generate(n, ""); err == nil {
+			t.Errorf("generate %d: expected an error", n)
+		}
+	}
+	if got := len(h.Nodes[0].Blockchain().Chain()); got != 1 {
+		t.Errorf("got %d blocks, want only the genesis block", got)
+	}
+}
+
+func TestCloseTwice(t *testing.T) {
+	n := NewNode()
+	n.Close()
+	n.Close()
+}
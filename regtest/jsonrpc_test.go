@@ -0,0 +1,180 @@
+package regtest
+
+import (
+	"encoding/json"
+	"go-blockchain/api"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// /rpcにbodyを送り、ステータスコードとレスポンスのボディを返す
+func postRPC(t *testing.T, n *Node, body string) (int, []byte) {
+	t.Helper()
+	resp, err := http.Post(n.URL()+"/rpc", "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var raw json.RawMessage
+	if resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&raw); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, raw
+}
+
+func callRPC(t *testing.T, n *Node, body string) *api.RPCResponse {
+	t.Helper()
+	status, raw := postRPC(t, n, body)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	var resp api.RPCResponse
+	if err := json.Unmarshal(raw, &resp); err != nil {
+		t.Fatalf("%s: %v", raw, err)
+	}
+	return &resp
+}
+
+func TestRPCCall(t *testing.T) {
+	n := NewHarness(t, 1).Nodes[0]
+
+	resp := callRPC(t, n, `{"jsonrpc":"2.0","id":1,"method":"generate","params":[2]}`)
+	if resp.Error != nil {
+		t.Fatalf("generate: %+v", resp.Error)
+	}
+	var generated struct {
+		Hashes []string `json:"hashes"`
+	}
+	if err := json.Unmarshal(resp.Result, &generated); err != nil || len(generated.Hashes) != 2 {
+		t.Fatalf("generate: unexpected result %s", resp.Result)
+	}
+
+	// 配列のparamsはParamsの順番、オブジェクトは名前で割り当てる
+	for _, body := range []string{
+		`{"jsonrpc":"2.0","id":"a","method":"getblock","params":[2]}`,
+		`{"jsonrpc":"2.0","id":"a","method":"getblock","params":{"id":"` + generated.Hashes[1] + `"}}`,
+	} {
+		resp := callRPC(t, n, body)
+		if resp.Error != nil {
+			t.Fatalf("getblock: %+v", resp.Error)
+		}
+		if string(resp.ID) != `"a"` {
+			t.Errorf("getblock: id %s, want \"a\"", resp.ID)
+		}
+		var b struct {
+			Height int    `json:"height"`
+			Hash   string `json:"hash"`
+		}
+		if err := json.Unmarshal(resp.Result, &b); err != nil {
+			t.Fatal(err)
+		}
+		if b.Height != 2 || b.Hash != generated.Hashes[1] {
+			t.Errorf("getblock: got height %d hash %s, want 2 %s", b.Height, b.Hash, generated.Hashes[1])
+		}
+	}
+}
+
+func TestRPCBatch(t *testing.T) {
+	n := NewHarness(t, 1).Nodes[0]
+
+	// 通知（idなし）はレスポンスを返さないが実行はされる
+	status, raw := postRPC(t, n, `[
+		{"jsonrpc":"2.0","id":1,"method":"getinfo"},
+		{"jsonrpc":"2.0","method":"generate","params":{"n":3}},
+		{"jsonrpc":"2.0","id":2,"method":"getblock","params":[3]},
+		{"jsonrpc":"2.0","id":3,"method":"nosuchmethod"}
+	]`)
+	if status != http.StatusOK {
+		t.Fatalf("unexpected status %d", status)
+	}
+	var responses []*api.RPCResponse
+	if err := json.Unmarshal(raw, &responses); err != nil {
+		t.Fatal(err)
+	}
+	if len(responses) != 3 {
+		t.Fatalf("got %d responses, want 3: %s", len(responses), raw)
+	}
+	for i, want := range []string{"1", "2", "3"} {
+		if string(responses[i].ID) != want {
+			t.Errorf("response %d: id %s, want %s", i, responses[i].ID, want)
+		}
+	}
+	if responses[0].Error != nil || responses[1].Error != nil {
+		t.Errorf("unexpected errors: %+v, %+v", responses[0].Error, responses[1].Error)
+	}
+	if e := responses[2].Error; e == nil || e.Code != api.RPCMethodNotFound {
+		t.Errorf("unknown method: got %+v, want code %d", e, api.RPCMethodNotFound)
+	}
+	if got := len(n.Blockchain().Chain()); got != 4 {
+		t.Errorf("notification not executed: got %d blocks, want 4", got)
+	}
+
+	// 通知だけのバッチは204
+	if status, _ := postRPC(t, n, `[{"jsonrpc":"2.0","method":"getinfo"}]`); status != http.StatusNoContent {
+		t.Errorf("notification batch: got status %d, want %d", status, http.StatusNoContent)
+	}
+	if status, _ := postRPC(t, n, `{"jsonrpc":"2.0","method":"getinfo"}`); status != http.StatusNoContent {
+		t.Errorf("notification: got status %d, want %d", status, http.StatusNoContent)
+	}
+}
+
+func TestRPCErrors(t *testing.T) {
+	n := NewHarness(t, 1).Nodes[0]
+	tooLarge := "[" + strings.TrimSuffix(strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"getinfo"},`, api.MAX_RPC_BATCH+1), ",") + "]"
+
+	tests := []struct {
+		name string
+		body string
+		code int
+	}{
+		{"parse error", `{"jsonrpc":"2.0",`, api.RPCParseError},
+		{"batch parse error", `[{"jsonrpc":"2.0"`, api.RPCParseError},
+		{"wrong version", `{"jsonrpc":"1.0","id":1,"method":"getinfo"}`, api.RPCInvalidRequest},
+		{"missing method", `{"jsonrpc":"2.0","id":1}`, api.RPCInvalidRequest},
+		{"invalid id", `{"jsonrpc":"2.0","id":{},"method":"getinfo"}`, api.RPCInvalidRequest},
+		{"empty batch", `[]`, api.RPCInvalidRequest},
+		{"batch too large", tooLarge, api.RPCInvalidRequest},
+		{"method not found", `{"jsonrpc":"2.0","id":1,"method":"nosuchmethod"}`, api.RPCMethodNotFound},
+		{"missing param", `{"jsonrpc":"2.0","id":1,"method":"getblock"}`, api.RPCInvalidParams},
+		{"invalid param", `{"jsonrpc":"2.0","id":1,"method":"generate","params":[0]}`, api.RPCInvalidParams},
+		{"body params not an object", `{"jsonrpc":"2.0","id":1,"method":"addpeer","params":[1]}`, api.RPCInvalidParams},
+		{"not found", `{"jsonrpc":"2.0","id":1,"method":"getblock","params":[999]}`, api.RPCNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := callRPC(t, n, tt.body)
+			if resp.Error == nil || resp.Error.Code != tt.code {
+				t.Errorf("got %+v, want code %d", resp.Error, tt.code)
+			}
+		})
+	}
+
+	// RESTのエラーコードとステータスコードはdataに入る
+	n.Server().SetAdminToken("secret")
+	resp := callRPC(t, n, `{"jsonrpc":"2.0","id":1,"method":"generate"}`)
+	if resp.Error == nil || resp.Error.Code != api.RPCUnauthorized {
+		t.Fatalf("unauthorized: got %+v, want code %d", resp.Error, api.RPCUnauthorized)
+	}
+	if d := resp.Error.Data; d == nil || d.Code != api.CodeUnauthorized || d.Status != http.StatusUnauthorized {
+		t.Errorf("unauthorized: unexpected data %+v", d)
+	}
+}
+
+func TestRPCDiscover(t *testing.T) {
+	n := NewHarness(t, 1).Nodes[0]
+	resp := callRPC(t, n, `{"jsonrpc":"2.0","id":1,"method":"rpc.discover"}`)
+	var methods []*api.RPCMethod
+	if err := json.Unmarshal(resp.Result, &methods); err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, m := range methods {
+		found = found || (m.Name == "generate" && m.REST == "POST /v1/regtest/generate")
+	}
+	if !found {
+		t.Errorf("generate not found in %s", resp.Result)
+	}
+}
@@ -0,0 +1,69 @@
+package regtest
+
+import (
+	"net/http"
+	"sync"
+	"testing"
+)
+
+// チェーンの置き換えとマイニングの最中に、イベント、Webhook、ヘルスチェックと同じようにチェーンを読み込む
+// go test -raceで競合がないことを確認する
+func TestConcurrentReorg(t *testing.T) {
+	h := NewHarness(t, 2)
+	a, b := h.Nodes[0], h.Nodes[1]
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, path := range []string{"/v1/chain", "/status", "/readyz", "/v1/admin/info"} {
+		wg.Add(1)
+		go func(path string) {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				resp, err := http.Get(b.URL() + path)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				resp.Body.Close()
+			}
+		}(path)
+	}
+
+	// イベントとWebhookの配信のようにBlockchainを直接読み込む
+	bc := b.Blockchain()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			bc.LastBlock()
+			bc.CalculateBalance(bc.BlockchainAddress(), 1)
+			bc.AddressInfo(bc.BlockchainAddress())
+		}
+	}()
+
+	for i := 0; i < 10; i++ {
+		if _, err := a.Generate(2, ""); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := b.Generate(1, ""); err != nil {
+			t.Fatal(err)
+		}
+		h.Sync()
+	}
+	close(done)
+	wg.Wait()
+
+	if la, lb := len(a.Blockchain().Chain()), len(b.Blockchain().Chain()); la != lb {
+		t.Errorf("nodes did not converge: %d and %d blocks", la, lb)
+	}
+}
@@ -0,0 +1,110 @@
+package script
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/btcsuite/btcutil/base58"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// アドレスのバージョンバイト
+const (
+	PUBKEY_HASH_ADDRESS_VERSION = 0x00
+	SCRIPT_HASH_ADDRESS_VERSION = 0x05
+
+	HASH160_SIZE = 20
+)
+
+// scriptを組み立てる
+// dataは最短の命令でpushする
+type Builder struct {
+	script []byte
+}
+
+func NewBuilder() *Builder {
+	return &Builder{}
+}
+
+func (b *Builder) AddOp(op byte) *Builder {
+	b.script = append(b.script, op)
+	return b
+}
+
+func (b *Builder) AddData(data []byte) *Builder {
+	op := pushOpcode(data)
+	switch {
+	case op == OP_0 || op == OP_1NEGATE || (op >= OP_1 && op <= OP_16):
+		return b.AddOp(op)
+	case op == OP_PUSHDATA1:
+		b.script = append(b.script, op, byte(len(data)))
+	case op == OP_PUSHDATA2:
+		var n [2]byte
+		binary.LittleEndian.PutUint16(n[:], uint16(len(data)))
+		b.script = append(b.script, op, n[0], n[1])
+	default:
+		b.script = append(b.script, op)
+	}
+	b.script = append(b.script, data...)
+	return b
+}
+
+func (b *Builder) AddInt64(n int64) *Builder {
+	return b.AddData(encodeNum(n))
+}
+
+// 組み立てたscriptを返す（分解できないscriptはエラー）
+func (b *Builder) Script() ([]byte, error) {
+	if _, err := parse(b.script); err != nil {
+		return nil, err
+	}
+	return b.script, nil
+}
+
+// SHA-256の後にRIPEMD-160
+func Hash160(b []byte) []byte {
+	h := sha256.Sum256(b)
+	r := ripemd160.New()
+	r.Write(h[:])
+	return r.Sum(nil)
+}
+
+// OP_DUP OP_HASH160 <hash> OP_EQUALVERIFY OP_CHECKSIG
+func PayToPubKeyHash(hash []byte) []byte {
+	s, _ := NewBuilder().AddOp(OP_DUP).AddOp(OP_HASH160).AddData(hash).
+		AddOp(OP_EQUALVERIFY).AddOp(OP_CHECKSIG).Script()
+	return s
+}
+
+// OP_HASH160 <hash> OP_EQUAL
+func PayToScriptHash(hash []byte) []byte {
+	s, _ := NewBuilder().AddOp(OP_HASH160).AddData(hash).AddOp(OP_EQUAL).Script()
+	return s
+}
+
+// P2SHのlocking scriptか
+func IsPayToScriptHash(script []byte) bool {
+	return len(script) == HASH160_SIZE+3 &&
+		script[0] == OP_HASH160 && script[1] == HASH160_SIZE && script[len(script)-1] == OP_EQUAL
+}
+
+// redeem scriptのhashから作るP2SHのアドレス
+func ScriptHashAddress(redeemScript []byte) string {
+	return base58.CheckEncode(Hash160(redeemScript), SCRIPT_HASH_ADDRESS_VERSION)
+}
+
+// アドレスに送られた仮想通貨を使うためのlocking script
+// バージョンバイトが0x00ならP2PKH、0x05ならP2SH
+func LockingScript(blockchainAddress string) ([]byte, error) {
+	hash, version, err := base58.CheckDecode(blockchainAddress)
+	if err != nil || len(hash) != HASH160_SIZE {
+		return nil, ErrInvalidAddress
+	}
+	switch version {
+	case PUBKEY_HASH_ADDRESS_VERSION:
+		return PayToPubKeyHash(hash), nil
+	case SCRIPT_HASH_ADDRESS_VERSION:
+		return PayToScriptHash(hash), nil
+	}
+	return nil, ErrInvalidAddress
+}
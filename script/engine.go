@@ -0,0 +1,449 @@
+// 送金の条件を表すスタックベースのscript
+//
+// 送信者のアドレスから作るlocking script（P2PKHまたはP2SH）を、
+// Transactionに載せたunlocking scriptで解除できる場合だけ送金を受け付ける
+// 同じscriptと同じContextなら必ず同じ結果になり、1回の検証で使えるコストには上限がある
+package script
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"go-blockchain/keys"
+)
+
+const (
+	MAX_SCRIPT_SIZE   = 10000
+	MAX_ELEMENT_SIZE  = 520
+	MAX_STACK_SIZE    = 1000
+	MAX_MULTISIG_KEYS = 20
+
+	LOCK_TIME_THRESHOLD = 500000000 // lock_timeがこれ未満ならブロックの高さ、以上ならUNIX時間（秒）
+
+	MAX_SCRIPT_COST = 2000 // 1回の検証で使えるコストの上限
+	OP_COST         = 1    // 命令1つのコスト
+	SIG_CHECK_COST  = 50   // 署名の検証1回のコスト
+)
+
+var (
+	ErrScriptTooLarge        = errors.New("script is too large")
+	ErrElementTooLarge       = errors.New("push data is too large")
+	ErrMalformedPush         = errors.New("malformed push")
+	ErrNonMinimalPush        = errors.New("push is not minimally encoded")
+	ErrUnknownOpcode         = errors.New("unknown opcode")
+	ErrInvalidAssembly       = errors.New("invalid script assembly")
+	ErrInvalidAddress        = errors.New("address has no locking script")
+	ErrNotPushOnly           = errors.New("unlocking script must contain only pushes")
+	ErrCostLimit             = errors.New("script exceeds the cost limit")
+	ErrStackOverflow         = errors.New("stack size limit exceeded")
+	ErrStackUnderflow        = errors.New("not enough items on the stack")
+	ErrNumberTooLarge        = errors.New("number is too large")
+	ErrNonMinimalNumber      = errors.New("number is not minimally encoded")
+	ErrMinimalIf             = errors.New("OP_IF argument must be empty or 1")
+	ErrUnbalancedConditional = errors.New("unbalanced conditional")
+	ErrVerifyFailed          = errors.New("verify failed")
+	ErrEarlyReturn           = errors.New("script returned early")
+	ErrInvalidMultisigCount  = errors.New("invalid number of multisig keys or signatures")
+	ErrNegativeLockTime      = errors.New("negative lock time")
+	ErrLockTimeNotReached    = errors.New("lock time has not been reached")
+	ErrLockTimeTypeMismatch  = errors.New("lock time must be the same type (height or time) as the transaction")
+	ErrSequenceNotReached    = errors.New("relative lock time has not been reached")
+	ErrEvalFalse             = errors.New("script evaluated to false")
+	ErrCleanStack            = errors.New("stack must contain only the result after execution")
+)
+
+// scriptを実行する時のTransactionとチェーンの情報
+type Context struct {
+	Scheme keys.Scheme // 署名と公開鍵の方式
+	Hash   []byte      // 署名するTransactionのhash
+	// Transactionのlock_time（OP_CHECKLOCKTIMEVERIFYで使う）
+	// 高さのlock_timeが次のブロックの高さより小さい場合は次のブロックの高さ
+	LockTime int64
+	Age      int64 // 支払いに使う資金を受け取ってからのブロック数（OP_CHECKSEQUENCEVERIFYで使う）
+}
+
+// unlocking scriptでlocking scriptを解除できるか検証する
+// locking scriptがP2SHの場合は、unlocking scriptの最後にpushしたredeem scriptも実行する
+func Verify(unlocking []byte, locking []byte, ctx *Context) error {
+	instructions, err := parse(unlocking)
+	if err != nil {
+		return err
+	}
+	for _, in := range instructions {
+		if !in.isPush() {
+			return ErrNotPushOnly
+		}
+	}
+
+	vm := &engine{ctx: ctx}
+	if err := vm.execute(unlocking); err != nil {
+		return err
+	}
+	var redeemScript []byte
+	var redeemStack [][]byte
+	p2sh := IsPayToScriptHash(locking)
+	if p2sh {
+		if len(vm.stack) == 0 {
+			return ErrStackUnderflow
+		}
+		redeemScript = vm.stack[len(vm.stack)-1]
+		redeemStack = append([][]byte{}, vm.stack[:len(vm.stack)-1]...)
+	}
+	if err := vm.execute(locking); err != nil {
+		return err
+	}
+	if err := vm.result(); err != nil {
+		return err
+	}
+	// P2SHの場合はunlocking scriptを実行した直後のスタックでredeem scriptを実行する
+	if p2sh {
+		vm.stack = redeemStack
+		if err := vm.execute(redeemScript); err != nil {
+			return err
+		}
+		if err := vm.result(); err != nil {
+			return err
+		}
+	}
+	if len(vm.stack) != 0 {
+		return ErrCleanStack
+	}
+	return nil
+}
+
+type engine struct {
+	ctx   *Context
+	stack [][]byte
+	cost  int
+}
+
+// 一番上の値が真なら取り除く
+func (vm *engine) result() error {
+	v, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(v) {
+		return ErrEvalFalse
+	}
+	return nil
+}
+
+func (vm *engine) execute(script []byte) error {
+	instructions, err := parse(script)
+	if err != nil {
+		return err
+	}
+	var conditions []bool
+	for _, in := range instructions {
+		if err := vm.spend(OP_COST); err != nil {
+			return err
+		}
+		executing := true
+		for _, c := range conditions {
+			executing = executing && c
+		}
+		switch in.op {
+		case OP_IF, OP_NOTIF:
+			cond := false
+			if executing {
+				v, err := vm.pop()
+				if err != nil {
+					return err
+				}
+				if len(v) > 1 || (len(v) == 1 && v[0] != 1) {
+					return ErrMinimalIf
+				}
+				cond = asBool(v) == (in.op == OP_IF)
+			}
+			conditions = append(conditions, cond)
+			continue
+		case OP_ELSE:
+			if len(conditions) == 0 {
+				return ErrUnbalancedConditional
+			}
+			conditions[len(conditions)-1] = !conditions[len(conditions)-1]
+			continue
+		case OP_ENDIF:
+			if len(conditions) == 0 {
+				return ErrUnbalancedConditional
+			}
+			conditions = conditions[:len(conditions)-1]
+			continue
+		}
+		if !executing {
+			continue
+		}
+		if err := vm.step(&in); err != nil {
+			return err
+		}
+	}
+	if len(conditions) != 0 {
+		return ErrUnbalancedConditional
+	}
+	return nil
+}
+
+// 制御構文以外の命令を1つ実行する
+func (vm *engine) step(in *instruction) error {
+	switch {
+	case in.data != nil || in.op == OP_0:
+		return vm.push(in.data)
+	case in.op == OP_1NEGATE:
+		return vm.push(encodeNum(-1))
+	case in.op >= OP_1 && in.op <= OP_16:
+		return vm.push(encodeNum(int64(in.op-OP_1) + 1))
+	}
+
+	switch in.op {
+	case OP_NOP:
+		return nil
+	case OP_VERIFY:
+		return vm.verify()
+	case OP_RETURN:
+		return ErrEarlyReturn
+	case OP_DROP:
+		_, err := vm.pop()
+		return err
+	case OP_DUP:
+		v, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		return vm.push(v)
+	case OP_SWAP:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		vm.stack = append(vm.stack, a, b)
+		return nil
+	case OP_SIZE:
+		v, err := vm.peek()
+		if err != nil {
+			return err
+		}
+		return vm.push(encodeNum(int64(len(v))))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if err := vm.pushBool(bytes.Equal(a, b)); err != nil {
+			return err
+		}
+		if in.op == OP_EQUALVERIFY {
+			return vm.verify()
+		}
+		return nil
+	case OP_SHA256:
+		v, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		h := sha256.Sum256(v)
+		return vm.push(h[:])
+	case OP_HASH160:
+		v, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		return vm.push(Hash160(v))
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		if err := vm.checkSig(); err != nil {
+			return err
+		}
+		if in.op == OP_CHECKSIGVERIFY {
+			return vm.verify()
+		}
+		return nil
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		if err := vm.checkMultisig(); err != nil {
+			return err
+		}
+		if in.op == OP_CHECKMULTISIGVERIFY {
+			return vm.verify()
+		}
+		return nil
+	case OP_CHECKLOCKTIMEVERIFY:
+		return vm.checkLockTime(vm.ctx.LockTime, true, ErrLockTimeNotReached)
+	case OP_CHECKSEQUENCEVERIFY:
+		return vm.checkLockTime(vm.ctx.Age, false, ErrSequenceNotReached)
+	}
+	return ErrUnknownOpcode
+}
+
+// <sig> <pubkey> OP_CHECKSIG
+// 空の署名は偽としてpushし、それ以外で不正なエンコードの署名や公開鍵はエラーにする
+func (vm *engine) checkSig() error {
+	pubKeyBytes, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	sigBytes, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if err := vm.spend(SIG_CHECK_COST); err != nil {
+		return err
+	}
+	pub, err := keys.ParseAddressBytes(vm.ctx.Scheme, pubKeyBytes)
+	if err != nil {
+		return err
+	}
+	if len(sigBytes) == 0 {
+		return vm.pushBool(false)
+	}
+	sig, err := keys.ParseSignature(vm.ctx.Scheme, sigBytes)
+	if err != nil {
+		return err
+	}
+	return vm.pushBool(pub.Verify(vm.ctx.Hash, sig))
+}
+
+// <sig1> ... <sigM> M <pubkey1> ... <pubkeyN> N OP_CHECKMULTISIG
+// 署名は公開鍵と同じ順番で並べる（Bitcoinの余分な要素のpopは行わない）
+func (vm *engine) checkMultisig() error {
+	n, err := vm.popCount(MAX_MULTISIG_KEYS)
+	if err != nil {
+		return err
+	}
+	if err := vm.spend(SIG_CHECK_COST * n); err != nil {
+		return err
+	}
+	pubs := make([]keys.PublicKey, n)
+	for i := n - 1; i >= 0; i-- {
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if pubs[i], err = keys.ParseAddressBytes(vm.ctx.Scheme, b); err != nil {
+			return err
+		}
+	}
+	m, err := vm.popCount(n)
+	if err != nil {
+		return err
+	}
+	sigs := make([]*keys.Signature, m)
+	for i := m - 1; i >= 0; i-- {
+		b, err := vm.pop()
+		if err != nil {
+			return err
+		}
+		if sigs[i], err = keys.ParseSignature(vm.ctx.Scheme, b); err != nil {
+			return err
+		}
+	}
+	k := 0
+	for _, sig := range sigs {
+		for k < n && !pubs[k].Verify(vm.ctx.Hash, sig) {
+			k++
+		}
+		if k == n {
+			return vm.pushBool(false)
+		}
+		k++
+	}
+	return vm.pushBool(true)
+}
+
+// スタックの一番上の値（取り除かない）とlimitを比べる
+// sameTypeの場合は高さとUNIX時間の種類も一致しなければならない
+func (vm *engine) checkLockTime(limit int64, sameType bool, notReached error) error {
+	v, err := vm.peek()
+	if err != nil {
+		return err
+	}
+	n, err := decodeNum(v, MAX_LOCK_NUM_SIZE)
+	if err != nil {
+		return err
+	}
+	if n < 0 {
+		return ErrNegativeLockTime
+	}
+	if sameType && (n < LOCK_TIME_THRESHOLD) != (limit < LOCK_TIME_THRESHOLD) {
+		return ErrLockTimeTypeMismatch
+	}
+	if n > limit {
+		return notReached
+	}
+	return nil
+}
+
+// 0..maxの数値を取り出す
+func (vm *engine) popCount(max int) (int, error) {
+	v, err := vm.pop()
+	if err != nil {
+		return 0, err
+	}
+	n, err := decodeNum(v, MAX_NUM_SIZE)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 || n > int64(max) {
+		return 0, ErrInvalidMultisigCount
+	}
+	return int(n), nil
+}
+
+func (vm *engine) verify() error {
+	v, err := vm.pop()
+	if err != nil {
+		return err
+	}
+	if !asBool(v) {
+		return ErrVerifyFailed
+	}
+	return nil
+}
+
+func (vm *engine) spend(cost int) error {
+	vm.cost += cost
+	if vm.cost > MAX_SCRIPT_COST {
+		return ErrCostLimit
+	}
+	return nil
+}
+
+func (vm *engine) push(v []byte) error {
+	if len(v) > MAX_ELEMENT_SIZE {
+		return ErrElementTooLarge
+	}
+	if len(vm.stack) >= MAX_STACK_SIZE {
+		return ErrStackOverflow
+	}
+	vm.stack = append(vm.stack, v)
+	return nil
+}
+
+func (vm *engine) pushBool(b bool) error {
+	if b {
+		return vm.push([]byte{1})
+	}
+	return vm.push([]byte{})
+}
+
+func (vm *engine) pop() ([]byte, error) {
+	v, err := vm.peek()
+	if err != nil {
+		return nil, err
+	}
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return v, nil
+}
+
+func (vm *engine) peek() ([]byte, error) {
+	if len(vm.stack) == 0 {
+		return nil, ErrStackUnderflow
+	}
+	return vm.stack[len(vm.stack)-1], nil
+}
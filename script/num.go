@@ -0,0 +1,68 @@
+package script
+
+// scriptの数値はリトルエンディアンの符号と絶対値の形式で、最上位ビットが符号を表す
+// 同じ値が複数の表現を持たないように、最短の形式でなければエラーにする
+
+const (
+	MAX_NUM_SIZE      = 4 // 演算に使う数値の最大バイト数
+	MAX_LOCK_NUM_SIZE = 5 // タイムロックの数値の最大バイト数
+)
+
+func encodeNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	negative := n < 0
+	if negative {
+		n = -n
+	}
+	var b []byte
+	for n > 0 {
+		b = append(b, byte(n&0xff))
+		n >>= 8
+	}
+	// 最上位ビットが使われている場合は符号のためのバイトを追加する
+	if b[len(b)-1]&0x80 != 0 {
+		if negative {
+			b = append(b, 0x80)
+		} else {
+			b = append(b, 0x00)
+		}
+	} else if negative {
+		b[len(b)-1] |= 0x80
+	}
+	return b
+}
+
+func decodeNum(b []byte, maxSize int) (int64, error) {
+	if len(b) > maxSize {
+		return 0, ErrNumberTooLarge
+	}
+	if len(b) == 0 {
+		return 0, nil
+	}
+	// 最上位バイトが符号だけの場合は、その下のバイトの最上位ビットが使われていなければならない
+	if b[len(b)-1]&0x7f == 0 && (len(b) == 1 || b[len(b)-2]&0x80 == 0) {
+		return 0, ErrNonMinimalNumber
+	}
+	var n int64
+	for i, c := range b {
+		n |= int64(c) << (8 * i)
+	}
+	if b[len(b)-1]&0x80 != 0 {
+		n &^= int64(0x80) << (8 * (len(b) - 1))
+		return -n, nil
+	}
+	return n, nil
+}
+
+// スタックの値を真偽値として扱う（0と負の0は偽）
+func asBool(b []byte) bool {
+	for i, c := range b {
+		if c != 0 {
+			// 最後のバイトが符号ビットだけの場合は負の0
+			return !(i == len(b)-1 && c == 0x80)
+		}
+	}
+	return false
+}
@@ -0,0 +1,94 @@
+package script
+
+import "strconv"
+
+// Bitcoinと同じ値のopcode（使えるものだけ）
+const (
+	OP_0         = 0x00 // 空のバイト列をpushする
+	OP_DATA_1    = 0x01 // 0x01..0x4bは続くnバイトをpushする
+	OP_DATA_75   = 0x4b
+	OP_PUSHDATA1 = 0x4c // 続く1バイトの長さのデータをpushする
+	OP_PUSHDATA2 = 0x4d // 続く2バイト（リトルエンディアン）の長さのデータをpushする
+	OP_1NEGATE   = 0x4f
+	OP_1         = 0x51 // OP_1..OP_16で1..16をpushする
+	OP_16        = 0x60
+
+	OP_NOP    = 0x61
+	OP_IF     = 0x63
+	OP_NOTIF  = 0x64
+	OP_ELSE   = 0x67
+	OP_ENDIF  = 0x68
+	OP_VERIFY = 0x69
+	OP_RETURN = 0x6a
+
+	OP_DROP = 0x75
+	OP_DUP  = 0x76
+	OP_SWAP = 0x7c
+	OP_SIZE = 0x82
+
+	OP_EQUAL       = 0x87
+	OP_EQUALVERIFY = 0x88
+
+	OP_SHA256              = 0xa8
+	OP_HASH160             = 0xa9
+	OP_CHECKSIG            = 0xac
+	OP_CHECKSIGVERIFY      = 0xad
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+	OP_CHECKSEQUENCEVERIFY = 0xb2
+)
+
+var opcodeNames = map[byte]string{
+	OP_0:                   "OP_0",
+	OP_PUSHDATA1:           "OP_PUSHDATA1",
+	OP_PUSHDATA2:           "OP_PUSHDATA2",
+	OP_1NEGATE:             "OP_1NEGATE",
+	OP_NOP:                 "OP_NOP",
+	OP_IF:                  "OP_IF",
+	OP_NOTIF:               "OP_NOTIF",
+	OP_ELSE:                "OP_ELSE",
+	OP_ENDIF:               "OP_ENDIF",
+	OP_VERIFY:              "OP_VERIFY",
+	OP_RETURN:              "OP_RETURN",
+	OP_DROP:                "OP_DROP",
+	OP_DUP:                 "OP_DUP",
+	OP_SWAP:                "OP_SWAP",
+	OP_SIZE:                "OP_SIZE",
+	OP_EQUAL:               "OP_EQUAL",
+	OP_EQUALVERIFY:         "OP_EQUALVERIFY",
+	OP_SHA256:              "OP_SHA256",
+	OP_HASH160:             "OP_HASH160",
+	OP_CHECKSIG:            "OP_CHECKSIG",
+	OP_CHECKSIGVERIFY:      "OP_CHECKSIGVERIFY",
+	OP_CHECKMULTISIG:       "OP_CHECKMULTISIG",
+	OP_CHECKMULTISIGVERIFY: "OP_CHECKMULTISIGVERIFY",
+	OP_CHECKLOCKTIMEVERIFY: "OP_CHECKLOCKTIMEVERIFY",
+	OP_CHECKSEQUENCEVERIFY: "OP_CHECKSEQUENCEVERIFY",
+}
+
+var opcodesByName = func() map[string]byte {
+	m := make(map[string]byte, len(opcodeNames)+16)
+	for op, name := range opcodeNames {
+		m[name] = op
+	}
+	for n := 1; n <= 16; n++ {
+		m[smallIntName(n)] = byte(OP_1 - 1 + n)
+	}
+	return m
+}()
+
+// opcodeの名前（OP_1..OP_16を含む）
+// 使えないopcodeの場合はfalseを返す
+func OpcodeName(op byte) (string, bool) {
+	if op >= OP_1 && op <= OP_16 {
+		return smallIntName(int(op-OP_1) + 1), true
+	}
+	name, ok := opcodeNames[op]
+	return name, ok
+}
+
+func smallIntName(n int) string {
+	return "OP_" + strconv.Itoa(n)
+}
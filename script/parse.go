@@ -0,0 +1,138 @@
+package script
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+)
+
+// scriptを分解した1つの命令
+type instruction struct {
+	op   byte
+	data []byte // pushするデータ（pushの命令の場合のみ）
+}
+
+// 使えるopcodeのうちOP_16以下はすべてpushの命令
+func (in *instruction) isPush() bool {
+	return in.op <= OP_16
+}
+
+// scriptを命令に分解する
+// 使えないopcode、途中で途切れたpush、最短でないpushはエラーにする
+func parse(script []byte) ([]instruction, error) {
+	if len(script) > MAX_SCRIPT_SIZE {
+		return nil, ErrScriptTooLarge
+	}
+	var instructions []instruction
+	for i := 0; i < len(script); {
+		op := script[i]
+		i++
+		var n int
+		switch {
+		case op >= OP_DATA_1 && op <= OP_DATA_75:
+			n = int(op)
+		case op == OP_PUSHDATA1:
+			if i+1 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			n = int(script[i])
+			i++
+		case op == OP_PUSHDATA2:
+			if i+2 > len(script) {
+				return nil, ErrMalformedPush
+			}
+			n = int(binary.LittleEndian.Uint16(script[i:]))
+			i += 2
+		default:
+			if _, ok := OpcodeName(op); !ok {
+				return nil, ErrUnknownOpcode
+			}
+			instructions = append(instructions, instruction{op: op})
+			continue
+		}
+		if i+n > len(script) {
+			return nil, ErrMalformedPush
+		}
+		data := script[i : i+n]
+		i += n
+		if n > MAX_ELEMENT_SIZE {
+			return nil, ErrElementTooLarge
+		}
+		if pushOpcode(data) != op {
+			return nil, ErrNonMinimalPush
+		}
+		instructions = append(instructions, instruction{op: op, data: data})
+	}
+	return instructions, nil
+}
+
+// データをpushする最短の命令
+func pushOpcode(data []byte) byte {
+	switch {
+	case len(data) == 0:
+		return OP_0
+	case len(data) == 1 && data[0] >= 1 && data[0] <= 16:
+		return OP_1 - 1 + data[0]
+	case len(data) == 1 && data[0] == 0x81:
+		return OP_1NEGATE
+	case len(data) <= OP_DATA_75:
+		return byte(len(data))
+	case len(data) <= 0xff:
+		return OP_PUSHDATA1
+	}
+	return OP_PUSHDATA2
+}
+
+// pushの命令だけからなるscriptか
+func IsPushOnly(script []byte) bool {
+	instructions, err := parse(script)
+	if err != nil {
+		return false
+	}
+	for _, in := range instructions {
+		if !in.isPush() {
+			return false
+		}
+	}
+	return true
+}
+
+// scriptを"OP_DUP OP_HASH160 <hex> ..."の形式にする
+func Disassemble(script []byte) (string, error) {
+	instructions, err := parse(script)
+	if err != nil {
+		return "", err
+	}
+	words := make([]string, 0, len(instructions))
+	for _, in := range instructions {
+		if in.data != nil {
+			words = append(words, hex.EncodeToString(in.data))
+			continue
+		}
+		name, _ := OpcodeName(in.op)
+		words = append(words, name)
+	}
+	return strings.Join(words, " "), nil
+}
+
+// "OP_DUP OP_HASH160 <hex> ..."の形式からscriptを作る
+// OP_から始まらない単語は16進数のデータとして最短の命令でpushする
+func Assemble(asm string) ([]byte, error) {
+	b := NewBuilder()
+	for _, word := range strings.Fields(asm) {
+		if strings.HasPrefix(word, "OP_") {
+			op, ok := opcodesByName[word]
+			if !ok {
+				return nil, ErrUnknownOpcode
+			}
+			b.AddOp(op)
+			continue
+		}
+		data, err := hex.DecodeString(word)
+		if err != nil {
+			return nil, ErrInvalidAssembly
+		}
+		b.AddData(data)
+	}
+	return b.Script()
+}
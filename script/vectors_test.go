@@ -0,0 +1,72 @@
+package script
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"go-blockchain/keys"
+	"os"
+	"testing"
+)
+
+// opcodeごとの動作を確認するテストベクター
+// scriptはAssembleの形式、解析できないscriptは16進数（*_raw）で書く
+type vector struct {
+	Name         string `json:"name"`
+	Unlocking    string `json:"unlocking,omitempty"`
+	Locking      string `json:"locking,omitempty"`
+	UnlockingRaw string `json:"unlocking_raw,omitempty"`
+	LockingRaw   string `json:"locking_raw,omitempty"`
+	Scheme       string `json:"scheme"`
+	Hash         string `json:"hash"`
+	LockTime     int64  `json:"lock_time"`
+	Age          int64  `json:"age"`
+	Error        string `json:"error,omitempty"` // 空なら成功する
+}
+
+func vectorScript(t *testing.T, asm string, raw string) []byte {
+	t.Helper()
+	var b []byte
+	var err error
+	if raw != "" {
+		b, err = hex.DecodeString(raw)
+	} else {
+		b, err = Assemble(asm)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestVectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/vectors.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vectors []*vector
+	if err := json.Unmarshal(data, &vectors); err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			unlocking := vectorScript(t, v.Unlocking, v.UnlockingRaw)
+			locking := vectorScript(t, v.Locking, v.LockingRaw)
+			scheme, err := keys.SchemeByID(keys.SchemeID(v.Scheme))
+			if err != nil {
+				t.Fatal(err)
+			}
+			hash, err := hex.DecodeString(v.Hash)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = Verify(unlocking, locking, &Context{Scheme: scheme, Hash: hash, LockTime: v.LockTime, Age: v.Age})
+			got := ""
+			if err != nil {
+				got = err.Error()
+			}
+			if got != v.Error {
+				t.Errorf("expected %q, got %q", v.Error, got)
+			}
+		})
+	}
+}
@@ -4,46 +4,80 @@ import (
 	"crypto/ecdsa"
 	"crypto/elliptic"
 	"encoding/hex"
-	"fmt"
+	"errors"
 	"math/big"
 )
 
-type Signature struct {
-	R *big.Int
-	S *big.Int
-}
-
-func (s *Signature) String() string {
-	return fmt.Sprintf("%064x%064x", s.R, s.S)
-}
-
-// 2つの座標（string）から通常のbig.Intに変換
-func String2BigIntTuple(s string) (big.Int, big.Int) {
-	bx, _ := hex.DecodeString(s[:64])
-	by, _ := hex.DecodeString(s[64:])
+// 以前のP-256の鍵で使っていた、座標X||Yを連結した16進数の文字列を扱うヘルパー
 
-	var bix big.Int
-	var biy big.Int
-
-	_ = bix.SetBytes(bx)
-	_ = biy.SetBytes(by)
+const (
+	COORDINATE_HEX_SIZE  = 64 // 32バイトの座標1つ分
+	PRIVATE_KEY_HEX_SIZE = 64
+)
 
-	return bix, biy
-}
+var (
+	ErrInvalidHex         = errors.New("invalid hex string")
+	ErrInvalidLength      = errors.New("invalid key length")
+	ErrPointNotOnCurve    = errors.New("public key is not on the curve")
+	ErrPrivateKeyRange    = errors.New("private key is out of range")
+	ErrKeyPairMismatch    = errors.New("private key does not match the public key")
+	ErrMissingPublicKey   = errors.New("public key is required")
+	ErrUnsupportedKeyType = errors.New("unsupported curve")
+)
 
-func SignatureFromString(s string) *Signature {
-	x, y := String2BigIntTuple(s)
-	return &Signature{&x, &y}
+// 2つの座標（string）から通常のbig.Intに変換
+// 128文字の16進数でなければエラーを返す
+func String2BigIntTuple(s string) (*big.Int, *big.Int, error) {
+	if len(s) != COORDINATE_HEX_SIZE*2 {
+		return nil, nil, ErrInvalidLength
+	}
+	bx, err := hex.DecodeString(s[:COORDINATE_HEX_SIZE])
+	if err != nil {
+		return nil, nil, ErrInvalidHex
+	}
+	by, err := hex.DecodeString(s[COORDINATE_HEX_SIZE:])
+	if err != nil {
+		return nil, nil, ErrInvalidHex
+	}
+	return new(big.Int).SetBytes(bx), new(big.Int).SetBytes(by), nil
 }
 
-func PublicKeyFromString(s string) *ecdsa.PublicKey {
-	x, y := String2BigIntTuple(s)
-	return &ecdsa.PublicKey{elliptic.P256(), &x, &y}
+// X||Y形式の公開鍵を読み込み、P-256の曲線上の点か確認する
+func PublicKeyFromString(s string) (*ecdsa.PublicKey, error) {
+	x, y, err := String2BigIntTuple(s)
+	if err != nil {
+		return nil, err
+	}
+	curve := elliptic.P256()
+	// IsOnCurveは座標が体の範囲外の場合もfalseを返す
+	if !curve.IsOnCurve(x, y) {
+		return nil, ErrPointNotOnCurve
+	}
+	return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
 }
 
-func PrivateKeyFromString(s string, publicKey *ecdsa.PublicKey) *ecdsa.PrivateKey {
-	b, _ := hex.DecodeString(s[:])
-	var bi big.Int
-	_ = bi.SetBytes(b)
-	return &ecdsa.PrivateKey{*publicKey, &bi}
+// 16進数の秘密鍵を読み込み、公開鍵と対応しているか確認する
+func PrivateKeyFromString(s string, publicKey *ecdsa.PublicKey) (*ecdsa.PrivateKey, error) {
+	if publicKey == nil {
+		return nil, ErrMissingPublicKey
+	}
+	if publicKey.Curve != elliptic.P256() {
+		return nil, ErrUnsupportedKeyType
+	}
+	if len(s) != PRIVATE_KEY_HEX_SIZE {
+		return nil, ErrInvalidLength
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidHex
+	}
+	d := new(big.Int).SetBytes(b)
+	if d.Sign() == 0 || d.Cmp(publicKey.Curve.Params().N) >= 0 {
+		return nil, ErrPrivateKeyRange
+	}
+	x, y := publicKey.Curve.ScalarBaseMult(b)
+	if x.Cmp(publicKey.X) != 0 || y.Cmp(publicKey.Y) != 0 {
+		return nil, ErrKeyPairMismatch
+	}
+	return &ecdsa.PrivateKey{PublicKey: *publicKey, D: d}, nil
 }
@@ -0,0 +1,73 @@
+package utils
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testKey(tb testing.TB) *ecdsa.PrivateKey {
+	tb.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return k
+}
+
+func publicKeyHex(pub *ecdsa.PublicKey) string {
+	return fmt.Sprintf("%064x%064x", pub.X, pub.Y)
+}
+
+func FuzzString2BigIntTuple(f *testing.F) {
+	f.Add(publicKeyHex(&testKey(f).PublicKey))
+	f.Add(strings.Repeat("0", 128))
+	f.Add(strings.Repeat("g", 128))
+	f.Add("")
+	f.Fuzz(func(t *testing.T, s string) {
+		x, y, err := String2BigIntTuple(s)
+		if err != nil {
+			return
+		}
+		// 読み込めた場合は同じ値の16進数に戻せる
+		if got := fmt.Sprintf("%064x%064x", x, y); !strings.EqualFold(got, s) {
+			t.Errorf("round trip: got %s, want %s", got, s)
+		}
+	})
+}
+
+func FuzzPublicKeyFromString(f *testing.F) {
+	f.Add(publicKeyHex(&testKey(f).PublicKey))
+	f.Add(strings.Repeat("f", 128))
+	f.Add(strings.Repeat("0", 128))
+	f.Fuzz(func(t *testing.T, s string) {
+		pub, err := PublicKeyFromString(s)
+		if err != nil {
+			return
+		}
+		if !pub.Curve.IsOnCurve(pub.X, pub.Y) {
+			t.Errorf("accepted a point that is not on the curve: %s", s)
+		}
+	})
+}
+
+func FuzzPrivateKeyFromString(f *testing.F) {
+	k := testKey(f)
+	f.Add(fmt.Sprintf("%064x", k.D))
+	f.Add(strings.Repeat("0", 64))
+	f.Add(strings.Repeat("f", 64))
+	f.Add(fmt.Sprintf("%064x", elliptic.P256().Params().N))
+	f.Fuzz(func(t *testing.T, s string) {
+		priv, err := PrivateKeyFromString(s, &k.PublicKey)
+		if err != nil {
+			return
+		}
+		// 公開鍵に対応する秘密鍵は1つだけ
+		if priv.D.Cmp(k.D) != 0 {
+			t.Errorf("accepted a private key that does not match the public key: %s", s)
+		}
+	})
+}
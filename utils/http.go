@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ハンドラが返したステータスコードを記録するResponseWriter
+// Server-Sent EventsとWebSocketのためにFlushとHijackは元のResponseWriterに渡す
+type StatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func NewStatusWriter(w http.ResponseWriter) *StatusWriter {
+	return &StatusWriter{ResponseWriter: w}
+}
+
+// 何も書き込まなかった場合は200
+func (sw *StatusWriter) Status() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+	return sw.status
+}
+
+func (sw *StatusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *StatusWriter) Write(b []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(b)
+}
+
+func (sw *StatusWriter) Flush() {
+	if f, ok := sw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (sw *StatusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := sw.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("hijacking is not supported")
+	}
+	if sw.status == 0 {
+		sw.status = http.StatusSwitchingProtocols
+	}
+	return h.Hijack()
+}
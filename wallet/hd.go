@@ -0,0 +1,297 @@
+package wallet
+
+import (
+	"crypto/hmac"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"go-blockchain/keys"
+
+	"github.com/tyler-smith/go-bip39"
+)
+
+// BIP-32の鍵導出の設定
+const (
+	HD_HARDENED_OFFSET = 0x80000000
+
+	// BIP-44のパス m/44'/HD_COIN_TYPE'/account'/change/index
+	HD_PURPOSE   = 44
+	HD_COIN_TYPE = 1
+	HD_EXTERNAL  = 0 // 受け取り用のアドレス
+	HD_INTERNAL  = 1 // お釣り用のアドレス
+
+	MNEMONIC_ENTROPY_BITS = 128 // 12単語
+)
+
+var (
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+	ErrInvalidHDPath   = errors.New("invalid derivation path")
+)
+
+// 署名方式ごとのマスター鍵の導出に使うキー
+// secp256k1はBIP-32、P-256はSLIP-10のもの
+var hdMasterKeySeeds = map[keys.SchemeID]string{
+	keys.SCHEME_SECP256K1: "Bitcoin seed",
+	keys.SCHEME_P256:      "Nist256p1 seed",
+}
+
+// 新しいBIP-39のニーモニックを作成する
+func NewMnemonic() (string, error) {
+	entropy, err := bip39.NewEntropy(MNEMONIC_ENTROPY_BITS)
+	if err != nil {
+		return "", err
+	}
+	return bip39.NewMnemonic(entropy)
+}
+
+// ニーモニックとパスワード（省略可）からBIP-39のシードを作成する
+func SeedFromMnemonic(mnemonic string, password string) ([]byte, error) {
+	mnemonic = strings.Join(strings.Fields(mnemonic), " ")
+	if !bip39.IsMnemonicValid(mnemonic) {
+		return nil, ErrInvalidMnemonic
+	}
+	return bip39.NewSeed(mnemonic, password), nil
+}
+
+// ------------------------------------------------------------------------------------------
+// BIP-32の拡張秘密鍵
+type ExtendedKey struct {
+	scheme    keys.Scheme
+	key       []byte // 32バイトの秘密鍵
+	chainCode []byte
+	depth     uint8
+	index     uint32
+}
+
+// シードからマスター鍵を作成する
+func NewMasterKey(scheme keys.Scheme, seed []byte) (*ExtendedKey, error) {
+	masterKeySeed, ok := hdMasterKeySeeds[scheme.ID()]
+	if !ok {
+		return nil, keys.ErrUnknownScheme
+	}
+	data := seed
+	for {
+		i := hmacSHA512([]byte(masterKeySeed), data)
+		if validKey(scheme, i[:32]) {
+			return &ExtendedKey{scheme: scheme, key: i[:32], chainCode: i[32:]}, nil
+		}
+		// 秘密鍵として使えない値の場合はSLIP-10に従ってやり直す
+		data = i
+	}
+}
+
+// index番目の子鍵を導出する（HD_HARDENED_OFFSET以上はhardened）
+func (k *ExtendedKey) Child(index uint32) (*ExtendedKey, error) {
+	if k.depth == 255 {
+		return nil, ErrInvalidHDPath
+	}
+	var data []byte
+	if index >= HD_HARDENED_OFFSET {
+		data = append([]byte{0x00}, k.key...)
+	} else {
+		privateKey, err := k.scheme.PrivateKeyFromBytes(k.key)
+		if err != nil {
+			return nil, err
+		}
+		data = privateKey.PublicKey().SerializeCompressed()
+	}
+	data = append(data, ser32(index)...)
+
+	n := k.scheme.Order()
+	for {
+		i := hmacSHA512(k.chainCode, data)
+		il := new(big.Int).SetBytes(i[:32])
+		if il.Cmp(n) < 0 {
+			child := il.Add(il, new(big.Int).SetBytes(k.key))
+			child.Mod(child, n)
+			if child.Sign() != 0 {
+				return &ExtendedKey{
+					scheme:    k.scheme,
+					key:       child.FillBytes(make([]byte, PRIVATE_KEY_SIZE)),
+					chainCode: i[32:],
+					depth:     k.depth + 1,
+					index:     index,
+				}, nil
+			}
+		}
+		// 秘密鍵として使えない値の場合はSLIP-10に従ってやり直す
+		data = append(append([]byte{0x01}, i[32:]...), ser32(index)...)
+	}
+}
+
+// "m/44'/1'/0'/0/0"のようなパスに従って子鍵を導出する
+func (k *ExtendedKey) Derive(path string) (*ExtendedKey, error) {
+	indexes, err := ParseHDPath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, i := range indexes {
+		if k, err = k.Child(i); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// 拡張秘密鍵からWalletを作成する（アドレスはNewWalletと同じ方法で作る）
+func (k *ExtendedKey) Wallet() (*Wallet, error) {
+	return FromPrivateKeyBytes(k.scheme, k.key)
+}
+
+func (k *ExtendedKey) Depth() uint8 {
+	return k.depth
+}
+
+func (k *ExtendedKey) Index() uint32 {
+	return k.index
+}
+
+// パスをインデックスの列に変換する
+func ParseHDPath(path string) ([]uint32, error) {
+	parts := strings.Split(path, "/")
+	if parts[0] != "m" {
+		return nil, ErrInvalidHDPath
+	}
+	indexes := make([]uint32, 0, len(parts)-1)
+	for _, p := range parts[1:] {
+		hardened := strings.HasSuffix(p, "'")
+		v, err := strconv.ParseUint(strings.TrimSuffix(p, "'"), 10, 32)
+		if err != nil || v >= HD_HARDENED_OFFSET {
+			return nil, ErrInvalidHDPath
+		}
+		i := uint32(v)
+		if hardened {
+			i += HD_HARDENED_OFFSET
+		}
+		indexes = append(indexes, i)
+	}
+	return indexes, nil
+}
+
+// BIP-44のパスを作成する
+func HDPath(account uint32, change uint32, index uint32) string {
+	return fmt.Sprintf("m/%d'/%d'/%d'/%d/%d", HD_PURPOSE, HD_COIN_TYPE, account, change, index)
+}
+
+// BIP-44のパスからアカウント、受け取り/お釣り、インデックスを取り出す
+func ParseHDPathIndexes(path string) (account uint32, change uint32, index uint32, err error) {
+	indexes, err := ParseHDPath(path)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(indexes) != 5 || indexes[0] != HD_PURPOSE+HD_HARDENED_OFFSET ||
+		indexes[1] != HD_COIN_TYPE+HD_HARDENED_OFFSET || indexes[2] < HD_HARDENED_OFFSET {
+		return 0, 0, 0, ErrInvalidHDPath
+	}
+	return indexes[2] - HD_HARDENED_OFFSET, indexes[3], indexes[4], nil
+}
+
+func ser32(i uint32) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+	return b
+}
+
+func hmacSHA512(key []byte, data []byte) []byte {
+	h := hmac.New(sha512.New, key)
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func validKey(scheme keys.Scheme, key []byte) bool {
+	k := new(big.Int).SetBytes(key)
+	return k.Sign() != 0 && k.Cmp(scheme.Order()) < 0
+}
+
+// ------------------------------------------------------------------------------------------
+// ニーモニックから作るHDウォレット
+// 1つのシードから複数のアカウントとアドレスを導出する
+type HDWallet struct {
+	master *ExtendedKey
+}
+
+func (hd *HDWallet) Scheme() keys.Scheme {
+	return hd.master.scheme
+}
+
+// HDウォレットで導出したアドレス
+type DerivedWallet struct {
+	*Wallet
+	Account uint32
+	Change  uint32
+	Index   uint32
+}
+
+func (dw *DerivedWallet) Path() string {
+	return HDPath(dw.Account, dw.Change, dw.Index)
+}
+
+// ニーモニックからデフォルトの署名方式のHDウォレットを作成する
+func NewHDWallet(mnemonic string, password string) (*HDWallet, error) {
+	seed, err := SeedFromMnemonic(mnemonic, password)
+	if err != nil {
+		return nil, err
+	}
+	return NewHDWalletFromSeed(keys.Default(), seed)
+}
+
+// シードからHDウォレットを作成する
+func NewHDWalletFromSeed(scheme keys.Scheme, seed []byte) (*HDWallet, error) {
+	master, err := NewMasterKey(scheme, seed)
+	if err != nil {
+		return nil, err
+	}
+	return &HDWallet{master: master}, nil
+}
+
+// アカウント、受け取り/お釣り、インデックスを指定してアドレスを導出する
+func (hd *HDWallet) Derive(account uint32, change uint32, index uint32) (*DerivedWallet, error) {
+	k, err := hd.master.Derive(HDPath(account, change, index))
+	if err != nil {
+		return nil, err
+	}
+	w, err := k.Wallet()
+	if err != nil {
+		return nil, err
+	}
+	return &DerivedWallet{Wallet: w, Account: account, Change: change, Index: index}, nil
+}
+
+// 使用済みのアドレスをgap limitまで探索する
+// 未使用のアドレスがgapLimit個連続したらそのチェーンの探索を終える
+// 使用済みのアドレスが1つもないアカウントが見つかるまで次のアカウントを探索する
+func (hd *HDWallet) Discover(gapLimit int, used func(address string) (bool, error)) ([]*DerivedWallet, error) {
+	var found []*DerivedWallet
+	for account := uint32(0); account < HD_HARDENED_OFFSET; account++ {
+		accountUsed := false
+		for _, change := range []uint32{HD_EXTERNAL, HD_INTERNAL} {
+			gap := 0
+			for index := uint32(0); gap < gapLimit && index < HD_HARDENED_OFFSET; index++ {
+				dw, err := hd.Derive(account, change, index)
+				if err != nil {
+					return nil, err
+				}
+				ok, err := used(dw.BlockchainAddress())
+				if err != nil {
+					return nil, err
+				}
+				if !ok {
+					gap++
+					continue
+				}
+				gap = 0
+				accountUsed = true
+				found = append(found, dw)
+			}
+		}
+		if !accountUsed {
+			break
+		}
+	}
+	return found, nil
+}
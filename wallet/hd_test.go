@@ -0,0 +1,110 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"go-blockchain/keys"
+	"testing"
+)
+
+// 導出した鍵の秘密鍵とchain code
+type hdVector struct {
+	path      string
+	chainCode string
+	key       string
+}
+
+func testHDVectors(t *testing.T, scheme keys.Scheme, seedHex string, vectors []hdVector) {
+	t.Helper()
+	seed, err := hex.DecodeString(seedHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := NewMasterKey(scheme, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vectors {
+		k, err := master.Derive(v.path)
+		if err != nil {
+			t.Fatalf("%s: %v", v.path, err)
+		}
+		if got := hex.EncodeToString(k.chainCode); got != v.chainCode {
+			t.Errorf("%s: chain code = %s, want %s", v.path, got, v.chainCode)
+		}
+		if got := hex.EncodeToString(k.key); got != v.key {
+			t.Errorf("%s: private key = %s, want %s", v.path, got, v.key)
+		}
+	}
+}
+
+// BIP-32のTest vector 1
+func TestBIP32Vector1(t *testing.T) {
+	testHDVectors(t, keys.Secp256k1, "000102030405060708090a0b0c0d0e0f", []hdVector{
+		{"m", "873dff81c02f525623fd1fe5167eac3a55a049de3d314bb42ee227ffed37d508",
+			"e8f32e723decf4051aefac8e2c93c9c5b214313817cdb01a1494b917c8436b35"},
+		{"m/0'", "47fdacbd0f1097043b78c63c20c34ef4ed9a111d980047ad16282c7ae6236141",
+			"edb2e14f9ee77d26dd93b4ecede8d16ed408ce149b6cd80b0715a2d911a0afea"},
+		{"m/0'/1", "2a7857631386ba23dacac34180dd1983734e444fdbf774041578e9b6adb37c19",
+			"3c6cb8d0f6a264c91ea8b5030fadaa8e538b020f0a387421a12de9319dc93368"},
+		{"m/0'/1/2'", "04466b9cc8e161e966409ca52986c584f07e9dc81f735db683c3ff6ec7b1503f",
+			"cbce0d719ecf7431d88e6a89fa1483e02e35092af60c042b1df2ff59fa424dca"},
+		{"m/0'/1/2'/2", "cfb71883f01676f587d023cc53a35bc7f88f724b1f8c2892ac1275ac822a3edd",
+			"0f479245fb19a38a1954c5c7c0ebab2f9bdfd96a17563ef28a6a4b1a2a764ef4"},
+		{"m/0'/1/2'/2/1000000000", "c783e67b921d2beb8f6b389cc646d7263b4145701dadd2161548a8b078e65e9e",
+			"471b76e389e528d6de6d816857e012c5455051cad6660850e58372a6c3e6e7c8"},
+	})
+}
+
+// SLIP-10のnist256p1のTest vector 1
+func TestSLIP10P256Vector1(t *testing.T) {
+	testHDVectors(t, keys.P256, "000102030405060708090a0b0c0d0e0f", []hdVector{
+		{"m", "beeb672fe4621673f722f38529c07392fecaa61015c80c34f29ce8b41b3cb6ea",
+			"612091aaa12e22dd2abef664f8a01a82cae99ad7441b7ef8110424915c268bc2"},
+		{"m/0'", "3460cea53e6a6bb5fb391eeef3237ffd8724bf0a40e94943c98b83825342ee11",
+			"6939694369114c67917a182c59ddb8cafc3004e63ca5d3b84403ba8613debc0c"},
+		{"m/0'/1", "4187afff1aafa8445010097fb99d23aee9f599450c7bd140b6826ac22ba21d0c",
+			"284e9d38d07d21e4e281b645089a94f4cf5a5a81369acf151a1c3a57f18b2129"},
+		{"m/0'/1/2'", "98c7514f562e64e74170cc3cf304ee1ce54d6b6da4f880f313e8204c2a185318",
+			"694596e8a54f252c960eb771a3c41e7e32496d03b954aeb90f61635b8e092aa7"},
+		{"m/0'/1/2'/2", "ba96f776a5c3907d7fd48bde5620ee374d4acfd540378476019eab70790c63a0",
+			"5996c37fd3dd2679039b23ed6f70b506c6b56b3cb5e424681fb0fa64caf82aaa"},
+		{"m/0'/1/2'/2/1000000000", "b9b7b82d326bb9cb5b5b121066feea4eb93d5241103c9e7a18aad40f1dde8059",
+			"21c4f269ef0a5fd1badf47eeacebeeaa3de22eb8e5b0adcd0f27dd99d34d0119"},
+	})
+}
+
+// SLIP-10のnist256p1で秘密鍵として使えない値が出てやり直す場合
+func TestSLIP10P256Retry(t *testing.T) {
+	// 子鍵の導出
+	testHDVectors(t, keys.P256, "000102030405060708090a0b0c0d0e0f", []hdVector{
+		{"m/28578'", "e94c8ebe30c2250a14713212f6449b20f3329105ea15b652ca5bdfc68f6c65c2",
+			"06f0db126f023755d0b8d86d4591718a5210dd8d024e3e14b6159d63f53aa669"},
+		{"m/28578'/33941", "9e87fe95031f14736774cd82f25fd885065cb7c358c1edf813c72af535e83071",
+			"092154eed4af83e078ff9b84322015aefe5769e31270f62c3f66c33888335f3a"},
+	})
+	// マスター鍵の作成
+	testHDVectors(t, keys.P256, "a7305bc8df8d0951f0cb224c0e95d7707cbdf2c6ce7e8d481fec69c7ff5e9446", []hdVector{
+		{"m", "7762f9729fed06121fd13f326884c82f59aa95c57ac492ce8c9654e60efd130c",
+			"3b8c18469a4634517d6d0b65448f8e6c62091b45540a1743c5846be55d47d88f"},
+	})
+}
+
+// BIP-39のニーモニックとパスワードからシードを作る（TrezorのTest vector）
+func TestSeedFromMnemonic(t *testing.T) {
+	mnemonic := "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+	seed, err := SeedFromMnemonic(mnemonic, "TREZOR")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "c55257c360c07c72029aebc1b53c05ed0362ada38ead3e3e9efa3708e53495531f09a6987599d18264c1e1c92f2cf141630c7a3c4ab7c81b2f001698e7463b04"
+	if got := hex.EncodeToString(seed); got != want {
+		t.Errorf("seed = %s, want %s", got, want)
+	}
+	// 単語の間の空白の違いは無視し、チェックサムの合わないニーモニックは受け付けない
+	if _, err := SeedFromMnemonic("  "+mnemonic+"\n", "TREZOR"); err != nil {
+		t.Errorf("extra whitespace: %v", err)
+	}
+	if _, err := SeedFromMnemonic(mnemonic[:len(mnemonic)-len("about")]+"abandon", ""); err != ErrInvalidMnemonic {
+		t.Errorf("got %v, want ErrInvalidMnemonic", err)
+	}
+}
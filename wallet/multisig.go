@@ -0,0 +1,127 @@
+package wallet
+
+import (
+	"errors"
+	"go-blockchain/keys"
+	"go-blockchain/multisig"
+)
+
+var (
+	ErrNotCosigner           = errors.New("wallet is not a cosigner of the multisig address")
+	ErrInvalidPartialTx      = errors.New("invalid partially signed transaction")
+	ErrInvalidCosignature    = errors.New("partially signed transaction has an invalid signature")
+	ErrIncompleteTransaction = errors.New("not enough signatures")
+)
+
+// 署名者の間で受け渡すマルチシグの署名途中のTransaction
+// signaturesはredeem scriptの公開鍵と同じ順番で、未署名の公開鍵はnullにする
+type PartiallySignedTransaction struct {
+	Scheme       string `json:"scheme"`
+	RedeemScript string `json:"redeem_script"`
+	TransactionData
+	Signatures []*string `json:"signatures"`
+}
+
+// マルチシグのアドレスから送金する未署名のTransactionを作成する
+func NewPartiallySignedTransaction(script *multisig.Script,
+	outputs []*Output, memo string, fee float32, lockTime int64) *PartiallySignedTransaction {
+	return &PartiallySignedTransaction{
+		Scheme:          string(script.Scheme().ID()),
+		RedeemScript:    script.String(),
+		TransactionData: NewTransactionData(script.Address(), outputs, memo, fee, lockTime),
+		Signatures:      make([]*string, len(script.PublicKeys())),
+	}
+}
+
+// redeem scriptを読み込み、送信者のアドレスと署名の数が合っているか確認する
+func (pt *PartiallySignedTransaction) Script() (*multisig.Script, error) {
+	scheme, err := keys.SchemeByID(keys.SchemeID(pt.Scheme))
+	if err != nil {
+		return nil, err
+	}
+	script, err := multisig.ParseString(scheme, pt.RedeemScript)
+	if err != nil {
+		return nil, err
+	}
+	if script.Address() != pt.Sender || len(pt.Signatures) != len(script.PublicKeys()) || !pt.valid() {
+		return nil, ErrInvalidPartialTx
+	}
+	return script, nil
+}
+
+// 署名済みの署名を検証して、公開鍵の順番に並べて返す（未署名はnil）
+func (pt *PartiallySignedTransaction) verifiedSignatures(script *multisig.Script) ([]*keys.Signature, error) {
+	h := pt.Digest()
+	signatures := make([]*keys.Signature, len(pt.Signatures))
+	for i, str := range pt.Signatures {
+		if str == nil {
+			continue
+		}
+		s, err := keys.ParseSignatureString(script.Scheme(), *str)
+		if err != nil {
+			return nil, err
+		}
+		if !script.PublicKeys()[i].Verify(h, s) {
+			return nil, ErrInvalidCosignature
+		}
+		signatures[i] = s
+	}
+	return signatures, nil
+}
+
+// walletの鍵で署名を追加する
+// 既存の署名が内容と合わない場合（改ざんされた場合）は署名しない
+func (pt *PartiallySignedTransaction) Sign(w *Wallet) error {
+	script, err := pt.Script()
+	if err != nil {
+		return err
+	}
+	i := script.IndexOf(w.PublicKey())
+	if i < 0 || w.Scheme().ID() != script.Scheme().ID() {
+		return ErrNotCosigner
+	}
+	if _, err := pt.verifiedSignatures(script); err != nil {
+		return err
+	}
+	s, err := pt.transaction(w.PrivateKey()).GenerateSignature()
+	if err != nil {
+		return err
+	}
+	str := s.String()
+	pt.Signatures[i] = &str
+	return nil
+}
+
+// 署名済みの数
+func (pt *PartiallySignedTransaction) SignatureCount() int {
+	n := 0
+	for _, s := range pt.Signatures {
+		if s != nil {
+			n++
+		}
+	}
+	return n
+}
+
+// nodeに送る署名（公開鍵の順番で閾値の数だけ）
+// 署名が足りない場合はErrIncompleteTransactionを返す
+func (pt *PartiallySignedTransaction) FinalSignatures() (*multisig.Script, []*keys.Signature, error) {
+	script, err := pt.Script()
+	if err != nil {
+		return nil, nil, err
+	}
+	signatures, err := pt.verifiedSignatures(script)
+	if err != nil {
+		return nil, nil, err
+	}
+	final := make([]*keys.Signature, 0, script.Threshold())
+	for _, s := range signatures {
+		if s != nil && len(final) < script.Threshold() {
+			final = append(final, s)
+		}
+	}
+	if len(final) < script.Threshold() {
+		return nil, nil, ErrIncompleteTransaction
+	}
+	return script, final, nil
+}
@@ -0,0 +1,164 @@
+package wallet
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidValue   = errors.New("invalid value")
+	ErrInvalidOutputs = errors.New("specify either recipient_blockchain_address and value, outputs, or csv")
+	ErrInvalidCSV     = errors.New("invalid csv")
+	ErrInvalidFee     = errors.New("invalid fee")
+)
+
+// CSVの1行目として読み飛ばす見出し（大文字と小文字は区別しない）
+var csvHeaders = map[string]bool{
+	"address,amount":                     true,
+	"address,value":                      true,
+	"recipient,amount":                   true,
+	"recipient,value":                    true,
+	"recipient_blockchain_address,value": true,
+}
+
+// Transactionの出力（受取人と金額）
+type Output struct {
+	RecipientBlockchainAddress string  `json:"recipient_blockchain_address"`
+	Value                      float32 `json:"value"`
+}
+
+func NewOutput(recipient string, value float32) *Output {
+	return &Output{RecipientBlockchainAddress: recipient, Value: value}
+}
+
+// フロントから送られる出力の1つ
+type OutputRequest struct {
+	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
+	Value                      *string `json:"value"`
+}
+
+// フロントから送られる送金先の指定
+// 受取人が1人の場合はrecipient_blockchain_addressとvalue、複数の場合はoutputsか、
+// 1行に「アドレス,金額」を書いたcsv（1行目は見出しでもよい）のいずれか1つを指定する
+// memo（請求書番号など）とfee（省略時はメモの大きさに応じた最低限の手数料）は任意
+type PaymentRequest struct {
+	RecipientBlockchainAddress *string          `json:"recipient_blockchain_address,omitempty"`
+	Value                      *string          `json:"value,omitempty"`
+	Outputs                    []*OutputRequest `json:"outputs,omitempty"`
+	CSV                        *string          `json:"csv,omitempty"`
+	Memo                       *string          `json:"memo,omitempty"`
+	Fee                        *string          `json:"fee,omitempty"`
+}
+
+// いずれか1つの形式で指定されているか
+func (pr *PaymentRequest) Validate() bool {
+	n := 0
+	if pr.RecipientBlockchainAddress != nil || pr.Value != nil {
+		if pr.RecipientBlockchainAddress == nil || pr.Value == nil {
+			return false
+		}
+		n++
+	}
+	if pr.Outputs != nil {
+		n++
+	}
+	if pr.CSV != nil {
+		n++
+	}
+	return n == 1
+}
+
+// 金額を読み込んで出力の一覧にする
+func (pr *PaymentRequest) TransactionOutputs() ([]*Output, error) {
+	switch {
+	case pr.CSV != nil:
+		return ParseOutputsCSV(strings.NewReader(*pr.CSV))
+	case pr.Outputs != nil:
+		if len(pr.Outputs) == 0 {
+			return nil, ErrInvalidOutputs
+		}
+		outputs := make([]*Output, 0, len(pr.Outputs))
+		for _, o := range pr.Outputs {
+			if o == nil || o.RecipientBlockchainAddress == nil || o.Value == nil {
+				return nil, ErrInvalidOutputs
+			}
+			output, err := parseOutput(*o.RecipientBlockchainAddress, *o.Value)
+			if err != nil {
+				return nil, err
+			}
+			outputs = append(outputs, output)
+		}
+		return outputs, nil
+	case pr.RecipientBlockchainAddress != nil && pr.Value != nil:
+		output, err := parseOutput(*pr.RecipientBlockchainAddress, *pr.Value)
+		if err != nil {
+			return nil, err
+		}
+		return []*Output{output}, nil
+	}
+	return nil, ErrInvalidOutputs
+}
+
+// 「アドレス,金額」の行からなるCSVを読み込む
+// 1行目はcsvHeadersの見出しと一致する場合だけ読み飛ばす（金額を書き間違えた1行目を黙って捨てない）
+func ParseOutputsCSV(r io.Reader) ([]*Output, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = 2
+	reader.TrimLeadingSpace = true
+	reader.Comment = '#'
+	outputs := make([]*Output, 0)
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidCSV, err)
+		}
+		recipient, value := strings.TrimSpace(record[0]), strings.TrimSpace(record[1])
+		if line == 1 && csvHeaders[strings.ToLower(recipient+","+value)] {
+			continue
+		}
+		output, err := parseOutput(recipient, value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidCSV, line, err)
+		}
+		outputs = append(outputs, output)
+	}
+	if len(outputs) == 0 {
+		return nil, fmt.Errorf("%w: no outputs", ErrInvalidCSV)
+	}
+	return outputs, nil
+}
+
+// メモと手数料を読み込む
+// 手数料が指定されていなければminimumFeeでメモから計算する
+func (pr *PaymentRequest) MemoAndFee(minimumFee func(memo string) float32) (string, float32, error) {
+	memo := ""
+	if pr.Memo != nil {
+		memo = *pr.Memo
+	}
+	if pr.Fee == nil {
+		return memo, minimumFee(memo), nil
+	}
+	fee, err := strconv.ParseFloat(*pr.Fee, 32)
+	if err != nil || fee < 0 {
+		return "", 0, fmt.Errorf("%w %q", ErrInvalidFee, *pr.Fee)
+	}
+	return memo, float32(fee), nil
+}
+
+func parseOutput(recipient string, valueStr string) (*Output, error) {
+	if recipient == "" {
+		return nil, ErrInvalidOutputs
+	}
+	value, err := strconv.ParseFloat(valueStr, 32)
+	if err != nil || value <= 0 {
+		return nil, fmt.Errorf("%w %q", ErrInvalidValue, valueStr)
+	}
+	return NewOutput(recipient, float32(value)), nil
+}
@@ -0,0 +1,51 @@
+package wallet
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseOutputsCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		csv  string
+		want []Output
+	}{
+		{"no header", "A,1\nB,2.5\n", []Output{{"A", 1}, {"B", 2.5}}},
+		{"header", "address,amount\nA,1\n", []Output{{"A", 1}}},
+		{"header with spaces", "Address, Amount\nA,1\n", []Output{{"A", 1}}},
+		{"comment", "# payroll\nA,1\n", []Output{{"A", 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputs, err := ParseOutputsCSV(strings.NewReader(tt.csv))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(outputs) != len(tt.want) {
+				t.Fatalf("got %d outputs, want %d", len(outputs), len(tt.want))
+			}
+			for i, o := range outputs {
+				if *o != tt.want[i] {
+					t.Errorf("output %d = %+v, want %+v", i, *o, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// 見出しと一致しない1行目は読み飛ばさずにエラーにする
+func TestParseOutputsCSVInvalid(t *testing.T) {
+	for _, csv := range []string{
+		"A,1O\nB,2\n",        // 1行目の金額の書き間違い
+		"name,amount\nA,1\n", // 知らない見出し
+		"A,1\naddress,amount\n",
+		"address,amount\n",
+		"A,-1\n",
+	} {
+		if _, err := ParseOutputsCSV(strings.NewReader(csv)); !errors.Is(err, ErrInvalidCSV) {
+			t.Errorf("%q: got %v, want ErrInvalidCSV", csv, err)
+		}
+	}
+}
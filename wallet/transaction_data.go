@@ -0,0 +1,144 @@
+package wallet
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"go-blockchain/keys"
+)
+
+var (
+	ErrInvalidTransaction = errors.New("invalid transaction")
+	ErrDigestMismatch     = errors.New("digest does not match the transaction")
+	ErrSenderMismatch     = errors.New("wallet address does not match the sender")
+	ErrSignatureMismatch  = errors.New("signature does not match the transaction")
+)
+
+// 署名の対象になるTransactionの内容（block.TransactionのJSONと同じ形式）
+// 受取人が1人の場合はrecipient_blockchain_addressとvalue、複数の場合はoutputsになる
+type TransactionData struct {
+	Sender    string    `json:"sender_blockchain_address"`
+	Recipient string    `json:"recipient_blockchain_address,omitempty"`
+	Value     float32   `json:"value,omitempty"`
+	Outputs   []*Output `json:"outputs,omitempty"`
+	Fee       float32   `json:"fee,omitempty"`
+	Memo      string    `json:"memo,omitempty"`
+	LockTime  int64     `json:"lock_time,omitempty"`
+}
+
+func NewTransactionData(sender string, outputs []*Output, memo string, fee float32, lockTime int64) TransactionData {
+	td := TransactionData{Sender: sender, Fee: fee, Memo: memo, LockTime: lockTime}
+	if len(outputs) == 1 {
+		td.Recipient, td.Value = outputs[0].RecipientBlockchainAddress, outputs[0].Value
+	} else {
+		td.Outputs = outputs
+	}
+	return td
+}
+
+// Transactionの出力
+func (td *TransactionData) TransactionOutputs() []*Output {
+	if td.Outputs != nil {
+		return td.Outputs
+	}
+	return []*Output{NewOutput(td.Recipient, td.Value)}
+}
+
+// 出力がどちらか一方の形式で指定され、金額、手数料、lock_timeが正しいか
+func (td *TransactionData) valid() bool {
+	if td.Sender == "" || td.Fee < 0 || td.LockTime < 0 {
+		return false
+	}
+	if td.Outputs != nil && (td.Recipient != "" || td.Value != 0) {
+		return false
+	}
+	for _, o := range td.TransactionOutputs() {
+		if o == nil || o.RecipientBlockchainAddress == "" || o.Value <= 0 {
+			return false
+		}
+	}
+	return len(td.TransactionOutputs()) > 0
+}
+
+func (td *TransactionData) transaction(privateKey keys.PrivateKey) *Transaction {
+	return NewBatchTransaction(privateKey, td.Sender, td.TransactionOutputs(), td.LockTime).WithMemo(td.Memo, td.Fee)
+}
+
+// 署名するhash（Transactionの正規化したJSONのsha256）
+func (td *TransactionData) Digest() []byte {
+	m, _ := td.transaction(nil).MarshalJSON()
+	h := sha256.Sum256(m)
+	return h[:]
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// オフラインで署名するための未署名のTransaction
+// digestは署名するhashで、署名する側で内容から計算し直して一致するか確認する
+type UnsignedTransaction struct {
+	TransactionData
+	Digest string `json:"digest"`
+}
+
+func NewUnsignedTransaction(td TransactionData) *UnsignedTransaction {
+	return &UnsignedTransaction{TransactionData: td, Digest: hex.EncodeToString(td.Digest())}
+}
+
+// walletの鍵で署名する
+// 内容とdigestが一致しない場合や、送信者がwalletのアドレスでない場合は署名しない
+func (ut *UnsignedTransaction) Sign(w *Wallet) (*SignedTransaction, error) {
+	if !ut.valid() {
+		return nil, ErrInvalidTransaction
+	}
+	if ut.Digest != hex.EncodeToString(ut.TransactionData.Digest()) {
+		return nil, ErrDigestMismatch
+	}
+	if ut.Sender != w.BlockchainAddress() {
+		return nil, ErrSenderMismatch
+	}
+	s, err := ut.transaction(w.PrivateKey()).GenerateSignature()
+	if err != nil {
+		return nil, err
+	}
+	return &SignedTransaction{
+		TransactionData: ut.TransactionData,
+		Scheme:          string(w.Scheme().ID()),
+		PublicKey:       w.PublicKeyStr(),
+		Signature:       s.String(),
+	}, nil
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// オフラインで署名したTransaction
+type SignedTransaction struct {
+	TransactionData
+	Scheme    string `json:"scheme"`
+	PublicKey string `json:"public_key"`
+	Signature string `json:"signature"`
+}
+
+// 署名方式、公開鍵、署名を読み込み、内容に対する署名か検証する
+func (st *SignedTransaction) Verify() (keys.PublicKey, *keys.Signature, error) {
+	if !st.valid() {
+		return nil, nil, ErrInvalidTransaction
+	}
+	scheme, err := keys.SchemeByID(keys.SchemeID(st.Scheme))
+	if err != nil {
+		return nil, nil, err
+	}
+	publicKey, err := keys.ParsePublicKeyString(scheme, st.PublicKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := keys.ParseSignatureString(scheme, st.Signature)
+	if err != nil {
+		return nil, nil, err
+	}
+	if AddressFromPublicKey(publicKey) != st.Sender {
+		return nil, nil, ErrSenderMismatch
+	}
+	if !publicKey.Verify(st.TransactionData.Digest(), s) {
+		return nil, nil, ErrSignatureMismatch
+	}
+	return publicKey, s, nil
+}
@@ -0,0 +1,69 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"testing"
+)
+
+// オンラインの端末で作った未署名のTransactionをJSONで受け渡して署名し、署名を検証する
+func TestSignUnsignedTransaction(t *testing.T) {
+	w := NewWallet()
+	td := NewTransactionData(w.BlockchainAddress(), []*Output{NewOutput("B", 1.5), NewOutput("C", 2)}, "INV-1", 0.01, 100)
+	m, err := json.Marshal(NewUnsignedTransaction(td))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ut UnsignedTransaction
+	if err := json.Unmarshal(m, &ut); err != nil {
+		t.Fatal(err)
+	}
+	if ut.Digest != hex.EncodeToString(td.Digest()) {
+		t.Fatalf("digest changed in JSON: %s", ut.Digest)
+	}
+
+	st, err := ut.Sign(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = json.Marshal(st)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed SignedTransaction
+	if err := json.Unmarshal(m, &signed); err != nil {
+		t.Fatal(err)
+	}
+	publicKey, s, err := signed.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !publicKey.Verify(td.Digest(), s) {
+		t.Errorf("signature does not match the digest")
+	}
+}
+
+func TestSignUnsignedTransactionMismatch(t *testing.T) {
+	w := NewWallet()
+	td := NewTransactionData(w.BlockchainAddress(), []*Output{NewOutput("B", 1)}, "", 0, 0)
+
+	// digestを作った後に送金先を書き換えたもの
+	tampered := NewUnsignedTransaction(td)
+	tampered.Recipient = "attacker"
+	if _, err := tampered.Sign(w); err != ErrDigestMismatch {
+		t.Errorf("tampered: got %v, want ErrDigestMismatch", err)
+	}
+	// 送信者でない鍵
+	if _, err := NewUnsignedTransaction(td).Sign(NewWallet()); err != ErrSenderMismatch {
+		t.Errorf("other wallet: got %v, want ErrSenderMismatch", err)
+	}
+	// 署名した後に金額を書き換えたもの
+	st, err := NewUnsignedTransaction(td).Sign(w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.Value = 100
+	if _, _, err := st.Verify(); err != ErrSignatureMismatch {
+		t.Errorf("modified after signing: got %v, want ErrSignatureMismatch", err)
+	}
+}
@@ -1,38 +1,64 @@
 package wallet
 
 import (
-	"crypto/ecdsa"
-	"crypto/elliptic"
-	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
-	"fmt"
 
-	"go-blockchain/utils"
+	"go-blockchain/keys"
 
 	"github.com/btcsuite/btcutil/base58"
 	"golang.org/x/crypto/ripemd160"
 )
 
+const PRIVATE_KEY_SIZE = keys.PRIVATE_KEY_SIZE
+
+var ErrInvalidPrivateKey = keys.ErrInvalidPrivateKey
+
 type Wallet struct {
-	privateKey        *ecdsa.PrivateKey
-	publicKey         *ecdsa.PublicKey
+	privateKey        keys.PrivateKey
+	publicKey         keys.PublicKey
 	blockchainAddress string
 }
 
-// Walletの新規作成
+// Walletの新規作成（デフォルトの署名方式を使う）
 func NewWallet() *Wallet {
-	// 1. Createing ECDSA privateKey & publicKey
-	w := new(Wallet)
+	return NewWalletWithScheme(keys.Default())
+}
+
+// 署名方式を指定してWalletを新規作成する
+func NewWalletWithScheme(scheme keys.Scheme) *Wallet {
+	// 1. Createing privateKey & publicKey
 	// pricvateKeyの作成
-	privateKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	privateKey, _ := scheme.GenerateKey()
+	return FromPrivateKey(privateKey)
+}
+
+// 既存のprivateKeyからWalletを作成する（publicKeyとアドレスはprivateKeyから計算する）
+func FromPrivateKey(privateKey keys.PrivateKey) *Wallet {
+	w := new(Wallet)
 	w.privateKey = privateKey
-	w.publicKey = &w.privateKey.PublicKey
+	w.publicKey = privateKey.PublicKey()
+	w.blockchainAddress = AddressFromPublicKey(w.publicKey)
+	return w
+}
 
+// privateKeyのバイト列からWalletを作成する
+func FromPrivateKeyBytes(scheme keys.Scheme, d []byte) (*Wallet, error) {
+	privateKey, err := scheme.PrivateKeyFromBytes(d)
+	if err != nil {
+		return nil, err
+	}
+	return FromPrivateKey(privateKey), nil
+}
+
+// publicKeyからブロックチェーンのアドレスを作成する
+// P-256の鍵は以前のアドレスと変わらないように座標をそのまま連結したものから作る
+func AddressFromPublicKey(publicKey keys.PublicKey) string {
+	data := keys.AddressBytes(publicKey)
 	// 2. Perform SHA-256 hashing on the publicKey
 	h2 := sha256.New()
-	h2.Write(w.publicKey.X.Bytes())
-	h2.Write(w.publicKey.Y.Bytes())
+	h2.Write(data)
 	digest2 := h2.Sum(nil)
 	// 3. Perform RIPEMD-160 hashing on the result of SHA-256
 	h3 := ripemd160.New()
@@ -57,30 +83,37 @@ func NewWallet() *Wallet {
 	copy(dc8[:21], vd4[:])
 	copy(dc8[21:], chsum[:])
 	// 9. Convert the result from a byte string into base58
-	address := base58.Encode(dc8)
-	w.blockchainAddress = address
-
-	return w
+	return base58.Encode(dc8)
 }
 
 // privateKeyの取得
-func (w *Wallet) PrivateKey() *ecdsa.PrivateKey {
+func (w *Wallet) PrivateKey() keys.PrivateKey {
 	return w.privateKey
 }
 
 // PrivateKeyの中身を出力
 func (w *Wallet) PrivateKeyStr() string {
-	return fmt.Sprintf("%x", w.privateKey.D.Bytes())
+	return hex.EncodeToString(w.PrivateKeyBytes())
+}
+
+// PrivateKeyを32バイトの固定長で取得
+func (w *Wallet) PrivateKeyBytes() []byte {
+	return w.privateKey.Bytes()
 }
 
 // publicKeyの取得
-func (w *Wallet) PublicKey() *ecdsa.PublicKey {
+func (w *Wallet) PublicKey() keys.PublicKey {
 	return w.publicKey
 }
 
-// PublicKeyの中身を出力
+// PublicKeyの中身を圧縮形式で出力
 func (w *Wallet) PublicKeyStr() string {
-	return fmt.Sprintf("%064x%064x", w.publicKey.X.Bytes(), w.publicKey.Y.Bytes())
+	return keys.PublicKeyString(w.publicKey)
+}
+
+// 署名方式の取得
+func (w *Wallet) Scheme() keys.Scheme {
+	return w.privateKey.Scheme()
 }
 
 func (w *Wallet) BlockchainAddress() string {
@@ -89,10 +122,12 @@ func (w *Wallet) BlockchainAddress() string {
 
 func (w *Wallet) MarshalJSON() ([]byte, error) {
 	return json.Marshal(struct {
-		PrivateKey        string `json:"private_key"`
-		PublicKey         string `json:"public_key"`
-		BlockchainAddress string `json:"blockchain_address"`
+		Scheme            keys.SchemeID `json:"scheme"`
+		PrivateKey        string        `json:"private_key"`
+		PublicKey         string        `json:"public_key"`
+		BlockchainAddress string        `json:"blockchain_address"`
 	}{
+		Scheme:            w.Scheme().ID(),
 		PrivateKey:        w.PrivateKeyStr(),
 		PublicKey:         w.PublicKeyStr(),
 		BlockchainAddress: w.BlockchainAddress(),
@@ -101,60 +136,284 @@ func (w *Wallet) MarshalJSON() ([]byte, error) {
 
 // ----------------------------------------------------------------
 type Transaction struct {
-	senderPrivateKey           *ecdsa.PrivateKey
-	senderPublicKey            *ecdsa.PublicKey
-	senderBlockchainAddress    string
-	recipientBlockchainAddress string
-	value                      float32
+	senderPrivateKey        keys.PrivateKey
+	senderBlockchainAddress string
+	outputs                 []*Output
+	fee                     float32
+	memo                    string
+	lockTime                int64
 }
 
 // Transactionの新規作成
-func NewTransaction(privateKey *ecdsa.PrivateKey, publicKey *ecdsa.PublicKey,
+func NewTransaction(privateKey keys.PrivateKey,
 	sender string, recipient string, value float32) *Transaction {
+	return NewTransactionWithLockTime(privateKey, sender, recipient, value, 0)
+}
+
+// lock_time（ブロックの高さまたはUNIX時間の秒）を指定してTransactionを作成する
+func NewTransactionWithLockTime(privateKey keys.PrivateKey,
+	sender string, recipient string, value float32, lockTime int64) *Transaction {
+	return NewBatchTransaction(privateKey, sender, []*Output{NewOutput(recipient, value)}, lockTime)
+}
+
+// 複数の受取人に送るTransactionを作成する
+func NewBatchTransaction(privateKey keys.PrivateKey,
+	sender string, outputs []*Output, lockTime int64) *Transaction {
 	return &Transaction{
-		privateKey, publicKey, sender, recipient, value,
+		senderPrivateKey:        privateKey,
+		senderBlockchainAddress: sender,
+		outputs:                 outputs,
+		lockTime:                lockTime,
 	}
 }
 
+// メモと手数料を設定する
+func (t *Transaction) WithMemo(memo string, fee float32) *Transaction {
+	t.memo = memo
+	t.fee = fee
+	return t
+}
+
 // Signatureの生成をPrivateKeyとTransationのhashを用いて生成
-func (t *Transaction) GenerateSignature() *utils.Signature {
+func (t *Transaction) GenerateSignature() (*keys.Signature, error) {
 	m, _ := json.Marshal(t)
 	h := sha256.Sum256([]byte(m))
-	r, s, _ := ecdsa.Sign(rand.Reader, t.senderPrivateKey, h[:])
-	return &utils.Signature{r, s}
+	return t.senderPrivateKey.Sign(h[:])
 }
 
+// block.TransactionのJSONと同じ形式（出力が1つの場合はrecipient_blockchain_addressとvalue、複数の場合はoutputs、
+// fee、memo、lock_timeは0（空）なら省略）
 func (t *Transaction) MarshalJSON() ([]byte, error) {
+	if len(t.outputs) == 1 {
+		return json.Marshal(struct {
+			Sender    string  `json:"sender_blockchain_address"`
+			Recipient string  `json:"recipient_blockchain_address"`
+			Value     float32 `json:"value"`
+			Fee       float32 `json:"fee,omitempty"`
+			Memo      string  `json:"memo,omitempty"`
+			LockTime  int64   `json:"lock_time,omitempty"`
+		}{
+			Sender:    t.senderBlockchainAddress,
+			Recipient: t.outputs[0].RecipientBlockchainAddress,
+			Value:     t.outputs[0].Value,
+			Fee:       t.fee,
+			Memo:      t.memo,
+			LockTime:  t.lockTime,
+		})
+	}
 	return json.Marshal(struct {
-		Sender    string  `json:"sender_blockchain_address"`
-		Recipient string  `json:"recipient_blockchain_address"`
-		Value     float32 `json:"value"`
+		Sender   string    `json:"sender_blockchain_address"`
+		Outputs  []*Output `json:"outputs"`
+		Fee      float32   `json:"fee,omitempty"`
+		Memo     string    `json:"memo,omitempty"`
+		LockTime int64     `json:"lock_time,omitempty"`
 	}{
-		Sender:    t.senderBlockchainAddress,
-		Recipient: t.recipientBlockchainAddress,
-		Value:     t.value,
+		Sender:   t.senderBlockchainAddress,
+		Outputs:  t.outputs,
+		Fee:      t.fee,
+		Memo:     t.memo,
+		LockTime: t.lockTime,
 	})
 }
 
 // ----------------------------------------------------------------------------
 // フロントから送られるTransactionのリクエスト
+// 秘密鍵は送らず、キーストアに保存されたウォレットをIDとパスフレーズで指定する
 type TransactionRequest struct {
-	SenderPrivateKey           *string `json:"sender_private_key"`
-	SenderBlockchainAddress    *string `json:"sender_blockchain_address"`
-	RecipientBlockchainAddress *string `json:"recipient_blockchain_address"`
-	SenderPublicKey            *string `json:"sender_public_key"`
-	Value                      *string `json:"value"`
+	User       *string `json:"user"`
+	WalletID   *string `json:"wallet_id"`
+	Passphrase *string `json:"passphrase"`
+	PaymentRequest
+	LockTime *int64 `json:"lock_time,omitempty"` // 指定したブロックの高さまたはUNIX時間（秒）まで送金を予約する
 }
 
 // 送信されたJsonのバリデーション
 func (tr *TransactionRequest) Validate() bool {
-	if tr.SenderPrivateKey == nil ||
-		tr.SenderBlockchainAddress == nil ||
-		tr.RecipientBlockchainAddress == nil ||
-		tr.SenderPublicKey == nil ||
-		tr.Value == nil {
+	if tr.User == nil ||
+		tr.WalletID == nil ||
+		tr.Passphrase == nil ||
+		!tr.PaymentRequest.Validate() ||
+		!validLockTime(tr.LockTime) {
 
 		return false
 	}
 	return true
 }
+
+// フロントから送られるウォレット作成のリクエスト
+type WalletRequest struct {
+	User       *string `json:"user"`
+	Passphrase *string `json:"passphrase"`
+}
+
+func (wr *WalletRequest) Validate() bool {
+	return wr.User != nil && wr.Passphrase != nil
+}
+
+// フロントから送られるHDウォレットの作成・復元のリクエスト
+// mnemonicを指定しない場合は新しいニーモニックを作成する
+type HDWalletRequest struct {
+	User             *string `json:"user"`
+	Passphrase       *string `json:"passphrase"`
+	Mnemonic         *string `json:"mnemonic,omitempty"`
+	MnemonicPassword *string `json:"mnemonic_password,omitempty"`
+	GapLimit         *int    `json:"gap_limit,omitempty"`
+}
+
+func (hr *HDWalletRequest) Validate() bool {
+	if hr.User == nil || hr.Passphrase == nil {
+		return false
+	}
+	return hr.GapLimit == nil || *hr.GapLimit > 0
+}
+
+// フロントから送られるHDウォレットの新しいアドレスの導出のリクエスト
+type HDAddressRequest struct {
+	User       *string `json:"user"`
+	SeedID     *string `json:"hd_seed_id"`
+	Passphrase *string `json:"passphrase"`
+	Account    *uint32 `json:"account,omitempty"`
+	Change     *uint32 `json:"change,omitempty"`
+}
+
+func (ar *HDAddressRequest) Validate() bool {
+	if ar.User == nil || ar.SeedID == nil || ar.Passphrase == nil {
+		return false
+	}
+	if ar.Account != nil && *ar.Account >= HD_HARDENED_OFFSET {
+		return false
+	}
+	return ar.Change == nil || *ar.Change == HD_EXTERNAL || *ar.Change == HD_INTERNAL
+}
+
+// フロントから送られるウォレットのインポートのリクエスト
+// WIF、パスワードで暗号化したバックアップ、以前のP-256の秘密鍵と公開鍵のいずれかを指定する
+type ImportRequest struct {
+	User           *string          `json:"user"`
+	Passphrase     *string          `json:"passphrase"`
+	WIF            *string          `json:"wif,omitempty"`
+	Backup         *json.RawMessage `json:"backup,omitempty"`
+	BackupPassword *string          `json:"backup_password,omitempty"`
+	PrivateKey     *string          `json:"private_key,omitempty"`
+	PublicKey      *string          `json:"public_key,omitempty"`
+}
+
+func (ir *ImportRequest) Validate() bool {
+	if ir.User == nil || ir.Passphrase == nil {
+		return false
+	}
+	switch {
+	case ir.WIF != nil:
+		return ir.Backup == nil && ir.PrivateKey == nil
+	case ir.Backup != nil:
+		return ir.BackupPassword != nil && ir.PrivateKey == nil
+	}
+	return ir.PrivateKey != nil && ir.PublicKey != nil
+}
+
+// エクスポートの形式
+const (
+	EXPORT_FORMAT_WIF    = "wif"
+	EXPORT_FORMAT_BACKUP = "backup"
+)
+
+// フロントから送られるウォレットのエクスポートのリクエスト
+type ExportRequest struct {
+	User           *string `json:"user"`
+	WalletID       *string `json:"wallet_id"`
+	Passphrase     *string `json:"passphrase"`
+	Format         *string `json:"format"`
+	BackupPassword *string `json:"backup_password,omitempty"`
+}
+
+func (er *ExportRequest) Validate() bool {
+	if er.User == nil || er.WalletID == nil || er.Passphrase == nil || er.Format == nil {
+		return false
+	}
+	switch *er.Format {
+	case EXPORT_FORMAT_WIF:
+		return true
+	case EXPORT_FORMAT_BACKUP:
+		return er.BackupPassword != nil
+	}
+	return false
+}
+
+// フロントから送られるマルチシグのアドレス作成のリクエスト
+// schemeを指定しない場合はデフォルトの署名方式を使う
+type MultisigRequest struct {
+	Threshold  *int     `json:"threshold"`
+	PublicKeys []string `json:"public_keys"`
+	Scheme     *string  `json:"scheme,omitempty"`
+}
+
+func (mr *MultisigRequest) Validate() bool {
+	return mr.Threshold != nil && len(mr.PublicKeys) > 0
+}
+
+// フロントから送られるマルチシグのアドレスから送金する未署名のTransactionの作成のリクエスト
+type MultisigTransactionRequest struct {
+	RedeemScript *string `json:"redeem_script"`
+	Scheme       *string `json:"scheme,omitempty"`
+	PaymentRequest
+	LockTime *int64 `json:"lock_time,omitempty"`
+}
+
+func (mr *MultisigTransactionRequest) Validate() bool {
+	return mr.RedeemScript != nil && mr.PaymentRequest.Validate() && validLockTime(mr.LockTime)
+}
+
+// フロントから送られる署名途中のTransactionへの署名のリクエスト
+type MultisigSignRequest struct {
+	User        *string                     `json:"user"`
+	WalletID    *string                     `json:"wallet_id"`
+	Passphrase  *string                     `json:"passphrase"`
+	Transaction *PartiallySignedTransaction `json:"transaction"`
+}
+
+func (mr *MultisigSignRequest) Validate() bool {
+	return mr.User != nil && mr.WalletID != nil && mr.Passphrase != nil && mr.Transaction != nil
+}
+
+// フロントから送られる署名が揃ったTransactionの送信のリクエスト
+type MultisigBroadcastRequest struct {
+	Transaction *PartiallySignedTransaction `json:"transaction"`
+}
+
+func (mr *MultisigBroadcastRequest) Validate() bool {
+	return mr.Transaction != nil
+}
+
+// フロントから送られるオフラインで署名する未署名のTransactionの作成のリクエスト
+// 秘密鍵やキーストアのウォレットは使わず、送信者のアドレスだけを指定する
+type BuildTransactionRequest struct {
+	SenderBlockchainAddress *string `json:"sender_blockchain_address"`
+	PaymentRequest
+	LockTime *int64 `json:"lock_time,omitempty"`
+}
+
+func (br *BuildTransactionRequest) Validate() bool {
+	return br.SenderBlockchainAddress != nil && br.PaymentRequest.Validate() && validLockTime(br.LockTime)
+}
+
+// オフラインで署名したTransactionのnodeへの送信のリクエスト
+type BroadcastTransactionRequest struct {
+	Transaction *SignedTransaction `json:"transaction"`
+}
+
+func (br *BroadcastTransactionRequest) Validate() bool {
+	return br.Transaction != nil
+}
+
+// lock_timeは省略するか0以上
+func validLockTime(lockTime *int64) bool {
+	return lockTime == nil || *lockTime >= 0
+}
+
+// 省略された場合は0（すぐに取り込める）
+func LockTimeValue(lockTime *int64) int64 {
+	if lockTime == nil {
+		return 0
+	}
+	return *lockTime
+}
@@ -0,0 +1,61 @@
+package wallet
+
+import (
+	"errors"
+
+	"go-blockchain/keys"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// WIFのネットワークバージョンバイト
+const (
+	WIF_VERSION_MAIN    = 0x80
+	WIF_VERSION_REGTEST = 0xef
+
+	// 圧縮形式の公開鍵を使うsecp256k1の鍵はBitcoinと同じく末尾に付ける
+	WIF_COMPRESSED_SUFFIX = 0x01
+)
+
+var (
+	ErrInvalidWIF         = errors.New("invalid WIF")
+	ErrWIFNetworkMismatch = errors.New("WIF is for a different network")
+)
+
+// ネットワークに対応するWIFのバージョンバイト
+func WIFVersion(regtest bool) byte {
+	if regtest {
+		return WIF_VERSION_REGTEST
+	}
+	return WIF_VERSION_MAIN
+}
+
+// privateKeyをWIF（Wallet Import Format）にエンコードする
+// version || privateKey(32byte) || [0x01] || checksum(4byte)をbase58にしたもの
+// secp256k1の鍵は0x01を付け、P-256の鍵は付けないことで署名方式を区別する
+func (w *Wallet) WIF(version byte) string {
+	payload := w.PrivateKeyBytes()
+	if w.Scheme().ID() == keys.SCHEME_SECP256K1 {
+		payload = append(payload, WIF_COMPRESSED_SUFFIX)
+	}
+	return base58.CheckEncode(payload, version)
+}
+
+// WIFをデコードしてWalletを作成する
+// versionが指定したネットワークのものでなければエラーを返す
+func FromWIF(wif string, version byte) (*Wallet, error) {
+	payload, v, err := base58.CheckDecode(wif)
+	if err != nil {
+		return nil, ErrInvalidWIF
+	}
+	if v != version {
+		return nil, ErrWIFNetworkMismatch
+	}
+	switch {
+	case len(payload) == PRIVATE_KEY_SIZE+1 && payload[PRIVATE_KEY_SIZE] == WIF_COMPRESSED_SUFFIX:
+		return FromPrivateKeyBytes(keys.Secp256k1, payload[:PRIVATE_KEY_SIZE])
+	case len(payload) == PRIVATE_KEY_SIZE:
+		return FromPrivateKeyBytes(keys.P256, payload)
+	}
+	return nil, ErrInvalidWIF
+}
@@ -0,0 +1,86 @@
+package wallet
+
+import (
+	"bytes"
+	"encoding/hex"
+	"go-blockchain/keys"
+	"testing"
+
+	"github.com/btcsuite/btcutil/base58"
+)
+
+// エンコードしてデコードすると同じ鍵と署名方式に戻る
+func TestWIFRoundTrip(t *testing.T) {
+	for _, scheme := range []keys.Scheme{keys.Secp256k1, keys.P256} {
+		for _, version := range []byte{WIF_VERSION_MAIN, WIF_VERSION_REGTEST} {
+			w := NewWalletWithScheme(scheme)
+			got, err := FromWIF(w.WIF(version), version)
+			if err != nil {
+				t.Fatalf("%s %#x: %v", scheme.ID(), version, err)
+			}
+			if !bytes.Equal(got.PrivateKeyBytes(), w.PrivateKeyBytes()) || got.Scheme().ID() != scheme.ID() ||
+				got.BlockchainAddress() != w.BlockchainAddress() {
+				t.Errorf("%s %#x: decoded a different wallet", scheme.ID(), version)
+			}
+		}
+	}
+}
+
+// secp256k1の鍵は圧縮形式の印を付け、印のない鍵はP-256として読み込む
+func TestWIFCompressed(t *testing.T) {
+	// Bitcoinの例と同じ秘密鍵とWIF
+	key, _ := hex.DecodeString("0c28fca386c7a227600b2fe50b7cae11ec86d3bf1fbe471be89827e19d72aa1d")
+	compressed := "KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617"
+	uncompressed := base58.CheckEncode(key, WIF_VERSION_MAIN)
+
+	w, err := FromPrivateKeyBytes(keys.Secp256k1, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := w.WIF(WIF_VERSION_MAIN); got != compressed {
+		t.Errorf("WIF = %s, want %s", got, compressed)
+	}
+	for _, tt := range []struct {
+		wif    string
+		scheme keys.SchemeID
+	}{
+		{compressed, keys.SCHEME_SECP256K1},
+		{uncompressed, keys.SCHEME_P256},
+	} {
+		w, err := FromWIF(tt.wif, WIF_VERSION_MAIN)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.wif, err)
+		}
+		if !bytes.Equal(w.PrivateKeyBytes(), key) || w.Scheme().ID() != tt.scheme {
+			t.Errorf("%s: got %s key %x", tt.wif, w.Scheme().ID(), w.PrivateKeyBytes())
+		}
+	}
+}
+
+func TestWIFInvalid(t *testing.T) {
+	wif := NewWallet().WIF(WIF_VERSION_MAIN)
+	// 最後の文字を変えるとチェックサムが合わない
+	last := byte('2')
+	if wif[len(wif)-1] == last {
+		last = '3'
+	}
+	badChecksum := wif[:len(wif)-1] + string(last)
+	key := NewWallet().PrivateKeyBytes()
+
+	tests := []struct {
+		name string
+		wif  string
+		want error
+	}{
+		{"bad checksum", badChecksum, ErrInvalidWIF},
+		{"not base58", "0OIl", ErrInvalidWIF},
+		{"wrong network", NewWallet().WIF(WIF_VERSION_REGTEST), ErrWIFNetworkMismatch},
+		{"unknown suffix", base58.CheckEncode(append(key, 0x02), WIF_VERSION_MAIN), ErrInvalidWIF},
+		{"short key", base58.CheckEncode(key[:31], WIF_VERSION_MAIN), ErrInvalidWIF},
+	}
+	for _, tt := range tests {
+		if _, err := FromWIF(tt.wif, WIF_VERSION_MAIN); err != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"go-blockchain/api"
+	"net/http"
+	"net/url"
+)
+
+// walletの画面で残高を更新するきっかけになるイベント
+const WALLET_EVENTS = "block_connected,block_disconnected,balance_changed"
+
+// アドレスの残高の変化などのイベントをBlockchainServerから中継するAPI（Server-Sent Events）
+func (ws *WalletServer) WalletEvents(w http.ResponseWriter, req *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		api.WriteError(w, http.StatusInternalServerError, api.CodeInternal, "streaming is not supported")
+		return
+	}
+	blockchainAddress := req.URL.Query().Get("blockchain_address")
+	if blockchainAddress == "" {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "blockchain_address is required")
+		return
+	}
+	q := url.Values{}
+	q.Set("events", WALLET_EVENTS)
+	q.Set("addresses", blockchainAddress)
+
+	// クライアントが切断したらBlockchainServerへの接続も閉じる
+	bcsReq, err := ws.gatewayRequest(req.Context(), http.MethodGet, "/v1/events?"+q.Encode(), nil)
+	if err != nil {
+		writeGatewayUnavailable(w, req, err)
+		return
+	}
+	bcsReq.Header.Set("Accept", "text/event-stream")
+	bcsResp, err := http.DefaultClient.Do(bcsReq)
+	if err != nil {
+		writeGatewayUnavailable(w, req, err)
+		return
+	}
+	defer bcsResp.Body.Close()
+	if bcsResp.StatusCode != http.StatusOK {
+		writeGatewayError(w, req, bcsResp)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	buf := make([]byte, 4096)
+	for {
+		n, err := bcsResp.Body.Read(buf)
+		if n > 0 {
+			if _, err := w.Write(buf[:n]); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
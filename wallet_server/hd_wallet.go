@@ -0,0 +1,197 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-blockchain/api"
+	"go-blockchain/keys"
+	"go-blockchain/wallet"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DEFAULT_GAP_LIMIT = 20
+	MAX_GAP_LIMIT     = 100
+
+	GATEWAY_REQUEST_TIMEOUT_SEC = 10
+)
+
+// POST /v1/hdwalletのレスポンス
+// ニーモニックは新しく作成した場合のみ返す
+type HDWalletResponse struct {
+	SeedID   string            `json:"hd_seed_id"`
+	Mnemonic string            `json:"mnemonic,omitempty"`
+	Wallets  []*WalletResponse `json:"wallets"`
+}
+
+// ニーモニックからHDウォレットを作成または復元してキーストアに保存するAPIハンドル
+// 復元の場合はnodeのアドレスインデックスに問い合わせて使用済みのアドレスを探す
+func (ws *WalletServer) HDWallet(w http.ResponseWriter, req *http.Request) {
+	var hr wallet.HDWalletRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &hr) {
+		return
+	}
+	if !hr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "user and passphrase are required")
+		return
+	}
+	gapLimit := DEFAULT_GAP_LIMIT
+	if hr.GapLimit != nil {
+		if *hr.GapLimit > MAX_GAP_LIMIT {
+			api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+				fmt.Sprintf("gap_limit must be between 1 and %d", MAX_GAP_LIMIT))
+			return
+		}
+		gapLimit = *hr.GapLimit
+	}
+
+	restore := hr.Mnemonic != nil
+	var mnemonic, password string
+	if restore {
+		mnemonic = *hr.Mnemonic
+	} else {
+		var err error
+		if mnemonic, err = wallet.NewMnemonic(); err != nil {
+			writeKeystoreError(w, req, err)
+			return
+		}
+	}
+	if hr.MnemonicPassword != nil {
+		password = *hr.MnemonicPassword
+	}
+	seed, err := wallet.SeedFromMnemonic(mnemonic, password)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	hd, err := wallet.NewHDWalletFromSeed(keys.Default(), seed)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+
+	var derived []*wallet.DerivedWallet
+	if restore {
+		derived, err = hd.Discover(gapLimit, func(blockchainAddress string) (bool, error) {
+			return ws.addressUsed(req.Context(), blockchainAddress)
+		})
+		if err != nil {
+			writeGatewayUnavailable(w, req, err)
+			return
+		}
+	}
+	// 使用済みのアドレスがなければ最初の受け取り用アドレスを作る
+	if len(derived) == 0 {
+		dw, err := hd.Derive(0, wallet.HD_EXTERNAL, 0)
+		if err != nil {
+			writeKeystoreError(w, req, err)
+			return
+		}
+		derived = append(derived, dw)
+	}
+
+	sf, err := ws.keystore.StoreSeed(*hr.User, hd.Scheme(), seed, *hr.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	resp := &HDWalletResponse{SeedID: sf.ID, Wallets: make([]*WalletResponse, 0, len(derived))}
+	if !restore {
+		resp.Mnemonic = mnemonic
+	}
+	for _, dw := range derived {
+		kf, err := ws.keystore.StoreDerived(*hr.User, dw, sf.ID, *hr.Passphrase)
+		if err != nil {
+			writeKeystoreError(w, req, err)
+			return
+		}
+		resp.Wallets = append(resp.Wallets, NewWalletResponse(kf))
+	}
+	api.WriteJSON(w, http.StatusCreated, resp)
+}
+
+// HDウォレットの次のアドレスを導出してキーストアに保存するAPIハンドル
+func (ws *WalletServer) HDAddress(w http.ResponseWriter, req *http.Request) {
+	var ar wallet.HDAddressRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &ar) {
+		return
+	}
+	if !ar.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+			"user, hd_seed_id and passphrase are required and change must be 0 or 1")
+		return
+	}
+	var account, change uint32
+	if ar.Account != nil {
+		account = *ar.Account
+	}
+	if ar.Change != nil {
+		change = *ar.Change
+	}
+
+	seed, scheme, err := ws.keystore.UnlockSeed(*ar.User, *ar.SeedID, *ar.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	keyFiles, err := ws.keystore.List(*ar.User)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	// 保存済みのアドレスの次のインデックスを使う
+	var next uint32
+	for _, kf := range keyFiles {
+		if kf.HDSeedID != *ar.SeedID {
+			continue
+		}
+		a, c, i, err := wallet.ParseHDPathIndexes(kf.HDPath)
+		if err == nil && a == account && c == change && i >= next {
+			next = i + 1
+		}
+	}
+
+	hd, err := wallet.NewHDWalletFromSeed(scheme, seed)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	dw, err := hd.Derive(account, change, next)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	kf, err := ws.keystore.StoreDerived(*ar.User, dw, *ar.SeedID, *ar.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, NewWalletResponse(kf))
+}
+
+// nodeのアドレスインデックスでアドレスが使用済みか確認する
+func (ws *WalletServer) addressUsed(ctx context.Context, blockchainAddress string) (bool, error) {
+	r, err := ws.gatewayRequest(ctx, http.MethodGet, "/v1/addresses/"+url.PathEscape(blockchainAddress), nil)
+	if err != nil {
+		return false, err
+	}
+	client := &http.Client{Timeout: time.Second * GATEWAY_REQUEST_TIMEOUT_SEC}
+	resp, err := client.Do(r)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("unexpected gateway response %d", resp.StatusCode)
+	}
+	var ar struct {
+		Used bool `json:"used"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return false, err
+	}
+	return ar.Used, nil
+}
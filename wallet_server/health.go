@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"go-blockchain/api"
+	"net/http"
+	"time"
+)
+
+// BlockchainServerの/healthzを待つ時間
+const GATEWAY_HEALTH_TIMEOUT_SEC = 3
+
+// GET /healthzのレスポンス
+// プロセスが応答していればstatusはokで、BlockchainServerに接続できるかをgatewayで返す
+type HealthResponse struct {
+	Status  string     `json:"status"`
+	Gateway *api.Check `json:"gateway"`
+}
+
+// BlockchainServerの/healthzに接続できるか確認する
+func (ws *WalletServer) gatewayCheck(ctx context.Context) *api.Check {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*GATEWAY_HEALTH_TIMEOUT_SEC)
+	defer cancel()
+	c := &api.Check{Name: "gateway"}
+	resp, err := ws.gatewayDo(ctx, http.MethodGet, "/healthz", nil)
+	if err != nil {
+		c.Message = err.Error()
+		return c
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		c.Message = fmt.Sprintf("%s responded %d", ws.Gateway(), resp.StatusCode)
+		return c
+	}
+	c.OK, c.Message = true, fmt.Sprintf("%s is reachable", ws.Gateway())
+	return c
+}
+
+// プロセスが応答しているかとBlockchainServerに接続できるかを返すAPI（liveness）
+// BlockchainServerに接続できなくても再起動では直らないので200を返す
+func (ws *WalletServer) Healthz(w http.ResponseWriter, req *http.Request) {
+	api.WriteJSON(w, http.StatusOK, &HealthResponse{Status: api.HealthOK.Status, Gateway: ws.gatewayCheck(req.Context())})
+}
+
+// BlockchainServerに接続できる場合のみ200を返すAPI（readiness）
+func (ws *WalletServer) Readyz(w http.ResponseWriter, req *http.Request) {
+	api.WriteReady(w, []*api.Check{ws.gatewayCheck(req.Context())})
+}
@@ -2,18 +2,27 @@ package main
 
 import (
 	"flag"
-	"log"
+	"fmt"
+	"go-blockchain/keystore"
+	"go-blockchain/logging"
+	"go-blockchain/wallet"
+	"os"
 )
 
-func init() {
-	log.SetPrefix("Wallet Server: ")
-}
-
 func main() {
 	port := flag.Uint("port", 8080, "TCP Port Number for Wallet Server")
 	gateway := flag.String("gateway", "http://127.0.0.1:5001", "Blockchain Gateway")
+	keystoreDir := flag.String("keystore", "keystore", "Directory to store encrypted wallets")
+	regtest := flag.Bool("regtest", false, "Use the regtest network version byte for WIF import/export")
+	logLevel := flag.String("log-level", "info", "Minimum log level: debug, info, warn or error")
+	logFormat := flag.String("log-format", logging.FORMAT_LOGFMT, "Log format: logfmt or json")
 	flag.Parse()
+	if err := logging.Configure(*logLevel, *logFormat); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
 
-	app := NewWalletServer(uint16(*port), *gateway)
+	app := NewWalletServer(uint16(*port), *gateway, keystore.NewKeystore(*keystoreDir),
+		wallet.WIFVersion(*regtest))
 	app.Run()
 }
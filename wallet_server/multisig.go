@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/keys"
+	"go-blockchain/multisig"
+	"go-blockchain/wallet"
+	"net/http"
+)
+
+// POST /v1/multisigのレスポンス
+// public_keysはredeem scriptと同じ辞書順に並べたもの
+type MultisigResponse struct {
+	BlockchainAddress string   `json:"blockchain_address"`
+	RedeemScript      string   `json:"redeem_script"`
+	Scheme            string   `json:"scheme"`
+	Threshold         int      `json:"threshold"`
+	PublicKeys        []string `json:"public_keys"`
+}
+
+func NewMultisigResponse(script *multisig.Script) *MultisigResponse {
+	publicKeys := make([]string, 0, len(script.PublicKeys()))
+	for _, pub := range script.PublicKeys() {
+		publicKeys = append(publicKeys, keys.PublicKeyString(pub))
+	}
+	return &MultisigResponse{
+		BlockchainAddress: script.Address(),
+		RedeemScript:      script.String(),
+		Scheme:            string(script.Scheme().ID()),
+		Threshold:         script.Threshold(),
+		PublicKeys:        publicKeys,
+	}
+}
+
+// POST /v1/multisig/signのレスポンス
+type MultisigSignResponse struct {
+	Transaction *wallet.PartiallySignedTransaction `json:"transaction"`
+	Signed      int                                `json:"signed"`
+	Threshold   int                                `json:"threshold"`
+	Complete    bool                               `json:"complete"`
+}
+
+// 署名方式の指定がなければデフォルトの署名方式を使う
+func schemeOrDefault(id *string) (keys.Scheme, error) {
+	if id == nil {
+		return keys.Default(), nil
+	}
+	return keys.SchemeByID(keys.SchemeID(*id))
+}
+
+// 公開鍵と閾値からマルチシグのアドレスを作成するAPIハンドル
+// 鍵は保存しないので、同じ公開鍵と閾値を指定すれば誰でも同じアドレスを作れる
+func (ws *WalletServer) MultisigAddress(w http.ResponseWriter, req *http.Request) {
+	var mr wallet.MultisigRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &mr) {
+		return
+	}
+	if !mr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "threshold and public_keys are required")
+		return
+	}
+	scheme, err := schemeOrDefault(mr.Scheme)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	publicKeys := make([]keys.PublicKey, 0, len(mr.PublicKeys))
+	for _, s := range mr.PublicKeys {
+		pub, err := keys.ParsePublicKeyString(scheme, s)
+		if err != nil {
+			writeKeystoreError(w, req, err)
+			return
+		}
+		publicKeys = append(publicKeys, pub)
+	}
+	script, err := multisig.New(*mr.Threshold, publicKeys)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, NewMultisigResponse(script))
+}
+
+// マルチシグのアドレスから送金する未署名のTransactionを作成するAPIハンドル
+// 返したTransactionを署名者の間で受け渡して/v1/multisig/signで署名を集める
+func (ws *WalletServer) MultisigTransaction(w http.ResponseWriter, req *http.Request) {
+	var mr wallet.MultisigTransactionRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &mr) {
+		return
+	}
+	if !mr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "missing field(s)")
+		return
+	}
+	scheme, err := schemeOrDefault(mr.Scheme)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	script, err := multisig.ParseString(scheme, *mr.RedeemScript)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	outputs, memo, fee, err := readPayment(&mr.PaymentRequest)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	pt := wallet.NewPartiallySignedTransaction(script, outputs, memo, fee, wallet.LockTimeValue(mr.LockTime))
+	api.WriteJSON(w, http.StatusCreated, pt)
+}
+
+// キーストアのウォレットで署名途中のTransactionに署名を追加するAPIハンドル
+func (ws *WalletServer) MultisigSign(w http.ResponseWriter, req *http.Request) {
+	var sr wallet.MultisigSignRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &sr) {
+		return
+	}
+	if !sr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "missing field(s)")
+		return
+	}
+	signer, _, err := ws.keystore.Unlock(*sr.User, *sr.WalletID, *sr.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	pt := sr.Transaction
+	if err := pt.Sign(signer); err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	script, _ := pt.Script()
+	api.WriteJSON(w, http.StatusOK, &MultisigSignResponse{
+		Transaction: pt,
+		Signed:      pt.SignatureCount(),
+		Threshold:   script.Threshold(),
+		Complete:    pt.SignatureCount() >= script.Threshold(),
+	})
+}
+
+// 署名が揃ったTransactionをnodeに送信するAPIハンドル
+func (ws *WalletServer) MultisigBroadcast(w http.ResponseWriter, req *http.Request) {
+	var br wallet.MultisigBroadcastRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &br) {
+		return
+	}
+	if !br.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "transaction is required")
+		return
+	}
+	pt := br.Transaction
+	script, signatures, err := pt.FinalSignatures()
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	bt := block.NewTransactionRequest(
+		blockTransaction(pt.Sender, pt.TransactionOutputs(), pt.Memo, pt.Fee, pt.LockTime),
+		block.NewMultisigAuthorization(script, signatures))
+	m, _ := json.Marshal(bt)
+
+	resp, err := ws.gatewayDo(req.Context(), http.MethodPost, "/v1/transactions", bytes.NewBuffer(m))
+	if err != nil {
+		writeGatewayUnavailable(w, req, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		writeGatewayError(w, req, resp)
+		return
+	}
+	api.WriteSuccess(w, http.StatusCreated)
+}
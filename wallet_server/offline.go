@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/wallet"
+	"net/http"
+)
+
+// オフラインで署名するための未署名のTransactionと、署名するhashを返すAPIハンドル
+// 秘密鍵は使わないので、署名はネットワークにつながっていない端末で行える
+func (ws *WalletServer) BuildTransaction(w http.ResponseWriter, req *http.Request) {
+	var br wallet.BuildTransactionRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &br) {
+		return
+	}
+	if !br.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "missing field(s)")
+		return
+	}
+	outputs, memo, fee, err := readPayment(&br.PaymentRequest)
+	if err != nil {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	td := wallet.NewTransactionData(*br.SenderBlockchainAddress, outputs, memo, fee, wallet.LockTimeValue(br.LockTime))
+	api.WriteJSON(w, http.StatusOK, wallet.NewUnsignedTransaction(td))
+}
+
+// オフラインで署名したTransactionを検証してnodeに送信するAPIハンドル
+func (ws *WalletServer) BroadcastTransaction(w http.ResponseWriter, req *http.Request) {
+	var br wallet.BroadcastTransactionRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &br) {
+		return
+	}
+	if !br.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "transaction is required")
+		return
+	}
+	st := br.Transaction
+	publicKey, signature, err := st.Verify()
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	bt := block.NewTransactionRequest(
+		blockTransaction(st.Sender, st.TransactionOutputs(), st.Memo, st.Fee, st.LockTime),
+		block.NewSignatureAuthorization(publicKey, signature))
+	m, _ := json.Marshal(bt)
+
+	resp, err := ws.gatewayDo(req.Context(), http.MethodPost, "/v1/transactions", bytes.NewBuffer(m))
+	if err != nil {
+		writeGatewayUnavailable(w, req, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		writeGatewayError(w, req, resp)
+		return
+	}
+	api.WriteSuccess(w, http.StatusCreated)
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"go-blockchain/api"
+	"go-blockchain/block"
+	"go-blockchain/keys"
+	"go-blockchain/keystore"
+	"go-blockchain/logging"
+	"go-blockchain/wallet"
+	"net/http"
+)
+
+const API_VERSION = "v1"
+
+// POST /v1/wallet/exportのレスポンス（formatに応じてどちらかを返す）
+type ExportResponse struct {
+	WIF    string           `json:"wif,omitempty"`
+	Backup *keystore.Backup `json:"backup,omitempty"`
+}
+
+// GET /v1/walletsのレスポンス
+type WalletsResponse struct {
+	Wallets []*WalletResponse `json:"wallets"`
+}
+
+// OpenAPIの例に使う値
+var (
+	exampleUser       = "alice"
+	examplePassphrase = "correct horse battery staple"
+	exampleWalletID   = "5f2b8c0e4d6a41e3b7c9d1f0a2e4c6b8"
+	exampleAddress    = "1Kb7aKPSmdXpY53qAkGPmgKvbD1PR5G1tb"
+	exampleRecipient  = "1NRtW14nJH187LcLNx4bAUc5reu7ePiuyz"
+	examplePublicKey  = "022a20ba619029da5b69a12ac2f19a1f6744a96ebf3a2e982fca199ae6b7a102a4"
+	exampleValue      = "1.5"
+	exampleLockTime   = int64(120)
+	exampleRecipient2 = "1BgGZ9tcN4rm9KBzDn7KprQz87SZ26SAMH"
+	exampleValue2     = "0.25"
+	exampleMemo       = "INV-2024-0042"
+	exampleWIF        = "KzB8kVEFyFyKkSv7gHY3CQBsSWTTfGJGAHshfkWcXLnkedtFYcSt"
+	exampleFormat     = wallet.EXPORT_FORMAT_WIF
+	exampleWallet     = &WalletResponse{
+		WalletID:          exampleWalletID,
+		PublicKey:         examplePublicKey,
+		BlockchainAddress: exampleAddress,
+	}
+	exampleSeedID   = "9c1e5a7b3d2f48e6a0b4c8d2e6f1a3b5"
+	exampleMnemonic = "abandon ability able about above absent absorb abstract absurd abuse access accident"
+	exampleHDWallet = &WalletResponse{
+		WalletID:          exampleWalletID,
+		PublicKey:         examplePublicKey,
+		BlockchainAddress: exampleAddress,
+		HDSeedID:          exampleSeedID,
+		HDPath:            wallet.HDPath(0, wallet.HD_EXTERNAL, 0),
+	}
+	exampleThreshold       = 2
+	exampleMultisigAddress = "33hG2q39jRi2NqicRJB4ggY1J8EJm97Szz"
+	exampleRedeemScript    = "52210279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f817982102c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee52102f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f953ae"
+	exampleMultisigKeys    = []string{
+		"0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+		"02c6047f9441ed7d6d3045406e95c07cd85c778e4b8cef3ca7abac09b95c709ee5",
+		"02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9",
+	}
+	exampleCosignature = "01304402207b8ab8fb46ea8ab00200a95878fd66ce2110e08654bbe02ff94e352179a3ff8e02204fa48afb37c579254bf629a1a7910a07903759d4e3b7991e4d15c9cd4367fb2b"
+	examplePartialTx   = &wallet.PartiallySignedTransaction{
+		Scheme:       string(keys.DEFAULT_SCHEME),
+		RedeemScript: exampleRedeemScript,
+		TransactionData: wallet.TransactionData{
+			Sender:    exampleMultisigAddress,
+			Recipient: exampleRecipient,
+			Value:     1.5,
+		},
+		Signatures: []*string{&exampleCosignature, nil, nil},
+	}
+	exampleTransactionData = wallet.TransactionData{
+		Sender:    exampleAddress,
+		Recipient: exampleRecipient,
+		Value:     1.5,
+		Fee:       block.MinimumFee(exampleMemo),
+		Memo:      exampleMemo,
+	}
+	exampleSignature = "013044022013c8fec8db7977712d963c8b3956e0a3d9d912288986ebcc80eadf2ce48cc86902204b0ffbecdb4fe8e85bcd80eb73ba6b9ba2ba2e2ab0e67d104bab4e85e4fd9234"
+)
+
+// v1のAPIのルーティング
+func (ws *WalletServer) Routes() *api.Router {
+	r := api.NewRouter()
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/wallet",
+		Summary:  "Create a new wallet and store it encrypted in the keystore",
+		Request:  &wallet.WalletRequest{User: &exampleUser, Passphrase: &examplePassphrase},
+		Response: exampleWallet,
+		Status:   http.StatusCreated,
+		Errors:   []int{http.StatusBadRequest},
+		Handler:  ws.Wallet,
+	})
+	exampleGapLimit := DEFAULT_GAP_LIMIT
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/hdwallet",
+		Summary: "Create an HD wallet from a new mnemonic, or restore one by discovering used addresses",
+		Request: &wallet.HDWalletRequest{
+			User:       &exampleUser,
+			Passphrase: &examplePassphrase,
+			Mnemonic:   &exampleMnemonic,
+			GapLimit:   &exampleGapLimit,
+		},
+		Response: &HDWalletResponse{
+			SeedID:   exampleSeedID,
+			Mnemonic: exampleMnemonic,
+			Wallets:  []*WalletResponse{exampleHDWallet},
+		},
+		Status:  http.StatusCreated,
+		Errors:  []int{http.StatusBadRequest, http.StatusBadGateway},
+		Handler: ws.HDWallet,
+	})
+	exampleAccount := uint32(0)
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/hdwallet/address",
+		Summary: "Derive the next address of an HD wallet and store it in the keystore",
+		Request: &wallet.HDAddressRequest{
+			User:       &exampleUser,
+			SeedID:     &exampleSeedID,
+			Passphrase: &examplePassphrase,
+			Account:    &exampleAccount,
+		},
+		Response: exampleHDWallet,
+		Status:   http.StatusCreated,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+		Handler:  ws.HDAddress,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/wallet/import",
+		Summary: "Import a wallet from WIF or an encrypted backup into the keystore",
+		Request: &wallet.ImportRequest{
+			User:       &exampleUser,
+			Passphrase: &examplePassphrase,
+			WIF:        &exampleWIF,
+		},
+		Response: exampleWallet,
+		Status:   http.StatusCreated,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized},
+		Handler:  ws.ImportWallet,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/wallet/export",
+		Summary: "Export a stored wallet as WIF or an encrypted backup",
+		Request: &wallet.ExportRequest{
+			User:       &exampleUser,
+			WalletID:   &exampleWalletID,
+			Passphrase: &examplePassphrase,
+			Format:     &exampleFormat,
+		},
+		Response: &ExportResponse{WIF: exampleWIF},
+		Errors:   []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+		Handler:  ws.ExportWallet,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/wallets",
+		Summary: "List wallets stored for a user",
+		Params: []api.Param{
+			{Name: "user", In: "query", Required: true},
+		},
+		Response: &WalletsResponse{Wallets: []*WalletResponse{exampleWallet}},
+		Errors:   []int{http.StatusBadRequest},
+		Handler:  ws.Wallets,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/wallet/amount",
+		Summary: "Get the balance of an address from the gateway",
+		Params: []api.Param{
+			{Name: "blockchain_address", In: "query", Required: true},
+			{Name: "minconf", In: "query", Type: "integer", Description: "Minimum confirmations for confirmed balance (default 1)"},
+		},
+		Response: block.NewAmountResponse(&block.Balance{Confirmed: 1.5, Unconfirmed: 0.5, Immature: 2.5}, 1),
+		Errors:   []int{http.StatusBadRequest, http.StatusBadGateway},
+		Handler:  ws.WalletAmount,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/wallet/events",
+		Summary: "Relay block and balance events of an address from the gateway as Server-Sent Events",
+		Params: []api.Param{
+			{Name: "blockchain_address", In: "query", Required: true},
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusBadGateway},
+		Handler: ws.WalletEvents,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/transaction",
+		Summary: "Sign a transaction to one recipient or many (outputs or csv), with an optional memo, fee and lock_time, and send it to the gateway",
+		Request: &wallet.TransactionRequest{
+			User:       &exampleUser,
+			WalletID:   &exampleWalletID,
+			Passphrase: &examplePassphrase,
+			PaymentRequest: wallet.PaymentRequest{
+				Outputs: []*wallet.OutputRequest{
+					{RecipientBlockchainAddress: &exampleRecipient, Value: &exampleValue},
+					{RecipientBlockchainAddress: &exampleRecipient2, Value: &exampleValue2},
+				},
+				Memo: &exampleMemo,
+			},
+			LockTime: &exampleLockTime,
+		},
+		Response: api.SuccessExample,
+		Status:   http.StatusCreated,
+		Errors: []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound,
+			http.StatusUnprocessableEntity, http.StatusBadGateway},
+		Handler: ws.CreateTransaction,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/transaction/build",
+		Summary: "Build an unsigned transaction and its digest to be signed offline",
+		Request: &wallet.BuildTransactionRequest{
+			SenderBlockchainAddress: &exampleAddress,
+			PaymentRequest: wallet.PaymentRequest{
+				RecipientBlockchainAddress: &exampleRecipient,
+				Value:                      &exampleValue,
+				Memo:                       &exampleMemo,
+			},
+		},
+		Response: wallet.NewUnsignedTransaction(exampleTransactionData),
+		Errors:   []int{http.StatusBadRequest},
+		Handler:  ws.BuildTransaction,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/transaction/broadcast",
+		Summary: "Verify a transaction signed offline and send it to the gateway",
+		Request: &wallet.BroadcastTransactionRequest{Transaction: &wallet.SignedTransaction{
+			TransactionData: exampleTransactionData,
+			Scheme:          string(keys.DEFAULT_SCHEME),
+			PublicKey:       examplePublicKey,
+			Signature:       exampleSignature,
+		}},
+		Response: api.SuccessExample,
+		Status:   http.StatusCreated,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusBadGateway},
+		Handler:  ws.BroadcastTransaction,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/multisig",
+		Summary: "Create an m-of-n multisig address from public keys and a threshold",
+		Request: &wallet.MultisigRequest{
+			Threshold:  &exampleThreshold,
+			PublicKeys: exampleMultisigKeys,
+		},
+		Response: &MultisigResponse{
+			BlockchainAddress: exampleMultisigAddress,
+			RedeemScript:      exampleRedeemScript,
+			Scheme:            string(keys.DEFAULT_SCHEME),
+			Threshold:         exampleThreshold,
+			PublicKeys:        exampleMultisigKeys,
+		},
+		Status:  http.StatusCreated,
+		Errors:  []int{http.StatusBadRequest},
+		Handler: ws.MultisigAddress,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/multisig/transaction",
+		Summary: "Create an unsigned transaction spending from a multisig address",
+		Request: &wallet.MultisigTransactionRequest{
+			RedeemScript: &exampleRedeemScript,
+			PaymentRequest: wallet.PaymentRequest{
+				RecipientBlockchainAddress: &exampleRecipient,
+				Value:                      &exampleValue,
+			},
+		},
+		Response: examplePartialTx,
+		Status:   http.StatusCreated,
+		Errors:   []int{http.StatusBadRequest},
+		Handler:  ws.MultisigTransaction,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodPost,
+		Path:    "/v1/multisig/sign",
+		Summary: "Add a signature from a stored cosigner wallet to a partially signed transaction",
+		Request: &wallet.MultisigSignRequest{
+			User:        &exampleUser,
+			WalletID:    &exampleWalletID,
+			Passphrase:  &examplePassphrase,
+			Transaction: examplePartialTx,
+		},
+		Response: &MultisigSignResponse{
+			Transaction: examplePartialTx,
+			Signed:      1,
+			Threshold:   exampleThreshold,
+		},
+		Errors:  []int{http.StatusBadRequest, http.StatusUnauthorized, http.StatusNotFound},
+		Handler: ws.MultisigSign,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodPost,
+		Path:     "/v1/multisig/broadcast",
+		Summary:  "Send a multisig transaction with enough signatures to the gateway",
+		Request:  &wallet.MultisigBroadcastRequest{Transaction: examplePartialTx},
+		Response: api.SuccessExample,
+		Status:   http.StatusCreated,
+		Errors:   []int{http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusBadGateway},
+		Handler:  ws.MultisigBroadcast,
+	})
+	exampleGateway := &api.Check{Name: "gateway", OK: true, Message: "http://127.0.0.1:5001 is reachable"}
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/healthz",
+		Summary:  "Liveness probe; always ok while the process is serving requests, with the reachability of the gateway",
+		Response: &HealthResponse{Status: api.HealthOK.Status, Gateway: exampleGateway},
+		Handler:  ws.Healthz,
+	})
+	r.Handle(&api.Route{
+		Method:   http.MethodGet,
+		Path:     "/readyz",
+		Summary:  "Readiness probe; 503 unless the gateway blockchain server is reachable",
+		Response: &api.ReadyResponse{Ready: true, Checks: []*api.Check{exampleGateway}},
+		Handler:  ws.Readyz,
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/metrics",
+		Summary: "HTTP metrics in the Prometheus text format",
+		Handler: ws.metrics.Handler(),
+	})
+	r.Handle(&api.Route{
+		Method:  http.MethodGet,
+		Path:    "/v1/openapi.json",
+		Summary: "OpenAPI specification of this API",
+		Handler: r.OpenAPIHandler("Wallet Server API", API_VERSION),
+	})
+	return r
+}
+
+// ルーティングの設定
+// 全てのリクエストにリクエストIDを付け、BlockchainServerへのリクエストに引き継ぐ
+func (ws *WalletServer) Handler() http.Handler {
+	routes := ws.Routes()
+	routes.Instrument(ws.http)
+	mux := http.NewServeMux()
+	mux.Handle("/v1/", routes)
+	mux.Handle("/metrics", routes)
+	mux.Handle("/healthz", routes)
+	mux.Handle("/readyz", routes)
+	mux.Handle("/", ws.http.Handler("/", http.HandlerFunc(ws.Index)))
+	return logging.Handler(ws.logger.Component(logging.COMPONENT_RPC), mux)
+}
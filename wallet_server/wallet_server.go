@@ -2,30 +2,49 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
+	"go-blockchain/api"
 	"go-blockchain/block"
+	"go-blockchain/keys"
+	"go-blockchain/keystore"
+	"go-blockchain/logging"
+	"go-blockchain/metrics"
+	"go-blockchain/multisig"
 	"go-blockchain/utils"
 	"go-blockchain/wallet"
 	"html/template"
 	"io"
-	"log"
 	"net/http"
+	"net/url"
+	"os"
 	"path"
 	"strconv"
 )
 
-const tempDir = "templates"
+const (
+	tempDir          = "templates"
+	MAX_REQUEST_SIZE = 1 << 16
+)
 
 // wallet（ユーザー）の構造た
 type WalletServer struct {
-	port    uint16
-	gateway string // 接続するBlockchainNode
+	port       uint16
+	gateway    string // 接続するBlockchainNode
+	keystore   *keystore.Keystore
+	wifVersion byte // インポート・エクスポートするWIFのネットワークバージョン
+	// /metricsで公開するメトリクス
+	metrics *metrics.Registry
+	http    *metrics.HTTPMetrics
+	// portフィールドを付けたLogger
+	logger *logging.Logger
 }
 
 // Walletの作成
-func NewWalletServer(port uint16, gateway string) *WalletServer {
-	return &WalletServer{port, gateway}
+func NewWalletServer(port uint16, gateway string, ks *keystore.Keystore, wifVersion byte) *WalletServer {
+	registry := metrics.NewRegistry()
+	return &WalletServer{port, gateway, ks, wifVersion, registry, registry.NewHTTPMetrics(), logging.New("port", port)}
 }
 
 func (ws *WalletServer) Port() uint16 {
@@ -38,148 +57,335 @@ func (ws *WalletServer) Gateway() string {
 
 // indexページを表示するハンドル
 func (ws *WalletServer) Index(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodGet:
-		// htmlファイルを表示
-		t, _ := template.ParseFiles(path.Join(tempDir, "index.html"))
-		t.Execute(w, "")
-	default:
-		log.Printf("ERROR: Invalid HTTP Method")
+	if req.URL.Path != "/" {
+		api.WriteError(w, http.StatusNotFound, api.CodeNotFound, fmt.Sprintf("%s not found", req.URL.Path))
+		return
+	}
+	if req.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		api.WriteError(w, http.StatusMethodNotAllowed, api.CodeMethodNotAllowed,
+			fmt.Sprintf("method %s is not allowed", req.Method))
+		return
 	}
+	// htmlファイルを表示
+	t, _ := template.ParseFiles(path.Join(tempDir, "index.html"))
+	t.Execute(w, "")
 }
 
-// ウォレットを作成するAPIハンドル
+// キーストアに保存したウォレットの情報（秘密鍵は含めない）
+type WalletResponse struct {
+	WalletID          string `json:"wallet_id"`
+	PublicKey         string `json:"public_key"`
+	BlockchainAddress string `json:"blockchain_address"`
+	HDSeedID          string `json:"hd_seed_id,omitempty"`
+	HDPath            string `json:"hd_path,omitempty"`
+}
+
+func NewWalletResponse(kf *keystore.KeyFile) *WalletResponse {
+	return &WalletResponse{
+		WalletID:          kf.ID,
+		PublicKey:         kf.PublicKey,
+		BlockchainAddress: kf.BlockchainAddress,
+		HDSeedID:          kf.HDSeedID,
+		HDPath:            kf.HDPath,
+	}
+}
+
+// ウォレットを作成してキーストアに保存するAPIハンドル
 func (ws *WalletServer) Wallet(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodPost:
-		w.Header().Add("Content-Type", "application/json")
-		myWallet := wallet.NewWallet()
-		m, _ := myWallet.MarshalJSON()
-		io.WriteString(w, string(m[:]))
-	default:
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("ERROR: Invalid HTTP Method")
+	var wr wallet.WalletRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &wr) {
+		return
+	}
+	if !wr.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "missing field(s)")
+		return
+	}
+	myWallet := wallet.NewWallet()
+	kf, err := ws.keystore.Store(*wr.User, myWallet, *wr.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
 	}
+	api.WriteJSON(w, http.StatusCreated, NewWalletResponse(kf))
 }
 
-// トランザクションを作成して、ブロックチェーンネットワークに送信するAPIハンドル
-func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodPost:
-		// フロントからくるJsonをStructに格納する
-		decoder := json.NewDecoder(req.Body)
-		var t wallet.TransactionRequest
-		err := decoder.Decode(&t)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
-		// Jsonのバリデーション処理
-		if !t.Validate() {
-			log.Println("ERROR: missing field(s)")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
+// ユーザーのウォレットの一覧を返すAPIハンドル
+func (ws *WalletServer) Wallets(w http.ResponseWriter, req *http.Request) {
+	keys, err := ws.keystore.List(req.URL.Query().Get("user"))
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	wallets := make([]*WalletResponse, 0, len(keys))
+	for _, kf := range keys {
+		wallets = append(wallets, NewWalletResponse(kf))
+	}
+	api.WriteJSON(w, http.StatusOK, &WalletsResponse{Wallets: wallets})
+}
+
+// WIFまたは暗号化したバックアップからウォレットをインポートしてキーストアに保存するAPIハンドル
+func (ws *WalletServer) ImportWallet(w http.ResponseWriter, req *http.Request) {
+	var ir wallet.ImportRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &ir) {
+		return
+	}
+	if !ir.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+			"user, passphrase and one of wif, backup with backup_password, or private_key with public_key are required")
+		return
+	}
 
-		// publicKeyとprivateKeyを生成
-		publicKey := utils.PublicKeyFromString(*t.SenderPublicKey)
-		privateKey := utils.PrivateKeyFromString(*t.SenderPrivateKey, publicKey)
-		// valueを生成
-		value, err := strconv.ParseFloat(*t.Value, 32)
-		if err != nil {
-			log.Println("ERROR: parse error")
-			io.WriteString(w, string(utils.JsonStatus("fail")))
+	var imported *wallet.Wallet
+	var err error
+	switch {
+	case ir.WIF != nil:
+		imported, err = wallet.FromWIF(*ir.WIF, ws.wifVersion)
+	case ir.Backup != nil:
+		var backup keystore.Backup
+		if err := json.Unmarshal(*ir.Backup, &backup); err != nil {
+			api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, keystore.ErrInvalidBackup.Error())
 			return
 		}
-		value32 := float32(value)
-
-		w.Header().Add("Content-Type", "application/json")
-		// transactionの生成
-		transaction := wallet.NewTransaction(privateKey, publicKey,
-			*t.SenderBlockchainAddress, *t.RecipientBlockchainAddress, value32)
-		// signatureの生成
-		signature := transaction.GenerateSignature()
-		signatureStr := signature.String()
-
-		bt := &block.TransactionRequest{
-			t.SenderBlockchainAddress,
-			t.RecipientBlockchainAddress,
-			t.SenderPublicKey,
-			&value32, &signatureStr,
-		}
-		m, _ := json.Marshal(bt)
-		buf := bytes.NewBuffer(m)
+		imported, err = keystore.ImportBackup(&backup, *ir.BackupPassword)
+	default:
+		imported, err = importLegacyKey(*ir.PrivateKey, *ir.PublicKey)
+	}
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
 
-		resp, _ := http.Post(ws.Gateway()+"/transactions", "application/json", buf)
+	kf, err := ws.keystore.Store(*ir.User, imported, *ir.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusCreated, NewWalletResponse(kf))
+}
 
-		if resp.StatusCode == 201 {
-			io.WriteString(w, string(utils.JsonStatus("success")))
-			return
-		}
-		io.WriteString(w, string(utils.JsonStatus("fail")))
+// 以前のウォレットが表示していたP-256の秘密鍵と公開鍵（X||Y）からウォレットを作成する
+func importLegacyKey(privateKeyStr string, publicKeyStr string) (*wallet.Wallet, error) {
+	publicKey, err := utils.PublicKeyFromString(publicKeyStr)
+	if err != nil {
+		return nil, err
+	}
+	privateKey, err := utils.PrivateKeyFromString(privateKeyStr, publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return wallet.FromPrivateKey(keys.NewP256PrivateKey(privateKey)), nil
+}
+
+// キーストアのウォレットをWIFまたは暗号化したバックアップとしてエクスポートするAPIハンドル
+func (ws *WalletServer) ExportWallet(w http.ResponseWriter, req *http.Request) {
+	var er wallet.ExportRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &er) {
+		return
+	}
+	if !er.Validate() {
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest,
+			"user, wallet_id, passphrase and format (wif or backup with backup_password) are required")
+		return
+	}
+	exported, _, err := ws.keystore.Unlock(*er.User, *er.WalletID, *er.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+
+	if *er.Format == wallet.EXPORT_FORMAT_WIF {
+		api.WriteJSON(w, http.StatusOK, &ExportResponse{WIF: exported.WIF(ws.wifVersion)})
+		return
+	}
+	backup, err := keystore.ExportBackup(exported, *er.BackupPassword)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, &ExportResponse{Backup: backup})
+}
 
+// キーストアのエラーをステータスコードに変換して返す
+func writeKeystoreError(w http.ResponseWriter, req *http.Request, err error) {
+	logging.FromContext(req.Context()).Warn("keystore error", "err", err)
+	switch err {
+	case keystore.ErrInvalidName, keystore.ErrEmptyPassphrase, keystore.ErrInvalidBackup,
+		keystore.ErrAddressMismatch, keystore.ErrUnsupportedCrypto, wallet.ErrInvalidPrivateKey, wallet.ErrInvalidWIF,
+		wallet.ErrWIFNetworkMismatch, wallet.ErrInvalidMnemonic,
+		utils.ErrInvalidHex, utils.ErrInvalidLength, utils.ErrPointNotOnCurve,
+		utils.ErrPrivateKeyRange, utils.ErrKeyPairMismatch,
+		keys.ErrUnknownScheme, keys.ErrInvalidPublicKey, keys.ErrInvalidSignature, keys.ErrHighS,
+		multisig.ErrInvalidThreshold, multisig.ErrTooManyKeys, multisig.ErrDuplicateKey,
+		multisig.ErrMixedSchemes, multisig.ErrInvalidScript,
+		wallet.ErrNotCosigner, wallet.ErrInvalidPartialTx, wallet.ErrInvalidCosignature,
+		wallet.ErrIncompleteTransaction, wallet.ErrInvalidTransaction, wallet.ErrSenderMismatch,
+		wallet.ErrDigestMismatch, wallet.ErrSignatureMismatch:
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+	case keystore.ErrNotFound:
+		api.WriteError(w, http.StatusNotFound, api.CodeNotFound, err.Error())
+	case keystore.ErrInvalidPassphrase:
+		api.WriteError(w, http.StatusUnauthorized, api.CodeInvalidPassphrase, err.Error())
 	default:
-		w.WriteHeader(http.StatusBadRequest)
-		log.Println("ERROR: Invalid HTTP Method")
+		api.WriteError(w, http.StatusInternalServerError, api.CodeInternal, "keystore error")
 	}
 }
 
+// トランザクションを作成して、ブロックチェーンネットワークに送信するAPIハンドル
+func (ws *WalletServer) CreateTransaction(w http.ResponseWriter, req *http.Request) {
+	// フロントからくるJsonをStructに格納する
+	var t wallet.TransactionRequest
+	if !api.DecodeJSON(w, req, MAX_REQUEST_SIZE, &t) {
+		return
+	}
+	// Jsonのバリデーション処理
+	if !t.Validate() {
+		logging.FromContext(req.Context()).Warn("invalid transaction request: missing field(s)")
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, "missing field(s)")
+		return
+	}
+
+	// キーストアのウォレットをパスフレーズで復号する
+	senderWallet, kf, err := ws.keystore.Unlock(*t.User, *t.WalletID, *t.Passphrase)
+	if err != nil {
+		writeKeystoreError(w, req, err)
+		return
+	}
+	// 受取人と金額の一覧を生成（outputsやcsvで複数指定した場合は1つのTransactionにまとめる）
+	outputs, memo, fee, err := readPayment(&t.PaymentRequest)
+	if err != nil {
+		logging.FromContext(req.Context()).Warn("invalid payment", "err", err)
+		api.WriteError(w, http.StatusBadRequest, api.CodeInvalidRequest, err.Error())
+		return
+	}
+	lockTime := wallet.LockTimeValue(t.LockTime)
+
+	// transactionの生成（lock_timeを指定した場合は、その時まで取り込まれない予約送金になる）
+	transaction := wallet.NewBatchTransaction(senderWallet.PrivateKey(), kf.BlockchainAddress, outputs, lockTime).
+		WithMemo(memo, fee)
+	// signatureの生成
+	signature, err := transaction.GenerateSignature()
+	if err != nil {
+		logging.FromContext(req.Context()).Error("failed to sign transaction", "err", err)
+		api.WriteError(w, http.StatusInternalServerError, api.CodeInternal, "failed to sign transaction")
+		return
+	}
+	// キーストアのファイルには以前の形式の公開鍵が保存されている場合があるので、秘密鍵から作り直した公開鍵を送る
+	bt := block.NewTransactionRequest(blockTransaction(kf.BlockchainAddress, outputs, memo, fee, lockTime),
+		block.NewSignatureAuthorization(senderWallet.PublicKey(), signature))
+	m, _ := json.Marshal(bt)
+
+	resp, err := ws.gatewayDo(req.Context(), http.MethodPost, "/v1/transactions", bytes.NewBuffer(m))
+	if err != nil {
+		writeGatewayUnavailable(w, req, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		writeGatewayError(w, req, resp)
+		return
+	}
+	api.WriteSuccess(w, http.StatusCreated)
+}
+
+// 受取人と金額の一覧、メモ、手数料（省略時はメモの大きさに応じた最低限の手数料）を読み込む
+func readPayment(pr *wallet.PaymentRequest) ([]*wallet.Output, string, float32, error) {
+	outputs, err := pr.TransactionOutputs()
+	if err != nil {
+		return nil, "", 0, err
+	}
+	memo, fee, err := pr.MemoAndFee(block.MinimumFee)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if len(memo) > block.MAX_MEMO_SIZE {
+		return nil, "", 0, block.ErrMemoTooLarge
+	}
+	return outputs, memo, fee, nil
+}
+
+// nodeに送るTransaction
+func blockTransaction(sender string, outputs []*wallet.Output, memo string, fee float32, lockTime int64) *block.Transaction {
+	bo := make([]*block.Output, 0, len(outputs))
+	for _, o := range outputs {
+		bo = append(bo, block.NewOutput(o.RecipientBlockchainAddress, o.Value))
+	}
+	return block.NewBatchTransaction(sender, bo, lockTime).WithMemo(memo, fee)
+}
+
 // walletでBlockchainServerの仮想通貨の合計値を取得するAPIを叩く
 func (ws *WalletServer) WalletAmount(w http.ResponseWriter, req *http.Request) {
-	switch req.Method {
-	case http.MethodGet:
-		blockchainAddress := req.URL.Query().Get("blockchain_address")
-		endpoint := fmt.Sprintf("%s/amount", ws.Gateway())
-
-		// GETリクエストを送信
-		client := &http.Client{}
-		bcsReq, _ := http.NewRequest("GET", endpoint, nil)
-		q := bcsReq.URL.Query()
-		q.Add("blockchain_address", blockchainAddress)
-		bcsReq.URL.RawQuery = q.Encode()
-
-		// GETリクエストから値を取得
-		bcsResp, err := client.Do(bcsReq)
-		if err != nil {
-			log.Printf("ERROR: %v", err)
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-			return
-		}
+	blockchainAddress := req.URL.Query().Get("blockchain_address")
+	minConf := req.URL.Query().Get("minconf")
+	q := url.Values{}
+	q.Add("blockchain_address", blockchainAddress)
+	if minConf != "" {
+		q.Add("minconf", minConf)
+	}
 
-		w.Header().Add("Content-Type", "application/json")
-		if bcsResp.StatusCode == 200 {
-			decoder := json.NewDecoder(bcsResp.Body)
-			var bar block.AmountResponse
-			err := decoder.Decode(&bar)
-			if err != nil {
-				log.Printf("ERROR: %v", err)
-				io.WriteString(w, string(utils.JsonStatus("fail")))
-				return
-			}
-
-			m, _ := json.Marshal(struct {
-				Message string  `json:"message"`
-				Amount  float32 `json:"amount"`
-			}{
-				Message: "success",
-				Amount:  bar.Amount,
-			})
-			io.WriteString(w, string(m[:]))
-		} else {
-			io.WriteString(w, string(utils.JsonStatus("fail")))
-		}
+	// GETリクエストから値を取得
+	bcsResp, err := ws.gatewayDo(req.Context(), http.MethodGet, "/v1/amount?"+q.Encode(), nil)
+	if err != nil {
+		writeGatewayUnavailable(w, req, err)
+		return
+	}
+	defer bcsResp.Body.Close()
+	if bcsResp.StatusCode != http.StatusOK {
+		writeGatewayError(w, req, bcsResp)
+		return
+	}
 
-	default:
-		log.Printf("ERROR: Invalid HTTP Method")
-		w.WriteHeader(http.StatusBadRequest)
+	decoder := json.NewDecoder(bcsResp.Body)
+	var bar block.AmountResponse
+	if err := decoder.Decode(&bar); err != nil {
+		writeGatewayUnavailable(w, req, err)
+		return
+	}
+	api.WriteJSON(w, http.StatusOK, &bar)
+}
+
+// BlockchainServerへのリクエストを送る
+// 受け取ったリクエストのリクエストIDを引き継ぎ、クライアントが切断したら中断する
+func (ws *WalletServer) gatewayDo(ctx context.Context, method string, path string, body io.Reader) (*http.Response, error) {
+	r, err := ws.gatewayRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(r)
+}
+
+func (ws *WalletServer) gatewayRequest(ctx context.Context, method string, path string, body io.Reader) (*http.Request, error) {
+	r, err := http.NewRequestWithContext(ctx, method, ws.Gateway()+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	logging.SetRequestID(ctx, r)
+	return r, nil
+}
+
+// BlockchainServerに接続できなかった場合のエラーを返す
+func writeGatewayUnavailable(w http.ResponseWriter, req *http.Request, err error) {
+	logging.FromContext(req.Context()).Error("gateway request failed", "err", err)
+	api.WriteError(w, http.StatusBadGateway, api.CodeGatewayUnavailable, err.Error())
+}
+
+// BlockchainServerから返ってきたエラーをそのままフロントに返す
+func writeGatewayError(w http.ResponseWriter, req *http.Request, resp *http.Response) {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, block.MAX_TRANSACTION_REQUEST_SIZE))
+	if e, ok := api.DecodeError(body); ok {
+		api.WriteError(w, resp.StatusCode, e.Code, e.Message)
+		return
 	}
+	logging.FromContext(req.Context()).Error("unexpected gateway response", "status", resp.StatusCode)
+	api.WriteError(w, http.StatusBadGateway, api.CodeGatewayUnavailable,
+		fmt.Sprintf("unexpected gateway response %d", resp.StatusCode))
 }
 
 func (ws *WalletServer) Run() {
-	http.HandleFunc("/", ws.Index)
-	http.HandleFunc("/wallet", ws.Wallet)
-	http.HandleFunc("/wallet/amount", ws.WalletAmount)
-	http.HandleFunc("/transaction", ws.CreateTransaction)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ws.Port())), nil))
+	err := http.ListenAndServe("0.0.0.0:"+strconv.Itoa(int(ws.Port())), ws.Handler())
+	ws.logger.Error("server stopped", "err", err)
+	os.Exit(1)
 }
@@ -0,0 +1,648 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-blockchain/block"
+	"go-blockchain/logging"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// 配信の状態
+const (
+	STATUS_PENDING   = "pending"   // 配信待ち（再送待ちを含む）
+	STATUS_DELIVERED = "delivered" // 2xxのレスポンスを受け取った
+	STATUS_FAILED    = "failed"    // 再送の上限に達したか、Webhookが削除された
+)
+
+const (
+	STATE_FILE   = "webhooks.json"
+	JOURNAL_FILE = "webhooks.journal"
+
+	MAX_ATTEMPTS            = 10
+	MAX_PENDING_PER_WEBHOOK = 1000 // 1つのWebhookの配信待ちの通知の数（超えた分は送らずに失敗として記録する）
+	MAX_JOURNAL_RECORDS     = 1000 // ジャーナルに追記した記録がこの数を超えたら状態ファイルにまとめる
+	RETRY_BASE_SEC          = 5    // 1回目の再送までの秒数（以後2倍ずつ延ばす）
+	RETRY_MAX_SEC           = 3600 // 再送の間隔の上限
+	DELIVERY_TIMEOUT        = 10 * time.Second
+	MAX_DELIVERY_LOG        = 1000 // 保存しておく配信済み・失敗した通知の数（古いものから消す）
+	// 重複して登録しないように覚えておく通知のIDの数（配信記録を消した後もチェーンの置き換えで同じ通知を送らない）
+	MAX_SEEN_DELIVERIES = 10000
+	MAX_RESPONSE_READ   = 1 << 10
+	POLL_INTERVAL       = time.Second
+)
+
+// 通知のボディ
+// heightとblock_hashはconfirmationsが1以上の場合のみ
+type Payload struct {
+	ID            string             `json:"id"`
+	Type          string             `json:"type"`
+	WebhookID     string             `json:"webhook_id"`
+	Address       string             `json:"address"`
+	Value         float32            `json:"value"`
+	Confirmations int                `json:"confirmations"`
+	Height        *int               `json:"height,omitempty"`
+	BlockHash     string             `json:"block_hash,omitempty"`
+	Transaction   *block.Transaction `json:"transaction"`
+	Timestamp     int64              `json:"timestamp"`
+}
+
+// 通知の配信記録
+type Delivery struct {
+	ID             string          `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttempt    int64           `json:"next_attempt,omitempty"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      int64           `json:"created_at"`
+	DeliveredAt    int64           `json:"delivered_at,omitempty"`
+}
+
+// ファイルに保存する状態
+// generationは状態ファイルにまとめるたびに増やし、それより前のジャーナルの記録を読み飛ばすのに使う
+// seenはこれまでに登録した通知のID（古い順、配信記録はpruneで消えても残す）
+type state struct {
+	Generation int64       `json:"generation"`
+	Webhooks   []*Webhook  `json:"webhooks"`
+	Deliveries []*Delivery `json:"deliveries"`
+	Seen       []string    `json:"seen,omitempty"`
+}
+
+// ジャーナルの1行（追加または更新した配信記録）
+type journalRecord struct {
+	Generation int64     `json:"generation"`
+	Delivery   *Delivery `json:"delivery"`
+}
+
+// Webhookを管理し、通知を配信する
+type Dispatcher struct {
+	path           string
+	journalPath    string
+	journalRecords int
+	client         *http.Client
+	allowPrivate   bool
+	state          state
+	seen           map[string]bool
+	busy           map[string]bool // 配信中のworkerがあるWebhook
+	mux            sync.Mutex
+	wake           chan struct{}
+	done           chan struct{}
+	closeOnce      sync.Once
+	running        sync.WaitGroup
+	logger         *logging.Logger
+}
+
+// dirに保存したWebhookと配信記録を読み込む
+func Open(dir string) (*Dispatcher, error) {
+	d := &Dispatcher{
+		path:        filepath.Join(dir, STATE_FILE),
+		journalPath: filepath.Join(dir, JOURNAL_FILE),
+		state:       state{Webhooks: make([]*Webhook, 0), Deliveries: make([]*Delivery, 0)},
+		seen:        make(map[string]bool),
+		busy:        make(map[string]bool),
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		logger:      logging.New("component", logging.COMPONENT_WEBHOOK),
+	}
+	d.client = d.newClient()
+	m, err := os.ReadFile(d.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(m, &d.state); err != nil {
+			return nil, fmt.Errorf("%s: %v", d.path, err)
+		}
+	}
+	seen := d.state.Seen
+	d.state.Seen = nil
+	for _, id := range seen {
+		d.markSeen(id)
+	}
+	for _, dl := range d.state.Deliveries {
+		d.markSeen(dl.ID)
+	}
+	if err := d.replay(); err != nil {
+		return nil, fmt.Errorf("%s: %v", d.journalPath, err)
+	}
+	d.prune()
+	return d, nil
+}
+
+// 状態ファイルより後にジャーナルに追記した配信記録を反映する
+// 状態ファイルにまとめる前の世代の記録と、書き込みの途中で止まった末尾の行は読み飛ばす
+func (d *Dispatcher) replay() error {
+	f, err := os.Open(d.journalPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	deliveries := make(map[string]*Delivery, len(d.state.Deliveries))
+	for _, dl := range d.state.Deliveries {
+		deliveries[dl.ID] = dl
+	}
+	dec := json.NewDecoder(f)
+	for {
+		var r journalRecord
+		if err := dec.Decode(&r); err != nil {
+			if err != io.EOF {
+				d.logger.Warn("ignoring the rest of the webhook journal", "path", d.journalPath, "err", err)
+			}
+			return nil
+		}
+		if r.Generation != d.state.Generation || r.Delivery == nil {
+			continue
+		}
+		d.journalRecords++
+		if dl, ok := deliveries[r.Delivery.ID]; ok {
+			*dl = *r.Delivery
+			continue
+		}
+		deliveries[r.Delivery.ID] = r.Delivery
+		d.state.Deliveries = append(d.state.Deliveries, r.Delivery)
+		d.markSeen(r.Delivery.ID)
+	}
+}
+
+// 登録した通知のIDを覚える（呼び出し側でd.muxをロックすること）
+// MAX_SEEN_DELIVERIESを超えたら古いものから忘れる
+func (d *Dispatcher) markSeen(id string) {
+	if d.seen[id] {
+		return
+	}
+	d.seen[id] = true
+	d.state.Seen = append(d.state.Seen, id)
+	if excess := len(d.state.Seen) - MAX_SEEN_DELIVERIES; excess > 0 {
+		for _, old := range d.state.Seen[:excess] {
+			delete(d.seen, old)
+		}
+		d.state.Seen = append([]string(nil), d.state.Seen[excess:]...)
+	}
+}
+
+// Webhookを登録する
+// URLのホストがloopback、link-local、プライベートのアドレスに解決される場合はErrInvalidTarget
+func (d *Dispatcher) Add(wr *WebhookRequest) (*Webhook, error) {
+	if err := d.checkTarget(*wr.URL); err != nil {
+		return nil, err
+	}
+	wh := &Webhook{
+		ID:            newID(16),
+		URL:           *wr.URL,
+		Addresses:     wr.Addresses,
+		Confirmations: *wr.Confirmations,
+		CreatedAt:     time.Now().Unix(),
+	}
+	if wr.Secret != nil {
+		wh.Secret = *wr.Secret
+	} else {
+		wh.Secret = newID(SECRET_SIZE)
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if len(d.state.Webhooks) >= MAX_WEBHOOKS {
+		return nil, ErrTooManyWebhooks
+	}
+	d.state.Webhooks = append(d.state.Webhooks, wh)
+	if err := d.save(); err != nil {
+		d.state.Webhooks = d.state.Webhooks[:len(d.state.Webhooks)-1]
+		return nil, err
+	}
+	return wh, nil
+}
+
+// 登録しているWebhookの一覧（secretは含めない）
+func (d *Dispatcher) Webhooks() []*Webhook {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	webhooks := make([]*Webhook, 0, len(d.state.Webhooks))
+	for _, wh := range d.state.Webhooks {
+		webhooks = append(webhooks, wh.Redacted())
+	}
+	return webhooks
+}
+
+// Webhookを削除する
+// 配信待ちの通知は失敗として配信記録に残す
+func (d *Dispatcher) Remove(id string) error {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	i := d.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	d.state.Webhooks = append(d.state.Webhooks[:i], d.state.Webhooks[i+1:]...)
+	for _, dl := range d.state.Deliveries {
+		if dl.WebhookID == id && dl.Status == STATUS_PENDING {
+			dl.Status, dl.NextAttempt, dl.LastError = STATUS_FAILED, 0, "webhook removed"
+		}
+	}
+	return d.save()
+}
+
+// Webhookの配信記録（新しい順）
+func (d *Dispatcher) Deliveries(id string) ([]*Delivery, error) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if d.index(id) < 0 {
+		return nil, ErrNotFound
+	}
+	deliveries := make([]*Delivery, 0)
+	for i := len(d.state.Deliveries) - 1; i >= 0; i-- {
+		if dl := d.state.Deliveries[i]; dl.WebhookID == id {
+			c := *dl
+			deliveries = append(deliveries, &c)
+		}
+	}
+	return deliveries, nil
+}
+
+func (d *Dispatcher) index(id string) int {
+	for i, wh := range d.state.Webhooks {
+		if wh.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// Poolに追加されたTransactionをconfirmationsが0のWebhookに通知する
+func (d *Dispatcher) TransactionAdded(t *block.Transaction) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	n := len(d.state.Deliveries)
+	pending := d.pending()
+	for _, wh := range d.state.Webhooks {
+		if wh.Confirmations != 0 {
+			continue
+		}
+		for _, a := range wh.Addresses {
+			if v := t.ValueTo(a); v > 0 {
+				d.enqueue(pending, wh, newID(16), a, v, t, nil, "")
+			}
+		}
+	}
+	d.commit(n)
+}
+
+// chainの高さheightにブロックが追加された時に、ちょうどconfirmationsの承認数に達したブロックのTransactionを通知する
+// 同じブロックが再び追加されても（チェーンの置き換えで一度外れた場合など）、配信記録を消した後でも同じ通知は送らない
+func (d *Dispatcher) BlockConnected(chain []*block.Block, height int) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	n := len(d.state.Deliveries)
+	pending := d.pending()
+	for _, wh := range d.state.Webhooks {
+		h := height + 1 - wh.Confirmations
+		if wh.Confirmations == 0 || h < 0 {
+			continue
+		}
+		b := chain[h]
+		hash := fmt.Sprintf("%x", b.Hash())
+		for i, t := range b.Transactions() {
+			for _, a := range wh.Addresses {
+				v := t.ValueTo(a)
+				if v <= 0 {
+					continue
+				}
+				id := deliveryID(wh.ID, hash, i, a)
+				if d.seen[id] {
+					continue
+				}
+				d.enqueue(pending, wh, id, a, v, t, &h, hash)
+			}
+		}
+	}
+	d.commit(n)
+}
+
+// ブロック内のTransactionの通知のID（同じ通知を重複して登録しないように内容から決める）
+func deliveryID(webhookID string, blockHash string, index int, address string) string {
+	h := sha256.Sum256([]byte(webhookID + ":" + blockHash + ":" + strconv.Itoa(index) + ":" + address))
+	return hex.EncodeToString(h[:16])
+}
+
+// Webhookごとの配信待ちの通知の数（呼び出し側でd.muxをロックすること）
+func (d *Dispatcher) pending() map[string]int {
+	pending := make(map[string]int)
+	for _, dl := range d.state.Deliveries {
+		if dl.Status == STATUS_PENDING {
+			pending[dl.WebhookID]++
+		}
+	}
+	return pending
+}
+
+// 呼び出し側でd.muxをロックし、最後にcommitを呼ぶこと
+// 受信側が止まっている間に溜まり続けないように、配信待ちが上限に達したWebhookの通知は送らずに失敗として記録する
+func (d *Dispatcher) enqueue(pending map[string]int, wh *Webhook, id string, address string, value float32,
+	t *block.Transaction, height *int, blockHash string) {
+	now := time.Now()
+	payload, _ := json.Marshal(&Payload{
+		ID:            id,
+		Type:          EVENT_ADDRESS_RECEIVED,
+		WebhookID:     wh.ID,
+		Address:       address,
+		Value:         value,
+		Confirmations: wh.Confirmations,
+		Height:        height,
+		BlockHash:     blockHash,
+		Transaction:   t,
+		Timestamp:     now.Unix(),
+	})
+	dl := &Delivery{
+		ID:          id,
+		WebhookID:   wh.ID,
+		Payload:     payload,
+		Status:      STATUS_PENDING,
+		NextAttempt: now.Unix(),
+		CreatedAt:   now.Unix(),
+	}
+	if pending[wh.ID] >= MAX_PENDING_PER_WEBHOOK {
+		dl.Status, dl.NextAttempt, dl.LastError = STATUS_FAILED, 0, "too many pending deliveries"
+		d.logger.Warn("webhook has too many pending deliveries", "webhook", wh.ID, "delivery", id)
+	} else {
+		pending[wh.ID]++
+	}
+	d.state.Deliveries = append(d.state.Deliveries, dl)
+	d.markSeen(id)
+}
+
+// n件目以降に追加した通知を保存して配信を始める（呼び出し側でd.muxをロックすること）
+func (d *Dispatcher) commit(n int) {
+	if len(d.state.Deliveries) == n {
+		return
+	}
+	d.persist(d.state.Deliveries[n:]...)
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// ログに使うLoggerを変更する（nodeのportなどのフィールドを付ける）
+func (d *Dispatcher) SetLogger(l *logging.Logger) {
+	d.logger = l
+}
+
+// --------------------------------------------------------------------------------------------------------------------
+// 配信待ちの通知を送るgoroutineを始める
+func (d *Dispatcher) Start() {
+	d.running.Add(1)
+	go d.run()
+}
+
+// 配信を止める（送信中の通知を送り終えるまで待つ）
+// 送信中の通知はDELIVERY_TIMEOUTまでかかることがある
+func (d *Dispatcher) Close() {
+	d.closeOnce.Do(func() {
+		close(d.done)
+	})
+	d.running.Wait()
+}
+
+func (d *Dispatcher) run() {
+	defer d.running.Done()
+	ticker := time.NewTicker(POLL_INTERVAL)
+	defer ticker.Stop()
+	for {
+		d.startWorkers()
+		select {
+		case <-ticker.C:
+		case <-d.wake:
+		case <-d.done:
+			return
+		}
+	}
+}
+
+// 送信時刻になった通知があるWebhookごとに、配信中でなければworkerを始める
+// 応答の遅い受信側や止まっている受信側があっても、他のWebhookの配信は待たせない
+func (d *Dispatcher) startWorkers() {
+	byWebhook := make(map[string][]*Delivery)
+	for _, dl := range d.due() {
+		byWebhook[dl.WebhookID] = append(byWebhook[dl.WebhookID], dl)
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	for id, deliveries := range byWebhook {
+		if d.busy[id] {
+			continue
+		}
+		d.busy[id] = true
+		d.running.Add(1)
+		go d.work(id, deliveries)
+	}
+}
+
+// 1つのWebhookの通知を順に送る
+// 失敗した場合は受信側が止まっているとみなし、残りは次の回に回す
+func (d *Dispatcher) work(id string, deliveries []*Delivery) {
+	defer d.running.Done()
+	defer func() {
+		d.mux.Lock()
+		delete(d.busy, id)
+		d.mux.Unlock()
+	}()
+	for _, dl := range deliveries {
+		select {
+		case <-d.done:
+			return
+		default:
+		}
+		if !d.deliver(dl) {
+			return
+		}
+	}
+}
+
+// 送信時刻になった通知
+func (d *Dispatcher) due() []*Delivery {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	now := time.Now().Unix()
+	deliveries := make([]*Delivery, 0)
+	for _, dl := range d.state.Deliveries {
+		if dl.Status == STATUS_PENDING && dl.NextAttempt <= now {
+			deliveries = append(deliveries, dl)
+		}
+	}
+	return deliveries
+}
+
+// 通知を1回送り、送れたか（送る必要がなくなった場合を含む）を返す
+func (d *Dispatcher) deliver(dl *Delivery) bool {
+	d.mux.Lock()
+	i := d.index(dl.WebhookID)
+	if i < 0 || dl.Status != STATUS_PENDING {
+		d.mux.Unlock()
+		return true
+	}
+	wh := *d.state.Webhooks[i]
+	d.mux.Unlock()
+
+	statusCode, err := d.post(&wh, dl)
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	if dl.Status != STATUS_PENDING {
+		// 送信中にWebhookが削除された
+		return true
+	}
+	now := time.Now().Unix()
+	dl.Attempts++
+	dl.LastStatusCode = statusCode
+	switch {
+	case err == nil:
+		dl.Status, dl.NextAttempt, dl.LastError, dl.DeliveredAt = STATUS_DELIVERED, 0, "", now
+		d.logger.Debug("webhook delivered", "webhook", wh.ID, "delivery", dl.ID, "attempts", dl.Attempts)
+	case dl.Attempts >= MAX_ATTEMPTS:
+		dl.Status, dl.NextAttempt, dl.LastError = STATUS_FAILED, 0, err.Error()
+		d.logger.Error("webhook delivery failed", "webhook", wh.ID, "delivery", dl.ID, "attempts", dl.Attempts, "err", err)
+	default:
+		dl.NextAttempt, dl.LastError = now+retryDelay(dl.Attempts), err.Error()
+		d.logger.Warn("webhook delivery will be retried", "webhook", wh.ID, "delivery", dl.ID,
+			"attempts", dl.Attempts, "retry_in_sec", dl.NextAttempt-now, "err", err)
+	}
+	d.prune()
+	d.persist(dl)
+	return err == nil
+}
+
+// attempts回失敗した後に再送するまでの秒数
+func retryDelay(attempts int) int64 {
+	delay := int64(RETRY_BASE_SEC)
+	for i := 1; i < attempts && delay < RETRY_MAX_SEC; i++ {
+		delay *= 2
+	}
+	if delay > RETRY_MAX_SEC {
+		delay = RETRY_MAX_SEC
+	}
+	return delay
+}
+
+// 署名を付けて通知を送る（2xx以外のレスポンスはエラー）
+func (d *Dispatcher) post(wh *Webhook, dl *Delivery) (int, error) {
+	req, err := http.NewRequest(http.MethodPost, wh.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := time.Now().Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HEADER_WEBHOOK, wh.ID)
+	req.Header.Set(HEADER_DELIVERY, dl.ID)
+	req.Header.Set(HEADER_TIMESTAMP, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HEADER_SIGNATURE, Sign(wh.Secret, timestamp, dl.Payload))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, MAX_RESPONSE_READ))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// 配信済み・失敗した通知が多くなったら古いものから消す（呼び出し側でd.muxをロックすること）
+func (d *Dispatcher) prune() {
+	finished := 0
+	for _, dl := range d.state.Deliveries {
+		if dl.Status != STATUS_PENDING {
+			finished++
+		}
+	}
+	if finished <= MAX_DELIVERY_LOG {
+		return
+	}
+	deliveries := d.state.Deliveries[:0]
+	for _, dl := range d.state.Deliveries {
+		if dl.Status != STATUS_PENDING && finished > MAX_DELIVERY_LOG {
+			finished--
+			continue
+		}
+		deliveries = append(deliveries, dl)
+	}
+	d.state.Deliveries = deliveries
+}
+
+// 追加・更新した配信記録をジャーナルに追記し、溜まったら状態ファイルにまとめる（呼び出し側でd.muxをロックすること）
+func (d *Dispatcher) persist(deliveries ...*Delivery) {
+	err := d.appendJournal(deliveries)
+	if err == nil && d.journalRecords <= MAX_JOURNAL_RECORDS {
+		return
+	}
+	// 追記できなかった場合も状態ファイルに全体を書いて残す
+	if err := d.save(); err != nil {
+		d.logger.Error("failed to save webhooks", "path", d.path, "err", err)
+	}
+}
+
+// payloadは署名するボディそのものなので、インデントで変わらないように詰めて保存する
+func (d *Dispatcher) appendJournal(deliveries []*Delivery) error {
+	var buf bytes.Buffer
+	for _, dl := range deliveries {
+		m, _ := json.Marshal(&journalRecord{Generation: d.state.Generation, Delivery: dl})
+		buf.Write(m)
+		buf.WriteByte('\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(d.journalPath), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(d.journalPath, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	d.journalRecords += len(deliveries)
+	return nil
+}
+
+// 全体を状態ファイルに書き、ジャーナルを空にする（呼び出し側でd.muxをロックすること）
+// 書き込み途中のファイルが残らないように一時ファイルに書いてからrenameする
+// ジャーナルを消す前に止まっても、世代が変わっているので古い記録は読み飛ばされる
+func (d *Dispatcher) save() error {
+	if err := os.MkdirAll(filepath.Dir(d.path), 0700); err != nil {
+		return err
+	}
+	d.state.Generation++
+	m, _ := json.Marshal(&d.state)
+	tmp := d.path + ".tmp"
+	err := os.WriteFile(tmp, m, 0600)
+	if err == nil {
+		err = os.Rename(tmp, d.path)
+	}
+	if err != nil {
+		d.state.Generation--
+		return err
+	}
+	d.journalRecords = 0
+	if err := os.Remove(d.journalPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		d.logger.Warn("failed to remove webhook journal", "path", d.journalPath, "err", err)
+	}
+	return nil
+}
@@ -0,0 +1,336 @@
+package webhook
+
+import (
+	"encoding/json"
+	"errors"
+	"go-blockchain/block"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 受け取った通知を記録する受信側
+type receiver struct {
+	*httptest.Server
+	mux      sync.Mutex
+	requests []*http.Request
+	bodies   [][]byte
+	status   []int // 順番に返すステータス（使い切ったら200）
+}
+
+func newReceiver(t *testing.T, status ...int) *receiver {
+	t.Helper()
+	r := &receiver{status: status}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mux.Lock()
+		defer r.mux.Unlock()
+		r.requests = append(r.requests, req)
+		r.bodies = append(r.bodies, body)
+		code := http.StatusOK
+		if len(r.status) > 0 {
+			code, r.status = r.status[0], r.status[1:]
+		}
+		w.WriteHeader(code)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) count() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return len(r.requests)
+}
+
+// テストではhttptestのloopbackのアドレスに送れるようにする
+func openTest(t *testing.T, dir string) *Dispatcher {
+	t.Helper()
+	d, err := Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetAllowPrivateTargets(true)
+	return d
+}
+
+func addTest(t *testing.T, d *Dispatcher, url string, confirmations int, addresses ...string) *Webhook {
+	t.Helper()
+	wh, err := d.Add(&WebhookRequest{URL: &url, Addresses: addresses, Confirmations: &confirmations})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return wh
+}
+
+// 送信時刻になった通知をRunを使わずに送る
+func flush(d *Dispatcher) {
+	for _, dl := range d.due() {
+		d.deliver(dl)
+	}
+}
+
+func deliveries(t *testing.T, d *Dispatcher, id string) []*Delivery {
+	t.Helper()
+	deliveries, err := d.Deliveries(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return deliveries
+}
+
+func TestDeliver(t *testing.T) {
+	r := newReceiver(t)
+	d := openTest(t, t.TempDir())
+	wh := addTest(t, d, r.URL, 0, "B")
+
+	d.TransactionAdded(block.NewTransaction("A", "B", 1.5))
+	d.TransactionAdded(block.NewTransaction("A", "C", 1))
+	flush(d)
+
+	if r.count() != 1 {
+		t.Fatalf("got %d requests, want 1", r.count())
+	}
+	req, body := r.requests[0], r.bodies[0]
+	timestamp, err := strconv.ParseInt(req.Header.Get(HEADER_TIMESTAMP), 10, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Verify(wh.Secret, timestamp, body, req.Header.Get(HEADER_SIGNATURE)) {
+		t.Errorf("invalid signature %q", req.Header.Get(HEADER_SIGNATURE))
+	}
+	if req.Header.Get(HEADER_WEBHOOK) != wh.ID {
+		t.Errorf("%s = %q, want %q", HEADER_WEBHOOK, req.Header.Get(HEADER_WEBHOOK), wh.ID)
+	}
+	var p Payload
+	if err := json.Unmarshal(body, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p.Type != EVENT_ADDRESS_RECEIVED || p.Address != "B" || p.Value != 1.5 || p.ID != req.Header.Get(HEADER_DELIVERY) {
+		t.Errorf("unexpected payload %s", body)
+	}
+	if dl := deliveries(t, d, wh.ID); len(dl) != 1 || dl[0].Status != STATUS_DELIVERED || dl[0].Attempts != 1 {
+		t.Errorf("unexpected deliveries %+v", dl)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	r := newReceiver(t, http.StatusInternalServerError)
+	d := openTest(t, t.TempDir())
+	wh := addTest(t, d, r.URL, 0, "B")
+
+	d.TransactionAdded(block.NewTransaction("A", "B", 1))
+	flush(d)
+	dl := deliveries(t, d, wh.ID)[0]
+	if dl.Status != STATUS_PENDING || dl.Attempts != 1 || dl.LastStatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected delivery after a failure %+v", dl)
+	}
+	// 再送の時刻まではもう一度送らない
+	flush(d)
+	if r.count() != 1 {
+		t.Fatalf("retried before the delay: %d requests", r.count())
+	}
+
+	d.mux.Lock()
+	d.state.Deliveries[0].NextAttempt = 0
+	d.mux.Unlock()
+	flush(d)
+	dl = deliveries(t, d, wh.ID)[0]
+	if r.count() != 2 || dl.Status != STATUS_DELIVERED || dl.Attempts != 2 {
+		t.Errorf("unexpected delivery after a retry %+v (%d requests)", dl, r.count())
+	}
+	if string(r.bodies[0]) != string(r.bodies[1]) {
+		t.Errorf("retry sent a different body")
+	}
+}
+
+// nodeの内部のホストは登録できず、登録後に内部のアドレスになった場合も接続しない
+func TestPrivateTarget(t *testing.T) {
+	d, err := Open(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	confirmations := 0
+	for _, url := range []string{
+		"http://127.0.0.1:8080/hook",
+		"http://localhost/hook",
+		"http://10.0.0.1/hook",
+		"http://192.168.1.1/hook",
+		"http://172.16.0.1/hook",
+		"http://169.254.169.254/latest/meta-data",
+		"http://0.0.0.0/hook",
+		"http://[::1]/hook",
+		"http://[fe80::1]/hook",
+		"http://[fd00::1]/hook",
+		"http://[::ffff:127.0.0.1]/hook",
+	} {
+		_, err := d.Add(&WebhookRequest{URL: &url, Addresses: []string{"B"}, Confirmations: &confirmations})
+		if !errors.Is(err, ErrInvalidTarget) {
+			t.Errorf("%s: got %v, want ErrInvalidTarget", url, err)
+		}
+	}
+	if len(d.Webhooks()) != 0 {
+		t.Fatalf("private targets were registered")
+	}
+
+	r := newReceiver(t)
+	d.SetAllowPrivateTargets(true)
+	wh := addTest(t, d, r.URL, 0, "B")
+	d.SetAllowPrivateTargets(false)
+	d.TransactionAdded(block.NewTransaction("A", "B", 1))
+	flush(d)
+	if r.count() != 0 {
+		t.Fatalf("delivered to a private address")
+	}
+	if dl := deliveries(t, d, wh.ID)[0]; dl.Status != STATUS_PENDING || dl.LastError == "" {
+		t.Errorf("unexpected delivery %+v", dl)
+	}
+}
+
+// 受信側が止まっていても配信待ちは上限までしか溜まらない
+func TestPendingLimit(t *testing.T) {
+	r := newReceiver(t)
+	d := openTest(t, t.TempDir())
+	wh := addTest(t, d, r.URL, 0, "B")
+
+	for i := 0; i < MAX_PENDING_PER_WEBHOOK+2; i++ {
+		d.TransactionAdded(block.NewTransaction("A", "B", 1))
+	}
+	count := make(map[string]int)
+	for _, dl := range deliveries(t, d, wh.ID) {
+		count[dl.Status]++
+	}
+	if count[STATUS_PENDING] != MAX_PENDING_PER_WEBHOOK || count[STATUS_FAILED] != 2 {
+		t.Errorf("got %v, want %d pending and 2 failed", count, MAX_PENDING_PER_WEBHOOK)
+	}
+}
+
+func TestTooManyWebhooks(t *testing.T) {
+	d := openTest(t, t.TempDir())
+	for i := 0; i < MAX_WEBHOOKS; i++ {
+		addTest(t, d, "http://127.0.0.1/hook", 0, "B")
+	}
+	url, confirmations := "http://127.0.0.1/hook", 0
+	if _, err := d.Add(&WebhookRequest{URL: &url, Addresses: []string{"B"}, Confirmations: &confirmations}); err != ErrTooManyWebhooks {
+		t.Errorf("got %v, want ErrTooManyWebhooks", err)
+	}
+}
+
+// 再起動しても配信待ちの通知と配信済みの記録が残る
+func TestReopen(t *testing.T) {
+	r := newReceiver(t)
+	dir := t.TempDir()
+	d := openTest(t, dir)
+	wh := addTest(t, d, r.URL, 0, "B")
+
+	d.TransactionAdded(block.NewTransaction("A", "B", 1))
+	flush(d)
+	d.TransactionAdded(block.NewTransaction("A", "B", 2))
+	// 送る前に止まった
+
+	d = openTest(t, dir)
+	want := map[string]int{STATUS_DELIVERED: 1, STATUS_PENDING: 1}
+	count := make(map[string]int)
+	for _, dl := range deliveries(t, d, wh.ID) {
+		count[dl.Status]++
+	}
+	if count[STATUS_DELIVERED] != want[STATUS_DELIVERED] || count[STATUS_PENDING] != want[STATUS_PENDING] {
+		t.Fatalf("got %v after reopening, want %v", count, want)
+	}
+	flush(d)
+	if r.count() != 2 {
+		t.Errorf("got %d requests, want 2", r.count())
+	}
+}
+
+// ジャーナルを状態ファイルにまとめた後に古いジャーナルが残っていても読み飛ばす
+func TestReopenAfterCompaction(t *testing.T) {
+	r := newReceiver(t)
+	dir := t.TempDir()
+	d := openTest(t, dir)
+	wh := addTest(t, d, r.URL, 0, "B")
+
+	d.TransactionAdded(block.NewTransaction("A", "B", 1))
+	stale, err := os.ReadFile(d.journalPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	flush(d)
+	d.mux.Lock()
+	if err := d.save(); err != nil {
+		t.Fatal(err)
+	}
+	d.mux.Unlock()
+	// ジャーナルを消す前に止まった場合と同じ状態にする
+	if err := os.WriteFile(d.journalPath, stale, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	d = openTest(t, dir)
+	if dl := deliveries(t, d, wh.ID); len(dl) != 1 || dl[0].Status != STATUS_DELIVERED {
+		t.Errorf("unexpected deliveries after reopening %+v", dl)
+	}
+}
+
+// 応答しない受信側があっても他のWebhookの配信は待たない
+func TestSlowReceiver(t *testing.T) {
+	release := make(chan struct{})
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-release
+	}))
+	defer slow.Close()
+	r := newReceiver(t)
+	d := openTest(t, t.TempDir())
+	addTest(t, d, slow.URL, 0, "B")
+	addTest(t, d, r.URL, 0, "C")
+	d.Start()
+	defer d.Close()
+	defer close(release)
+
+	for i := 0; i < 3; i++ {
+		d.TransactionAdded(block.NewTransaction("A", "B", 1))
+	}
+	d.TransactionAdded(block.NewTransaction("A", "C", 1))
+	deadline := time.Now().Add(5 * time.Second)
+	for r.count() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("delivery to another webhook waited for the slow receiver")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// 配信記録を消した後や再起動した後にブロックが再び追加されても同じ通知は登録しない
+func TestBlockConnectedAfterPrune(t *testing.T) {
+	r := newReceiver(t)
+	dir := t.TempDir()
+	d := openTest(t, dir)
+	addTest(t, d, r.URL, 1, "B")
+
+	bc := block.NewBlockchain("miner", 0, block.RegtestParams)
+	bc.Generate(1, "B")
+	chain := bc.Chain()
+	d.BlockConnected(chain, 1)
+	flush(d)
+	// pruneで配信記録が消えた場合と同じ状態にする
+	d.mux.Lock()
+	d.state.Deliveries = d.state.Deliveries[:0]
+	if err := d.save(); err != nil {
+		t.Fatal(err)
+	}
+	d.mux.Unlock()
+
+	d.BlockConnected(chain, 1)
+	flush(d)
+	d = openTest(t, dir)
+	d.BlockConnected(chain, 1)
+	flush(d)
+	if r.count() != 1 {
+		t.Errorf("got %d requests, want 1", r.count())
+	}
+}
@@ -0,0 +1,87 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// 登録時にURLのホストを名前解決する時間の上限
+const RESOLVE_TIMEOUT = 5 * time.Second
+
+// 通知先にできないURL（nodeの内部のホストへのリクエストに使われないようにする）
+var ErrInvalidTarget = errors.New("invalid webhook target")
+
+// loopback、link-local、プライベート、未指定、マルチキャストのアドレスは通知先にしない
+func forbiddenIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast()
+}
+
+// 登録するURLのホストが通知先にできるアドレスだけに解決されるか確認する
+func (d *Dispatcher) checkTarget(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	if d.allowPrivate {
+		return nil
+	}
+	host := u.Hostname()
+	if ip := net.ParseIP(host); ip != nil {
+		if forbiddenIP(ip) {
+			return fmt.Errorf("%w: %s is a loopback, link-local or private address", ErrInvalidTarget, ip)
+		}
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), RESOLVE_TIMEOUT)
+	defer cancel()
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTarget, err)
+	}
+	for _, a := range addrs {
+		if forbiddenIP(a.IP) {
+			return fmt.Errorf("%w: %s resolves to %s, a loopback, link-local or private address", ErrInvalidTarget, host, a.IP)
+		}
+	}
+	return nil
+}
+
+// 接続する直前のアドレスを確認する
+// 登録後に名前解決の結果が変わった場合やリダイレクトされた場合も内部のホストには接続しない
+func (d *Dispatcher) controlDial(network string, address string, c syscall.RawConn) error {
+	if d.allowPrivate {
+		return nil
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || forbiddenIP(ip) {
+		return fmt.Errorf("%w: %s is a loopback, link-local or private address", ErrInvalidTarget, host)
+	}
+	return nil
+}
+
+// 通知先の確認を行うHTTPクライアント
+// 環境変数のプロキシを経由すると接続先を確認できないので使わない
+func (d *Dispatcher) newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DELIVERY_TIMEOUT, Control: d.controlDial}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: DELIVERY_TIMEOUT, Transport: transport}
+}
+
+// loopbackやプライベートアドレスへの通知を許可する（同じホストやLAN内の受信側で試す場合）
+// Runより前に呼ぶこと
+func (d *Dispatcher) SetAllowPrivateTargets(allow bool) {
+	d.allowPrivate = allow
+}
@@ -0,0 +1,115 @@
+// アドレスへの入金をHTTPのPOSTで通知するWebhook
+//
+// 登録したWebhookと通知の配信記録は<dir>/webhooks.jsonに保存し、再起動しても配信待ちの通知を送り続ける
+// 配信記録の変更は<dir>/webhooks.journalに追記し、溜まったらwebhooks.jsonにまとめる
+// loopback、link-local、プライベートのアドレスには通知しない（SetAllowPrivateTargetsで許可できる）
+// 通知のボディにはWebhookのsecretを鍵にしたHMAC-SHA256の署名をX-Webhook-Signatureヘッダーに付ける
+// 配信は少なくとも1回（受信側はX-Webhook-Deliveryで重複を除く）
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+)
+
+const (
+	EVENT_ADDRESS_RECEIVED = "address_received" // 登録したアドレスが送金を受け取った
+
+	MAX_WEBHOOKS      = 100  // 登録できるWebhookの数
+	MAX_ADDRESSES     = 1000 // 1つのWebhookに登録できるアドレスの数
+	MAX_CONFIRMATIONS = 100
+	SECRET_SIZE       = 32
+
+	// 通知のリクエストのヘッダー
+	HEADER_WEBHOOK   = "X-Webhook-Id"
+	HEADER_DELIVERY  = "X-Webhook-Delivery"
+	HEADER_TIMESTAMP = "X-Webhook-Timestamp"
+	HEADER_SIGNATURE = "X-Webhook-Signature"
+)
+
+var (
+	ErrNotFound        = errors.New("webhook not found")
+	ErrTooManyWebhooks = fmt.Errorf("too many webhooks (max %d)", MAX_WEBHOOKS)
+)
+
+// 登録したWebhook
+// confirmationsが0の場合はPoolに入った時点、1以上の場合はその承認数に達した時点で通知する
+type Webhook struct {
+	ID            string   `json:"id"`
+	URL           string   `json:"url"`
+	Addresses     []string `json:"addresses"`
+	Confirmations int      `json:"confirmations"`
+	Secret        string   `json:"secret,omitempty"`
+	CreatedAt     int64    `json:"created_at"`
+}
+
+// secretを除いたコピー（一覧の表示用）
+func (wh *Webhook) Redacted() *Webhook {
+	c := *wh
+	c.Secret = ""
+	return &c
+}
+
+func (wh *Webhook) watches(address string) bool {
+	for _, a := range wh.Addresses {
+		if a == address {
+			return true
+		}
+	}
+	return false
+}
+
+// Webhookを登録するリクエスト
+// secretを省略した場合はランダムに生成して登録のレスポンスで一度だけ返す
+type WebhookRequest struct {
+	URL           *string  `json:"url"`
+	Addresses     []string `json:"addresses"`
+	Confirmations *int     `json:"confirmations"`
+	Secret        *string  `json:"secret,omitempty"`
+}
+
+func (wr *WebhookRequest) Validate() bool {
+	if wr.URL == nil || wr.Confirmations == nil ||
+		len(wr.Addresses) == 0 || len(wr.Addresses) > MAX_ADDRESSES ||
+		*wr.Confirmations < 0 || *wr.Confirmations > MAX_CONFIRMATIONS {
+		return false
+	}
+	u, err := url.Parse(*wr.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return false
+	}
+	for _, a := range wr.Addresses {
+		if a == "" {
+			return false
+		}
+	}
+	return wr.Secret == nil || *wr.Secret != ""
+}
+
+// 通知のボディの署名
+// タイムスタンプ（UNIX秒）と"."とボディを連結したものにsecretでHMAC-SHA256をかけ、"sha256=<hex>"の形式にする
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// 受信側で署名を確認する
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+func newID(size int) string {
+	b := make([]byte, size)
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("webhook: %v", err))
+	}
+	return hex.EncodeToString(b)
+}